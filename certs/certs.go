@@ -0,0 +1,263 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	// Command is the provider subcommand that checks the control plane certificates.
+	Command = "certs-check"
+)
+
+// Options configures the certificate check.
+type Options struct {
+	RootPath    string
+	RenewBefore time.Duration
+}
+
+// certificate is a certificate kubeadm manages, by its `kubeadm certs renew` name. Pod is the
+// static pod which has to be restarted to load a renewed certificate.
+type certificate struct {
+	name       string
+	file       string
+	kubeconfig bool
+	ca         bool
+	pod        string
+}
+
+// certificates lists the files relative to the kubernetes dir in the order of
+// `kubeadm certs check-expiration`. The CAs are recorded but kubeadm does not renew them.
+var certificates = []certificate{
+	{name: "admin.conf", file: "admin.conf", kubeconfig: true},
+	{name: "super-admin.conf", file: "super-admin.conf", kubeconfig: true},
+	{name: "apiserver", file: "pki/apiserver.crt", pod: "kube-apiserver"},
+	{name: "apiserver-etcd-client", file: "pki/apiserver-etcd-client.crt", pod: "kube-apiserver"},
+	{name: "apiserver-kubelet-client", file: "pki/apiserver-kubelet-client.crt", pod: "kube-apiserver"},
+	{name: "controller-manager.conf", file: "controller-manager.conf", kubeconfig: true, pod: "kube-controller-manager"},
+	{name: "etcd-healthcheck-client", file: "pki/etcd/healthcheck-client.crt"},
+	{name: "etcd-peer", file: "pki/etcd/peer.crt", pod: "etcd"},
+	{name: "etcd-server", file: "pki/etcd/server.crt", pod: "etcd"},
+	{name: "front-proxy-client", file: "pki/front-proxy-client.crt", pod: "kube-apiserver"},
+	{name: "scheduler.conf", file: "scheduler.conf", kubeconfig: true, pod: "kube-scheduler"},
+	{name: "ca", file: "pki/ca.crt", ca: true},
+	{name: "etcd-ca", file: "pki/etcd/ca.crt", ca: true},
+	{name: "front-proxy-ca", file: "pki/front-proxy-ca.crt", ca: true},
+}
+
+// stubbed in tests
+var (
+	kubernetesDir = "/etc/kubernetes"
+
+	findBinary    = utils.FindBinary
+	runCommand    = utils.RunCommand
+	commandOutput = utils.CommandOutput
+	now           = time.Now
+)
+
+// Args returns the provider arguments that check the certificates with the given options.
+func Args(opts Options) []string {
+	return []string{
+		Command,
+		"--root-path", opts.RootPath,
+		"--renew-before", opts.RenewBefore.String(),
+	}
+}
+
+// ParseArgs parses the arguments following the Command.
+func ParseArgs(args []string) (Options, error) {
+	var opts Options
+
+	fs := flag.NewFlagSet(Command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.DurationVar(&opts.RenewBefore, "renew-before", domain.DefaultCertificateRenewBefore, "renew certificates expiring within this duration")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.RenewBefore <= 0 {
+		return opts, fmt.Errorf("invalid renew-before %s, must be positive", opts.RenewBefore)
+	}
+	return opts, nil
+}
+
+// Check renews the certificates which expire within the renewal window, restarts the static pods
+// using them and records the expiry dates in the node status. A certificate which fails to renew
+// does not stop the others from being renewed.
+func Check(opts Options) error {
+	var errs []error
+	renewed := map[string]bool{}
+	pods := map[string]bool{}
+
+	deadline := now().Add(opts.RenewBefore)
+	for _, cert := range certificates {
+		expiresAt, err := expiry(cert)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !expiresAt.Before(deadline) {
+			continue
+		}
+
+		if cert.ca {
+			logrus.Warnf("ca %s expires at %s and has to be rotated by hand", cert.name, expiresAt.UTC().Format(time.RFC3339))
+			continue
+		}
+
+		logrus.Infof("renewing certificate %s which expires at %s", cert.name, expiresAt.UTC().Format(time.RFC3339))
+		if err = renew(opts, cert); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		renewed[cert.name] = true
+		if cert.pod != "" {
+			pods[cert.pod] = true
+		}
+	}
+
+	if err := restartStaticPods(opts.RootPath, pods); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := record(opts.RootPath, renewed); err != nil {
+		logrus.Errorf("failed to record certificate expiry: %v", err)
+	}
+	return errors.Join(errs...)
+}
+
+func renew(opts Options, cert certificate) error {
+	kubeadm, err := findBinary(opts.RootPath, "kubeadm")
+	if err != nil {
+		return err
+	}
+	if err = runCommand(kubeadm, "certs", "renew", cert.name); err != nil {
+		return fmt.Errorf("failed to renew certificate %s: %w", cert.name, err)
+	}
+	return nil
+}
+
+// record writes the expiry of every certificate on the node to the node status.
+func record(rootPath string, renewed map[string]bool) error {
+	var checked []status.Certificate
+	for _, cert := range certificates {
+		expiresAt, err := expiry(cert)
+		if err != nil {
+			continue
+		}
+		checked = append(checked, status.Certificate{Name: cert.name, ExpiresAt: expiresAt.UTC()})
+	}
+
+	renewedAt := now().UTC()
+	return status.Update(rootPath, func(s *status.Status) {
+		for i := range checked {
+			if renewed[checked[i].Name] {
+				checked[i].RenewedAt = &renewedAt
+				continue
+			}
+			for _, previous := range s.Certificates {
+				if previous.Name == checked[i].Name {
+					checked[i].RenewedAt = previous.RenewedAt
+				}
+			}
+		}
+		s.Certificates = checked
+	})
+}
+
+// expiry returns the expiry of the certificate, or of the client certificate embedded in the kubeconfig.
+func expiry(cert certificate) (time.Time, error) {
+	path := filepath.Join(kubernetesDir, cert.file)
+
+	var content []byte
+	if cert.kubeconfig {
+		config, err := clientcmd.LoadFromFile(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		context, ok := config.Contexts[config.CurrentContext]
+		if !ok {
+			return time.Time{}, fmt.Errorf("%s has no current context", path)
+		}
+		user, ok := config.AuthInfos[context.AuthInfo]
+		if !ok || len(user.ClientCertificateData) == 0 {
+			return time.Time{}, fmt.Errorf("%s has no embedded client certificate", path)
+		}
+		content = user.ClientCertificateData
+	} else {
+		var err error
+		if content, err = os.ReadFile(path); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("%s does not contain a PEM encoded certificate", path)
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return parsed.NotAfter, nil
+}
+
+// restartStaticPods restarts the static pods using renewed certificates. Without crictl the pods
+// keep serving the old certificates, which is an error.
+func restartStaticPods(rootPath string, pods map[string]bool) error {
+	if len(pods) == 0 {
+		return nil
+	}
+	crictl, err := findBinary(rootPath, "crictl")
+	if err != nil {
+		return fmt.Errorf("failed to restart the static pods with renewed certificates: %w", err)
+	}
+
+	var errs []error
+	// restart the pods in a fixed order, etcd first so the api server reconnects to it
+	for _, pod := range []string{"etcd", "kube-apiserver", "kube-controller-manager", "kube-scheduler"} {
+		if !pods[pod] {
+			continue
+		}
+		if err = restartStaticPod(crictl, pod); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restartStaticPod stops the containers of the static pod, the kubelet starts them again with the
+// renewed certificates.
+func restartStaticPod(crictl, name string) error {
+	output, err := commandOutput(crictl, utils.CrictlArgs("ps", "--name", fmt.Sprintf("^%s$", name), "--state", "running", "-q")...)
+	if err != nil {
+		return fmt.Errorf("failed to find %s containers: %w", name, err)
+	}
+
+	for _, id := range strings.Fields(output) {
+		logrus.Infof("restarting %s container %s", name, id)
+		if err = runCommand(crictl, utils.CrictlArgs("stop", id)...); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+)
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// writeCertificate writes a self-signed certificate expiring at notAfter to the file of the certificate.
+func writeCertificate(t *testing.T, cert certificate, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cert.name},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	path := filepath.Join(kubernetesDir, cert.file)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if !cert.kubeconfig {
+		if err = os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kubernetes"] = &clientcmdapi.Cluster{Server: "https://10.0.0.1:6443"}
+	config.AuthInfos["user"] = &clientcmdapi.AuthInfo{ClientCertificateData: content}
+	config.Contexts["user@kubernetes"] = &clientcmdapi.Context{Cluster: "kubernetes", AuthInfo: "user"}
+	config.CurrentContext = "user@kubernetes"
+	if err = clientcmd.WriteToFile(*config, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lookup(name string) certificate {
+	for _, cert := range certificates {
+		if cert.name == name {
+			return cert
+		}
+	}
+	panic("unknown certificate " + name)
+}
+
+// TestArgs tests that ParseArgs parses the arguments built by Args
+func TestArgs(t *testing.T) {
+	g := NewWithT(t)
+	opts := Options{RootPath: "/persistent/spectro", RenewBefore: 720 * time.Hour}
+
+	args := Args(opts)
+	g.Expect(args[0]).To(Equal(Command))
+
+	result, err := ParseArgs(args[1:])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(opts))
+
+	_, err = ParseArgs([]string{"--renew-before", "0s"})
+	g.Expect(err).To(MatchError("invalid renew-before 0s, must be positive"))
+}
+
+// TestCheck tests the Check function
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name             string
+		expiring         []string
+		failRenew        string
+		missingBinary    string
+		previousRenewals map[string]time.Time
+		expectedCommands []string
+		expectedRenewed  []string
+		expectedError    string
+	}{
+		{
+			name: "nothing_expiring",
+		},
+		{
+			name:     "renews_expiring_certificates",
+			expiring: []string{"apiserver", "front-proxy-client", "scheduler.conf", "admin.conf"},
+			expectedCommands: []string{
+				"kubeadm certs renew admin.conf",
+				"kubeadm certs renew apiserver",
+				"kubeadm certs renew front-proxy-client",
+				"kubeadm certs renew scheduler.conf",
+				"crictl ps --name ^kube-apiserver$ --state running -q",
+				"crictl stop 3f2a9c",
+				"crictl ps --name ^kube-scheduler$ --state running -q",
+				"crictl stop 3f2a9c",
+			},
+			expectedRenewed: []string{"admin.conf", "apiserver", "front-proxy-client", "scheduler.conf"},
+		},
+		{
+			name:     "keeps_previous_renewals",
+			expiring: []string{"etcd-server"},
+			previousRenewals: map[string]time.Time{
+				"etcd-server":  testNow.Add(-365 * 24 * time.Hour),
+				"etcd-peer":    testNow.Add(-30 * 24 * time.Hour),
+				"removed.conf": testNow.Add(-30 * 24 * time.Hour),
+			},
+			expectedCommands: []string{
+				"kubeadm certs renew etcd-server",
+				"crictl ps --name ^etcd$ --state running -q",
+				"crictl stop 3f2a9c",
+			},
+			expectedRenewed: []string{"etcd-server"},
+		},
+		{
+			name:          "failed_renewal_continues",
+			expiring:      []string{"apiserver", "controller-manager.conf"},
+			failRenew:     "apiserver",
+			expectedError: "failed to renew certificate apiserver: exit status 1",
+			expectedCommands: []string{
+				"kubeadm certs renew apiserver",
+				"kubeadm certs renew controller-manager.conf",
+				"crictl ps --name ^kube-controller-manager$ --state running -q",
+				"crictl stop 3f2a9c",
+			},
+			expectedRenewed: []string{"controller-manager.conf"},
+		},
+		{
+			name:             "missing_crictl_fails",
+			expiring:         []string{"apiserver"},
+			missingBinary:    "crictl",
+			expectedError:    "failed to restart the static pods with renewed certificates: crictl binary not found",
+			expectedCommands: []string{"kubeadm certs renew apiserver"},
+			expectedRenewed:  []string{"apiserver"},
+		},
+		{
+			name:     "expiring_ca_is_not_renewed",
+			expiring: []string{"ca"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			originalDir, originalFind, originalRun, originalOutput, originalNow := kubernetesDir, findBinary, runCommand, commandOutput, now
+			t.Cleanup(func() {
+				kubernetesDir, findBinary, runCommand, commandOutput, now = originalDir, originalFind, originalRun, originalOutput, originalNow
+			})
+
+			kubernetesDir = t.TempDir()
+			rootPath := t.TempDir()
+			now = func() time.Time { return testNow }
+			findBinary = func(_, name string) (string, error) {
+				if name == tt.missingBinary {
+					return "", fmt.Errorf("%s binary not found", name)
+				}
+				return name, nil
+			}
+
+			var commands []string
+			runCommand = func(name string, args ...string) error {
+				commands = append(commands, strings.Join(append([]string{name}, args...), " "))
+				if name != "kubeadm" {
+					return nil
+				}
+				if args[2] == tt.failRenew {
+					return errors.New("exit status 1")
+				}
+				writeCertificate(t, lookup(args[2]), testNow.Add(365*24*time.Hour))
+				return nil
+			}
+			commandOutput = func(name string, args ...string) (string, error) {
+				commands = append(commands, strings.Join(append([]string{name}, args...), " "))
+				return "3f2a9c", nil
+			}
+
+			expiresAt := map[string]time.Time{}
+			for _, cert := range certificates {
+				expiresAt[cert.name] = testNow.Add(200 * 24 * time.Hour)
+				if cert.name == "super-admin.conf" {
+					continue
+				}
+				for _, name := range tt.expiring {
+					if name == cert.name {
+						expiresAt[cert.name] = testNow.Add(10 * 24 * time.Hour)
+					}
+				}
+				writeCertificate(t, cert, expiresAt[cert.name])
+			}
+
+			if tt.previousRenewals != nil {
+				g.Expect(status.Update(rootPath, func(s *status.Status) {
+					for name, renewedAt := range tt.previousRenewals {
+						s.Certificates = append(s.Certificates, status.Certificate{Name: name, RenewedAt: &renewedAt})
+					}
+				})).To(Succeed())
+			}
+
+			err := Check(Options{RootPath: rootPath, RenewBefore: 30 * 24 * time.Hour})
+			if tt.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(tt.expectedError))
+			}
+			g.Expect(commands).To(Equal(tt.expectedCommands))
+
+			nodeStatus, err := status.Read(rootPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(nodeStatus.Certificates).To(HaveLen(len(certificates) - 1))
+
+			var renewed []string
+			for _, cert := range nodeStatus.Certificates {
+				g.Expect(cert.Name).ToNot(Equal("super-admin.conf"))
+
+				if previous, ok := tt.previousRenewals[cert.Name]; ok && cert.Name != "etcd-server" {
+					g.Expect(cert.RenewedAt).To(HaveValue(Equal(previous)))
+					continue
+				}
+				if cert.RenewedAt == nil {
+					g.Expect(cert.ExpiresAt).To(BeTemporally("==", expiresAt[cert.Name]))
+					continue
+				}
+				renewed = append(renewed, cert.Name)
+				g.Expect(*cert.RenewedAt).To(Equal(testNow))
+				g.Expect(cert.ExpiresAt).To(BeTemporally("==", testNow.Add(365*24*time.Hour)))
+			}
+			g.Expect(renewed).To(ConsistOf(tt.expectedRenewed))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package containerd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+const (
+	criPlugin = `plugins."io.containerd.grpc.v1.cri"`
+)
+
+// ConfigPath returns the config.toml of the containerd service, e.g. /etc/containerd/config.toml.
+func ConfigPath(serviceName string) string {
+	return filepath.Join("/etc", serviceName, "config.toml")
+}
+
+// Config renders the config.toml of the containerd service from the defaulted configuration. The
+// files of the conf.d directory of the service are imported on top of it.
+func Config(serviceName string, cfg domain.ContainerdConfiguration) string {
+	var b strings.Builder
+
+	b.WriteString("version = 2\n")
+	if cfg.Root != "" {
+		fmt.Fprintf(&b, "root = %s\n", tomlString(cfg.Root))
+	}
+	fmt.Fprintf(&b, "imports = %s\n", tomlArray([]string{filepath.Join("/etc", serviceName, "conf.d", "*.toml")}))
+
+	b.WriteString("\n[plugins]\n")
+	fmt.Fprintf(&b, "  [%s]\n", criPlugin)
+	fmt.Fprintf(&b, "    sandbox_image = %s\n", tomlString(cfg.SandboxImage))
+	fmt.Fprintf(&b, "    [%s.containerd]\n", criPlugin)
+	fmt.Fprintf(&b, "      snapshotter = %s\n", tomlString(cfg.Snapshotter))
+	fmt.Fprintf(&b, "      default_runtime_name = %s\n", tomlString(cfg.DefaultRuntime))
+	fmt.Fprintf(&b, "      discard_unpacked_layers = %t\n", cfg.DiscardUnpackedLayers)
+
+	for _, runtime := range cfg.Runtimes {
+		// the runtime names are validated DNS labels, which are bare TOML keys
+		table := fmt.Sprintf("%s.containerd.runtimes.%s", criPlugin, runtime.Name)
+		fmt.Fprintf(&b, "    [%s]\n", table)
+		fmt.Fprintf(&b, "      runtime_type = %s\n", tomlString(runtime.Type))
+
+		// the options are decoded by the shim, only the runc shim knows these
+		if runtime.Type != domain.DefaultContainerdRuntimeType {
+			continue
+		}
+		fmt.Fprintf(&b, "      [%s.options]\n", table)
+		if runtime.BinaryName != "" {
+			fmt.Fprintf(&b, "        BinaryName = %s\n", tomlString(runtime.BinaryName))
+		}
+		fmt.Fprintf(&b, "        SystemdCgroup = %t\n", cfg.CgroupDriver == "systemd")
+	}
+
+	fmt.Fprintf(&b, "    [%s.registry]\n", criPlugin)
+	fmt.Fprintf(&b, "      config_path = %s\n", tomlString(cfg.RegistryConfigPath))
+	return b.String()
+}
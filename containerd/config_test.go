@@ -0,0 +1,110 @@
+package containerd
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestConfigPath tests the ConfigPath function
+func TestConfigPath(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ConfigPath("containerd")).To(Equal("/etc/containerd/config.toml"))
+	g.Expect(ConfigPath("spectro-containerd")).To(Equal("/etc/spectro-containerd/config.toml"))
+}
+
+// TestConfig tests the Config function
+func TestConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		serviceName    string
+		cfg            domain.ContainerdConfiguration
+		expectedConfig string
+	}{
+		{
+			name:        "defaults",
+			serviceName: "containerd",
+			cfg: domain.ContainerdConfiguration{
+				Root:               "/opt/containerd",
+				CgroupDriver:       "systemd",
+				SandboxImage:       "registry.k8s.io/pause:3.10",
+				Snapshotter:        "overlayfs",
+				RegistryConfigPath: "/etc/containerd/certs.d",
+				DefaultRuntime:     "runc",
+				Runtimes:           []domain.ContainerdRuntime{{Name: "runc", Type: "io.containerd.runc.v2", BinaryName: "/opt/bin/runc"}},
+			},
+			expectedConfig: `version = 2
+root = "/opt/containerd"
+imports = ["/etc/containerd/conf.d/*.toml"]
+
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    sandbox_image = "registry.k8s.io/pause:3.10"
+    [plugins."io.containerd.grpc.v1.cri".containerd]
+      snapshotter = "overlayfs"
+      default_runtime_name = "runc"
+      discard_unpacked_layers = false
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+      runtime_type = "io.containerd.runc.v2"
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+        BinaryName = "/opt/bin/runc"
+        SystemdCgroup = true
+    [plugins."io.containerd.grpc.v1.cri".registry]
+      config_path = "/etc/containerd/certs.d"
+`,
+		},
+		{
+			name:        "cgroupfs_with_runtime_handlers",
+			serviceName: "spectro-containerd",
+			cfg: domain.ContainerdConfiguration{
+				CgroupDriver:          "cgroupfs",
+				SandboxImage:          "registry.local:5000/k8s/pause:3.10",
+				Snapshotter:           "native",
+				RegistryConfigPath:    "/etc/spectro-containerd/certs.d",
+				DefaultRuntime:        "nvidia",
+				DiscardUnpackedLayers: true,
+				Runtimes: []domain.ContainerdRuntime{
+					{Name: "runc", Type: "io.containerd.runc.v2", BinaryName: "/opt/bin/runc"},
+					{Name: "nvidia", Type: "io.containerd.runc.v2", BinaryName: "/usr/bin/nvidia-container-runtime"},
+					{Name: "kata", Type: "io.containerd.kata.v2"},
+				},
+			},
+			expectedConfig: `version = 2
+imports = ["/etc/spectro-containerd/conf.d/*.toml"]
+
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    sandbox_image = "registry.local:5000/k8s/pause:3.10"
+    [plugins."io.containerd.grpc.v1.cri".containerd]
+      snapshotter = "native"
+      default_runtime_name = "nvidia"
+      discard_unpacked_layers = true
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+      runtime_type = "io.containerd.runc.v2"
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+        BinaryName = "/opt/bin/runc"
+        SystemdCgroup = false
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia]
+      runtime_type = "io.containerd.runc.v2"
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia.options]
+        BinaryName = "/usr/bin/nvidia-container-runtime"
+        SystemdCgroup = false
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.kata]
+      runtime_type = "io.containerd.kata.v2"
+    [plugins."io.containerd.grpc.v1.cri".registry]
+      config_path = "/etc/spectro-containerd/certs.d"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(Config(tt.serviceName, tt.cfg)).To(Equal(tt.expectedConfig))
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package containerd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+const (
+	hostsFile    = "hosts.toml"
+	upstreamCA   = "ca.crt"
+	mirrorCAFile = "mirror-%d-ca.crt"
+
+	// RegistryMarkerFile lists the upstream registry directories below the registry config path
+	// that were written from the registries block, one per line.
+	RegistryMarkerFile = ".provider-kubeadm-registries"
+)
+
+var defaultCapabilities = []string{"pull", "resolve"}
+
+// RegistryConfigPath returns the directory the containerd service reads the registry hosts.toml
+// files from, e.g. /etc/containerd/certs.d for the containerd service.
+func RegistryConfigPath(serviceName string) string {
+	return filepath.Join("/etc", serviceName, "certs.d")
+}
+
+// RegistryFiles renders the hosts.toml of every upstream registry below the registry config
+// path, together with the CA bundles it refers to. containerd reads them on every pull.
+func RegistryFiles(configPath string, registries []domain.RegistryConfiguration) []yip.File {
+	var files []yip.File
+
+	for _, registry := range registries {
+		dir := filepath.Join(configPath, registry.Upstream)
+
+		var b strings.Builder
+		secret := registry.Auth != nil
+
+		if registry.PlainHTTP {
+			fmt.Fprintf(&b, "server = %s\n", tomlString("http://"+registry.Upstream))
+		}
+		if registry.CABundle != "" {
+			path := filepath.Join(dir, upstreamCA)
+			files = append(files, yip.File{Path: path, Permissions: 0644, Content: registry.CABundle})
+			fmt.Fprintf(&b, "ca = %s\n", tomlString(path))
+		}
+		if registry.InsecureSkipTLSVerify {
+			b.WriteString("skip_verify = true\n")
+		}
+		if registry.Auth != nil {
+			writeAuthHeader(&b, "header", registry.Auth)
+		}
+
+		for i, mirror := range registry.Mirrors {
+			table := "host." + tomlString(strings.TrimSuffix(mirror.Endpoint, "/"))
+			capabilities := mirror.Capabilities
+			if len(capabilities) == 0 {
+				capabilities = defaultCapabilities
+			}
+
+			fmt.Fprintf(&b, "\n[%s]\n", table)
+			fmt.Fprintf(&b, "  capabilities = %s\n", tomlArray(capabilities))
+			if mirror.CABundle != "" {
+				path := filepath.Join(dir, fmt.Sprintf(mirrorCAFile, i))
+				files = append(files, yip.File{Path: path, Permissions: 0644, Content: mirror.CABundle})
+				fmt.Fprintf(&b, "  ca = %s\n", tomlString(path))
+			}
+			if mirror.InsecureSkipTLSVerify {
+				b.WriteString("  skip_verify = true\n")
+			}
+			if mirror.OverridePath {
+				b.WriteString("  override_path = true\n")
+			}
+			if mirror.Auth != nil {
+				secret = true
+				writeAuthHeader(&b, table+".header", mirror.Auth)
+			}
+		}
+
+		// the credentials are only readable by containerd
+		permissions := uint32(0644)
+		if secret {
+			permissions = 0600
+		}
+		files = append(files, yip.File{Path: filepath.Join(dir, hostsFile), Permissions: permissions, Content: strings.TrimPrefix(b.String(), "\n")})
+	}
+	return files
+}
+
+func writeAuthHeader(b *strings.Builder, table string, auth *domain.RegistryAuth) {
+	credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	fmt.Fprintf(b, "\n[%s]\n", table)
+	fmt.Fprintf(b, "  Authorization = %s\n", tomlString("Basic "+credentials))
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\u%04X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func tomlArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = tomlString(value)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
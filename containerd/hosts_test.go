@@ -0,0 +1,112 @@
+package containerd
+
+import (
+	"testing"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestRegistryConfigPath tests the RegistryConfigPath function
+func TestRegistryConfigPath(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(RegistryConfigPath("containerd")).To(Equal("/etc/containerd/certs.d"))
+	g.Expect(RegistryConfigPath("spectro-containerd")).To(Equal("/etc/spectro-containerd/certs.d"))
+}
+
+// TestRegistryFiles tests the RegistryFiles function
+func TestRegistryFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		registry      domain.RegistryConfiguration
+		expectedFiles []yip.File
+	}{
+		{
+			name: "mirrors",
+			registry: domain.RegistryConfiguration{
+				Upstream: "docker.io",
+				Mirrors: []domain.RegistryMirror{
+					{Endpoint: "https://mirror.local/"},
+					{Endpoint: "http://10.0.0.5:5000/v2/docker.io", Capabilities: []string{"pull"}, OverridePath: true},
+				},
+			},
+			expectedFiles: []yip.File{
+				{
+					Path:        "/etc/containerd/certs.d/docker.io/hosts.toml",
+					Permissions: 0644,
+					Content: `[host."https://mirror.local"]
+  capabilities = ["pull", "resolve"]
+
+[host."http://10.0.0.5:5000/v2/docker.io"]
+  capabilities = ["pull"]
+  override_path = true
+`,
+				},
+			},
+		},
+		{
+			name: "private_registry",
+			registry: domain.RegistryConfiguration{
+				Upstream:              "registry.local:5000",
+				CABundle:              "REGISTRY CA",
+				InsecureSkipTLSVerify: true,
+				Auth:                  &domain.RegistryAuth{Username: "admin", Password: `pa"ss`},
+				Mirrors: []domain.RegistryMirror{
+					{Endpoint: "https://cache.local", CABundle: "CACHE CA", InsecureSkipTLSVerify: true, Auth: &domain.RegistryAuth{Username: "cache", Password: "secret"}},
+				},
+			},
+			expectedFiles: []yip.File{
+				{Path: "/etc/containerd/certs.d/registry.local:5000/ca.crt", Permissions: 0644, Content: "REGISTRY CA"},
+				{Path: "/etc/containerd/certs.d/registry.local:5000/mirror-0-ca.crt", Permissions: 0644, Content: "CACHE CA"},
+				{
+					Path:        "/etc/containerd/certs.d/registry.local:5000/hosts.toml",
+					Permissions: 0600,
+					Content: `ca = "/etc/containerd/certs.d/registry.local:5000/ca.crt"
+skip_verify = true
+
+[header]
+  Authorization = "Basic YWRtaW46cGEic3M="
+
+[host."https://cache.local"]
+  capabilities = ["pull", "resolve"]
+  ca = "/etc/containerd/certs.d/registry.local:5000/mirror-0-ca.crt"
+  skip_verify = true
+
+[host."https://cache.local".header]
+  Authorization = "Basic Y2FjaGU6c2VjcmV0"
+`,
+				},
+			},
+		},
+		{
+			name: "plain_http",
+			registry: domain.RegistryConfiguration{
+				Upstream:  "10.0.0.5:5000",
+				PlainHTTP: true,
+			},
+			expectedFiles: []yip.File{
+				{Path: "/etc/containerd/certs.d/10.0.0.5:5000/hosts.toml", Permissions: 0644, Content: "server = \"http://10.0.0.5:5000\"\n"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			files := RegistryFiles("/etc/containerd/certs.d", []domain.RegistryConfiguration{tt.registry})
+			g.Expect(files).To(Equal(tt.expectedFiles))
+		})
+	}
+}
+
+// TestTomlString tests the tomlString function
+func TestTomlString(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(tomlString(`C:\certs "ca"`)).To(Equal(`"C:\\certs \"ca\""`))
+	g.Expect(tomlString("line\nbreak\x7f")).To(Equal(`"line\u000Abreak\u007F"`))
+}
@@ -1,23 +1,81 @@
 package domain
 
+import "time"
+
 type ClusterContext struct {
-	RootPath                    string `json:"rootPath" yaml:"rootPath"`
-	NodeRole                    string `json:"nodeRole" yaml:"nodeRole"`
-	ClusterCidr                 string `json:"clusterCidr" yaml:"clusterCidr"`
-	ServiceCidr                 string `json:"serviceCidr" yaml:"serviceCidr"`
-	KubeletArgs                 string `json:"kubeletArgs" yaml:"kubeletArgs"`
-	CertSansRevision            string `json:"certSans" yaml:"certSans"`
-	ControlPlaneHost            string `json:"controlPlaneHost" yaml:"controlPlaneHost"`
-	ClusterToken                string `json:"clusterToken" yaml:"clusterToken"`
-	UserOptions                 string `json:"userOptions" yaml:"userOptions"`
-	LocalImagesPath             string `json:"localImagesPath" yaml:"localImagesPath"`
-	CustomNodeIp                string `json:"customNodeIp" yaml:"customNodeIp"`
-	ContainerdServiceFolderName string `json:"containerdServiceFolderName" yaml:"containerdServiceFolderName"`
-	KubernetesVersion           string `json:"kubernetesVersion" yaml:"kubernetesVersion"`
+	RootPath                    string                   `json:"rootPath" yaml:"rootPath"`
+	NodeRole                    string                   `json:"nodeRole" yaml:"nodeRole"`
+	ClusterCidr                 string                   `json:"clusterCidr" yaml:"clusterCidr"`
+	ServiceCidr                 string                   `json:"serviceCidr" yaml:"serviceCidr"`
+	KubeletArgs                 string                   `json:"kubeletArgs" yaml:"kubeletArgs"`
+	CertSansRevision            string                   `json:"certSans" yaml:"certSans"`
+	ControlPlaneHost            string                   `json:"controlPlaneHost" yaml:"controlPlaneHost"`
+	ClusterToken                string                   `json:"clusterToken" yaml:"clusterToken"`
+	UserOptions                 string                   `json:"userOptions" yaml:"userOptions"`
+	LocalImagesPath             string                   `json:"localImagesPath" yaml:"localImagesPath"`
+	LocalImagesPublicKey        string                   `json:"localImagesPublicKey,omitempty" yaml:"localImagesPublicKey,omitempty"`
+	CustomNodeIp                string                   `json:"customNodeIp" yaml:"customNodeIp"`
+	ContainerdServiceFolderName string                   `json:"containerdServiceFolderName" yaml:"containerdServiceFolderName"`
+	KubernetesVersion           string                   `json:"kubernetesVersion" yaml:"kubernetesVersion"`
+	BootstrapTokenTTL           time.Duration            `json:"bootstrapTokenTTL" yaml:"bootstrapTokenTTL"`
+	ProviderPath                string                   `json:"providerPath" yaml:"providerPath"`
+	KubeadmRetry                RetryPolicy              `json:"kubeadmRetry" yaml:"kubeadmRetry"`
+	IgnorePreflightErrors       []string                 `json:"ignorePreflightErrors,omitempty" yaml:"ignorePreflightErrors,omitempty"`
+	VerifyImages                bool                     `json:"verifyImages" yaml:"verifyImages"`
+	KubeVip                     *KubeVip                 `json:"kubeVip,omitempty" yaml:"kubeVip,omitempty"`
+	Drain                       DrainConfiguration       `json:"drain" yaml:"drain"`
+	EtcdSnapshot                EtcdSnapshotPolicy       `json:"etcdSnapshot" yaml:"etcdSnapshot"`
+	EtcdBackup                  *EtcdBackupConfiguration `json:"etcdBackup,omitempty" yaml:"etcdBackup,omitempty"`
+	// ExternalEtcd is set when the cluster uses an external etcd cluster, the certificate PEMs are
+	// empty if the user manages the certificate files in clusterConfiguration.etcd.external.
+	ExternalEtcd       *ExternalEtcdConfiguration      `json:"externalEtcd,omitempty" yaml:"externalEtcd,omitempty"`
+	CertificateRenewal CertificateRenewalConfiguration `json:"certificateRenewal" yaml:"certificateRenewal"`
+	// PKI is set when the CAs or the service account key come from the provider options.
+	PKI *ClusterPKI `json:"pki,omitempty" yaml:"pki,omitempty"`
+	// CACertHashes are the cluster CA hashes of the provider options joining nodes pin.
+	CACertHashes []string `json:"caCertHashes,omitempty" yaml:"caCertHashes,omitempty"`
 
 	EnvConfig map[string]string `json:"envConfig" yaml:"envConfig"`
 }
 
+type RetryPolicy struct {
+	// MaxAttempts of 0 retries forever.
+	MaxAttempts int           `json:"maxAttempts" yaml:"maxAttempts"`
+	Backoff     time.Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff  time.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+}
+
+// EtcdSnapshotPolicy configures the etcd snapshots taken before upgrades and reconfigurations.
+type EtcdSnapshotPolicy struct {
+	// Dir is relative to the cluster root path.
+	Dir       string `json:"dir" yaml:"dir"`
+	Retention int    `json:"retention" yaml:"retention"`
+}
+
+// ClusterPKI holds the PEMs of the user provided CAs and service account key, kubeadm generates
+// the empty ones. Joining nodes only read the cluster CA certificate to pin its hash.
+type ClusterPKI struct {
+	CACert            string `json:"caCert,omitempty" yaml:"caCert,omitempty"`
+	CAKey             string `json:"caKey,omitempty" yaml:"caKey,omitempty"`
+	FrontProxyCACert  string `json:"frontProxyCACert,omitempty" yaml:"frontProxyCACert,omitempty"`
+	FrontProxyCAKey   string `json:"frontProxyCAKey,omitempty" yaml:"frontProxyCAKey,omitempty"`
+	EtcdCACert        string `json:"etcdCACert,omitempty" yaml:"etcdCACert,omitempty"`
+	EtcdCAKey         string `json:"etcdCAKey,omitempty" yaml:"etcdCAKey,omitempty"`
+	ServiceAccountKey string `json:"serviceAccountKey,omitempty" yaml:"serviceAccountKey,omitempty"`
+}
+
+// KubeVip configures the kube-vip static pod which serves the control plane endpoint.
+type KubeVip struct {
+	Address     string `json:"address" yaml:"address"`
+	Port        string `json:"port" yaml:"port"`
+	Interface   string `json:"interface" yaml:"interface"`
+	Mode        string `json:"mode" yaml:"mode"`
+	Image       string `json:"image" yaml:"image"`
+	BGPAS       uint32 `json:"bgpAS,omitempty" yaml:"bgpAS,omitempty"`
+	BGPRouterID string `json:"bgpRouterID,omitempty" yaml:"bgpRouterID,omitempty"`
+	BGPPeers    string `json:"bgpPeers,omitempty" yaml:"bgpPeers,omitempty"`
+}
+
 type ClusterOptions struct {
 	ClusterConfig struct {
 		KubernetesVersion string `yaml:"kubernetesVersion" json:"kubernetesVersion"`
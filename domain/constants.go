@@ -1,8 +1,95 @@
 package domain
 
+import "time"
+
 const (
 	DefaultAPIAdvertiseAddress = "0.0.0.0"
 
 	ClusterRootPath = "cluster_root_path"
 	DefaultRootPath = "/"
+
+	KubernetesVersionOption = "kubernetes_version"
+	BootstrapTokenTTLOption = "bootstrap_token_ttl"
+
+	ResetDryRunOption       = "reset_dry_run"
+	ResetKeepCNIOption      = "reset_keep_cni"
+	ResetKeepImagesOption   = "reset_keep_images"
+	ResetKeepIPTablesOption = "reset_keep_iptables"
+	// ResetKeepEtcdSnapshotsOption keeps the etcd snapshot and backup directories, which hold every
+	// Secret of the cluster.
+	ResetKeepEtcdSnapshotsOption = "reset_keep_etcd_snapshots"
+
+	KubeadmMaxAttemptsOption = "kubeadm_max_attempts"
+	KubeadmBackoffOption     = "kubeadm_retry_backoff"
+	KubeadmMaxBackoffOption  = "kubeadm_retry_max_backoff"
+
+	// IgnorePreflightErrorsOption is a comma separated list of kubeadm preflight checks, it
+	// replaces the default list the provider ignores.
+	IgnorePreflightErrorsOption = "ignore_preflight_errors"
+
+	// VerifyImagesOption fails the boot before kubeadm runs if containerd misses an image the node needs.
+	VerifyImagesOption = "verify_images"
+
+	DefaultKubeadmMaxAttempts = 10
+	DefaultKubeadmBackoff     = 10 * time.Second
+	DefaultKubeadmMaxBackoff  = 5 * time.Minute
+
+	// CACertHashesOption is a comma separated list of cluster CA public key hashes, joining nodes
+	// pin them in the discovery instead of skipping the CA verification.
+	CACertHashesOption = "ca_cert_hashes"
+
+	// The PKI options hold a PEM, or a path relative to the cluster root path.
+	CACertOption            = "ca_cert"
+	CAKeyOption             = "ca_key"
+	FrontProxyCACertOption  = "front_proxy_ca_cert"
+	FrontProxyCAKeyOption   = "front_proxy_ca_key"
+	EtcdCACertOption        = "etcd_ca_cert"
+	EtcdCAKeyOption         = "etcd_ca_key"
+	ServiceAccountKeyOption = "service_account_key"
+
+	// LocalImagesPublicKeyOption holds the PEM of the key the checksums of the local image archives
+	// are signed with, or its path relative to the cluster root path.
+	LocalImagesPublicKeyOption = "local_images_public_key"
+
+	KubeVipEnabledOption     = "kube_vip_enabled"
+	KubeVipAddressOption     = "kube_vip_address"
+	KubeVipInterfaceOption   = "kube_vip_interface"
+	KubeVipModeOption        = "kube_vip_mode"
+	KubeVipImageOption       = "kube_vip_image"
+	KubeVipBGPASOption       = "kube_vip_bgp_as"
+	KubeVipBGPRouterIDOption = "kube_vip_bgp_router_id"
+	KubeVipBGPPeersOption    = "kube_vip_bgp_peers"
+
+	KubeVipModeARP      = "arp"
+	KubeVipModeBGP      = "bgp"
+	DefaultKubeVipImage = "ghcr.io/kube-vip/kube-vip:v0.8.9"
+	DefaultKubeVipBGPAS = 65000
+
+	DefaultDrainTimeout = 5 * time.Minute
+
+	EtcdSnapshotDirOption       = "etcd_snapshot_dir"
+	EtcdSnapshotRetentionOption = "etcd_snapshot_retention"
+
+	DefaultEtcdSnapshotDir       = "opt/etcd-snapshots"
+	DefaultEtcdSnapshotRetention = 5
+
+	DefaultEtcdBackupInterval  = 6 * time.Hour
+	DefaultEtcdBackupDir       = "opt/etcd-backups"
+	DefaultEtcdBackupRetention = 7
+	DefaultS3Region            = "us-east-1"
+
+	// ExternalEtcdCertsPath is relative to the cluster root path, so the certificates survive the
+	// resets between kubeadm retries.
+	ExternalEtcdCertsPath = "opt/kubeadm/pki/etcd"
+
+	DefaultCertificateRenewBefore = 30 * 24 * time.Hour
+	// DefaultCertificateValidity is the validity of the certificates kubeadm issues.
+	DefaultCertificateValidity = 365 * 24 * time.Hour
+
+	DefaultContainerdRoot        = "/opt/containerd"
+	DefaultContainerdSnapshotter = "overlayfs"
+	DefaultContainerdRuntime     = "runc"
+	DefaultContainerdRuntimeType = "io.containerd.runc.v2"
+	// DefaultRuncBinaryName is the runc binary shipped with containerd in the image.
+	DefaultRuncBinaryName = "/opt/bin/runc"
 )
@@ -1,21 +1,159 @@
 package domain
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
 	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
 )
 
 type KubeadmConfigBeta4 struct {
-	ClusterConfiguration kubeadmapiv4.ClusterConfiguration   `json:"clusterConfiguration,omitempty" yaml:"clusterConfiguration,omitempty"`
-	InitConfiguration    kubeadmapiv4.InitConfiguration      `json:"initConfiguration,omitempty" yaml:"initConfiguration,omitempty"`
-	JoinConfiguration    kubeadmapiv4.JoinConfiguration      `json:"joinConfiguration,omitempty" yaml:"joinConfiguration,omitempty"`
-	KubeletConfiguration kubeletv1beta1.KubeletConfiguration `json:"kubeletConfiguration,omitempty" yaml:"kubeletConfiguration,omitempty"`
+	ClusterConfiguration  kubeadmapiv4.ClusterConfiguration   `json:"clusterConfiguration,omitempty" yaml:"clusterConfiguration,omitempty"`
+	InitConfiguration     kubeadmapiv4.InitConfiguration      `json:"initConfiguration,omitempty" yaml:"initConfiguration,omitempty"`
+	JoinConfiguration     kubeadmapiv4.JoinConfiguration      `json:"joinConfiguration,omitempty" yaml:"joinConfiguration,omitempty"`
+	KubeletConfiguration  kubeletv1beta1.KubeletConfiguration `json:"kubeletConfiguration,omitempty" yaml:"kubeletConfiguration,omitempty"`
+	ProviderConfiguration `json:",inline" yaml:",inline"`
 }
 
 type KubeadmConfigBeta3 struct {
-	ClusterConfiguration kubeadmapiv3.ClusterConfiguration   `json:"clusterConfiguration,omitempty" yaml:"clusterConfiguration,omitempty"`
-	InitConfiguration    kubeadmapiv3.InitConfiguration      `json:"initConfiguration,omitempty" yaml:"initConfiguration,omitempty"`
-	JoinConfiguration    kubeadmapiv3.JoinConfiguration      `json:"joinConfiguration,omitempty" yaml:"joinConfiguration,omitempty"`
-	KubeletConfiguration kubeletv1beta1.KubeletConfiguration `json:"kubeletConfiguration,omitempty" yaml:"kubeletConfiguration,omitempty"`
+	ClusterConfiguration  kubeadmapiv3.ClusterConfiguration   `json:"clusterConfiguration,omitempty" yaml:"clusterConfiguration,omitempty"`
+	InitConfiguration     kubeadmapiv3.InitConfiguration      `json:"initConfiguration,omitempty" yaml:"initConfiguration,omitempty"`
+	JoinConfiguration     kubeadmapiv3.JoinConfiguration      `json:"joinConfiguration,omitempty" yaml:"joinConfiguration,omitempty"`
+	KubeletConfiguration  kubeletv1beta1.KubeletConfiguration `json:"kubeletConfiguration,omitempty" yaml:"kubeletConfiguration,omitempty"`
+	ProviderConfiguration `json:",inline" yaml:",inline"`
+}
+
+// ProviderConfiguration holds the blocks of the cluster config that are owned by the provider
+// rather than by kubeadm. They are the same for every kubeadm API version. Without a containerd
+// block the containerd config of the image is kept.
+type ProviderConfiguration struct {
+	Drain              DrainConfiguration              `json:"drain,omitempty" yaml:"drain,omitempty"`
+	EtcdBackup         *EtcdBackupConfiguration        `json:"etcdBackup,omitempty" yaml:"etcdBackup,omitempty"`
+	ExternalEtcd       *ExternalEtcdConfiguration      `json:"externalEtcd,omitempty" yaml:"externalEtcd,omitempty"`
+	CertificateRenewal CertificateRenewalConfiguration `json:"certificateRenewal,omitempty" yaml:"certificateRenewal,omitempty"`
+	Registries         []RegistryConfiguration         `json:"registries,omitempty" yaml:"registries,omitempty"`
+	Containerd         *ContainerdConfiguration        `json:"containerd,omitempty" yaml:"containerd,omitempty"`
+}
+
+// DrainConfiguration configures how a worker is drained before its kubelet is upgraded. Static
+// and finished pods are never evicted.
+type DrainConfiguration struct {
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Timeout defaults to DefaultDrainTimeout, 0 waits until every pod is evicted.
+	Timeout               *metav1.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	EvictDaemonSetPods    bool             `json:"evictDaemonSetPods,omitempty" yaml:"evictDaemonSetPods,omitempty"`
+	EvictLocalStoragePods bool             `json:"evictLocalStoragePods,omitempty" yaml:"evictLocalStoragePods,omitempty"`
+}
+
+// EtcdBackupConfiguration schedules etcd snapshots on control plane nodes with a local etcd member.
+type EtcdBackupConfiguration struct {
+	// Interval defaults to DefaultEtcdBackupInterval.
+	Interval *metav1.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Dir is relative to the cluster root path and defaults to DefaultEtcdBackupDir.
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// Retention defaults to DefaultEtcdBackupRetention.
+	Retention *int             `json:"retention,omitempty" yaml:"retention,omitempty"`
+	Compress  bool             `json:"compress,omitempty" yaml:"compress,omitempty"`
+	S3        *S3Configuration `json:"s3,omitempty" yaml:"s3,omitempty"`
+}
+
+// S3Configuration uploads the backups to an S3 compatible endpoint using path style URLs.
+type S3Configuration struct {
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Region defaults to DefaultS3Region.
+	Region                string `json:"region,omitempty" yaml:"region,omitempty"`
+	Bucket                string `json:"bucket" yaml:"bucket"`
+	Prefix                string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	AccessKeyID           string `json:"accessKeyID" yaml:"accessKeyID"`
+	SecretAccessKey       string `json:"secretAccessKey" yaml:"secretAccessKey"`
+	InsecureSkipTLSVerify bool   `json:"insecureSkipTLSVerify,omitempty" yaml:"insecureSkipTLSVerify,omitempty"`
+}
+
+// ExternalEtcdConfiguration connects the API server to an external etcd cluster with the given
+// client certificate. The PEMs are written below the cluster root path on control plane nodes.
+type ExternalEtcdConfiguration struct {
+	Endpoints  []string `json:"endpoints" yaml:"endpoints"`
+	CACert     string   `json:"caCert,omitempty" yaml:"caCert,omitempty"`
+	ClientCert string   `json:"clientCert,omitempty" yaml:"clientCert,omitempty"`
+	ClientKey  string   `json:"clientKey,omitempty" yaml:"clientKey,omitempty"`
+}
+
+// CertificateRenewalConfiguration configures the control plane certificate check which runs on
+// every boot. Certificates expiring within RenewBefore are renewed with kubeadm.
+type CertificateRenewalConfiguration struct {
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// RenewBefore defaults to DefaultCertificateRenewBefore.
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty" yaml:"renewBefore,omitempty"`
+}
+
+// ContainerdConfiguration is rendered to the config.toml of the containerd service on every boot,
+// before containerd is restarted ahead of kubeadm.
+type ContainerdConfiguration struct {
+	// CgroupDriver is systemd or cgroupfs. It defaults to the cgroup driver of the kubelet
+	// configuration, else to systemd, and the kubelet always uses the same driver.
+	CgroupDriver string `json:"cgroupDriver,omitempty" yaml:"cgroupDriver,omitempty"`
+	// Root is the directory containerd keeps its state and content store in. It defaults to
+	// DefaultContainerdRoot for the containerd service, other services keep their own default.
+	Root string `json:"root,omitempty" yaml:"root,omitempty"`
+	// SandboxImage defaults to the pause image kubeadm uses for the kubernetes version.
+	SandboxImage string `json:"sandboxImage,omitempty" yaml:"sandboxImage,omitempty"`
+	// Snapshotter defaults to DefaultContainerdSnapshotter.
+	Snapshotter string `json:"snapshotter,omitempty" yaml:"snapshotter,omitempty"`
+	// RegistryConfigPath is the directory of the registry hosts.toml files, it defaults to the
+	// certs.d directory of the containerd service.
+	RegistryConfigPath string `json:"registryConfigPath,omitempty" yaml:"registryConfigPath,omitempty"`
+	// DiscardUnpackedLayers removes the layers from the content store once they are unpacked.
+	// Peer to peer registry mirrors such as spegel serve the layers from there, keep it off for them.
+	DiscardUnpackedLayers bool `json:"discardUnpackedLayers,omitempty" yaml:"discardUnpackedLayers,omitempty"`
+	// DefaultRuntime is the runtime handler of the pods without a runtime class, it defaults to
+	// DefaultContainerdRuntime.
+	DefaultRuntime string `json:"defaultRuntime,omitempty" yaml:"defaultRuntime,omitempty"`
+	// Runtimes are added to the runc runtime, an entry named runc replaces it.
+	Runtimes []ContainerdRuntime `json:"runtimes,omitempty" yaml:"runtimes,omitempty"`
+}
+
+// ContainerdRuntime is a runtime handler, pods select it with a RuntimeClass of the same handler.
+type ContainerdRuntime struct {
+	Name string `json:"name" yaml:"name"`
+	// Type defaults to DefaultContainerdRuntimeType.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// BinaryName is the binary the runc shim runs, e.g. /usr/bin/nvidia-container-runtime.
+	BinaryName string `json:"binaryName,omitempty" yaml:"binaryName,omitempty"`
+}
+
+// RegistryConfiguration configures how containerd pulls the images of an upstream registry. It is
+// rendered to the hosts.toml of the upstream below the containerd registry config path.
+type RegistryConfiguration struct {
+	// Upstream is the registry host with an optional port, e.g. docker.io or registry.local:5000.
+	// "_default" applies to every registry without a configuration of its own.
+	Upstream string `json:"upstream" yaml:"upstream"`
+	// Mirrors are tried in order before the upstream.
+	Mirrors []RegistryMirror `json:"mirrors,omitempty" yaml:"mirrors,omitempty"`
+	// PlainHTTP pulls from the upstream over http.
+	PlainHTTP             bool          `json:"plainHTTP,omitempty" yaml:"plainHTTP,omitempty"`
+	CABundle              string        `json:"caBundle,omitempty" yaml:"caBundle,omitempty"`
+	InsecureSkipTLSVerify bool          `json:"insecureSkipTLSVerify,omitempty" yaml:"insecureSkipTLSVerify,omitempty"`
+	Auth                  *RegistryAuth `json:"auth,omitempty" yaml:"auth,omitempty"`
+}
+
+// RegistryMirror is a host serving the images of an upstream registry.
+type RegistryMirror struct {
+	// Endpoint is the http or https URL of the mirror.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Capabilities defaults to pull and resolve.
+	Capabilities []string `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	// OverridePath uses the endpoint path as the registry API root instead of appending /v2.
+	OverridePath          bool          `json:"overridePath,omitempty" yaml:"overridePath,omitempty"`
+	CABundle              string        `json:"caBundle,omitempty" yaml:"caBundle,omitempty"`
+	InsecureSkipTLSVerify bool          `json:"insecureSkipTLSVerify,omitempty" yaml:"insecureSkipTLSVerify,omitempty"`
+	Auth                  *RegistryAuth `json:"auth,omitempty" yaml:"auth,omitempty"`
+}
+
+// RegistryAuth is sent as a basic Authorization header, so the registry has to accept basic
+// authentication on its API.
+type RegistryAuth struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
 }
@@ -0,0 +1,147 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	pkiPath = "/etc/kubernetes/pki/etcd"
+
+	containerPollInterval = 5 * time.Second
+	containerWaitTimeout  = 5 * time.Minute
+)
+
+// ErrNoLocalEtcd is returned when the node does not run a local etcd member.
+var ErrNoLocalEtcd = errors.New("node does not run a local etcd member")
+
+// stubbed in tests
+var (
+	manifestPath = "/etc/kubernetes/manifests/etcd.yaml"
+
+	findBinary    = utils.FindBinary
+	runCommand    = utils.RunCommand
+	commandOutput = utils.CommandOutput
+	fileExists    = func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	now   = time.Now
+	sleep = func(ctx context.Context, d time.Duration) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+			return nil
+		}
+	}
+)
+
+// member is the local etcd member described by the kubeadm static pod manifest.
+type member struct {
+	Name           string
+	Image          string
+	DataDir        string
+	PeerURL        string
+	ClientEndpoint string
+}
+
+func readMember() (member, error) {
+	content, err := os.ReadFile(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return member{}, ErrNoLocalEtcd
+	}
+	if err != nil {
+		return member{}, err
+	}
+	return parseMember(content)
+}
+
+func parseMember(manifest []byte) (member, error) {
+	var pod corev1.Pod
+	if err := yaml.Unmarshal(manifest, &pod); err != nil {
+		return member{}, fmt.Errorf("failed to parse etcd manifest: %w", err)
+	}
+
+	for _, container := range pod.Spec.Containers {
+		if container.Name != "etcd" {
+			continue
+		}
+
+		m := member{
+			Image:          container.Image,
+			ClientEndpoint: "https://127.0.0.1:2379",
+		}
+		for _, arg := range append(container.Command, container.Args...) {
+			name, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			if !ok {
+				continue
+			}
+			switch name {
+			case "name":
+				m.Name = value
+			case "data-dir":
+				m.DataDir = value
+			case "initial-advertise-peer-urls":
+				m.PeerURL, _, _ = strings.Cut(value, ",")
+			case "listen-client-urls":
+				for _, url := range strings.Split(value, ",") {
+					if strings.HasPrefix(url, "https://127.0.0.1:") {
+						m.ClientEndpoint = url
+					}
+				}
+			}
+		}
+
+		if m.Name == "" || m.DataDir == "" || m.PeerURL == "" || m.Image == "" {
+			return member{}, errors.New("etcd manifest is missing the member name, data dir, peer url or image")
+		}
+		return m, nil
+	}
+	return member{}, errors.New("etcd manifest has no etcd container")
+}
+
+// containerID returns the id of the running etcd container, or an empty string if it is not running.
+func containerID(crictl string) (string, error) {
+	output, err := commandOutput(crictl, utils.CrictlArgs("ps", "--name", "^etcd$", "--state", "running", "-q")...)
+	if err != nil {
+		return "", err
+	}
+	id, _, _ := strings.Cut(output, "\n")
+	return strings.TrimSpace(id), nil
+}
+
+// waitForContainer waits until the etcd container is running, or is stopped when running is false.
+func waitForContainer(ctx context.Context, crictl string, running bool) (string, error) {
+	deadline := now().Add(containerWaitTimeout)
+	for {
+		id, err := containerID(crictl)
+		if err == nil && (id != "") == running {
+			return id, nil
+		}
+		if err != nil {
+			logrus.Errorf("failed to list etcd containers: %v", err)
+		}
+
+		if !now().Before(deadline) {
+			state := "running"
+			if !running {
+				state = "stopped"
+			}
+			return "", fmt.Errorf("etcd container was not %s after %s", state, containerWaitTimeout)
+		}
+		if err = sleep(ctx, containerPollInterval); err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package etcd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testManifest(dataDir string) string {
+	return `apiVersion: v1
+kind: Pod
+metadata:
+  name: etcd
+  namespace: kube-system
+spec:
+  containers:
+  - name: etcd
+    image: registry.k8s.io/etcd:3.5.15-0
+    command:
+    - etcd
+    - --advertise-client-urls=https://10.0.0.10:2379
+    - --data-dir=` + dataDir + `
+    - --initial-advertise-peer-urls=https://10.0.0.10:2380
+    - --initial-cluster=cp-1=https://10.0.0.10:2380
+    - --listen-client-urls=https://127.0.0.1:2379,https://10.0.0.10:2379
+    - --name=cp-1
+`
+}
+
+// TestParseMember tests the parseMember function
+func TestParseMember(t *testing.T) {
+	tests := []struct {
+		name          string
+		manifest      string
+		expected      member
+		expectedError string
+	}{
+		{
+			name:     "kubeadm_manifest",
+			manifest: testManifest("/var/lib/etcd"),
+			expected: member{
+				Name:           "cp-1",
+				Image:          "registry.k8s.io/etcd:3.5.15-0",
+				DataDir:        "/var/lib/etcd",
+				PeerURL:        "https://10.0.0.10:2380",
+				ClientEndpoint: "https://127.0.0.1:2379",
+			},
+		},
+		{
+			name:          "missing_flags",
+			manifest:      "apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: etcd\n    image: etcd\n    command: [etcd]\n",
+			expectedError: "etcd manifest is missing the member name, data dir, peer url or image",
+		},
+		{
+			name:          "no_etcd_container",
+			manifest:      "apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: sidecar\n",
+			expectedError: "etcd manifest has no etcd container",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := parseMember([]byte(tt.manifest))
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(tt.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestReadMemberWithoutManifest tests that readMember returns ErrNoLocalEtcd without an etcd manifest
+func TestReadMemberWithoutManifest(t *testing.T) {
+	g := NewWithT(t)
+	original := manifestPath
+	t.Cleanup(func() { manifestPath = original })
+	manifestPath = filepath.Join(t.TempDir(), "etcd.yaml")
+
+	_, err := readMember()
+	g.Expect(err).To(MatchError(ErrNoLocalEtcd))
+}
+
+// stubHost writes an etcd manifest for a data dir in a temporary directory and stubs the
+// commands, runCommand records the commands and calls run if it is set.
+func stubHost(t *testing.T, running func() bool, run func(name string, args []string) error) (string, *[]string) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "var/lib/etcd")
+	if err := os.MkdirAll(filepath.Join(dataDir, "member"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "manifests"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifests/etcd.yaml"), []byte(testManifest(dataDir)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	originalManifestPath, originalFindBinary, originalRunCommand, originalCommandOutput, originalFileExists, originalNow, originalSleep := manifestPath, findBinary, runCommand, commandOutput, fileExists, now, sleep
+	t.Cleanup(func() {
+		manifestPath, findBinary, runCommand, commandOutput, fileExists, now, sleep = originalManifestPath, originalFindBinary, originalRunCommand, originalCommandOutput, originalFileExists, originalNow, originalSleep
+	})
+
+	var commands []string
+	manifestPath = filepath.Join(dir, "manifests/etcd.yaml")
+	findBinary = func(rootPath, name string) (string, error) {
+		return filepath.Join(rootPath, "usr/bin", name), nil
+	}
+	runCommand = func(name string, args ...string) error {
+		commands = append(commands, strings.Join(append([]string{name}, args...), " "))
+		if run != nil {
+			return run(name, args)
+		}
+		return nil
+	}
+	commandOutput = func(string, ...string) (string, error) {
+		if running() {
+			return "3f2a9c\n", nil
+		}
+		return "", nil
+	}
+	fileExists = func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	now = func() time.Time { return testNow }
+	sleep = func(context.Context, time.Duration) error { return nil }
+
+	return dataDir, &commands
+}
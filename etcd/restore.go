@@ -0,0 +1,145 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+// RestoreCommand is the provider subcommand that restores the local etcd member from a snapshot.
+const RestoreCommand = "etcd-restore"
+
+// RestoreOptions selects the snapshot to restore. Snapshot is a file name in Dir or an absolute
+// path, the newest snapshot in Dir is restored when it is empty.
+type RestoreOptions struct {
+	RootPath string
+	Dir      string
+	Snapshot string
+}
+
+// ParseRestoreArgs parses the arguments following the RestoreCommand.
+func ParseRestoreArgs(args []string) (RestoreOptions, error) {
+	var opts RestoreOptions
+
+	fs := flag.NewFlagSet(RestoreCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.StringVar(&opts.Dir, "dir", domain.DefaultEtcdSnapshotDir, "snapshot directory relative to the cluster root path")
+	fs.StringVar(&opts.Snapshot, "snapshot", "", "snapshot to restore, defaults to the newest snapshot")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// Restore replaces the data of the local etcd member with the snapshot. The member is stopped
+// by moving its static pod manifest away, the previous data dir is kept next to the new one. The
+// restored member forms a new single member cluster, other control plane nodes have to be reset
+// and joined again.
+func Restore(ctx context.Context, opts RestoreOptions) error {
+	dir := filepath.Join(opts.RootPath, opts.Dir)
+
+	snapshot := opts.Snapshot
+	switch {
+	case snapshot == "":
+		snapshots, err := List(dir)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			return fmt.Errorf("no etcd snapshots found in %s", dir)
+		}
+		snapshot = snapshots[0]
+	case !filepath.IsAbs(snapshot):
+		snapshot = filepath.Join(dir, snapshot)
+	}
+	if !fileExists(snapshot) {
+		return fmt.Errorf("etcd snapshot %s not found", snapshot)
+	}
+
+	m, err := readMember()
+	if err != nil {
+		return err
+	}
+	crictl, err := findBinary(opts.RootPath, "crictl")
+	if err != nil {
+		return err
+	}
+	ctr, err := findBinary(opts.RootPath, "ctr")
+	if err != nil {
+		return err
+	}
+	logrus.Infof("restoring etcd member %s from %s", m.Name, snapshot)
+
+	restoreFrom := snapshot
+	if strings.HasSuffix(snapshot, compressedSuffix) {
+		restoreFrom = filepath.Join(filepath.Dir(snapshot), ".restore-"+strings.TrimSuffix(filepath.Base(snapshot), ".gz"))
+		if err = decompressFile(snapshot, restoreFrom); err != nil {
+			return fmt.Errorf("failed to decompress etcd snapshot: %w", err)
+		}
+		defer os.Remove(restoreFrom)
+	}
+
+	disabledManifest := filepath.Join(filepath.Dir(filepath.Dir(manifestPath)), "etcd.yaml.restore")
+	if err = os.Rename(manifestPath, disabledManifest); err != nil {
+		return fmt.Errorf("failed to stop etcd: %w", err)
+	}
+	defer func() {
+		if err := os.Rename(disabledManifest, manifestPath); err != nil {
+			logrus.Errorf("failed to start etcd, move %s back to %s: %v", disabledManifest, manifestPath, err)
+		}
+	}()
+
+	if _, err = waitForContainer(ctx, crictl, false); err != nil {
+		return err
+	}
+
+	backup := fmt.Sprintf("%s.before-restore-%s", m.DataDir, now().UTC().Format("20060102T150405Z"))
+	if err = os.Rename(m.DataDir, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to move the etcd data dir away: %w", err)
+	}
+
+	if err = runCommand(ctr, restoreArgs(m, restoreFrom)...); err != nil {
+		logrus.Errorf("failed to restore etcd snapshot, keeping the previous data: %v", err)
+		if rollbackErr := errors.Join(os.RemoveAll(m.DataDir), os.Rename(backup, m.DataDir)); rollbackErr != nil {
+			logrus.Errorf("failed to move the previous etcd data dir back from %s: %v", backup, rollbackErr)
+		}
+		return fmt.Errorf("failed to restore etcd snapshot: %w", err)
+	}
+
+	logrus.Infof("restored etcd snapshot %s, the previous data dir was moved to %s", snapshot, backup)
+	return nil
+}
+
+// restoreArgs runs etcdutl of the etcd image, the host has no etcd binaries.
+func restoreArgs(m member, snapshot string) []string {
+	var args []string
+	if utils.SpectroContainerd() {
+		args = append(args, "--address", utils.SpectroContainerdSocket)
+	}
+
+	dataParent := filepath.Dir(m.DataDir)
+	snapshotDir := filepath.Dir(snapshot)
+
+	return append(args, "-n", "k8s.io", "run", "--rm",
+		"--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,options=rbind:rw", dataParent, dataParent),
+		"--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,options=rbind:ro", snapshotDir, snapshotDir),
+		m.Image, fmt.Sprintf("etcd-restore-%d", now().Unix()),
+		"etcdutl", "snapshot", "restore", snapshot,
+		"--data-dir", m.DataDir,
+		"--name", m.Name,
+		"--initial-cluster", fmt.Sprintf("%s=%s", m.Name, m.PeerURL),
+		"--initial-advertise-peer-urls", m.PeerURL,
+	)
+}
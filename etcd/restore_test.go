@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// TestRestore tests the Restore function
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name             string
+		snapshot         string
+		failRestore      bool
+		expectedSnapshot string
+		expectedError    string
+	}{
+		{
+			name:             "newest_snapshot",
+			expectedSnapshot: "etcd-snapshot-20260215T120000Z-upgrade.db",
+		},
+		{
+			name:             "named_snapshot",
+			snapshot:         "etcd-snapshot-20260101T120000Z-manual.db",
+			expectedSnapshot: "etcd-snapshot-20260101T120000Z-manual.db",
+		},
+		{
+			name:             "compressed_snapshot",
+			snapshot:         "etcd-snapshot-20260201T120000Z-scheduled.db.gz",
+			expectedSnapshot: ".restore-etcd-snapshot-20260201T120000Z-scheduled.db",
+		},
+		{
+			name:          "missing_snapshot",
+			snapshot:      "etcd-snapshot-20250101T120000Z-manual.db",
+			expectedError: "etcd snapshot ROOT/opt/etcd-snapshots/etcd-snapshot-20250101T120000Z-manual.db not found",
+		},
+		{
+			name:             "failed_restore_keeps_the_data_dir",
+			failRestore:      true,
+			expectedSnapshot: "etcd-snapshot-20260215T120000Z-upgrade.db",
+			expectedError:    "failed to restore etcd snapshot: exit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// etcd stops once its manifest is moved away
+			var dataDir string
+			dataDir, commands := stubHost(t, func() bool {
+				_, err := os.Stat(manifestPath)
+				return err == nil
+			}, func(_ string, args []string) error {
+				g.Expect(os.ReadFile(args[len(args)-9])).To(Equal([]byte("snapshot")))
+				g.Expect(os.MkdirAll(filepath.Join(dataDir, "member"), 0700)).To(Succeed())
+				if tt.failRestore {
+					return errors.New("exit status 1")
+				}
+				return nil
+			})
+			g.Expect(os.WriteFile(filepath.Join(dataDir, "member/previous"), nil, 0600)).To(Succeed())
+
+			rootPath := t.TempDir()
+			dir := filepath.Join(rootPath, "opt/etcd-snapshots")
+			g.Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+			for _, name := range []string{"etcd-snapshot-20260101T120000Z-manual.db", "etcd-snapshot-20260201T120000Z-scheduled.db", "etcd-snapshot-20260215T120000Z-upgrade.db"} {
+				g.Expect(os.WriteFile(filepath.Join(dir, name), []byte("snapshot"), 0600)).To(Succeed())
+			}
+			g.Expect(compressFile(filepath.Join(dir, "etcd-snapshot-20260201T120000Z-scheduled.db"))).To(Succeed())
+
+			err := Restore(context.Background(), RestoreOptions{RootPath: rootPath, Dir: "opt/etcd-snapshots", Snapshot: tt.snapshot})
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(strings.ReplaceAll(tt.expectedError, "ROOT", rootPath)))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			// the manifest is moved back in every case
+			g.Expect(manifestPath).To(BeARegularFile())
+
+			if tt.expectedSnapshot == "" {
+				g.Expect(*commands).To(BeEmpty())
+				return
+			}
+			g.Expect(*commands).To(Equal([]string{fmt.Sprintf("%[6]s/usr/bin/ctr -n k8s.io run --rm "+
+				"--mount type=bind,src=%[1]s,dst=%[1]s,options=rbind:rw --mount type=bind,src=%[2]s,dst=%[2]s,options=rbind:ro "+
+				"registry.k8s.io/etcd:3.5.15-0 etcd-restore-%[3]d etcdutl snapshot restore %[2]s/%[4]s --data-dir %[5]s "+
+				"--name cp-1 --initial-cluster cp-1=https://10.0.0.10:2380 --initial-advertise-peer-urls https://10.0.0.10:2380",
+				filepath.Dir(dataDir), dir, testNow.Unix(), tt.expectedSnapshot, dataDir, rootPath)}))
+
+			// a decompressed snapshot is removed
+			g.Expect(filepath.Join(dir, ".restore-etcd-snapshot-20260201T120000Z-scheduled.db")).ToNot(BeAnExistingFile())
+
+			backup := dataDir + ".before-restore-20260301T120000Z"
+			if tt.failRestore {
+				g.Expect(filepath.Join(dataDir, "member/previous")).To(BeARegularFile())
+				g.Expect(backup).ToNot(BeADirectory())
+			} else {
+				g.Expect(filepath.Join(backup, "member/previous")).To(BeARegularFile())
+				g.Expect(filepath.Join(dataDir, "member")).To(BeADirectory())
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package etcd
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	// SnapshotCommand is the provider subcommand that takes an etcd snapshot.
+	SnapshotCommand = "etcd-snapshot"
+
+	snapshotPrefix   = "etcd-snapshot-"
+	snapshotSuffix   = ".db"
+	compressedSuffix = ".db.gz"
+)
+
+// SnapshotOptions configures where snapshots are stored and how many are kept. Dir is relative
+// to the cluster root path. The snapshot is gzipped with Compress and uploaded if S3 is set.
+type SnapshotOptions struct {
+	RootPath  string
+	Dir       string
+	Retention int
+	Reason    string
+	Compress  bool
+	S3        *domain.S3Configuration
+}
+
+// SnapshotArgs returns the provider arguments that take a snapshot with the given options. The S3
+// credentials are read from the AccessKeyIDEnv and SecretAccessKeyEnv environment variables.
+func SnapshotArgs(opts SnapshotOptions) []string {
+	args := []string{
+		SnapshotCommand,
+		"--root-path", opts.RootPath,
+		"--dir", opts.Dir,
+		"--retention", strconv.Itoa(opts.Retention),
+		"--reason", opts.Reason,
+	}
+	if opts.Compress {
+		args = append(args, "--compress")
+	}
+	if opts.S3 != nil {
+		args = append(args, "--s3-endpoint", opts.S3.Endpoint, "--s3-bucket", opts.S3.Bucket)
+		if opts.S3.Region != "" {
+			args = append(args, "--s3-region", opts.S3.Region)
+		}
+		if opts.S3.Prefix != "" {
+			args = append(args, "--s3-prefix", opts.S3.Prefix)
+		}
+		if opts.S3.InsecureSkipTLSVerify {
+			args = append(args, "--s3-insecure-skip-tls-verify")
+		}
+	}
+	return args
+}
+
+// ParseSnapshotArgs parses the arguments following the SnapshotCommand.
+func ParseSnapshotArgs(args []string) (SnapshotOptions, error) {
+	var opts SnapshotOptions
+	var s3 domain.S3Configuration
+
+	fs := flag.NewFlagSet(SnapshotCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.StringVar(&opts.Dir, "dir", domain.DefaultEtcdSnapshotDir, "snapshot directory relative to the cluster root path")
+	fs.IntVar(&opts.Retention, "retention", domain.DefaultEtcdSnapshotRetention, "number of snapshots to keep")
+	fs.StringVar(&opts.Reason, "reason", "manual", "reason recorded in the snapshot name")
+	fs.BoolVar(&opts.Compress, "compress", false, "gzip the snapshot")
+	fs.StringVar(&s3.Endpoint, "s3-endpoint", "", "S3 compatible endpoint to upload the snapshot to")
+	fs.StringVar(&s3.Region, "s3-region", "", "S3 region")
+	fs.StringVar(&s3.Bucket, "s3-bucket", "", "S3 bucket")
+	fs.StringVar(&s3.Prefix, "s3-prefix", "", "prefix of the uploaded object names")
+	fs.BoolVar(&s3.InsecureSkipTLSVerify, "s3-insecure-skip-tls-verify", false, "skip verifying the S3 endpoint certificate")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.Retention < 1 {
+		return opts, fmt.Errorf("invalid retention %d, must be at least 1", opts.Retention)
+	}
+	if opts.Reason == "" || strings.ContainsAny(opts.Reason, "/ ") {
+		return opts, fmt.Errorf("invalid reason %q", opts.Reason)
+	}
+
+	if s3.Endpoint != "" {
+		s3.AccessKeyID = os.Getenv(AccessKeyIDEnv)
+		s3.SecretAccessKey = os.Getenv(SecretAccessKeyEnv)
+		if s3.Bucket == "" || s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			return opts, fmt.Errorf("an S3 upload needs --s3-bucket and the %s and %s environment variables", AccessKeyIDEnv, SecretAccessKeyEnv)
+		}
+		opts.S3 = &s3
+	}
+	return opts, nil
+}
+
+// Snapshot saves a snapshot of the local etcd member and removes the oldest snapshots beyond the
+// retention. It returns ErrNoLocalEtcd on nodes without a local etcd member. A failed upload is
+// returned with the path of the snapshot, which is kept.
+func Snapshot(ctx context.Context, opts SnapshotOptions) (string, error) {
+	m, err := readMember()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(opts.RootPath, opts.Dir)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	crictl, err := findBinary(opts.RootPath, "crictl")
+	if err != nil {
+		return "", err
+	}
+	id, err := waitForContainer(ctx, crictl, true)
+	if err != nil {
+		return "", err
+	}
+
+	// etcdctl runs in the etcd container, which only mounts the data dir of the host. The temporary
+	// file is named after the snapshot and the process, so that the scheduled backup, an upgrade and
+	// the reconfigure stage do not overwrite each other's snapshot.
+	name := fmt.Sprintf("%s%s-%s", snapshotPrefix, now().UTC().Format("20060102T150405Z"), opts.Reason)
+	tmp := filepath.Join(m.DataDir, fmt.Sprintf("%s-%d%s.part", name, os.Getpid(), snapshotSuffix))
+	defer os.Remove(tmp)
+
+	if err = runCommand(crictl, utils.CrictlArgs("exec", id, "etcdctl",
+		"--endpoints", m.ClientEndpoint,
+		"--cacert", filepath.Join(pkiPath, "ca.crt"),
+		"--cert", filepath.Join(pkiPath, "healthcheck-client.crt"),
+		"--key", filepath.Join(pkiPath, "healthcheck-client.key"),
+		"snapshot", "save", tmp)...); err != nil {
+		return "", fmt.Errorf("failed to save etcd snapshot: %w", err)
+	}
+
+	path := filepath.Join(dir, name+snapshotSuffix)
+	if err = moveFile(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to store etcd snapshot: %w", err)
+	}
+	if opts.Compress {
+		if err = compressFile(path); err != nil {
+			return "", errors.Join(fmt.Errorf("failed to compress etcd snapshot: %w", err), os.Remove(path))
+		}
+		path += ".gz"
+	}
+	logrus.Infof("saved etcd snapshot %s", path)
+
+	if err = prune(dir, opts.Retention); err != nil {
+		logrus.Errorf("failed to remove old etcd snapshots: %v", err)
+	}
+
+	if opts.S3 != nil {
+		if err = upload(ctx, opts.S3, path); err != nil {
+			return path, fmt.Errorf("failed to upload etcd snapshot %s: %w", path, err)
+		}
+		logrus.Infof("uploaded etcd snapshot %s to %s", path, opts.S3.Endpoint)
+	}
+	return path, nil
+}
+
+// List returns the snapshots in the directory, newest first.
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) && (strings.HasSuffix(name, snapshotSuffix) || strings.HasSuffix(name, compressedSuffix)) {
+			snapshots = append(snapshots, filepath.Join(dir, name))
+		}
+	}
+
+	// the names start with the UTC time the snapshot was taken
+	sort.Sort(sort.Reverse(sort.StringSlice(snapshots)))
+	return snapshots, nil
+}
+
+func prune(dir string, retention int) error {
+	snapshots, err := List(dir)
+	if err != nil || len(snapshots) <= retention {
+		return err
+	}
+
+	var errs []error
+	for _, snapshot := range snapshots[retention:] {
+		logrus.Infof("removing etcd snapshot %s", snapshot)
+		errs = append(errs, os.Remove(snapshot))
+	}
+	return errors.Join(errs...)
+}
+
+// moveFile renames the file, or copies it when the data dir is on another filesystem.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return os.Chmod(dst, 0600)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst+".part", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return errors.Join(err, os.Remove(dst+".part"))
+	}
+	if err = out.Close(); err != nil {
+		return errors.Join(err, os.Remove(dst+".part"))
+	}
+	return os.Rename(dst+".part", dst)
+}
+
+// compressFile replaces the file with a gzipped copy with a .gz suffix.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz.part", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(path+".gz.part"))
+	}
+
+	if err = os.Rename(path+".gz.part", path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// decompressFile writes the gunzipped file to dst.
+func decompressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, zr); err != nil {
+		out.Close()
+		return errors.Join(err, os.Remove(dst))
+	}
+	if err = out.Close(); err != nil {
+		return errors.Join(err, os.Remove(dst))
+	}
+	return nil
+}
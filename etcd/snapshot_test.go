@@ -0,0 +1,168 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestSnapshotArgs tests that ParseSnapshotArgs parses the arguments built by SnapshotArgs
+func TestSnapshotArgs(t *testing.T) {
+	g := NewWithT(t)
+	opts := SnapshotOptions{RootPath: "/persistent/spectro", Dir: "opt/etcd-snapshots", Retention: 3, Reason: "upgrade"}
+
+	args := SnapshotArgs(opts)
+	g.Expect(args[0]).To(Equal(SnapshotCommand))
+
+	result, err := ParseSnapshotArgs(args[1:])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(opts))
+
+	_, err = ParseSnapshotArgs([]string{"--retention", "0"})
+	g.Expect(err).To(MatchError("invalid retention 0, must be at least 1"))
+
+	_, err = ParseSnapshotArgs([]string{"--reason", "../upgrade"})
+	g.Expect(err).To(MatchError(`invalid reason "../upgrade"`))
+
+	// the S3 credentials are passed in the environment
+	opts.Compress = true
+	opts.S3 = &domain.S3Configuration{
+		Endpoint:              "https://minio.local:9000",
+		Region:                "eu-west-1",
+		Bucket:                "etcd",
+		Prefix:                "site-1",
+		InsecureSkipTLSVerify: true,
+	}
+	args = SnapshotArgs(opts)
+	g.Expect(args).ToNot(ContainElement("minio123"))
+
+	_, err = ParseSnapshotArgs(args[1:])
+	g.Expect(err).To(MatchError("an S3 upload needs --s3-bucket and the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables"))
+
+	t.Setenv(AccessKeyIDEnv, "minio")
+	t.Setenv(SecretAccessKeyEnv, "minio123")
+	opts.S3.AccessKeyID = "minio"
+	opts.S3.SecretAccessKey = "minio123"
+	result, err = ParseSnapshotArgs(args[1:])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(opts))
+}
+
+// TestSnapshot tests the Snapshot function
+func TestSnapshot(t *testing.T) {
+	tests := []struct {
+		name              string
+		existing          []string
+		retention         int
+		compress          bool
+		failSave          bool
+		expectedSnapshots []string
+		expectedError     string
+	}{
+		{
+			name:              "first_snapshot",
+			retention:         5,
+			expectedSnapshots: []string{"etcd-snapshot-20260301T120000Z-upgrade.db"},
+		},
+		{
+			name: "removes_snapshots_beyond_retention",
+			existing: []string{
+				"etcd-snapshot-20260101T120000Z-upgrade.db",
+				"etcd-snapshot-20260201T120000Z-reconfigure.db",
+				"etcd-snapshot-20260215T120000Z-manual.db",
+				"notes.txt",
+			},
+			retention: 2,
+			expectedSnapshots: []string{
+				"etcd-snapshot-20260301T120000Z-upgrade.db",
+				"etcd-snapshot-20260215T120000Z-manual.db",
+				"notes.txt",
+			},
+		},
+		{
+			name:      "compressed_snapshots_share_the_retention",
+			existing:  []string{"etcd-snapshot-20260101T120000Z-scheduled.db.gz", "etcd-snapshot-20260201T120000Z-upgrade.db"},
+			retention: 2,
+			compress:  true,
+			expectedSnapshots: []string{
+				"etcd-snapshot-20260301T120000Z-upgrade.db.gz",
+				"etcd-snapshot-20260201T120000Z-upgrade.db",
+			},
+		},
+		{
+			name:              "failed_save_keeps_snapshots",
+			existing:          []string{"etcd-snapshot-20260101T120000Z-upgrade.db"},
+			retention:         1,
+			failSave:          true,
+			expectedSnapshots: []string{"etcd-snapshot-20260101T120000Z-upgrade.db"},
+			expectedError:     "failed to save etcd snapshot: exit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			dataDir, commands := stubHost(t, func() bool { return true }, func(_ string, args []string) error {
+				if tt.failSave {
+					return errors.New("exit status 1")
+				}
+				return os.WriteFile(args[len(args)-1], []byte("snapshot"), 0600)
+			})
+
+			rootPath := t.TempDir()
+			dir := filepath.Join(rootPath, "opt/etcd-snapshots")
+			g.Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+			for _, name := range tt.existing {
+				g.Expect(os.WriteFile(filepath.Join(dir, name), nil, 0600)).To(Succeed())
+			}
+
+			path, err := Snapshot(context.Background(), SnapshotOptions{RootPath: rootPath, Dir: "opt/etcd-snapshots", Retention: tt.retention, Reason: "upgrade", Compress: tt.compress})
+			if tt.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(path).To(Equal(filepath.Join(dir, tt.expectedSnapshots[0])))
+
+				content := filepath.Join(t.TempDir(), "snapshot.db")
+				if tt.compress {
+					g.Expect(decompressFile(path, content)).To(Succeed())
+				} else {
+					content = path
+				}
+				g.Expect(os.ReadFile(content)).To(Equal([]byte("snapshot")))
+			} else {
+				g.Expect(err).To(MatchError(tt.expectedError))
+			}
+
+			g.Expect(*commands).To(HaveLen(1))
+			g.Expect((*commands)[0]).To(HavePrefix(rootPath + "/usr/bin/crictl exec 3f2a9c etcdctl --endpoints https://127.0.0.1:2379 --cacert /etc/kubernetes/pki/etcd/ca.crt"))
+			g.Expect((*commands)[0]).To(HaveSuffix(fmt.Sprintf("snapshot save %s/etcd-snapshot-20260301T120000Z-upgrade-%d.db.part", dataDir, os.Getpid())))
+			g.Expect(os.ReadDir(dataDir)).To(HaveLen(1), "the temporary snapshot is removed")
+
+			entries, err := os.ReadDir(dir)
+			g.Expect(err).ToNot(HaveOccurred())
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			g.Expect(names).To(ConsistOf(tt.expectedSnapshots))
+		})
+	}
+}
+
+// TestSnapshotWithoutLocalEtcd tests that Snapshot returns ErrNoLocalEtcd on nodes without an etcd manifest
+func TestSnapshotWithoutLocalEtcd(t *testing.T) {
+	g := NewWithT(t)
+	_, commands := stubHost(t, func() bool { return true }, nil)
+	manifestPath = filepath.Join(t.TempDir(), "etcd.yaml")
+
+	_, err := Snapshot(context.Background(), SnapshotOptions{RootPath: t.TempDir(), Dir: "opt/etcd-snapshots", Retention: 1, Reason: "upgrade"})
+	g.Expect(err).To(MatchError(ErrNoLocalEtcd))
+	g.Expect(*commands).To(BeEmpty())
+}
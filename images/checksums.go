@@ -0,0 +1,163 @@
+package images
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	// ChecksumsFile lists the sha256 of the archives of a directory in the `sha256sum` format, the
+	// checksum of an OCI layout directory is the one of its index.json.
+	ChecksumsFile = "SHA256SUMS"
+	// SignatureFile is the base64 signature of the checksums file, as written by `cosign sign-blob`.
+	SignatureFile = "SHA256SUMS.sig"
+)
+
+// checksums maps the paths relative to the directory to their sha256.
+type checksums map[string]string
+
+// loadChecksums reads the checksums of the directory, nil if the directory has none. With a public
+// key the checksums file has to be present and signed with it.
+func loadChecksums(dir, publicKey string) (checksums, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ChecksumsFile))
+	if errors.Is(err, os.ErrNotExist) && publicKey == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the image checksums: %w", err)
+	}
+
+	if publicKey != "" {
+		if err = verifySignature(content, filepath.Join(dir, SignatureFile), publicKey); err != nil {
+			return nil, fmt.Errorf("invalid signature of %s: %w", filepath.Join(dir, ChecksumsFile), err)
+		}
+	}
+	return parseChecksums(content)
+}
+
+func parseChecksums(content []byte) (checksums, error) {
+	sums := checksums{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		sum, path, ok := strings.Cut(text, " ")
+		// the binary mode of sha256sum marks the path with a star
+		path = strings.TrimPrefix(strings.TrimSpace(path), "*")
+		if _, err := hex.DecodeString(sum); !ok || err != nil || len(sum) != sha256.Size*2 || path == "" {
+			return nil, fmt.Errorf("invalid line %d of %s: must be a sha256 and a path", line, ChecksumsFile)
+		}
+		sums[filepath.Clean(path)] = strings.ToLower(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// expected returns the checksum the source has to match, an error refuses an unlisted source.
+func (c checksums) expected(dir string, src source) (string, error) {
+	path := src.Path
+	if src.Layout {
+		path = filepath.Join(path, "index.json")
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", err
+	}
+
+	sum, ok := c[rel]
+	if !ok {
+		return "", fmt.Errorf("%s is not listed in %s", rel, ChecksumsFile)
+	}
+	return sum, nil
+}
+
+// verifyChecksum checks the archive, or the index.json of an OCI layout, against its checksum.
+// The blobs of an OCI layout are checked by containerd against the digests the index refers to.
+func verifyChecksum(src source, expected string) error {
+	path := src.Path
+	if src.Layout {
+		path = filepath.Join(path, "index.json")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != expected {
+		return &checksumError{sum: sum, expected: expected}
+	}
+	return nil
+}
+
+// checksumError is returned for a source which does not match its checksum.
+type checksumError struct {
+	sum      string
+	expected string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("sha256 %s does not match the expected %s", e.sum, e.expected)
+}
+
+// verifySignature checks the signature of the content like `cosign verify-blob --key`.
+func verifySignature(content []byte, signaturePath, publicKey string) error {
+	encoded, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("signature must be base64 encoded: %w", err)
+	}
+
+	key, err := utils.ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(content)
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return errors.New("signature does not match the public key")
+		}
+	case *rsa.PublicKey:
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("signature does not match the public key")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, content, signature) {
+			return errors.New("signature does not match the public key")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	return nil
+}
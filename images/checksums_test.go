@@ -0,0 +1,312 @@
+package images
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func publicKeyPEM(t *testing.T, key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// TestParseChecksums tests the parseChecksums function
+func TestParseChecksums(t *testing.T) {
+	g := NewWithT(t)
+
+	sum := sha256Hex([]byte("x"))
+	sums, err := parseChecksums([]byte(fmt.Sprintf("# images\n%s  pause.tar\n%s *./nested/coredns.tar.gz\n\n", sum, strings.ToUpper(sum))))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(sums).To(Equal(checksums{"pause.tar": sum, "nested/coredns.tar.gz": sum}))
+
+	_, err = parseChecksums([]byte("abc  pause.tar\n"))
+	g.Expect(err).To(MatchError("invalid line 1 of SHA256SUMS: must be a sha256 and a path"))
+
+	_, err = parseChecksums([]byte(sum + "\n"))
+	g.Expect(err).To(MatchError("invalid line 1 of SHA256SUMS: must be a sha256 and a path"))
+}
+
+// TestVerifySignature tests the verifySignature function
+func TestVerifySignature(t *testing.T) {
+	content := []byte("checksums")
+	digest := sha256.Sum256(content)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaSignature, err := ecdsa.SignASN1(rand.Reader, ecdsaKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ed25519Public, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		signature     string
+		publicKey     string
+		expectedError string
+	}{
+		{
+			name:      "ecdsa",
+			signature: base64.StdEncoding.EncodeToString(ecdsaSignature) + "\n",
+			publicKey: publicKeyPEM(t, &ecdsaKey.PublicKey),
+		},
+		{
+			name:      "rsa",
+			signature: base64.StdEncoding.EncodeToString(rsaSignature),
+			publicKey: publicKeyPEM(t, &rsaKey.PublicKey),
+		},
+		{
+			name:      "ed25519",
+			signature: base64.StdEncoding.EncodeToString(ed25519.Sign(ed25519Key, content)),
+			publicKey: publicKeyPEM(t, ed25519Public),
+		},
+		{
+			name:          "other_key",
+			signature:     base64.StdEncoding.EncodeToString(ecdsaSignature),
+			publicKey:     publicKeyPEM(t, &otherKey.PublicKey),
+			expectedError: "signature does not match the public key",
+		},
+		{
+			name:          "not_base64",
+			signature:     "not base64!",
+			publicKey:     publicKeyPEM(t, &ecdsaKey.PublicKey),
+			expectedError: "signature must be base64 encoded: illegal base64 data at input byte 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			path := filepath.Join(t.TempDir(), SignatureFile)
+			g.Expect(os.WriteFile(path, []byte(tt.signature), 0644)).To(Succeed())
+
+			err := verifySignature(content, path, tt.publicKey)
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(tt.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+// TestImportChecksums tests that Import refuses the archives which fail their verification
+func TestImportChecksums(t *testing.T) {
+	pause := tarball("blobs", "pause")
+	coreDNS := tarball("blobs", "coredns")
+	index := []byte(`{}`)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(content string) string {
+		digest := sha256.Sum256([]byte(content))
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(signature)
+	}
+
+	validSums := fmt.Sprintf("%s  pause.tar\n%s  coredns.tar\n%s  layout/index.json\n", sha256Hex(pause), sha256Hex(coreDNS), sha256Hex(index))
+
+	tests := []struct {
+		name             string
+		sums             string
+		signature        string
+		publicKey        bool
+		expectedImported []string
+		expectedError    string
+	}{
+		{
+			name:             "valid_checksums",
+			sums:             validSums,
+			expectedImported: []string{"docker.io/library/coredns:latest", "docker.io/library/oci-layout:latest", "docker.io/library/pause:latest"},
+		},
+		{
+			name:             "mismatch_and_unlisted_archives_are_refused",
+			sums:             fmt.Sprintf("%s  pause.tar\n%s  layout/index.json\n", sha256Hex(coreDNS), sha256Hex(index)),
+			expectedImported: []string{"docker.io/library/oci-layout:latest"},
+			expectedError: fmt.Sprintf("refusing DIR/coredns.tar: coredns.tar is not listed in SHA256SUMS\nrefusing DIR/pause.tar: sha256 %s does not match the expected %s",
+				sha256Hex(pause), sha256Hex(coreDNS)),
+		},
+		{
+			name:             "signed_checksums",
+			sums:             validSums,
+			signature:        sign(validSums),
+			publicKey:        true,
+			expectedImported: []string{"docker.io/library/coredns:latest", "docker.io/library/oci-layout:latest", "docker.io/library/pause:latest"},
+		},
+		{
+			name:          "tampered_checksums",
+			sums:          validSums + sha256Hex([]byte("other")) + "  other.tar\n",
+			signature:     sign(validSums),
+			publicKey:     true,
+			expectedError: "refusing the images of DIR: invalid signature of DIR/SHA256SUMS: signature does not match the public key",
+		},
+		{
+			name:          "missing_checksums_with_public_key",
+			publicKey:     true,
+			expectedError: "refusing the images of DIR: failed to read the image checksums: open DIR/SHA256SUMS: no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rootPath := t.TempDir()
+			dir := filepath.Join(t.TempDir(), "images")
+			for name, content := range map[string][]byte{
+				"pause.tar":         pause,
+				"coredns.tar":       coreDNS,
+				"layout/oci-layout": []byte(`{"imageLayoutVersion":"1.0.0"}`),
+				"layout/index.json": index,
+			} {
+				path := filepath.Join(dir, name)
+				g.Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				g.Expect(os.WriteFile(path, content, 0644)).To(Succeed())
+			}
+			if tt.sums != "" {
+				g.Expect(os.WriteFile(filepath.Join(dir, ChecksumsFile), []byte(tt.sums), 0644)).To(Succeed())
+			}
+			if tt.signature != "" {
+				g.Expect(os.WriteFile(filepath.Join(dir, SignatureFile), []byte(tt.signature), 0644)).To(Succeed())
+			}
+
+			opts := Options{RootPath: rootPath, Dir: dir, Concurrency: 2}
+			if tt.publicKey {
+				opts.PublicKey = filepath.Join(rootPath, "cosign.pub")
+				g.Expect(os.WriteFile(opts.PublicKey, []byte(publicKeyPEM(t, &key.PublicKey)), 0644)).To(Succeed())
+			}
+
+			store := &fakeStore{images: map[string]string{}}
+			stub(t, store)
+
+			err := Import(context.Background(), opts)
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(strings.ReplaceAll(tt.expectedError, "DIR", dir)))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			g.Expect(store.imported).To(ConsistOf(tt.expectedImported))
+
+			manifest, err := readManifest(filepath.Join(rootPath, ManifestFile))
+			g.Expect(err).ToNot(HaveOccurred())
+			for _, archive := range manifest.Archives {
+				g.Expect(archive.SHA256).ToNot(BeEmpty())
+			}
+		})
+	}
+}
+
+// TestImportOnceChecksum tests that importOnce checks the stream it imported and removes the images of a mismatch
+func TestImportOnceChecksum(t *testing.T) {
+	pause := tarball("blobs", "pause")
+	compressed := gzipped(pause)
+	index := []byte(`{}`)
+
+	tests := []struct {
+		name     string
+		files    map[string][]byte
+		path     string
+		layout   bool
+		expected string
+	}{
+		{
+			name:     "archive",
+			files:    map[string][]byte{"pause.tar": pause},
+			path:     "pause.tar",
+			expected: sha256Hex(pause),
+		},
+		{
+			name:     "compressed_archive",
+			files:    map[string][]byte{"pause.tar.gz": compressed},
+			path:     "pause.tar.gz",
+			expected: sha256Hex(compressed),
+		},
+		{
+			name:     "layout",
+			files:    map[string][]byte{"layout/oci-layout": []byte(`{"imageLayoutVersion":"1.0.0"}`), "layout/index.json": index},
+			path:     "layout",
+			layout:   true,
+			expected: sha256Hex(index),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				g.Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				g.Expect(os.WriteFile(path, content, 0644)).To(Succeed())
+			}
+			src := source{Path: filepath.Join(dir, tt.path), Layout: tt.layout}
+
+			store := &fakeStore{images: map[string]string{}}
+			imgs, err := importOnce(context.Background(), store, src, tt.expected)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(imgs).To(HaveLen(1))
+			g.Expect(store.images).To(HaveKey(imgs[0].Name))
+
+			// a source changed after verifyChecksum
+			store = &fakeStore{images: map[string]string{}}
+			other := sha256Hex([]byte("other"))
+			_, err = importOnce(context.Background(), store, src, other)
+			g.Expect(err).To(MatchError(fmt.Sprintf("sha256 %s does not match the expected %s", tt.expected, other)))
+			g.Expect(store.imported).To(HaveLen(1))
+			g.Expect(store.images).To(BeEmpty())
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package images
+
+import (
+	"context"
+	"io"
+	"time"
+
+	containerd "github.com/containerd/containerd/v2/client"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	containerdSocket    = "/run/containerd/containerd.sock"
+	containerdNamespace = "k8s.io"
+	connectTimeout      = 30 * time.Second
+)
+
+// containerdStore imports the images like `ctr -n k8s.io image import --all-platforms`, unpacking
+// them for the node platform into the default snapshotter.
+type containerdStore struct {
+	client *containerd.Client
+}
+
+func connectContainerd(_ context.Context) (Store, error) {
+	address := containerdSocket
+	if utils.SpectroContainerd() {
+		address = utils.SpectroContainerdSocket
+	}
+
+	client, err := containerd.New(address, containerd.WithDefaultNamespace(containerdNamespace), containerd.WithTimeout(connectTimeout))
+	if err != nil {
+		return nil, err
+	}
+	return &containerdStore{client: client}, nil
+}
+
+func (s *containerdStore) Import(ctx context.Context, r io.Reader) ([]Image, error) {
+	imported, err := s.client.Import(ctx, r, containerd.WithAllPlatforms(true))
+	if err != nil {
+		return nil, err
+	}
+
+	imgs := make([]Image, 0, len(imported))
+	for _, img := range imported {
+		if err = containerd.NewImageWithPlatform(s.client, img, platforms.DefaultStrict()).Unpack(ctx, ""); err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, Image{Name: img.Name, Digest: img.Target.Digest.String()})
+	}
+	return imgs, nil
+}
+
+func (s *containerdStore) Digest(ctx context.Context, name string) (string, error) {
+	img, err := s.client.ImageService().Get(ctx, name)
+	if errdefs.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return img.Target.Digest.String(), nil
+}
+
+func (s *containerdStore) Delete(ctx context.Context, name string) error {
+	return s.client.ImageService().Delete(ctx, name)
+}
+
+func (s *containerdStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,518 @@
+package images
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/v2/pkg/archive/compression"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+const (
+	// Command is the provider subcommand that imports the images of a directory into containerd.
+	Command = "images-import"
+
+	// ManifestFile is written under the cluster root path.
+	ManifestFile = "opt/kubeadm/images.json"
+
+	DefaultConcurrency = 4
+
+	importAttempts = 3
+)
+
+// Options configures an image import.
+type Options struct {
+	RootPath string
+	// Dir is searched for image archives and OCI layout directories.
+	Dir         string
+	Concurrency int
+	// PublicKey is the path of the PEM key the checksums of the directory have to be signed with.
+	PublicKey string
+}
+
+// Manifest records the images loaded from each archive, so that unchanged archives whose images
+// are still in containerd are skipped.
+type Manifest struct {
+	Archives []Archive `json:"archives"`
+}
+
+// Archive is an image archive or OCI layout directory, an OCI layout is identified by its index.json.
+type Archive struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	ImportedAt time.Time `json:"importedAt"`
+	Images     []Image   `json:"images"`
+	// SHA256 is the verified checksum of the archive, empty if the directory has no checksums.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Image is an image loaded into containerd, Digest is the digest of its manifest or index.
+type Image struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+// Store is the containerd image store of the k8s.io namespace.
+type Store interface {
+	// Import loads and unpacks the images of an archive stream.
+	Import(ctx context.Context, r io.Reader) ([]Image, error)
+	// Digest returns the digest of the named image, or an empty string if it is not present.
+	Digest(ctx context.Context, name string) (string, error)
+	// Delete removes the named image.
+	Delete(ctx context.Context, name string) error
+	Close() error
+}
+
+// stubbed in tests
+var (
+	connect = connectContainerd
+	sleep   = time.Sleep
+	now     = time.Now
+)
+
+// Args returns the provider arguments that import the images with the given options.
+func Args(opts Options) []string {
+	args := []string{
+		Command,
+		"--root-path", opts.RootPath,
+		"--dir", opts.Dir,
+		"--concurrency", strconv.Itoa(opts.Concurrency),
+	}
+	if opts.PublicKey != "" {
+		args = append(args, "--public-key", opts.PublicKey)
+	}
+	return args
+}
+
+// ParseArgs parses the arguments following the Command.
+func ParseArgs(args []string) (Options, error) {
+	var opts Options
+
+	fs := flag.NewFlagSet(Command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.StringVar(&opts.Dir, "dir", "", "directory of the image archives")
+	fs.IntVar(&opts.Concurrency, "concurrency", DefaultConcurrency, "archives imported in parallel")
+	fs.StringVar(&opts.PublicKey, "public-key", "", "key the checksums have to be signed with")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if opts.Dir == "" {
+		return opts, errors.New("dir is required")
+	}
+	if opts.Concurrency < 1 {
+		return opts, fmt.Errorf("invalid concurrency %d, must be positive", opts.Concurrency)
+	}
+	return opts, nil
+}
+
+// Import loads the `.tar`, `.tar.gz`, `.tgz` and `.tar.zst` archives and the OCI layout directories
+// under the directory into containerd, a missing directory has nothing to import. Archives which
+// did not change since they were imported are skipped while containerd still holds their images
+// at the recorded digests. The images loaded from the directory are recorded in the manifest.
+//
+// When the directory holds a checksums file, or a public key is given, an archive is only imported
+// if it matches its checksum, and the checksums file is signed with the key. Other archives are
+// refused before they reach containerd.
+func Import(ctx context.Context, opts Options) error {
+	sources, err := findSources(opts.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		logrus.Infof("no images to import, %s does not exist", opts.Dir)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var publicKey string
+	if opts.PublicKey != "" {
+		content, err := os.ReadFile(opts.PublicKey)
+		if err != nil {
+			return fmt.Errorf("failed to read the public key: %w", err)
+		}
+		publicKey = string(content)
+	}
+	sums, err := loadChecksums(opts.Dir, publicKey)
+	if err != nil {
+		return fmt.Errorf("refusing the images of %s: %w", opts.Dir, err)
+	}
+
+	manifestPath := filepath.Join(opts.RootPath, ManifestFile)
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		logrus.Warnf("discarding unreadable image manifest: %v", err)
+	}
+
+	store, err := connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to containerd: %w", err)
+	}
+	defer store.Close()
+
+	results := make([]*Archive, len(sources))
+	errs := make([]error, len(sources))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(opts.Concurrency, 1))
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i], errs[i] = importSource(ctx, store, source, manifest.archive(source.Path), opts.Dir, sums)
+		}()
+	}
+	wg.Wait()
+
+	// the archives of other directories keep their entries
+	var archives []Archive
+	for _, archive := range manifest.Archives {
+		if !isUnder(archive.Path, opts.Dir) {
+			archives = append(archives, archive)
+		}
+	}
+	for _, archive := range results {
+		if archive != nil {
+			archives = append(archives, *archive)
+		}
+	}
+	if err = writeManifest(manifestPath, Manifest{Archives: archives}); err != nil {
+		errs = append(errs, fmt.Errorf("failed to write image manifest: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+type source struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// Layout is set for an OCI layout directory.
+	Layout bool
+}
+
+func importSource(ctx context.Context, store Store, src source, previous *Archive, dir string, sums checksums) (*Archive, error) {
+	var sum string
+	if sums != nil {
+		var err error
+		if sum, err = sums.expected(dir, src); err != nil {
+			logrus.Errorf("refusing %s: %v", src.Path, err)
+			return nil, fmt.Errorf("refusing %s: %w", src.Path, err)
+		}
+	}
+
+	if previous != nil && previous.Size == src.Size && previous.ModTime.Equal(src.ModTime) && previous.SHA256 == sum && present(ctx, store, previous.Images) {
+		logrus.Infof("skipping %s, its images are present", src.Path)
+		return previous, nil
+	}
+
+	if sum != "" {
+		if err := verifyChecksum(src, sum); err != nil {
+			logrus.Errorf("refusing %s: %v", src.Path, err)
+			return nil, fmt.Errorf("refusing %s: %w", src.Path, err)
+		}
+	}
+
+	var imgs []Image
+	var err error
+	for attempt := 1; attempt <= importAttempts; attempt++ {
+		if imgs, err = importOnce(ctx, store, src, sum); err == nil {
+			break
+		}
+		var mismatch *checksumError
+		if errors.As(err, &mismatch) {
+			logrus.Errorf("refusing %s: %v", src.Path, err)
+			return nil, fmt.Errorf("refusing %s: %w", src.Path, err)
+		}
+		logrus.Errorf("failed to import %s (attempt %d): %v", src.Path, attempt, err)
+		if attempt < importAttempts {
+			sleep(time.Second)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s: %w", src.Path, err)
+	}
+
+	if len(imgs) == 0 {
+		logrus.Warnf("no image imported from %s, its images might be filtered out", src.Path)
+	}
+	for _, img := range imgs {
+		logrus.Infof("imported %s@%s from %s", img.Name, img.Digest, src.Path)
+	}
+	return &Archive{
+		Path:       src.Path,
+		Size:       src.Size,
+		ModTime:    src.ModTime,
+		SHA256:     sum,
+		ImportedAt: now().UTC(),
+		Images:     imgs,
+	}, nil
+}
+
+// importOnce imports the source. With an expected checksum the stream it imported is hashed, so
+// that a source changed after verifyChecksum is refused, and the images imported from it removed.
+func importOnce(ctx context.Context, store Store, src source, expected string) ([]Image, error) {
+	h := sha256.New()
+
+	// the checksum covers the bytes read from stream, r is the archive imported from it
+	var stream, r io.Reader
+	if src.Layout {
+		layout := tarLayout(src.Path, h)
+		defer layout.Close()
+		stream, r = layout, layout
+	} else {
+		f, err := os.Open(src.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		stream = io.TeeReader(f, h)
+		decompressed, err := compression.DecompressStream(stream)
+		if err != nil {
+			return nil, err
+		}
+		defer decompressed.Close()
+		r = decompressed
+	}
+
+	imgs, err := store.Import(ctx, r)
+	if err != nil || expected == "" {
+		return imgs, err
+	}
+
+	// hash the rest of the stream the import did not read, the decompressor reads it first
+	if _, err = io.Copy(io.Discard, r); err == nil {
+		_, err = io.Copy(io.Discard, stream)
+	}
+	if err == nil {
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != expected {
+			err = &checksumError{sum: sum, expected: expected}
+		}
+	}
+	if err != nil {
+		return nil, errors.Join(err, removeImages(ctx, store, imgs))
+	}
+	return imgs, nil
+}
+
+func removeImages(ctx context.Context, store Store, imgs []Image) error {
+	var errs []error
+	for _, img := range imgs {
+		if err := store.Delete(ctx, img.Name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove image %s: %w", img.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// present reports whether containerd holds every image at its recorded digest.
+func present(ctx context.Context, store Store, imgs []Image) bool {
+	if len(imgs) == 0 {
+		return false
+	}
+	for _, img := range imgs {
+		digest, err := store.Digest(ctx, img.Name)
+		if err != nil {
+			logrus.Warnf("failed to look up image %s: %v", img.Name, err)
+			return false
+		}
+		if digest != img.Digest {
+			return false
+		}
+	}
+	return true
+}
+
+// findSources returns the archives and OCI layout directories under the directory, following
+// symlinks like `find -L`.
+func findSources(dir string) ([]source, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	var sources []source
+	visited := map[string]bool{}
+
+	var walk func(string) error
+	walk = func(dir string) error {
+		// symlinked directories may form a cycle
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			if visited[real] {
+				return nil
+			}
+			visited[real] = true
+		}
+
+		if index, err := os.Stat(filepath.Join(dir, "index.json")); err == nil && isFile(filepath.Join(dir, "oci-layout")) {
+			sources = append(sources, source{Path: dir, Size: index.Size(), ModTime: index.ModTime(), Layout: true})
+			return nil
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			info, err := os.Stat(path)
+			if err != nil {
+				logrus.Warnf("skipping %s: %v", path, err)
+				continue
+			}
+			if info.IsDir() {
+				if err = walk(path); err != nil {
+					return err
+				}
+				continue
+			}
+			if isArchive(entry.Name()) && info.Mode().IsRegular() {
+				sources = append(sources, source{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+			}
+		}
+		return nil
+	}
+
+	if err = walk(dir); err != nil {
+		return nil, err
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Path < sources[j].Path })
+	return sources, nil
+}
+
+func isArchive(name string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".tar.zst"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// tarLayout streams an OCI layout directory as an OCI archive, the content of its index.json is
+// also written to index.
+func tarLayout(dir string, index io.Writer) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || path == dir {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(rel)
+			if err = tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			var w io.Writer = tw
+			if header.Name == "index.json" {
+				w = io.MultiWriter(tw, index)
+			}
+			_, err = io.Copy(w, f)
+			return err
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+func readManifest(path string) (Manifest, error) {
+	var manifest Manifest
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+func writeManifest(path string, manifest Manifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that readers never see a partial manifest
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (m Manifest) archive(path string) *Archive {
+	for i := range m.Archives {
+		if m.Archives[i].Path == path {
+			return &m.Archives[i]
+		}
+	}
+	return nil
+}
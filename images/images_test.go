@@ -0,0 +1,264 @@
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// fakeStore holds the images by name, an imported archive holds one image named after its content.
+type fakeStore struct {
+	mu       sync.Mutex
+	images   map[string]string
+	imported []string
+	failures int
+}
+
+func (s *fakeStore) Import(_ context.Context, r io.Reader) ([]Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("connection reset")
+	}
+
+	tr := tar.NewReader(r)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+
+	name := "docker.io/library/" + filepath.Base(names[len(names)-1]) + ":latest"
+	img := Image{Name: name, Digest: "sha256:" + filepath.Base(names[0])}
+	s.images[img.Name] = img.Digest
+	s.imported = append(s.imported, img.Name)
+	return []Image{img}, nil
+}
+
+func (s *fakeStore) Digest(_ context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.images[name], nil
+}
+
+func (s *fakeStore) Delete(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.images, name)
+	return nil
+}
+
+func (s *fakeStore) Close() error {
+	return nil
+}
+
+func stub(t *testing.T, store *fakeStore) {
+	originalConnect, originalSleep, originalNow := connect, sleep, now
+	t.Cleanup(func() {
+		connect, sleep, now = originalConnect, originalSleep, originalNow
+	})
+
+	connect = func(context.Context) (Store, error) { return store, nil }
+	sleep = func(time.Duration) {}
+	now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }
+}
+
+func tarball(names ...string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 1})
+		_, _ = tw.Write([]byte("x"))
+	}
+	_ = tw.Close()
+	return buf.Bytes()
+}
+
+func gzipped(content []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(content)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// TestArgs tests the Args and ParseArgs functions
+func TestArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	opts := Options{RootPath: "/persistent/spectro", Dir: "/opt/content/images", Concurrency: 2}
+	args := Args(opts)
+	g.Expect(args).To(Equal([]string{"images-import", "--root-path", "/persistent/spectro", "--dir", "/opt/content/images", "--concurrency", "2"}))
+
+	parsed, err := ParseArgs(args[1:])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(parsed).To(Equal(opts))
+
+	_, err = ParseArgs([]string{"--root-path", "/"})
+	g.Expect(err).To(MatchError("dir is required"))
+
+	_, err = ParseArgs([]string{"--dir", "/opt/kube-images", "--concurrency", "0"})
+	g.Expect(err).To(MatchError("invalid concurrency 0, must be positive"))
+}
+
+// TestImport tests the Import function
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name             string
+		files            map[string][]byte
+		storeImages      map[string]string
+		failures         int
+		previous         []Archive
+		expectedImported []string
+		expectedArchives []string
+		expectedError    string
+	}{
+		{
+			name: "archives_and_oci_layout",
+			files: map[string][]byte{
+				"kube-apiserver.tar":    tarball("blobs", "kube-apiserver"),
+				"pause.tar.gz":          gzipped(tarball("blobs", "pause")),
+				"nested/coredns.tgz":    gzipped(tarball("blobs", "coredns")),
+				"layout/oci-layout":     []byte(`{"imageLayoutVersion":"1.0.0"}`),
+				"layout/index.json":     []byte(`{}`),
+				"layout/blobs/sha256/a": []byte("a"),
+				"README.md":             []byte("not an archive"),
+			},
+			expectedImported: []string{
+				"docker.io/library/coredns:latest",
+				"docker.io/library/kube-apiserver:latest",
+				"docker.io/library/oci-layout:latest",
+				"docker.io/library/pause:latest",
+			},
+			expectedArchives: []string{"kube-apiserver.tar", "layout", "nested/coredns.tgz", "pause.tar.gz"},
+		},
+		{
+			name:  "unchanged_archive_with_present_images_is_skipped",
+			files: map[string][]byte{"pause.tar": tarball("blobs", "pause")},
+			storeImages: map[string]string{
+				"docker.io/library/pause:latest": "sha256:blobs",
+			},
+			previous: []Archive{
+				{Path: "pause.tar", Images: []Image{{Name: "docker.io/library/pause:latest", Digest: "sha256:blobs"}}},
+				{Path: "/opt/content/images/app.tar", Images: []Image{{Name: "docker.io/library/app:latest", Digest: "sha256:app"}}},
+				{Path: "removed.tar"},
+			},
+			expectedArchives: []string{"/opt/content/images/app.tar", "pause.tar"},
+		},
+		{
+			name:  "archive_is_reimported_when_its_image_changed",
+			files: map[string][]byte{"pause.tar": tarball("blobs", "pause")},
+			storeImages: map[string]string{
+				"docker.io/library/pause:latest": "sha256:other",
+			},
+			previous: []Archive{
+				{Path: "pause.tar", Images: []Image{{Name: "docker.io/library/pause:latest", Digest: "sha256:blobs"}}},
+			},
+			expectedImported: []string{"docker.io/library/pause:latest"},
+			expectedArchives: []string{"pause.tar"},
+		},
+		{
+			name:             "failed_import_is_retried",
+			files:            map[string][]byte{"pause.tar": tarball("blobs", "pause")},
+			failures:         2,
+			expectedImported: []string{"docker.io/library/pause:latest"},
+			expectedArchives: []string{"pause.tar"},
+		},
+		{
+			name:          "failed_import_is_reported",
+			files:         map[string][]byte{"pause.tar": tarball("blobs", "pause")},
+			failures:      3,
+			expectedError: "failed to import DIR/pause.tar: connection reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rootPath := t.TempDir()
+			dir := filepath.Join(t.TempDir(), "images")
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				g.Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+				g.Expect(os.WriteFile(path, content, 0644)).To(Succeed())
+			}
+
+			// previous entries are relative to the directory unless absolute
+			var previous []Archive
+			for _, archive := range tt.previous {
+				if !filepath.IsAbs(archive.Path) {
+					archive.Path = filepath.Join(dir, archive.Path)
+					if info, err := os.Stat(archive.Path); err == nil {
+						archive.Size, archive.ModTime = info.Size(), info.ModTime()
+					}
+				}
+				previous = append(previous, archive)
+			}
+			g.Expect(writeManifest(filepath.Join(rootPath, ManifestFile), Manifest{Archives: previous})).To(Succeed())
+
+			store := &fakeStore{images: map[string]string{}, failures: tt.failures}
+			for name, digest := range tt.storeImages {
+				store.images[name] = digest
+			}
+			stub(t, store)
+
+			err := Import(context.Background(), Options{RootPath: rootPath, Dir: dir, Concurrency: 2})
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(strings.ReplaceAll(tt.expectedError, "DIR", dir)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			sort.Strings(store.imported)
+			g.Expect(store.imported).To(Equal(tt.expectedImported))
+
+			manifest, err := readManifest(filepath.Join(rootPath, ManifestFile))
+			g.Expect(err).ToNot(HaveOccurred())
+			var paths []string
+			for _, archive := range manifest.Archives {
+				path := archive.Path
+				if isUnder(path, dir) {
+					path, _ = filepath.Rel(dir, path)
+				}
+				paths = append(paths, path)
+				g.Expect(archive.Images).ToNot(BeEmpty())
+			}
+			sort.Strings(paths)
+			g.Expect(paths).To(Equal(tt.expectedArchives))
+		})
+	}
+}
+
+// TestImportMissingDir tests the Import function without a directory to import
+func TestImportMissingDir(t *testing.T) {
+	g := NewWithT(t)
+
+	stub(t, nil)
+	connect = func(context.Context) (Store, error) { return nil, errors.New("containerd is not running") }
+
+	rootPath := t.TempDir()
+	g.Expect(Import(context.Background(), Options{RootPath: rootPath, Dir: filepath.Join(rootPath, "missing"), Concurrency: 1})).To(Succeed())
+	g.Expect(filepath.Join(rootPath, ManifestFile)).ToNot(BeAnExistingFile())
+}
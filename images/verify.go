@@ -0,0 +1,175 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	// VerifyCommand is the provider subcommand that checks that containerd holds the images kubeadm needs.
+	VerifyCommand = "images-verify"
+
+	// VerifyConfigFile is the cluster configuration the image list is computed from, it is written
+	// under the cluster root path.
+	VerifyConfigFile = "opt/kubeadm/images-config.yaml"
+)
+
+// VerifyOptions configures an image verification.
+type VerifyOptions struct {
+	RootPath string
+	NodeRole string
+	// Config is read by `kubeadm config images list`.
+	Config string
+	// Images are required on top of the kubeadm images, e.g. the kube-vip image.
+	Images []string
+}
+
+// stubbed in tests
+var listKubeadmImages = func(rootPath, config string) ([]string, error) {
+	kubeadm, err := utils.FindKubeadmBinary(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(kubeadm, "config", "images", "list", "--config", config)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubeadm config images list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// VerifyArgs returns the provider arguments that verify the images with the given options.
+func VerifyArgs(opts VerifyOptions) []string {
+	args := []string{
+		VerifyCommand,
+		"--root-path", opts.RootPath,
+		"--role", opts.NodeRole,
+		"--config", opts.Config,
+	}
+	if len(opts.Images) > 0 {
+		args = append(args, "--images", strings.Join(opts.Images, ","))
+	}
+	return args
+}
+
+// ParseVerifyArgs parses the arguments following the VerifyCommand.
+func ParseVerifyArgs(args []string) (VerifyOptions, error) {
+	var opts VerifyOptions
+	var images string
+
+	fs := flag.NewFlagSet(VerifyCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.StringVar(&opts.NodeRole, "role", "", "node role")
+	fs.StringVar(&opts.Config, "config", "", "kubeadm cluster configuration")
+	fs.StringVar(&images, "images", "", "comma separated images required on top of the kubeadm images")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if opts.NodeRole == "" {
+		return opts, errors.New("role is required")
+	}
+	if opts.Config == "" {
+		return opts, errors.New("config is required")
+	}
+	if images != "" {
+		opts.Images = strings.Split(images, ",")
+	}
+	return opts, nil
+}
+
+// Verify checks that containerd holds every image the node needs before kubeadm runs, so that an
+// air-gapped node fails on the missing images instead of inside kubeadm. The image import stages
+// run first, containerd then holds the images of the local archives.
+func Verify(ctx context.Context, opts VerifyOptions) error {
+	required, err := requiredImages(opts)
+	if err != nil {
+		return err
+	}
+
+	store, err := connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to containerd: %w", err)
+	}
+	defer store.Close()
+
+	var missing []string
+	for _, image := range required {
+		digest, err := store.Digest(ctx, image)
+		if err != nil {
+			return fmt.Errorf("failed to look up image %s: %w", image, err)
+		}
+		if digest == "" {
+			missing = append(missing, image)
+			continue
+		}
+		logrus.Infof("found %s@%s", image, digest)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %d of %d required images, add them to the image archives: %s", len(missing), len(required), strings.Join(missing, ", "))
+	}
+	logrus.Infof("all %d required images are present", len(required))
+	return nil
+}
+
+// requiredImages returns the normalized references of the kubeadm images for the node role and of
+// the additional images. Worker nodes only run the pause and kube-proxy images.
+func requiredImages(opts VerifyOptions) ([]string, error) {
+	listed, err := listKubeadmImages(opts.RootPath, opts.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var required []string
+	seen := map[string]bool{}
+	add := func(image string, kubeadm bool) error {
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			return fmt.Errorf("invalid image %q: %w", image, err)
+		}
+		if kubeadm && opts.NodeRole == clusterplugin.RoleWorker {
+			if name := path.Base(reference.Path(named)); name != "pause" && name != "kube-proxy" {
+				return nil
+			}
+		}
+
+		normalized := reference.TagNameOnly(named).String()
+		if !seen[normalized] {
+			seen[normalized] = true
+			required = append(required, normalized)
+		}
+		return nil
+	}
+
+	for _, image := range listed {
+		if err = add(image, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, image := range opts.Images {
+		if err = add(image, false); err != nil {
+			return nil, err
+		}
+	}
+	return required, nil
+}
@@ -0,0 +1,99 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+var kubeadmImages = []string{
+	"registry.k8s.io/kube-apiserver:v1.33.2",
+	"registry.k8s.io/kube-controller-manager:v1.33.2",
+	"registry.k8s.io/kube-scheduler:v1.33.2",
+	"registry.k8s.io/kube-proxy:v1.33.2",
+	"registry.k8s.io/coredns/coredns:v1.12.0",
+	"registry.k8s.io/pause:3.10",
+	"registry.k8s.io/etcd:3.5.21-0",
+}
+
+// TestVerifyArgs tests the VerifyArgs and ParseVerifyArgs functions
+func TestVerifyArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	opts := VerifyOptions{RootPath: "/", NodeRole: "init", Config: "/opt/kubeadm/images-config.yaml", Images: []string{"ghcr.io/kube-vip/kube-vip:v0.8.9"}}
+	args := VerifyArgs(opts)
+	g.Expect(args).To(Equal([]string{"images-verify", "--root-path", "/", "--role", "init", "--config", "/opt/kubeadm/images-config.yaml", "--images", "ghcr.io/kube-vip/kube-vip:v0.8.9"}))
+
+	parsed, err := ParseVerifyArgs(args[1:])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(parsed).To(Equal(opts))
+
+	_, err = ParseVerifyArgs([]string{"--role", "init"})
+	g.Expect(err).To(MatchError("config is required"))
+}
+
+// TestVerify tests the Verify function
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name          string
+		nodeRole      string
+		extra         []string
+		present       []string
+		listError     error
+		expectedError string
+	}{
+		{
+			name:     "all_present",
+			nodeRole: "init",
+			extra:    []string{"ghcr.io/kube-vip/kube-vip:v0.8.9"},
+			present:  append([]string{"ghcr.io/kube-vip/kube-vip:v0.8.9"}, kubeadmImages...),
+		},
+		{
+			name:          "missing_images",
+			nodeRole:      "controlplane",
+			extra:         []string{"kube-vip/kube-vip"},
+			present:       kubeadmImages[:5],
+			expectedError: "missing 3 of 8 required images, add them to the image archives: registry.k8s.io/pause:3.10, registry.k8s.io/etcd:3.5.21-0, docker.io/kube-vip/kube-vip:latest",
+		},
+		{
+			name:     "worker_only_needs_pause_and_kube_proxy",
+			nodeRole: "worker",
+			present:  []string{"registry.k8s.io/kube-proxy:v1.33.2", "registry.k8s.io/pause:3.10"},
+		},
+		{
+			name:          "kubeadm_fails",
+			nodeRole:      "init",
+			listError:     errors.New("unknown apiVersion"),
+			expectedError: "unknown apiVersion",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			store := &fakeStore{images: map[string]string{}}
+			for _, image := range tt.present {
+				store.images[image] = "sha256:" + image
+			}
+			stub(t, store)
+
+			originalList := listKubeadmImages
+			t.Cleanup(func() { listKubeadmImages = originalList })
+			listKubeadmImages = func(rootPath, config string) ([]string, error) {
+				g.Expect(rootPath).To(Equal("/"))
+				g.Expect(config).To(Equal("/opt/kubeadm/images-config.yaml"))
+				return kubeadmImages, tt.listError
+			}
+
+			err := Verify(context.Background(), VerifyOptions{RootPath: "/", NodeRole: tt.nodeRole, Config: "/opt/kubeadm/images-config.yaml", Images: tt.extra})
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(tt.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package kubeadm
+
+import (
+	"bytes"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/printers"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
+	bootstraptokenv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/bootstraptoken/v1"
+	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+var (
+	scheme = runtime.NewScheme()
+)
+
+func init() {
+	_ = kubeadmapiv3.AddToScheme(scheme)
+	_ = kubeadmapiv4.AddToScheme(scheme)
+	_ = kubeletv1beta1.AddToScheme(scheme)
+}
+
+// API is implemented once per kubeadm configuration API version. An implementation
+// holds the user configuration for a single node and renders every kubeadm file from it.
+type API interface {
+	// Version returns the kubeadm API group version, e.g. kubeadm.k8s.io/v1beta4.
+	Version() string
+
+	// ParseUserOptions strictly decodes and validates the cluster `config` block.
+	ParseUserOptions(options string) error
+
+	// Networking returns the service and pod subnets of the cluster configuration.
+	Networking() (serviceSubnet, podSubnet string)
+
+	// ApplyDefaults mutates the configuration with the provider defaults.
+	ApplyDefaults(clusterCtx *domain.ClusterContext)
+
+	KubeletArgs(nodeRole string) string
+	CertSANs() []string
+	NodeIP(nodeRole string) string
+	// IgnorePreflightErrors returns the preflight errors ignored by the node registration.
+	IgnorePreflightErrors(nodeRole string) []string
+
+	InitConfig(clusterCtx *domain.ClusterContext) string
+	JoinConfig(clusterCtx *domain.ClusterContext) string
+	ClusterConfig(nodeRole string) string
+	KubeletConfig() string
+	// ImagesConfig returns the cluster configuration `kubeadm config images list` reads.
+	ImagesConfig() string
+
+	// Drain returns the `drain` block of the cluster config.
+	Drain() domain.DrainConfiguration
+	// EtcdBackup returns the `etcdBackup` block of the cluster config, nil if backups are disabled.
+	EtcdBackup() *domain.EtcdBackupConfiguration
+	// CertificateRenewal returns the `certificateRenewal` block of the cluster config.
+	CertificateRenewal() domain.CertificateRenewalConfiguration
+	// ExternalEtcd returns the `externalEtcd` block of the cluster config, or the endpoints of
+	// clusterConfiguration.etcd.external. It is nil for a local etcd.
+	ExternalEtcd() *domain.ExternalEtcdConfiguration
+	// Registries returns the `registries` block of the cluster config.
+	Registries() []domain.RegistryConfiguration
+	// CustomCertificatesDir reports whether clusterConfiguration.certificatesDir differs from the
+	// kubeadm default. The provider only installs the user provided CAs into the default directory.
+	CustomCertificatesDir() bool
+	// Containerd returns the `containerd` block of the cluster config with the provider defaults.
+	// It is nil if the block is not set, the containerd config of the image is then kept.
+	Containerd(clusterCtx *domain.ClusterContext) *domain.ContainerdConfiguration
+}
+
+// now is stubbed in tests to pin the bootstrap token rotation period.
+var now = time.Now
+
+func bootstrapToken(clusterCtx *domain.ClusterContext) (string, time.Duration) {
+	return utils.GetBootstrapToken(clusterCtx.ClusterToken, clusterCtx.BootstrapTokenTTL, now())
+}
+
+// bootstrapTokens returns the bootstrap tokens created by kubeadm init: the token of the current
+// rotation period and, if the token is rotated, the token of the next one.
+func bootstrapTokens(clusterCtx *domain.ClusterContext) []bootstraptokenv1.BootstrapToken {
+	var tokens []bootstraptokenv1.BootstrapToken
+
+	token, tokenTTL := bootstrapToken(clusterCtx)
+	nextToken, nextTokenTTL := utils.GetNextBootstrapToken(clusterCtx.ClusterToken, clusterCtx.BootstrapTokenTTL, now())
+	for _, t := range []struct {
+		token string
+		ttl   time.Duration
+	}{{token, tokenTTL}, {nextToken, nextTokenTTL}} {
+		if t.token == "" {
+			continue
+		}
+		substrs := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(t.token)
+		tokens = append(tokens, bootstraptokenv1.BootstrapToken{
+			Token: &bootstraptokenv1.BootstrapTokenString{
+				ID:     substrs[1],
+				Secret: substrs[2],
+			},
+			TTL: &metav1.Duration{
+				Duration: t.ttl,
+			},
+		})
+	}
+	return tokens
+}
+
+// certificateKey returns the key the kubeadm-certs secret is encrypted with. It changes with the
+// rotation period of the bootstrap token, a control plane node still joining after a rotation
+// falls back to the key of the next period.
+func certificateKey(clusterCtx *domain.ClusterContext) string {
+	return utils.GetRotatedCertificateKey(clusterCtx.ClusterToken, clusterCtx.BootstrapTokenTTL, now())
+}
+
+// caCertHashes returns the discovery hashes of the cluster CA: the hashes of the provider options
+// and the hash of the user provided cluster CA. Without either the CA is unknown, kubeadm generates
+// a random one on the init node, and discovery skips the CA verification.
+func caCertHashes(clusterCtx *domain.ClusterContext) []string {
+	hashes := clusterCtx.CACertHashes
+	if clusterCtx.PKI != nil && clusterCtx.PKI.CACert != "" {
+		// the certificate was validated when it was read from the provider options
+		if hash, err := utils.GetCACertHash(clusterCtx.PKI.CACert); err == nil && !slices.Contains(hashes, hash) {
+			hashes = append(slices.Clone(hashes), hash)
+		}
+	}
+	return hashes
+}
+
+func printObj(objects []runtime.Object) string {
+	initPrintr := printers.NewTypeSetter(scheme).ToPrinter(&printers.YAMLPrinter{})
+	out := bytes.NewBuffer([]byte{})
+
+	for _, obj := range objects {
+		_ = initPrintr.PrintObj(obj, out)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,179 @@
+package kubeadm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	apiVersionV1Beta3 = "kubeadm.k8s.io/v1beta3"
+	apiVersionV1Beta4 = "kubeadm.k8s.io/v1beta4"
+)
+
+// convertV1Beta3Options rewrites cluster options written in the v1beta3 shape to the
+// v1beta4 shape, so that extra args and timeouts are kept when a cluster crosses v1.31.
+// Options that cannot be parsed are returned unchanged and left to validation.
+func convertV1Beta3Options(options string) (string, error) {
+	data, err := kyaml.YAMLToJSON([]byte(options))
+	if err != nil {
+		return options, nil
+	}
+
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&raw); err != nil {
+		return options, nil
+	}
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return options, nil
+	}
+
+	var converted []string
+
+	for _, path := range [][]string{
+		{"clusterConfiguration", "apiServer"},
+		{"clusterConfiguration", "controllerManager"},
+		{"clusterConfiguration", "scheduler"},
+		{"clusterConfiguration", "etcd", "local"},
+	} {
+		if convertArgs(getObject(obj, path...), "extraArgs") {
+			converted = append(converted, strings.Join(append(path, "extraArgs"), "."))
+		}
+	}
+
+	for _, path := range [][]string{
+		{"initConfiguration", "nodeRegistration"},
+		{"joinConfiguration", "nodeRegistration"},
+	} {
+		if convertArgs(getObject(obj, path...), "kubeletExtraArgs") {
+			converted = append(converted, strings.Join(append(path, "kubeletExtraArgs"), "."))
+		}
+	}
+
+	var dropped []string
+
+	for _, move := range []struct {
+		from []string
+		to   []string
+	}{
+		{[]string{"clusterConfiguration", "apiServer", "timeoutForControlPlane"}, []string{"initConfiguration", "timeouts", "controlPlaneComponentHealthCheck"}},
+		{[]string{"joinConfiguration", "discovery", "timeout"}, []string{"joinConfiguration", "timeouts", "discovery"}},
+	} {
+		moved, ok := moveValue(obj, move.from, move.to)
+		if !ok {
+			continue
+		}
+		if moved {
+			converted = append(converted, strings.Join(move.from, "."))
+		} else {
+			dropped = append(dropped, fmt.Sprintf("%s, %s is already set", strings.Join(move.from, "."), strings.Join(move.to, ".")))
+		}
+	}
+
+	for _, key := range []string{"clusterConfiguration", "initConfiguration", "joinConfiguration"} {
+		section := getObject(obj, key)
+		if section != nil && section["apiVersion"] == apiVersionV1Beta3 {
+			section["apiVersion"] = apiVersionV1Beta4
+			converted = append(converted, key+".apiVersion")
+		}
+	}
+
+	if len(converted) == 0 && len(dropped) == 0 {
+		return options, nil
+	}
+
+	for _, path := range converted {
+		logrus.Infof("converted %s from %s to %s", path, apiVersionV1Beta3, apiVersionV1Beta4)
+	}
+	for _, reason := range dropped {
+		logrus.Warnf("dropped %s", reason)
+	}
+
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert cluster config to %s: %w", apiVersionV1Beta4, err)
+	}
+	return string(out), nil
+}
+
+// convertArgs turns a v1beta3 map of arguments into a v1beta4 list of name/value pairs.
+func convertArgs(parent map[string]interface{}, key string) bool {
+	if parent == nil {
+		return false
+	}
+
+	args, ok := parent[key].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]interface{}, 0, len(args))
+	for _, name := range names {
+		list = append(list, map[string]interface{}{
+			"name":  name,
+			"value": args[name],
+		})
+	}
+	parent[key] = list
+	return true
+}
+
+// moveValue moves the value at from to to. If to is already set, the value at from is removed
+// and moved is false. ok is false if there is no value at from, or it cannot be moved.
+func moveValue(obj map[string]interface{}, from, to []string) (moved, ok bool) {
+	source := getObject(obj, from[:len(from)-1]...)
+	if source == nil {
+		return false, false
+	}
+
+	value, ok := source[from[len(from)-1]]
+	if !ok {
+		return false, false
+	}
+
+	target := obj
+	for _, key := range to[:len(to)-1] {
+		if target[key] == nil {
+			target[key] = map[string]interface{}{}
+		}
+		next, ok := target[key].(map[string]interface{})
+		if !ok {
+			// leave the invalid shape to validation
+			return false, false
+		}
+		target = next
+	}
+
+	delete(source, from[len(from)-1])
+	if _, set := target[to[len(to)-1]]; set {
+		return false, true
+	}
+	target[to[len(to)-1]] = value
+	return true, true
+}
+
+func getObject(obj map[string]interface{}, path ...string) map[string]interface{} {
+	for _, key := range path {
+		next, ok := obj[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		obj = next
+	}
+	return obj
+}
@@ -0,0 +1,130 @@
+package kubeadm
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestConvertV1Beta3Options tests the convertV1Beta3Options function
+func TestConvertV1Beta3Options(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{
+			name: "extra_args",
+			options: `
+clusterConfiguration:
+  apiServer:
+    extraArgs:
+      audit-log-path: /var/log/audit.log
+      anonymous-auth: "false"
+  etcd:
+    local:
+      extraArgs:
+        quota-backend-bytes: "8589934592"`,
+			expected: `{"clusterConfiguration":{"apiServer":{"extraArgs":[{"name":"anonymous-auth","value":"false"},{"name":"audit-log-path","value":"/var/log/audit.log"}]},"etcd":{"local":{"extraArgs":[{"name":"quota-backend-bytes","value":"8589934592"}]}}}}`,
+		},
+		{
+			name: "kubelet_extra_args",
+			options: `
+initConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+      node-ip: 10.0.0.1
+joinConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+      node-ip: 10.0.0.2`,
+			expected: `{"initConfiguration":{"nodeRegistration":{"kubeletExtraArgs":[{"name":"node-ip","value":"10.0.0.1"}]}},"joinConfiguration":{"nodeRegistration":{"kubeletExtraArgs":[{"name":"node-ip","value":"10.0.0.2"}]}}}`,
+		},
+		{
+			name: "timeouts",
+			options: `
+clusterConfiguration:
+  apiServer:
+    timeoutForControlPlane: 10m0s
+joinConfiguration:
+  discovery:
+    timeout: 5m0s`,
+			expected: `{"clusterConfiguration":{"apiServer":{}},"initConfiguration":{"timeouts":{"controlPlaneComponentHealthCheck":"10m0s"}},"joinConfiguration":{"discovery":{},"timeouts":{"discovery":"5m0s"}}}`,
+		},
+		{
+			name: "timeout_already_set",
+			options: `
+clusterConfiguration:
+  apiServer:
+    timeoutForControlPlane: 10m0s
+initConfiguration:
+  timeouts:
+    controlPlaneComponentHealthCheck: 2m0s`,
+			expected: `{"clusterConfiguration":{"apiServer":{}},"initConfiguration":{"timeouts":{"controlPlaneComponentHealthCheck":"2m0s"}}}`,
+		},
+		{
+			name: "api_version",
+			options: `
+clusterConfiguration:
+  apiVersion: kubeadm.k8s.io/v1beta3`,
+			expected: `{"clusterConfiguration":{"apiVersion":"kubeadm.k8s.io/v1beta4"}}`,
+		},
+		{
+			name: "v1beta4_unchanged",
+			options: `
+initConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+    - name: node-ip
+      value: 10.0.0.1`,
+			expected: `
+initConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+    - name: node-ip
+      value: 10.0.0.1`,
+		},
+		{
+			name:     "invalid_unchanged",
+			options:  `clusterConfiguration: [`,
+			expected: `clusterConfiguration: [`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := convertV1Beta3Options(tt.options)
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestV1Beta4ParseUserOptionsConverted tests that v1beta3 shaped options are accepted by v1beta4
+func TestV1Beta4ParseUserOptionsConverted(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeadmAPI := NewV1Beta4(domain.KubeadmConfigBeta4{})
+	err := kubeadmAPI.ParseUserOptions(`
+clusterConfiguration:
+  apiServer:
+    timeoutForControlPlane: 10m0s
+    extraArgs:
+      anonymous-auth: "false"
+initConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+      node-ip: 10.0.0.1`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(kubeadmAPI.NodeIP("init")).To(Equal("10.0.0.1"))
+
+	clusterCfg := kubeadmAPI.ClusterConfig("init")
+	g.Expect(clusterCfg).To(ContainSubstring("name: anonymous-auth"))
+	g.Expect(clusterCfg).To(ContainSubstring("controlPlaneComponentHealthCheck: 10m0s"))
+}
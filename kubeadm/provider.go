@@ -0,0 +1,186 @@
+package kubeadm
+
+import (
+	"path/filepath"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
+	bootstraptokenv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/bootstraptoken/v1"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+// clusterConfig is the adapter every API version implements for the provider. It exposes the
+// fields of the kubeadm configuration the provider reads, and returns the objects of the kubeadm
+// files with the values the provider sets. The objects are rendered from a copy of the
+// configuration, which is never mutated.
+type clusterConfig interface {
+	imageRepository() string
+	certificatesDir() string
+	// externalEtcdEndpoints returns the endpoints of clusterConfiguration.etcd.external, false
+	// for a local etcd.
+	externalEtcdEndpoints() ([]string, bool)
+	networking() (serviceSubnet, podSubnet string)
+	certSANs() []string
+	ignorePreflightErrors(nodeRole string) []string
+
+	initObjects(opts initOptions) []runtime.Object
+	joinObjects(opts joinOptions) []runtime.Object
+	clusterObjects(nodeRole string) []runtime.Object
+	kubeletObjects() []runtime.Object
+	imagesObjects() []runtime.Object
+}
+
+// apiEndpoint and bootstrapTokenDiscovery have the fields of the types of the same name of every
+// kubeadm API version, which convert them to their own types.
+type apiEndpoint struct {
+	AdvertiseAddress string
+	BindPort         int32
+}
+
+type bootstrapTokenDiscovery struct {
+	Token                    string
+	APIServerEndpoint        string
+	CACertHashes             []string
+	UnsafeSkipCAVerification bool
+}
+
+// initOptions are the values the provider sets in the init configuration.
+type initOptions struct {
+	bootstrapTokens []bootstraptokenv1.BootstrapToken
+	certificateKey  string
+}
+
+// joinOptions are the values the provider sets in the join configuration. The discovery is only
+// used if the user did not set discovery.bootstrapToken, the certificate key and the local API
+// endpoint only on control plane nodes.
+type joinOptions struct {
+	discovery      bootstrapTokenDiscovery
+	controlPlane   bool
+	certificateKey string
+}
+
+// provider implements the API accessors of the provider owned blocks of the cluster config,
+// which are the same for every kubeadm API version. It is embedded by every API version.
+type provider struct {
+	blocks  *domain.ProviderConfiguration
+	kubelet *kubeletv1beta1.KubeletConfiguration
+	cluster clusterConfig
+}
+
+func (p provider) Networking() (string, string) {
+	return p.cluster.networking()
+}
+
+func (p provider) CertSANs() []string {
+	return p.cluster.certSANs()
+}
+
+func (p provider) IgnorePreflightErrors(nodeRole string) []string {
+	return p.cluster.ignorePreflightErrors(nodeRole)
+}
+
+func (p provider) InitConfig(clusterCtx *domain.ClusterContext) string {
+	return printObj(p.cluster.initObjects(initOptions{
+		bootstrapTokens: bootstrapTokens(clusterCtx),
+		certificateKey:  certificateKey(clusterCtx),
+	}))
+}
+
+func (p provider) JoinConfig(clusterCtx *domain.ClusterContext) string {
+	token, _ := bootstrapToken(clusterCtx)
+	caCertHashes := caCertHashes(clusterCtx)
+	if len(caCertHashes) == 0 {
+		logrus.Warn("INSECURE: no ca_cert_hashes or ca_cert set, joining nodes skip the verification of the cluster CA")
+	}
+
+	opts := joinOptions{
+		discovery: bootstrapTokenDiscovery{
+			Token:                    token,
+			APIServerEndpoint:        clusterCtx.ControlPlaneHost,
+			CACertHashes:             caCertHashes,
+			UnsafeSkipCAVerification: len(caCertHashes) == 0,
+		},
+	}
+	if clusterCtx.NodeRole == clusterplugin.RoleControlPlane {
+		opts.controlPlane = true
+		opts.certificateKey = certificateKey(clusterCtx)
+	}
+	return printObj(p.cluster.joinObjects(opts))
+}
+
+// ClusterConfig renders the configuration the reconfigure and upgrade scripts pass to kubeadm. On
+// joined control plane nodes the init configuration carries the local API endpoint of the join
+// configuration.
+func (p provider) ClusterConfig(nodeRole string) string {
+	return printObj(p.cluster.clusterObjects(nodeRole))
+}
+
+func (p provider) KubeletConfig() string {
+	return printObj(p.cluster.kubeletObjects())
+}
+
+func (p provider) ImagesConfig() string {
+	return printObj(p.cluster.imagesObjects())
+}
+
+func (p provider) Drain() domain.DrainConfiguration {
+	return p.blocks.Drain
+}
+
+func (p provider) EtcdBackup() *domain.EtcdBackupConfiguration {
+	return p.blocks.EtcdBackup
+}
+
+func (p provider) CertificateRenewal() domain.CertificateRenewalConfiguration {
+	return p.blocks.CertificateRenewal
+}
+
+func (p provider) ExternalEtcd() *domain.ExternalEtcdConfiguration {
+	if p.blocks.ExternalEtcd != nil {
+		return p.blocks.ExternalEtcd
+	}
+	if endpoints, ok := p.cluster.externalEtcdEndpoints(); ok {
+		return &domain.ExternalEtcdConfiguration{Endpoints: endpoints}
+	}
+	return nil
+}
+
+func (p provider) Registries() []domain.RegistryConfiguration {
+	return p.blocks.Registries
+}
+
+func (p provider) CustomCertificatesDir() bool {
+	dir := p.cluster.certificatesDir()
+	return dir != "" && filepath.Clean(dir) != kubeadmapiv4.DefaultCertificatesDir
+}
+
+func (p provider) Containerd(clusterCtx *domain.ClusterContext) *domain.ContainerdConfiguration {
+	if p.blocks.Containerd == nil {
+		return nil
+	}
+	cfg := *p.blocks.Containerd
+	utils.MutateContainerdDefaults(clusterCtx, &cfg, p.cluster.imageRepository(), p.kubelet.CgroupDriver)
+	return &cfg
+}
+
+// applyKubeletDefaults mutates the kubelet configuration with the provider defaults.
+func (p provider) applyKubeletDefaults(clusterCtx *domain.ClusterContext) {
+	// the kubelet has to use the cgroup driver of the rendered containerd config
+	if cfg := p.Containerd(clusterCtx); cfg != nil {
+		p.kubelet.CgroupDriver = cfg.CgroupDriver
+	}
+	utils.MutateKubeletDefaults(clusterCtx, p.kubelet)
+}
+
+// defaultAPIEndpoint returns the local API endpoint with the provider default advertise address.
+func defaultAPIEndpoint(endpoint apiEndpoint) apiEndpoint {
+	if endpoint.AdvertiseAddress == "" {
+		endpoint.AdvertiseAddress = domain.DefaultAPIAdvertiseAddress
+	}
+	return endpoint
+}
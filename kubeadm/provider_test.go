@@ -0,0 +1,72 @@
+package kubeadm
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestProviderRenderKeepsConfig tests that rendering the kubeadm files does not change the
+// configuration the next file is rendered from
+func TestProviderRenderKeepsConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		kubeadmAPI API
+	}{
+		{
+			name: "v1beta3",
+			kubeadmAPI: NewV1Beta3(domain.KubeadmConfigBeta3{
+				InitConfiguration: kubeadmapiv3.InitConfiguration{
+					LocalAPIEndpoint: kubeadmapiv3.APIEndpoint{AdvertiseAddress: "10.0.0.3"},
+				},
+				JoinConfiguration: kubeadmapiv3.JoinConfiguration{
+					ControlPlane: &kubeadmapiv3.JoinControlPlane{
+						LocalAPIEndpoint: kubeadmapiv3.APIEndpoint{AdvertiseAddress: "10.0.0.2", BindPort: 7443},
+					},
+				},
+			}),
+		},
+		{
+			name: "v1beta4",
+			kubeadmAPI: NewV1Beta4(domain.KubeadmConfigBeta4{
+				InitConfiguration: kubeadmapiv4.InitConfiguration{
+					LocalAPIEndpoint: kubeadmapiv4.APIEndpoint{AdvertiseAddress: "10.0.0.3"},
+				},
+				JoinConfiguration: kubeadmapiv4.JoinConfiguration{
+					ControlPlane: &kubeadmapiv4.JoinControlPlane{
+						LocalAPIEndpoint: kubeadmapiv4.APIEndpoint{AdvertiseAddress: "10.0.0.2", BindPort: 7443},
+					},
+				},
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				NodeRole:         "controlplane",
+				ControlPlaneHost: "10.0.0.1:6443",
+				ClusterToken:     "abcdef.1234567890123456",
+			}
+
+			// a joined control plane node serves the API on the endpoint of the join configuration
+			clusterCfg := tt.kubeadmAPI.ClusterConfig("controlplane")
+			g.Expect(clusterCfg).To(ContainSubstring("advertiseAddress: 10.0.0.2"))
+			g.Expect(clusterCfg).ToNot(ContainSubstring("advertiseAddress: 10.0.0.3"))
+
+			joinCfg := tt.kubeadmAPI.JoinConfig(clusterCtx)
+			g.Expect(joinCfg).To(ContainSubstring("certificateKey:"))
+			g.Expect(joinCfg).To(ContainSubstring("bindPort: 7443"))
+
+			g.Expect(tt.kubeadmAPI.ClusterConfig("controlplane")).To(Equal(clusterCfg))
+			g.Expect(tt.kubeadmAPI.ClusterConfig("init")).To(ContainSubstring("advertiseAddress: 10.0.0.3"))
+			g.Expect(tt.kubeadmAPI.KubeletConfig()).To(ContainSubstring("advertiseAddress: 10.0.0.3"))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package kubeadm
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+type registration struct {
+	// minVersion is inclusive, maxVersion is exclusive. A nil bound is unbounded.
+	minVersion *version.Version
+	maxVersion *version.Version
+	newAPI     func() API
+}
+
+var registry []registration
+
+// Register adds a kubeadm API implementation for the kubernetes versions in
+// [minVersion, maxVersion). An empty bound leaves that side of the range open. A bound such as
+// v1.31.0-0 includes the pre-releases of v1.31.0 in the range that starts with it.
+// It panics on invalid or overlapping ranges as it is only meant to be called from init.
+func Register(minVersion, maxVersion string, newAPI func() API) {
+	r := registration{
+		minVersion: mustParseBound(minVersion),
+		maxVersion: mustParseBound(maxVersion),
+		newAPI:     newAPI,
+	}
+
+	if r.minVersion != nil && r.maxVersion != nil && !r.minVersion.LessThan(r.maxVersion) {
+		panic(fmt.Sprintf("invalid kubeadm api version range [%s, %s)", minVersion, maxVersion))
+	}
+
+	for _, existing := range registry {
+		if r.overlaps(existing) {
+			panic(fmt.Sprintf("kubeadm api version range [%s, %s) overlaps with an existing registration", minVersion, maxVersion))
+		}
+	}
+
+	registry = append(registry, r)
+}
+
+// ForKubernetesVersion returns a new kubeadm API implementation for the given kubernetes version.
+func ForKubernetesVersion(kubernetesVersion string) (API, error) {
+	v, err := version.ParseSemantic(kubernetesVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubernetes version %q: %w", kubernetesVersion, err)
+	}
+
+	for _, r := range registry {
+		if r.contains(v) {
+			return r.newAPI(), nil
+		}
+	}
+	return nil, fmt.Errorf("no kubeadm api registered for kubernetes version %s", kubernetesVersion)
+}
+
+func (r registration) contains(v *version.Version) bool {
+	if r.minVersion != nil && v.LessThan(r.minVersion) {
+		return false
+	}
+	if r.maxVersion != nil && !v.LessThan(r.maxVersion) {
+		return false
+	}
+	return true
+}
+
+func (r registration) overlaps(other registration) bool {
+	// [a, b) and [c, d) overlap when a < d and c < b.
+	if r.minVersion != nil && other.maxVersion != nil && !r.minVersion.LessThan(other.maxVersion) {
+		return false
+	}
+	if other.minVersion != nil && r.maxVersion != nil && !other.minVersion.LessThan(r.maxVersion) {
+		return false
+	}
+	return true
+}
+
+func mustParseBound(bound string) *version.Version {
+	if bound == "" {
+		return nil
+	}
+	return version.MustParseSemantic(bound)
+}
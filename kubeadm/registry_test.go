@@ -0,0 +1,101 @@
+package kubeadm
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestForKubernetesVersion tests the ForKubernetesVersion function
+func TestForKubernetesVersion(t *testing.T) {
+	tests := []struct {
+		name              string
+		kubernetesVersion string
+		expectedVersion   string
+		expectErr         bool
+	}{
+		{
+			name:              "v1beta3_before_1_31",
+			kubernetesVersion: "v1.30.11",
+			expectedVersion:   "kubeadm.k8s.io/v1beta3",
+		},
+		{
+			name:              "v1beta4_at_1_31",
+			kubernetesVersion: "v1.31.0",
+			expectedVersion:   "kubeadm.k8s.io/v1beta4",
+		},
+		{
+			name:              "v1beta3_before_1_31_pre_releases",
+			kubernetesVersion: "v1.30.11-rc.0",
+			expectedVersion:   "kubeadm.k8s.io/v1beta3",
+		},
+		{
+			name:              "v1beta4_at_1_31_alpha",
+			kubernetesVersion: "v1.31.0-alpha.1",
+			expectedVersion:   "kubeadm.k8s.io/v1beta4",
+		},
+		{
+			name:              "v1beta4_at_1_31_rc",
+			kubernetesVersion: "v1.31.0-rc.1",
+			expectedVersion:   "kubeadm.k8s.io/v1beta4",
+		},
+		{
+			name:              "v1beta4_after_1_31",
+			kubernetesVersion: "1.34.0",
+			expectedVersion:   "kubeadm.k8s.io/v1beta4",
+		},
+		{
+			name:              "invalid_version",
+			kubernetesVersion: "latest",
+			expectErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := ForKubernetesVersion(tt.kubernetesVersion)
+
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.Version()).To(Equal(tt.expectedVersion))
+		})
+	}
+}
+
+// TestRegister tests registering additional kubeadm api versions
+func TestRegister(t *testing.T) {
+	g := NewWithT(t)
+
+	original := registry
+	defer func() { registry = original }()
+
+	registry = nil
+	Register("", "v1.31.0-0", func() API { return NewV1Beta3(domain.KubeadmConfigBeta3{}) })
+	Register("v1.31.0-0", "v1.36.0-0", func() API { return NewV1Beta4(domain.KubeadmConfigBeta4{}) })
+
+	result, err := ForKubernetesVersion("v1.35.2")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Version()).To(Equal("kubeadm.k8s.io/v1beta4"))
+
+	_, err = ForKubernetesVersion("v1.36.0")
+	g.Expect(err).To(MatchError(ContainSubstring("no kubeadm api registered")))
+
+	_, err = ForKubernetesVersion("v1.36.0-beta.0")
+	g.Expect(err).To(MatchError(ContainSubstring("no kubeadm api registered")))
+
+	g.Expect(func() {
+		Register("v1.35.0", "", func() API { return nil })
+	}).To(Panic())
+
+	g.Expect(func() {
+		Register("v1.37.0", "v1.36.0", func() API { return nil })
+	}).To(Panic())
+}
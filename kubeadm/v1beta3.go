@@ -0,0 +1,152 @@
+package kubeadm
+
+import (
+	"fmt"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+	"github.com/kairos-io/kairos/provider-kubeadm/validation"
+)
+
+func init() {
+	Register("", "v1.31.0-0", func() API {
+		return NewV1Beta3(domain.KubeadmConfigBeta3{})
+	})
+}
+
+type v1beta3 struct {
+	provider
+	config domain.KubeadmConfigBeta3
+}
+
+func NewV1Beta3(config domain.KubeadmConfigBeta3) API {
+	a := &v1beta3{config: config}
+	a.provider = provider{blocks: &a.config.ProviderConfiguration, kubelet: &a.config.KubeletConfiguration, cluster: a}
+	return a
+}
+
+func (a *v1beta3) Version() string {
+	return kubeadmapiv3.SchemeGroupVersion.String()
+}
+
+func (a *v1beta3) ParseUserOptions(options string) error {
+	var config domain.KubeadmConfigBeta3
+
+	allErrs := validation.DecodeStrict(options, &config)
+	allErrs = append(allErrs, validation.ValidateKubeadmConfigBeta3(&config)...)
+	if len(allErrs) > 0 {
+		return fmt.Errorf("invalid cluster config: %w", allErrs.ToAggregate())
+	}
+
+	a.config = config
+	return nil
+}
+
+func (a *v1beta3) ApplyDefaults(clusterCtx *domain.ClusterContext) {
+	utils.MutateClusterConfigBeta3Defaults(clusterCtx, &a.config.ClusterConfiguration)
+	a.applyKubeletDefaults(clusterCtx)
+}
+
+func (a *v1beta3) KubeletArgs(nodeRole string) string {
+	return utils.RegenerateKubeletKubeadmArgsUsingBeta3Config(a.nodeRegistration(nodeRole), nodeRole)
+}
+
+func (a *v1beta3) NodeIP(nodeRole string) string {
+	return a.nodeRegistration(nodeRole).KubeletExtraArgs["node-ip"]
+}
+
+func (a *v1beta3) imageRepository() string {
+	return a.config.ClusterConfiguration.ImageRepository
+}
+
+func (a *v1beta3) certificatesDir() string {
+	return a.config.ClusterConfiguration.CertificatesDir
+}
+
+func (a *v1beta3) externalEtcdEndpoints() ([]string, bool) {
+	if external := a.config.ClusterConfiguration.Etcd.External; external != nil {
+		return external.Endpoints, true
+	}
+	return nil, false
+}
+
+func (a *v1beta3) networking() (string, string) {
+	return a.config.ClusterConfiguration.Networking.ServiceSubnet, a.config.ClusterConfiguration.Networking.PodSubnet
+}
+
+func (a *v1beta3) certSANs() []string {
+	return a.config.ClusterConfiguration.APIServer.CertSANs
+}
+
+func (a *v1beta3) ignorePreflightErrors(nodeRole string) []string {
+	return a.nodeRegistration(nodeRole).IgnorePreflightErrors
+}
+
+func (a *v1beta3) initObjects(opts initOptions) []runtime.Object {
+	clusterCfg := a.config.ClusterConfiguration
+	initCfg := a.config.InitConfiguration
+	kubeletCfg := a.config.KubeletConfiguration
+
+	initCfg.BootstrapTokens = opts.bootstrapTokens
+	initCfg.CertificateKey = opts.certificateKey
+	initCfg.LocalAPIEndpoint = kubeadmapiv3.APIEndpoint(defaultAPIEndpoint(apiEndpoint(initCfg.LocalAPIEndpoint)))
+
+	return []runtime.Object{&clusterCfg, &initCfg, &kubeletCfg}
+}
+
+func (a *v1beta3) joinObjects(opts joinOptions) []runtime.Object {
+	joinCfg := a.config.JoinConfiguration.DeepCopy()
+
+	if joinCfg.Discovery.BootstrapToken == nil {
+		discovery := kubeadmapiv3.BootstrapTokenDiscovery(opts.discovery)
+		joinCfg.Discovery.BootstrapToken = &discovery
+	}
+
+	if opts.controlPlane {
+		if joinCfg.ControlPlane == nil {
+			joinCfg.ControlPlane = &kubeadmapiv3.JoinControlPlane{}
+		}
+		joinCfg.ControlPlane.CertificateKey = opts.certificateKey
+		joinCfg.ControlPlane.LocalAPIEndpoint = kubeadmapiv3.APIEndpoint(defaultAPIEndpoint(apiEndpoint(joinCfg.ControlPlane.LocalAPIEndpoint)))
+	}
+
+	return []runtime.Object{joinCfg}
+}
+
+func (a *v1beta3) clusterObjects(nodeRole string) []runtime.Object {
+	clusterCfg := a.config.ClusterConfiguration
+	initCfg := a.config.InitConfiguration
+
+	if nodeRole == clusterplugin.RoleInit {
+		return []runtime.Object{&clusterCfg, &initCfg}
+	}
+
+	joinCfg := a.config.JoinConfiguration
+	if joinCfg.ControlPlane != nil {
+		initCfg.LocalAPIEndpoint = joinCfg.ControlPlane.LocalAPIEndpoint
+	}
+	return []runtime.Object{&clusterCfg, &initCfg, &joinCfg}
+}
+
+func (a *v1beta3) kubeletObjects() []runtime.Object {
+	clusterCfg := a.config.ClusterConfiguration
+	initCfg := a.config.InitConfiguration
+	kubeletCfg := a.config.KubeletConfiguration
+	return []runtime.Object{&clusterCfg, &initCfg, &kubeletCfg}
+}
+
+func (a *v1beta3) imagesObjects() []runtime.Object {
+	clusterCfg := a.config.ClusterConfiguration
+	return []runtime.Object{&clusterCfg}
+}
+
+func (a *v1beta3) nodeRegistration(nodeRole string) *kubeadmapiv3.NodeRegistrationOptions {
+	if nodeRole == clusterplugin.RoleInit {
+		return &a.config.InitConfiguration.NodeRegistration
+	}
+	return &a.config.JoinConfiguration.NodeRegistration
+}
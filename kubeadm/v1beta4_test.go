@@ -0,0 +1,220 @@
+package kubeadm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+// TestV1Beta4ParseUserOptions tests the v1beta4 ParseUserOptions implementation
+func TestV1Beta4ParseUserOptions(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeadmAPI := NewV1Beta4(domain.KubeadmConfigBeta4{})
+	err := kubeadmAPI.ParseUserOptions(`
+clusterConfiguration:
+  networking:
+    podSubnet: 10.244.0.0/16
+    serviceSubnet: 10.96.0.0/12
+  apiServer:
+    certSANs:
+    - cluster.example.com
+initConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+    - name: node-ip
+      value: 10.0.0.1
+joinConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+    - name: node-ip
+      value: 10.0.0.2
+drain:
+  timeout: 10m
+  evictLocalStoragePods: true
+certificateRenewal:
+  renewBefore: 1440h
+etcdBackup:
+  interval: 1h
+  compress: true
+  s3:
+    endpoint: http://minio.local:9000
+    bucket: etcd
+    accessKeyID: minio
+    secretAccessKey: minio123
+registries:
+- upstream: docker.io
+  mirrors:
+  - endpoint: https://mirror.local
+containerd:
+  cgroupDriver: cgroupfs
+  runtimes:
+  - name: nvidia
+    binaryName: /usr/bin/nvidia-container-runtime`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	serviceSubnet, podSubnet := kubeadmAPI.Networking()
+	g.Expect(serviceSubnet).To(Equal("10.96.0.0/12"))
+	g.Expect(podSubnet).To(Equal("10.244.0.0/16"))
+	g.Expect(kubeadmAPI.CertSANs()).To(ConsistOf("cluster.example.com"))
+	g.Expect(kubeadmAPI.NodeIP("init")).To(Equal("10.0.0.1"))
+	g.Expect(kubeadmAPI.NodeIP("worker")).To(Equal("10.0.0.2"))
+	g.Expect(kubeadmAPI.Drain().Timeout.Duration).To(Equal(10 * time.Minute))
+	g.Expect(kubeadmAPI.Drain().EvictLocalStoragePods).To(BeTrue())
+	g.Expect(kubeadmAPI.Drain().Enabled).To(BeNil())
+	g.Expect(kubeadmAPI.CertificateRenewal().RenewBefore.Duration).To(Equal(60 * 24 * time.Hour))
+	g.Expect(kubeadmAPI.EtcdBackup().Interval.Duration).To(Equal(time.Hour))
+	g.Expect(kubeadmAPI.EtcdBackup().Compress).To(BeTrue())
+	g.Expect(kubeadmAPI.EtcdBackup().S3.Bucket).To(Equal("etcd"))
+	g.Expect(kubeadmAPI.Registries()).To(Equal([]domain.RegistryConfiguration{
+		{Upstream: "docker.io", Mirrors: []domain.RegistryMirror{{Endpoint: "https://mirror.local"}}},
+	}))
+
+	clusterCtx := &domain.ClusterContext{ControlPlaneHost: "10.0.0.1:6443", KubernetesVersion: "v1.33.2", ContainerdServiceFolderName: "containerd"}
+	containerd := kubeadmAPI.Containerd(clusterCtx)
+	g.Expect(containerd.SandboxImage).To(Equal("registry.k8s.io/pause:3.10"))
+	g.Expect(containerd.Runtimes).To(HaveLen(2))
+	g.Expect(NewV1Beta4(domain.KubeadmConfigBeta4{}).Containerd(clusterCtx)).To(BeNil())
+	kubeadmAPI.ApplyDefaults(clusterCtx)
+	g.Expect(kubeadmAPI.KubeletConfig()).To(ContainSubstring("cgroupDriver: cgroupfs"))
+
+	g.Expect(kubeadmAPI.ParseUserOptions(`clusterConfiguration: {networking: {podSubnet: invalid}}`)).To(MatchError(ContainSubstring("clusterConfiguration.networking.podSubnet")))
+}
+
+// TestV1Beta4ExternalEtcd tests that ExternalEtcd returns the externalEtcd block or the kubeadm external etcd endpoints
+func TestV1Beta4ExternalEtcd(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(NewV1Beta4(domain.KubeadmConfigBeta4{}).ExternalEtcd()).To(BeNil())
+
+	external := &domain.ExternalEtcdConfiguration{Endpoints: []string{"https://10.0.0.5:2379"}, CACert: "ca"}
+	g.Expect(NewV1Beta4(domain.KubeadmConfigBeta4{ProviderConfiguration: domain.ProviderConfiguration{ExternalEtcd: external}}).ExternalEtcd()).To(Equal(external))
+
+	cfg := domain.KubeadmConfigBeta4{}
+	cfg.ClusterConfiguration.Etcd.External = &kubeadmapiv4.ExternalEtcd{
+		Endpoints: []string{"https://10.0.0.5:2379"},
+		CAFile:    "/etc/etcd/ca.crt",
+	}
+	g.Expect(NewV1Beta4(cfg).ExternalEtcd()).To(Equal(&domain.ExternalEtcdConfiguration{Endpoints: []string{"https://10.0.0.5:2379"}}))
+}
+
+// TestV1Beta4Render tests the v1beta4 config rendering
+func TestV1Beta4Render(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterCtx := &domain.ClusterContext{
+		NodeRole:         "controlplane",
+		ControlPlaneHost: "10.0.0.1:6443",
+		ClusterToken:     "abcdef.1234567890123456",
+	}
+
+	kubeadmAPI := NewV1Beta4(domain.KubeadmConfigBeta4{})
+	kubeadmAPI.ApplyDefaults(clusterCtx)
+
+	initCfg := kubeadmAPI.InitConfig(clusterCtx)
+	g.Expect(initCfg).To(ContainSubstring("apiVersion: kubeadm.k8s.io/v1beta4"))
+	g.Expect(initCfg).To(ContainSubstring("kind: InitConfiguration"))
+	g.Expect(initCfg).To(ContainSubstring("token: abcdef.1234567890123456"))
+
+	joinCfg := kubeadmAPI.JoinConfig(clusterCtx)
+	g.Expect(joinCfg).To(ContainSubstring("kind: JoinConfiguration"))
+	g.Expect(joinCfg).To(ContainSubstring("apiServerEndpoint: 10.0.0.1:6443"))
+	// without a known CA discovery skips the CA verification
+	g.Expect(joinCfg).ToNot(ContainSubstring("caCertHashes"))
+	g.Expect(joinCfg).To(ContainSubstring("unsafeSkipCAVerification: true"))
+	g.Expect(joinCfg).To(ContainSubstring("advertiseAddress: 0.0.0.0"))
+
+	g.Expect(kubeadmAPI.ClusterConfig("controlplane")).To(ContainSubstring("kind: JoinConfiguration"))
+	g.Expect(kubeadmAPI.KubeletConfig()).To(ContainSubstring("kind: KubeletConfiguration"))
+
+	// joining nodes pin the hashes of the provider options
+	hash := "sha256:" + strings.Repeat("ab", 32)
+	clusterCtx.CACertHashes = []string{hash}
+	joinCfg = kubeadmAPI.JoinConfig(clusterCtx)
+	g.Expect(joinCfg).To(ContainSubstring("- " + hash))
+	g.Expect(joinCfg).ToNot(ContainSubstring("unsafeSkipCAVerification"))
+
+	// and the hash of the CA of the provider options
+	caCert := testCACert(t)
+	caCertHash, err := utils.GetCACertHash(caCert)
+	g.Expect(err).ToNot(HaveOccurred())
+	clusterCtx.PKI = &domain.ClusterPKI{CACert: caCert}
+	joinCfg = kubeadmAPI.JoinConfig(clusterCtx)
+	g.Expect(joinCfg).To(ContainSubstring("- " + hash))
+	g.Expect(joinCfg).To(ContainSubstring("- " + caCertHash))
+	g.Expect(clusterCtx.CACertHashes).To(Equal([]string{hash}))
+
+	clusterCtx.CACertHashes = nil
+	joinCfg = kubeadmAPI.JoinConfig(clusterCtx)
+	g.Expect(joinCfg).ToNot(ContainSubstring(hash))
+	g.Expect(joinCfg).To(ContainSubstring("- " + caCertHash))
+}
+
+// testCACert returns a PEM encoded self-signed CA certificate.
+func testCACert(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// TestV1Beta4RenderRotatingToken tests the v1beta4 config rendering with a finite bootstrap token ttl
+func TestV1Beta4RenderRotatingToken(t *testing.T) {
+	g := NewWithT(t)
+
+	original := now
+	defer func() { now = original }()
+	now = func() time.Time { return time.Unix(20000*86400+3600, 0) }
+
+	clusterCtx := &domain.ClusterContext{
+		NodeRole:          "controlplane",
+		ControlPlaneHost:  "10.0.0.1:6443",
+		ClusterToken:      "abcdef.1234567890123456",
+		BootstrapTokenTTL: 24 * time.Hour,
+	}
+	token := utils.TransformToken("abcdef.1234567890123456-20000")
+	nextToken := utils.TransformToken("abcdef.1234567890123456-20001")
+	// the certificate key changes with the rotated token
+	certificateKey := utils.GetCertificateKey("abcdef.1234567890123456-certificate-key-20000")
+
+	kubeadmAPI := NewV1Beta4(domain.KubeadmConfigBeta4{})
+
+	initCfg := kubeadmAPI.InitConfig(clusterCtx)
+	g.Expect(initCfg).To(ContainSubstring("token: " + token))
+	g.Expect(initCfg).To(ContainSubstring("ttl: 47h0m0s"))
+	g.Expect(initCfg).To(ContainSubstring("token: " + nextToken))
+	g.Expect(initCfg).To(ContainSubstring("ttl: 71h0m0s"))
+	g.Expect(initCfg).To(ContainSubstring("certificateKey: " + certificateKey))
+
+	joinCfg := kubeadmAPI.JoinConfig(clusterCtx)
+	g.Expect(joinCfg).To(ContainSubstring("token: " + token))
+	g.Expect(joinCfg).ToNot(ContainSubstring(nextToken))
+	g.Expect(joinCfg).To(ContainSubstring("certificateKey: " + certificateKey))
+}
@@ -1,19 +1,36 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/kairos-io/kairos/provider-kubeadm/log"
 
+	"github.com/kairos-io/kairos/provider-kubeadm/certs"
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/etcd"
+	"github.com/kairos-io/kairos/provider-kubeadm/images"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+	"github.com/kairos-io/kairos/provider-kubeadm/reset"
+	"github.com/kairos-io/kairos/provider-kubeadm/runner"
 	"github.com/kairos-io/kairos/provider-kubeadm/stages"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+	"github.com/kairos-io/kairos/provider-kubeadm/token"
+	"github.com/kairos-io/kairos/provider-kubeadm/upgrade"
 	"github.com/kairos-io/kairos/provider-kubeadm/utils"
 	"gopkg.in/yaml.v3"
-	kyaml "sigs.k8s.io/yaml"
 
 	"github.com/kairos-io/kairos-sdk/bus"
 	"github.com/kairos-io/kairos-sdk/clusterplugin"
@@ -22,24 +39,321 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const clusterProviderCloudConfigFile = "/usr/local/cloud-config/cluster.kairos.yaml"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case runner.Command:
+			os.Exit(runKubeadm(os.Args[2:]))
+		case upgrade.Command:
+			os.Exit(runUpgrade(os.Args[2:]))
+		case etcd.SnapshotCommand:
+			os.Exit(runEtcdSnapshot(os.Args[2:]))
+		case etcd.RestoreCommand:
+			os.Exit(runEtcdRestore(os.Args[2:]))
+		case certs.Command:
+			os.Exit(runCertsCheck(os.Args[2:]))
+		case images.Command:
+			os.Exit(runImagesImport(os.Args[2:]))
+		case images.VerifyCommand:
+			os.Exit(runImagesVerify(os.Args[2:]))
+		case status.PhaseCommand:
+			os.Exit(runPhase(os.Args[2:]))
+		case status.Command:
+			os.Exit(printStatus(os.Args[2:], os.Stdout))
+		case token.Command:
+			os.Exit(printToken(os.Args[2:], os.Stdout))
+		}
+	}
+
 	log.InitLogger("/var/log/provider-kubeadm.log")
 	logrus.Info("starting provider-kubeadm")
-	plugin := clusterplugin.ClusterPlugin{
-		Provider: clusterProvider,
-	}
 
-	if err := plugin.Run(
+	// The boot handler is registered here instead of through clusterplugin.ClusterPlugin
+	// so that configuration errors are reported in the event response.
+	factory := pluggable.NewPluginFactory(
+		pluggable.FactoryPlugin{
+			EventType:     bus.EventBoot,
+			PluginHandler: handleClusterBoot,
+		},
 		pluggable.FactoryPlugin{
 			EventType:     clusterplugin.EventClusterReset,
 			PluginHandler: handleClusterReset,
 		},
-	); err != nil {
+	)
+
+	if err := factory.Run(pluggable.EventType(os.Args[1]), os.Stdin, os.Stdout); err != nil {
 		logrus.Fatal(err)
 	}
 	logrus.Infof("completed provider-kubeadm")
 }
 
+// runKubeadm runs kubeadm init or join for the "Run Kubeadm Init" and "Run Kubeadm Join" stages.
+func runKubeadm(args []string) int {
+	opts, err := runner.ParseArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", runner.Command, err)
+		return 2
+	}
+
+	log.InitLogger(fmt.Sprintf("/var/log/kube-%s.log", opts.Action))
+
+	if err = runner.Run(opts); err != nil {
+		logrus.Error(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runUpgrade upgrades the node for the "Run Kubeadm Init Upgrade" and "Run Kubeadm Join Upgrade" stages.
+func runUpgrade(args []string) int {
+	opts, err := upgrade.ParseArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", upgrade.Command, err)
+		return 2
+	}
+
+	log.InitLogger("/var/log/kube-upgrade.log")
+
+	// release the upgrade lease when the stage is interrupted
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err = upgrade.Run(ctx, opts); err != nil {
+		logrus.Error(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runEtcdSnapshot takes an etcd snapshot, the reconfiguration calls it before regenerating the etcd manifest.
+func runEtcdSnapshot(args []string) int {
+	opts, err := etcd.ParseSnapshotArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", etcd.SnapshotCommand, err)
+		return 2
+	}
+
+	log.InitLogger("/var/log/kube-etcd-snapshot.log")
+
+	path, err := etcd.Snapshot(context.Background(), opts)
+	switch {
+	case errors.Is(err, etcd.ErrNoLocalEtcd):
+		logrus.Info(err)
+	case err != nil:
+		logrus.Error(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	default:
+		fmt.Println(path)
+	}
+	return 0
+}
+
+// runEtcdRestore restores the local etcd member from a snapshot.
+func runEtcdRestore(args []string) int {
+	opts, err := etcd.ParseRestoreArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", etcd.RestoreCommand, err)
+		return 2
+	}
+
+	log.InitLogger("/var/log/kube-etcd-snapshot.log")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err = etcd.Restore(ctx, opts); err != nil {
+		logrus.Error(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runCertsCheck renews the control plane certificates which are about to expire.
+func runCertsCheck(args []string) int {
+	opts, err := certs.ParseArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", certs.Command, err)
+		return 2
+	}
+
+	log.InitLogger("/var/log/kube-certs.log")
+
+	if err = certs.Check(opts); err != nil {
+		logrus.Error(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runImagesImport loads the image archives of a directory into containerd for the image import stages.
+func runImagesImport(args []string) int {
+	opts, err := images.ParseArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", images.Command, err)
+		return 2
+	}
+
+	log.InitLogger("/var/log/import.log")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err = images.Import(ctx, opts); err != nil {
+		logrus.Error(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runImagesVerify checks that containerd holds the images the node needs before kubeadm runs.
+func runImagesVerify(args []string) int {
+	opts, err := images.ParseVerifyArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", images.VerifyCommand, err)
+		return 2
+	}
+
+	log.InitLogger("/var/log/import.log")
+
+	if err = images.Verify(context.Background(), opts); err != nil {
+		logrus.Error(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runPhase runs a stage command and records its progress in the node status.
+func runPhase(args []string) int {
+	opts, err := status.ParsePhaseArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status.PhaseCommand, err)
+		return 2
+	}
+
+	log.InitLogger("/var/log/provider-kubeadm.log")
+
+	if err = status.RunPhase(opts); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// printStatus prints the node status recorded under the cluster root path.
+func printStatus(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet(status.Command, flag.ContinueOnError)
+	rootPath := fs.String("root-path", domain.DefaultRootPath, "cluster root path")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	nodeStatus, err := status.Read(*rootPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read node status: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(nodeStatus); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print node status: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// printToken prints the bootstrap tokens and the certificate key of the current rotation period
+// for kube-token-rotate.sh.
+func printToken(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet(token.Command, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts, err := token.OptionsFromEnv(os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", token.Command, err)
+		return 2
+	}
+
+	if err = token.Print(out, opts, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print bootstrap token: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func handleClusterBoot(event *pluggable.Event) pluggable.EventResponse {
+	logrus.Info("handling cluster boot event")
+
+	var payload bus.EventPayload
+	var config clusterplugin.Config
+	var response pluggable.EventResponse
+
+	// parse the boot payload
+	if err := json.Unmarshal([]byte(event.Data), &payload); err != nil {
+		logrus.Error(fmt.Sprintf("failed to parse boot event: %s", err.Error()))
+		response.Error = fmt.Sprintf("failed to parse boot event: %s", err.Error())
+		return response
+	}
+
+	// parse config from boot payload
+	if err := yaml.Unmarshal([]byte(payload.Config), &config); err != nil {
+		logrus.Error(fmt.Sprintf("failed to parse config from boot event: %s", err.Error()))
+		response.Error = fmt.Sprintf("failed to parse config from boot event: %s", err.Error())
+		return response
+	}
+
+	if config.Cluster == nil {
+		return response
+	}
+
+	cc, err := clusterProvider(*config.Cluster)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("failed to generate cluster config: %s", err.Error()))
+		response.Error = fmt.Sprintf("failed to generate cluster config: %s", err.Error())
+		return response
+	}
+
+	configFilePath := clusterProviderCloudConfigFile
+	if len(config.Cluster.ClusterConfigPath) != 0 {
+		configFilePath = config.Cluster.ClusterConfigPath
+	}
+
+	if err = writeClusterConfig(configFilePath, cc); err != nil {
+		logrus.Error(fmt.Sprintf("failed to write cluster config: %s", err.Error()))
+		response.Error = fmt.Sprintf("failed to write cluster config: %s", err.Error())
+	}
+
+	return response
+}
+
+func writeClusterConfig(path string, cc yip.YipConfig) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString("#cloud-config\n"); err != nil {
+		return err
+	}
+	return yaml.NewEncoder(f).Encode(cc)
+}
+
 func handleClusterReset(event *pluggable.Event) pluggable.EventResponse {
 	logrus.Info("handling cluster reset event")
 
@@ -65,31 +379,96 @@ func handleClusterReset(event *pluggable.Event) pluggable.EventResponse {
 		return response
 	}
 
-	clusterRootPath := utils.GetClusterRootPath(*config.Cluster)
-	cmd := exec.Command("/bin/sh", "-c", filepath.Join(clusterRootPath, "/opt/kubeadm/scripts", "kube-reset.sh"))
-	output, err := cmd.CombinedOutput()
+	opts := reset.OptionsFromProviderOptions(utils.GetClusterRootPath(*config.Cluster), config.Cluster.ProviderOptions)
+	if dir := getEtcdBackupDir(config.Cluster.Options); dir != "" {
+		opts.EtcdSnapshotDirs = append(opts.EtcdSnapshotDirs, dir)
+	}
+	report := reset.Run(opts)
+
+	data, err := json.Marshal(report)
 	if err != nil {
-		logrus.Error(fmt.Sprintf("failed to reset cluster: %s", string(output)))
-		response.Error = fmt.Sprintf("failed to reset cluster: %s", string(output))
+		logrus.Error(fmt.Sprintf("failed to encode reset report: %s", err.Error()))
+	}
+	response.Data = string(data)
+
+	if failed := report.Failed(); len(failed) > 0 {
+		var failures []string
+		for _, step := range failed {
+			failures = append(failures, fmt.Sprintf("%s: %s", step.Step, step.Error))
+		}
+		response.Error = fmt.Sprintf("failed to reset cluster: %s", strings.Join(failures, "; "))
+		logrus.Error(response.Error)
 	}
 
 	return response
 }
 
-func clusterProvider(cluster clusterplugin.Cluster) yip.YipConfig {
-	var finalStages []yip.Stage
+func clusterProvider(cluster clusterplugin.Cluster) (yip.YipConfig, error) {
+	clusterCtx, err := CreateClusterContext(cluster)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
 
-	clusterCtx := CreateClusterContext(cluster)
+	kubernetesVersion, err := utils.ResolveKubernetesVersion(clusterCtx.KubernetesVersion, cluster.ProviderOptions, clusterCtx.RootPath)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+	clusterCtx.KubernetesVersion = kubernetesVersion
 
-	cmpResult, err := utils.IsKubeadmVersionGreaterThan131(clusterCtx.KubernetesVersion)
+	clusterCtx.BootstrapTokenTTL, err = utils.GetBootstrapTokenTTL(cluster.ProviderOptions)
 	if err != nil {
-		logrus.Fatalf("failed to check if kubeadm version is greater than 131: %v", err)
-	} else if cmpResult < 0 {
-		logrus.Info("kubeadm version is less than 1.31")
-		finalStages = append(finalStages, getV1Beta3FinalStage(clusterCtx)...)
-	} else {
-		logrus.Info("kubeadm version is greater than or equal to 1.31")
-		finalStages = append(finalStages, getV1Beta4FinalStage(clusterCtx)...)
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.KubeadmRetry, err = utils.GetKubeadmRetryPolicy(cluster.ProviderOptions)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.IgnorePreflightErrors, err = utils.GetIgnorePreflightErrors(cluster.ProviderOptions, clusterCtx.NodeRole)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.VerifyImages, err = utils.GetVerifyImages(cluster.ProviderOptions)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.KubeVip, err = utils.GetKubeVipConfig(cluster.ProviderOptions, clusterCtx.ControlPlaneHost)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.EtcdSnapshot, err = utils.GetEtcdSnapshotPolicy(cluster.ProviderOptions)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.PKI, err = utils.GetClusterPKI(cluster.ProviderOptions, clusterCtx.RootPath, clusterCtx.NodeRole)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.CACertHashes, err = utils.GetCACertHashes(cluster.ProviderOptions)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	clusterCtx.LocalImagesPublicKey, err = utils.GetLocalImagesPublicKey(cluster.ProviderOptions, clusterCtx.RootPath)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+
+	kubeadmAPI, err := kubeadm.ForKubernetesVersion(clusterCtx.KubernetesVersion)
+	if err != nil {
+		return yip.YipConfig{}, err
+	}
+	logrus.Infof("using kubeadm api %s for kubernetes version %s", kubeadmAPI.Version(), clusterCtx.KubernetesVersion)
+
+	finalStages, err := getFinalStages(clusterCtx, kubeadmAPI)
+	if err != nil {
+		return yip.YipConfig{}, err
 	}
 
 	cfg := yip.YipConfig{
@@ -99,17 +478,26 @@ func clusterProvider(cluster clusterplugin.Cluster) yip.YipConfig {
 		},
 	}
 
-	return cfg
+	return cfg, nil
 }
 
-func CreateClusterContext(cluster clusterplugin.Cluster) *domain.ClusterContext {
+// executable returns the path of the provider binary, the stages call its subcommands.
+var executable = os.Executable
+
+func CreateClusterContext(cluster clusterplugin.Cluster) (*domain.ClusterContext, error) {
 	controlPlaneHost := cluster.ControlPlaneHost
 
 	if _, _, err := net.SplitHostPort(controlPlaneHost); err != nil {
 		controlPlaneHost = net.JoinHostPort(controlPlaneHost, "6443")
 	}
 
+	providerPath, err := executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider path: %w", err)
+	}
+
 	clusterContext := &domain.ClusterContext{
+		ProviderPath:                providerPath,
 		RootPath:                    utils.GetClusterRootPath(cluster),
 		NodeRole:                    string(cluster.Role),
 		EnvConfig:                   cluster.Env,
@@ -126,65 +514,54 @@ func CreateClusterContext(cluster clusterplugin.Cluster) *domain.ClusterContext
 		clusterContext.LocalImagesPath = cluster.LocalImagesPath
 	}
 
-	return clusterContext
+	return clusterContext, nil
 }
 
-func getV1Beta3FinalStage(clusterCtx *domain.ClusterContext) []yip.Stage {
+func getFinalStages(clusterCtx *domain.ClusterContext, kubeadmAPI kubeadm.API) ([]yip.Stage, error) {
 	var finalStages []yip.Stage
-	var kubeadmConfig domain.KubeadmConfigBeta3
 
-	if clusterCtx.UserOptions != "" {
-		userOptions, _ := kyaml.YAMLToJSON([]byte(clusterCtx.UserOptions))
-		_ = json.Unmarshal(userOptions, &kubeadmConfig)
+	if err := kubeadmAPI.ParseUserOptions(clusterCtx.UserOptions); err != nil {
+		return nil, err
 	}
 
-	setClusterSubnetCtx(clusterCtx, kubeadmConfig.ClusterConfiguration.Networking.ServiceSubnet, kubeadmConfig.ClusterConfiguration.Networking.PodSubnet)
+	serviceSubnet, podSubnet := kubeadmAPI.Networking()
+	setClusterSubnetCtx(clusterCtx, serviceSubnet, podSubnet)
 
 	// pre stages
-	finalStages = append(finalStages, getKubeadmPreStages(clusterCtx)...)
+	finalStages = append(finalStages, getKubeadmPreStages(clusterCtx, kubeadmAPI)...)
 
 	switch clusterCtx.NodeRole {
 	case clusterplugin.RoleInit:
-		finalStages = append(finalStages, stages.GetInitYipStagesV1Beta3(clusterCtx, kubeadmConfig)...)
+		initStages, err := stages.GetInitYipStages(clusterCtx, kubeadmAPI)
+		if err != nil {
+			return nil, err
+		}
+		finalStages = append(finalStages, initStages...)
 	case clusterplugin.RoleControlPlane, clusterplugin.RoleWorker:
-		finalStages = append(finalStages, stages.GetJoinYipStagesV1Beta3(clusterCtx, kubeadmConfig)...)
+		joinStages, err := stages.GetJoinYipStages(clusterCtx, kubeadmAPI)
+		if err != nil {
+			return nil, err
+		}
+		finalStages = append(finalStages, joinStages...)
 	}
 
-	return finalStages
+	return finalStages, nil
 }
 
-func getV1Beta4FinalStage(clusterCtx *domain.ClusterContext) []yip.Stage {
-	var finalStages []yip.Stage
-	var kubeadmConfig domain.KubeadmConfigBeta4
+func getKubeadmPreStages(clusterCtx *domain.ClusterContext, kubeadmAPI kubeadm.API) []yip.Stage {
+	preStages := []yip.Stage{stages.GetPreKubeadmProxyStage(clusterCtx)}
 
-	if clusterCtx.UserOptions != "" {
-		userOptions, _ := kyaml.YAMLToJSON([]byte(clusterCtx.UserOptions))
-		_ = json.Unmarshal(userOptions, &kubeadmConfig)
+	// without a containerd block the containerd config of the image is kept
+	if cfg := kubeadmAPI.Containerd(clusterCtx); cfg != nil {
+		preStages = append(preStages, stages.GetPreKubeadmContainerdConfigStage(clusterCtx, cfg))
 	}
 
-	setClusterSubnetCtx(clusterCtx, kubeadmConfig.ClusterConfiguration.Networking.ServiceSubnet, kubeadmConfig.ClusterConfiguration.Networking.PodSubnet)
-
-	// pre stages
-	finalStages = append(finalStages, getKubeadmPreStages(clusterCtx)...)
-
-	switch clusterCtx.NodeRole {
-	case clusterplugin.RoleInit:
-		finalStages = append(finalStages, stages.GetInitYipStagesV1Beta4(clusterCtx, kubeadmConfig)...)
-	case clusterplugin.RoleControlPlane, clusterplugin.RoleWorker:
-		finalStages = append(finalStages, stages.GetJoinYipStagesV1Beta4(clusterCtx, kubeadmConfig)...)
-	}
-
-	return finalStages
-}
-
-func getKubeadmPreStages(clusterCtx *domain.ClusterContext) []yip.Stage {
-	return []yip.Stage{
-		stages.GetPreKubeadmProxyStage(clusterCtx),
-		stages.GetPreKubeadmCommandStages(clusterCtx.RootPath),
+	return append(preStages,
+		stages.GetPreKubeadmCommandStages(clusterCtx),
 		stages.GetPreKubeadmSwapOffDisableStage(),
-		stages.GetPreKubeadmImportCoreK8sImageStage(clusterCtx.RootPath),
+		stages.GetPreKubeadmImportCoreK8sImageStage(clusterCtx),
 		stages.GetPreKubeadmImportLocalImageStage(clusterCtx),
-	}
+	)
 }
 
 func getContainerdServiceFolderName(options map[string]string) string {
@@ -207,3 +584,18 @@ func getKubernetesVersion(config string) string {
 	}
 	return clusterOptions.ClusterConfig.KubernetesVersion
 }
+
+// getEtcdBackupDir returns the dir of the etcdBackup block of the cluster config, the reset also
+// removes the backups of a custom directory.
+func getEtcdBackupDir(config string) string {
+	var clusterOptions struct {
+		EtcdBackup struct {
+			Dir string `yaml:"dir"`
+		} `yaml:"etcdBackup"`
+	}
+	if err := yaml.Unmarshal([]byte(config), &clusterOptions); err != nil {
+		logrus.Errorf("Failed to unmarshal cluster options: %v", err)
+		return ""
+	}
+	return clusterOptions.EtcdBackup.Dir
+}
@@ -1,13 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/kairos-io/kairos-sdk/bus"
 	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"github.com/mudler/go-pluggable"
 	yip "github.com/mudler/yip/pkg/schema"
 	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
 
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/reset"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
 )
 
 // TestCreateClusterContext tests the CreateClusterContext function
@@ -24,7 +36,8 @@ func TestCreateClusterContext(t *testing.T) {
 		},
 	}
 
-	result := CreateClusterContext(cluster)
+	result, err := CreateClusterContext(cluster)
+	g.Expect(err).ToNot(HaveOccurred())
 
 	// Basic validations
 	g.Expect(result.RootPath).To(Equal("/"))
@@ -103,7 +116,8 @@ func TestCreateClusterContextComprehensive(t *testing.T) {
 			g := NewWithT(t)
 
 			// Execute function under test
-			result := CreateClusterContext(tt.cluster)
+			result, err := CreateClusterContext(tt.cluster)
+			g.Expect(err).ToNot(HaveOccurred())
 
 			// Basic validations
 			g.Expect(result.RootPath).To(Equal(tt.expectedRootPath))
@@ -230,7 +244,8 @@ joinConfiguration:
 			g := NewWithT(t)
 
 			// Execute function under test
-			result := clusterProvider(tt.cluster)
+			result, err := clusterProvider(tt.cluster)
+			g.Expect(err).ToNot(HaveOccurred())
 
 			// Basic validations
 			g.Expect(result.Name).To(Equal(tt.expectedName))
@@ -256,3 +271,180 @@ func TestGetKubernetesVersion(t *testing.T) {
 	result := getKubernetesVersion(cluster.Options)
 	g.Expect(result).To(Equal("v1.30.11"))
 }
+
+// TestHandleClusterBoot tests that invalid cluster config is reported in the event response
+func TestHandleClusterBoot(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		expectedError string
+		expectWritten bool
+	}{
+		{
+			name:   "no_cluster",
+			config: `hostname: test`,
+		},
+		{
+			name: "invalid_cluster_config",
+			config: `
+cluster:
+  role: worker
+  control_plane_host: 10.0.0.1
+  cluster_token: abcdef.1234567890123456
+  config: |
+    clusterConfiguration:
+      kubernetesVersion: v1.30.11
+      networking:
+        podSubnet: 10.96.0.0/8
+        serviceSubnet: 10.96.0.0/12`,
+			expectedError: "clusterConfiguration.networking.serviceSubnet",
+		},
+		{
+			name: "valid_cluster_config",
+			config: `
+cluster:
+  role: worker
+  control_plane_host: 10.0.0.1
+  cluster_token: abcdef.1234567890123456
+  config: |
+    clusterConfiguration:
+      kubernetesVersion: v1.30.11`,
+			expectWritten: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			configPath := filepath.Join(t.TempDir(), "cluster.kairos.yaml")
+
+			var config map[string]interface{}
+			g.Expect(yaml.Unmarshal([]byte(tt.config), &config)).To(Succeed())
+			if cluster, ok := config["cluster"].(map[string]interface{}); ok {
+				cluster["cluster_config_path"] = configPath
+			}
+			clusterConfig, err := yaml.Marshal(config)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			data, err := json.Marshal(bus.EventPayload{Config: string(clusterConfig)})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			response := handleClusterBoot(&pluggable.Event{Data: string(data)})
+
+			if tt.expectedError != "" {
+				g.Expect(response.Error).To(ContainSubstring(tt.expectedError))
+			} else {
+				g.Expect(response.Error).To(BeEmpty())
+			}
+
+			if tt.expectWritten {
+				content, err := os.ReadFile(configPath)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(string(content)).To(HavePrefix("#cloud-config\n"))
+				g.Expect(string(content)).To(ContainSubstring("Kubeadm Kairos Cluster Provider"))
+			} else {
+				g.Expect(configPath).ToNot(BeAnExistingFile())
+			}
+		})
+	}
+}
+
+// TestClusterProviderUnresolvableVersion tests that a missing kubernetesVersion is returned as an error
+func TestClusterProviderUnresolvableVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	t.Setenv("PATH", "")
+
+	_, err := clusterProvider(clusterplugin.Cluster{
+		Role:             clusterplugin.RoleWorker,
+		ControlPlaneHost: "10.0.0.1",
+		ClusterToken:     "abcdef.1234567890123456",
+		Options:          `clusterConfiguration: {}`,
+		ProviderOptions: map[string]string{
+			"cluster_root_path": t.TempDir(),
+		},
+	})
+
+	var versionErr *utils.KubernetesVersionError
+	g.Expect(errors.As(err, &versionErr)).To(BeTrue())
+	g.Expect(err.Error()).To(ContainSubstring("clusterConfiguration.kubernetesVersion: not set"))
+}
+
+// TestClusterProviderWithoutProviderPath tests that clusterProvider fails when the provider path is unknown
+func TestClusterProviderWithoutProviderPath(t *testing.T) {
+	g := NewWithT(t)
+
+	original := executable
+	t.Cleanup(func() { executable = original })
+	executable = func() (string, error) { return "", errors.New("readlink /proc/self/exe: no such file or directory") }
+
+	_, err := clusterProvider(clusterplugin.Cluster{
+		Role:             clusterplugin.RoleWorker,
+		ControlPlaneHost: "10.0.0.1",
+		ClusterToken:     "abcdef.1234567890123456",
+		Options:          `clusterConfiguration: {kubernetesVersion: v1.33.2}`,
+	})
+	g.Expect(err).To(MatchError("failed to get provider path: readlink /proc/self/exe: no such file or directory"))
+}
+
+// TestHandleClusterResetDryRun tests that a dry run reset returns the plan in the event response
+func TestHandleClusterResetDryRun(t *testing.T) {
+	g := NewWithT(t)
+
+	data, err := json.Marshal(bus.EventPayload{Config: `
+cluster:
+  role: worker
+  providerConfig:
+    reset_dry_run: "true"
+    reset_keep_cni: "true"
+  config: |
+    etcdBackup:
+      interval: 1h
+      dir: /opt/etcd-backups-custom`})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	response := handleClusterReset(&pluggable.Event{Data: string(data)})
+	g.Expect(response.Error).To(BeEmpty())
+
+	var report reset.Report
+	g.Expect(json.Unmarshal([]byte(response.Data), &report)).To(Succeed())
+	g.Expect(report.DryRun).To(BeTrue())
+	g.Expect(report.Steps).To(ContainElement(reset.StepResult{Step: "run kubeadm reset", Status: reset.StatusPlanned}))
+	g.Expect(report.Steps).ToNot(ContainElement(reset.StepResult{Step: "remove /opt/cni", Status: reset.StatusPlanned}))
+	g.Expect(report.Steps).To(ContainElement(reset.StepResult{Step: "remove /opt/etcd-backups-custom", Status: reset.StatusPlanned}))
+}
+
+// TestPrintStatus tests the printStatus function
+func TestPrintStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	rootPath := t.TempDir()
+	g.Expect(printStatus([]string{"--root-path", rootPath}, io.Discard)).To(Equal(1))
+
+	status.StartPhase(rootPath, status.PhasePre)
+	status.FinishPhase(rootPath, status.PhasePre, errors.New("exit status 1"))
+
+	var out bytes.Buffer
+	g.Expect(printStatus([]string{"--root-path", rootPath}, &out)).To(Equal(0))
+
+	var printed status.Status
+	g.Expect(json.Unmarshal(out.Bytes(), &printed)).To(Succeed())
+	g.Expect(printed.CurrentPhase).To(Equal(status.PhasePre))
+	g.Expect(printed.Phase(status.PhasePre).State).To(Equal(status.StateFailed))
+	g.Expect(printed.Phase(status.PhasePre).LastError).To(Equal("exit status 1"))
+}
+
+// TestPrintToken tests the printToken function
+func TestPrintToken(t *testing.T) {
+	g := NewWithT(t)
+
+	t.Setenv("CLUSTER_TOKEN", "")
+	g.Expect(printToken(nil, io.Discard)).To(Equal(2))
+
+	t.Setenv("CLUSTER_TOKEN", "abcdef.1234567890123456")
+	t.Setenv("TOKEN_TTL_SECONDS", "86400")
+	var out bytes.Buffer
+	g.Expect(printToken(nil, &out)).To(Equal(0))
+	g.Expect(out.String()).To(MatchRegexp(`(?m)^CERTIFICATE_KEY=[a-f0-9]{64}$`))
+}
@@ -0,0 +1,326 @@
+package reset
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	StatusPlanned = "planned"
+	StatusDone    = "done"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Options selects what a cluster reset cleans up.
+type Options struct {
+	RootPath          string
+	DryRun            bool
+	KeepCNI           bool
+	KeepImages        bool
+	KeepIPTables      bool
+	KeepEtcdSnapshots bool
+	// EtcdSnapshotDirs are relative to the root path, directories outside of it are never removed.
+	EtcdSnapshotDirs []string
+}
+
+// StepResult is the outcome of a single reset step.
+type StepResult struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report lists every reset step in the order it was planned or run.
+type Report struct {
+	DryRun bool         `json:"dryRun"`
+	Steps  []StepResult `json:"steps"`
+}
+
+// Failed returns the steps that failed.
+func (r Report) Failed() []StepResult {
+	var failed []StepResult
+	for _, step := range r.Steps {
+		if step.Status == StatusFailed {
+			failed = append(failed, step)
+		}
+	}
+	return failed
+}
+
+type step struct {
+	name string
+	run  func() error
+}
+
+// skipped is returned by a step that had nothing to do.
+type skipped string
+
+func (s skipped) Error() string {
+	return string(s)
+}
+
+// stubbed in tests
+var (
+	runCommand = utils.RunCommand
+	removeAll  = os.RemoveAll
+	isMounted  = isMountPoint
+)
+
+// OptionsFromProviderOptions builds the reset options from the cluster provider options. The etcd
+// snapshot directories are the upgrade snapshot directory and the default backup directory.
+func OptionsFromProviderOptions(rootPath string, options map[string]string) Options {
+	// an invalid snapshot directory was never used, the default one may have been
+	snapshotPolicy, _ := utils.GetEtcdSnapshotPolicy(options)
+
+	return Options{
+		RootPath:          rootPath,
+		DryRun:            isTrue(options[domain.ResetDryRunOption]),
+		KeepCNI:           isTrue(options[domain.ResetKeepCNIOption]),
+		KeepImages:        isTrue(options[domain.ResetKeepImagesOption]),
+		KeepIPTables:      isTrue(options[domain.ResetKeepIPTablesOption]),
+		KeepEtcdSnapshots: isTrue(options[domain.ResetKeepEtcdSnapshotsOption]),
+		EtcdSnapshotDirs:  []string{snapshotPolicy.Dir, domain.DefaultEtcdBackupDir},
+	}
+}
+
+// Run resets the node, or only plans the reset when DryRun is set. Every step is attempted
+// even if an earlier one failed, so that as much as possible is cleaned up.
+func Run(opts Options) Report {
+	report := Report{DryRun: opts.DryRun}
+
+	for _, s := range plan(opts) {
+		result := StepResult{Step: s.name, Status: StatusPlanned}
+
+		if !opts.DryRun {
+			var skip skipped
+			err := s.run()
+			switch {
+			case err == nil:
+				result.Status = StatusDone
+			case errors.As(err, &skip):
+				result.Status = StatusSkipped
+				result.Error = skip.Error()
+			default:
+				result.Status = StatusFailed
+				result.Error = err.Error()
+				logrus.Errorf("reset step %q failed: %v", s.name, err)
+			}
+		}
+
+		report.Steps = append(report.Steps, result)
+	}
+
+	return report
+}
+
+func plan(opts Options) []step {
+	root := opts.RootPath
+
+	steps := []step{kubeadmResetStep(root)}
+
+	if !opts.KeepIPTables {
+		steps = append(steps, step{name: "flush iptables rules", run: FlushIPTables})
+	}
+
+	steps = append(steps, removeSteps(
+		"/etc/kubernetes/etcd",
+		"/etc/kubernetes/manifests",
+		"/etc/kubernetes/pki",
+		"/etc/containerd/config.toml",
+		"/etc/spectro-containerd/config.toml",
+	)...)
+
+	steps = append(steps,
+		stopUnitStep("kubelet.service", false),
+		stopUnitStep("kubeadm-token-rotate.timer", true),
+		stopUnitStep("kubeadm-etcd-backup.timer", true),
+		stopUnitStep("spectro-containerd.service", true),
+		stopUnitStep("containerd.service", true),
+	)
+
+	steps = append(steps, unmountStep("/var/lib/kubelet"))
+	steps = append(steps, removeSteps("/var/lib/kubelet", filepath.Join(root, "var/lib/kubelet"), filepath.Join(root, "usr/local/bin/kubelet"))...)
+
+	if !opts.KeepImages {
+		steps = append(steps, unmountStep("/var/lib/spectro/containerd"))
+		steps = append(steps, removeSteps("/var/lib/spectro/containerd", filepath.Join(root, "var/lib/spectro/containerd"))...)
+	}
+
+	steps = append(steps, unmountStep("/opt/bin"))
+	steps = append(steps, removeSteps("/opt/bin", filepath.Join(root, "opt/bin"))...)
+
+	if !opts.KeepCNI {
+		steps = append(steps, unmountStep("/opt/cni/bin"))
+		steps = append(steps, removeSteps("/opt/cni", filepath.Join(root, "opt/cni"))...)
+	}
+
+	steps = append(steps, unmountStep("/etc/kubernetes"))
+	steps = append(steps, removeSteps("/etc/kubernetes", filepath.Join(root, "etc/kubernetes"))...)
+
+	steps = append(steps, removeSteps(
+		filepath.Join(root, "opt/kubeadm"),
+		filepath.Join(root, "opt/*init"),
+		filepath.Join(root, "opt/*join"),
+	)...)
+	if !opts.KeepEtcdSnapshots {
+		steps = append(steps, removeSteps(etcdSnapshotDirs(opts)...)...)
+	}
+	if !opts.KeepImages {
+		// the containerd root holds the content store of the imported images
+		steps = append(steps, removeSteps(filepath.Join(root, "opt/containerd"), filepath.Join(root, "opt/kube-images"))...)
+	}
+	steps = append(steps, removeSteps(filepath.Join(root, "opt/sentinel_kubeadmversion"))...)
+
+	steps = append(steps, removeSteps(
+		filepath.Join(root, "etc/systemd/system/spectro-kubelet.slice"),
+		filepath.Join(root, "etc/systemd/system/spectro-containerd.slice"),
+		filepath.Join(root, "etc/systemd/system/kubelet.service"),
+		filepath.Join(root, "etc/systemd/system/containerd.service"),
+		filepath.Join(root, "etc/systemd/system/spectro-containerd.service"),
+	)...)
+
+	return append(steps, removeSteps(
+		"/var/log/kube*.log",
+		"/var/log/apiserver",
+		"/var/log/pods",
+	)...)
+}
+
+// etcdSnapshotDirs returns the etcd snapshot directories below the root path.
+func etcdSnapshotDirs(opts Options) []string {
+	var dirs []string
+	for _, dir := range opts.EtcdSnapshotDirs {
+		dir = filepath.Clean(strings.TrimPrefix(dir, "/"))
+		if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") {
+			continue
+		}
+		dirs = append(dirs, filepath.Join(opts.RootPath, dir))
+	}
+	return dirs
+}
+
+func kubeadmResetStep(rootPath string) step {
+	return step{
+		name: "run kubeadm reset",
+		run: func() error {
+			return KubeadmReset(rootPath)
+		},
+	}
+}
+
+// KubeadmReset runs kubeadm reset against the container runtime used by the node.
+func KubeadmReset(rootPath string) error {
+	kubeadm, err := utils.FindKubeadmBinary(rootPath)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"reset", "-f"}
+	if utils.SpectroContainerd() {
+		args = append(args, "--cri-socket", "unix://"+utils.SpectroContainerdSocket)
+	}
+	return runCommand(kubeadm, append(args, "--cleanup-tmp-dir")...)
+}
+
+// FlushIPTables flushes the filter, nat and mangle tables and deletes the custom chains.
+func FlushIPTables() error {
+	for _, args := range [][]string{{"-F"}, {"-t", "nat", "-F"}, {"-t", "mangle", "-F"}, {"-X"}} {
+		if err := runCommand("iptables", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stopUnitStep(unit string, optional bool) step {
+	return step{
+		name: fmt.Sprintf("stop %s", unit),
+		run: func() error {
+			if optional && runCommand("systemctl", "cat", unit) != nil {
+				return skipped("unit not found")
+			}
+			return runCommand("systemctl", "stop", unit)
+		},
+	}
+}
+
+func unmountStep(path string) step {
+	return step{
+		name: fmt.Sprintf("unmount %s", path),
+		run: func() error {
+			if !isMounted(path) {
+				return skipped("not mounted")
+			}
+			return runCommand("umount", "-l", path)
+		},
+	}
+}
+
+// removeSteps returns one step per path, paths may contain glob patterns. Duplicate paths,
+// which happen when the root path is "/", are only removed once.
+func removeSteps(paths ...string) []step {
+	var steps []step
+	seen := map[string]bool{}
+
+	for _, path := range paths {
+		path := filepath.Clean(path)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		steps = append(steps, step{
+			name: fmt.Sprintf("remove %s", path),
+			run: func() error {
+				matches, err := filepath.Glob(path)
+				if err != nil {
+					return err
+				}
+				if len(matches) == 0 {
+					return skipped("not found")
+				}
+
+				var errs []error
+				for _, match := range matches {
+					errs = append(errs, removeAll(match))
+				}
+				return errors.Join(errs...)
+			},
+		})
+	}
+
+	return steps
+}
+
+func isMountPoint(path string) bool {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[1] == path {
+			return true
+		}
+	}
+	return false
+}
+
+func isTrue(value string) bool {
+	b, _ := strconv.ParseBool(value)
+	return b
+}
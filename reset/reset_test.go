@@ -0,0 +1,201 @@
+package reset
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// TestOptionsFromProviderOptions tests the OptionsFromProviderOptions function
+func TestOptionsFromProviderOptions(t *testing.T) {
+	g := NewWithT(t)
+
+	result := OptionsFromProviderOptions("/persistent/spectro", map[string]string{
+		"reset_dry_run":       "true",
+		"reset_keep_cni":      "1",
+		"reset_keep_images":   "false",
+		"reset_keep_iptables": "invalid",
+		"etcd_snapshot_dir":   "/opt/snapshots",
+	})
+
+	g.Expect(result).To(Equal(Options{
+		RootPath:         "/persistent/spectro",
+		DryRun:           true,
+		KeepCNI:          true,
+		EtcdSnapshotDirs: []string{"opt/snapshots", "opt/etcd-backups"},
+	}))
+
+	result = OptionsFromProviderOptions("/", map[string]string{"reset_keep_etcd_snapshots": "true"})
+	g.Expect(result.KeepEtcdSnapshots).To(BeTrue())
+	g.Expect(result.EtcdSnapshotDirs).To(Equal([]string{"opt/etcd-snapshots", "opt/etcd-backups"}))
+}
+
+// TestRunDryRun tests that a dry run only plans the reset
+func TestRunDryRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "full_reset",
+			opts: Options{RootPath: "/", DryRun: true, EtcdSnapshotDirs: []string{"opt/etcd-snapshots", "/opt/etcd-backups", "../etc"}},
+			contains: []string{
+				"run kubeadm reset",
+				"flush iptables rules",
+				"stop kubeadm-etcd-backup.timer",
+				"remove /opt/etcd-snapshots",
+				"remove /opt/etcd-backups",
+				"remove /var/lib/spectro/containerd",
+				"remove /opt/cni",
+				"remove /opt/containerd",
+				"remove /opt/kube-images",
+				"remove /etc/containerd/config.toml",
+				"remove /etc/spectro-containerd/config.toml",
+			},
+			notContains: []string{
+				"remove /etc",
+			},
+		},
+		{
+			name: "keep_etcd_snapshots",
+			opts: Options{RootPath: "/persistent/spectro", DryRun: true, KeepEtcdSnapshots: true, EtcdSnapshotDirs: []string{"opt/etcd-snapshots"}},
+			contains: []string{
+				"stop kubeadm-etcd-backup.timer",
+				"remove /persistent/spectro/opt/kubeadm",
+			},
+			notContains: []string{
+				"remove /persistent/spectro/opt/etcd-snapshots",
+			},
+		},
+		{
+			name: "keep_images",
+			opts: Options{RootPath: "/persistent/spectro", DryRun: true, KeepImages: true},
+			contains: []string{
+				"remove /persistent/spectro/opt/kubeadm",
+				"remove /etc/containerd/config.toml",
+				"remove /etc/spectro-containerd/config.toml",
+			},
+			notContains: []string{
+				"unmount /var/lib/spectro/containerd",
+				"remove /var/lib/spectro/containerd",
+				"remove /persistent/spectro/var/lib/spectro/containerd",
+				"remove /persistent/spectro/opt/containerd",
+				"remove /persistent/spectro/opt/kube-images",
+			},
+		},
+		{
+			name: "keep_everything_optional",
+			opts: Options{RootPath: "/", DryRun: true, KeepCNI: true, KeepImages: true, KeepIPTables: true},
+			contains: []string{
+				"run kubeadm reset",
+				"remove /opt/bin",
+			},
+			notContains: []string{
+				"flush iptables rules",
+				"unmount /var/lib/spectro/containerd",
+				"remove /var/lib/spectro/containerd",
+				"unmount /opt/cni/bin",
+				"remove /opt/cni",
+				"remove /opt/kube-images",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			stubRun(t, func(name string, args ...string) error {
+				t.Fatalf("unexpected command in dry run: %s %v", name, args)
+				return nil
+			})
+			removeAll = func(path string) error {
+				t.Fatalf("unexpected removal in dry run: %s", path)
+				return nil
+			}
+
+			report := Run(tt.opts)
+
+			g.Expect(report.DryRun).To(BeTrue())
+			var steps []string
+			for _, step := range report.Steps {
+				g.Expect(step.Status).To(Equal(StatusPlanned))
+				steps = append(steps, step.Step)
+			}
+			g.Expect(steps).To(ContainElements(tt.contains))
+			for _, step := range tt.notContains {
+				g.Expect(steps).ToNot(ContainElement(step))
+			}
+		})
+	}
+}
+
+// TestRun tests that a reset runs every step and reports failures per step
+func TestRun(t *testing.T) {
+	g := NewWithT(t)
+
+	rootPath := t.TempDir()
+	for _, path := range []string{"usr/bin/kubeadm", "opt/kubeadm.init", "opt/post-kubeadm.init", "opt/kubeadm/kubeadm.yaml"} {
+		g.Expect(os.MkdirAll(filepath.Join(rootPath, filepath.Dir(path)), 0755)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(rootPath, path), nil, 0755)).To(Succeed())
+	}
+
+	var commands []string
+	stubRun(t, func(name string, args ...string) error {
+		command := strings.Join(append([]string{filepath.Base(name)}, args...), " ")
+		commands = append(commands, command)
+		switch command {
+		case "iptables -t nat -F":
+			return errors.New("table nat does not exist")
+		case "systemctl cat kubeadm-token-rotate.timer":
+			return errors.New("no such unit")
+		}
+		return nil
+	})
+
+	var removed []string
+	removeAll = func(path string) error {
+		removed = append(removed, path)
+		return nil
+	}
+
+	report := Run(Options{RootPath: rootPath})
+
+	g.Expect(report.DryRun).To(BeFalse())
+	g.Expect(commands).To(ContainElements(
+		"kubeadm reset -f --cleanup-tmp-dir",
+		"iptables -F",
+		"systemctl stop kubelet.service",
+		"systemctl stop containerd.service",
+	))
+	g.Expect(commands).ToNot(ContainElement("iptables -X"))
+	g.Expect(commands).ToNot(ContainElement("systemctl stop kubeadm-token-rotate.timer"))
+
+	g.Expect(removed).To(ContainElements(
+		filepath.Join(rootPath, "opt/kubeadm"),
+		filepath.Join(rootPath, "opt/kubeadm.init"),
+		filepath.Join(rootPath, "opt/post-kubeadm.init"),
+	))
+
+	g.Expect(report.Failed()).To(Equal([]StepResult{
+		{Step: "flush iptables rules", Status: StatusFailed, Error: "table nat does not exist"},
+	}))
+	g.Expect(report.Steps).To(ContainElement(StepResult{Step: "stop kubeadm-token-rotate.timer", Status: StatusSkipped, Error: "unit not found"}))
+	g.Expect(report.Steps).To(ContainElement(StepResult{Step: "unmount /var/lib/kubelet", Status: StatusSkipped, Error: "not mounted"}))
+}
+
+func stubRun(t *testing.T, run func(name string, args ...string) error) {
+	originalRun, originalRemoveAll, originalIsMounted := runCommand, removeAll, isMounted
+	t.Cleanup(func() {
+		runCommand, removeAll, isMounted = originalRun, originalRemoveAll, originalIsMounted
+	})
+
+	runCommand = run
+	isMounted = func(string) bool { return false }
+}
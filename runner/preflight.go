@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	minControlPlaneCPUs      = 2
+	minControlPlaneMemoryMiB = 1700
+)
+
+// preflightCheck mirrors a kubeadm preflight check, name is the one kubeadm ignores.
+type preflightCheck struct {
+	name string
+	// controlPlaneOnly checks are skipped on worker nodes.
+	controlPlaneOnly bool
+	check            func() error
+}
+
+// stubbed in tests
+var (
+	manifestsDir = "/etc/kubernetes/manifests"
+	numCPU       = runtime.NumCPU
+	memoryMiB    = readMemoryMiB
+	portInUse    = isPortInUse
+)
+
+func preflightChecks() []preflightCheck {
+	return []preflightCheck{
+		{name: "NumCPU", controlPlaneOnly: true, check: checkNumCPU},
+		{name: "Mem", controlPlaneOnly: true, check: checkMemory},
+		{name: "DirAvailable--etc-kubernetes-manifests", check: checkManifestsDir},
+		{name: "Port-10250", check: checkPort(10250)},
+		{name: "Port-10257", controlPlaneOnly: true, check: checkPort(10257)},
+		{name: "Port-10259", controlPlaneOnly: true, check: checkPort(10259)},
+	}
+}
+
+// runPreflight runs the checks kubeadm fails on before the first attempt, and records the failed
+// ones in the node status with whether the ignored preflight errors waive them. kubeadm still runs
+// its own checks and decides whether the node can be set up.
+func runPreflight(opts Options) {
+	failed := []status.PreflightCheck{}
+	for _, c := range preflightChecks() {
+		if c.controlPlaneOnly && opts.NodeRole == clusterplugin.RoleWorker {
+			continue
+		}
+		err := c.check()
+		if err == nil {
+			continue
+		}
+
+		waived := utils.ContainsPreflightCheck(opts.IgnorePreflightErrors, c.name) || utils.ContainsPreflightCheck(opts.IgnorePreflightErrors, utils.PreflightAll)
+		if waived {
+			logrus.Warnf("preflight check %s waived: %v", c.name, err)
+		} else {
+			logrus.Errorf("preflight check %s failed: %v", c.name, err)
+		}
+		failed = append(failed, status.PreflightCheck{Name: c.name, Error: err.Error(), Waived: waived})
+	}
+
+	if err := status.Update(opts.RootPath, func(s *status.Status) { s.Preflight = failed }); err != nil {
+		logrus.Errorf("failed to record preflight checks: %v", err)
+	}
+}
+
+func checkNumCPU() error {
+	if cpus := numCPU(); cpus < minControlPlaneCPUs {
+		return fmt.Errorf("the number of available CPUs %d is less than the required %d", cpus, minControlPlaneCPUs)
+	}
+	return nil
+}
+
+func checkMemory() error {
+	mem, err := memoryMiB()
+	if err != nil {
+		return err
+	}
+	if mem < minControlPlaneMemoryMiB {
+		return fmt.Errorf("the system RAM (%d MB) is less than the minimum %d MB", mem, minControlPlaneMemoryMiB)
+	}
+	return nil
+}
+
+func checkManifestsDir() error {
+	entries, err := os.ReadDir(manifestsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", manifestsDir)
+	}
+	return nil
+}
+
+func checkPort(port int) func() error {
+	return func() error {
+		if portInUse(port) {
+			return fmt.Errorf("port %d is in use", port)
+		}
+		return nil
+	}
+}
+
+func readMemoryMiB() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse MemTotal: %w", err)
+		}
+		return kb / 1024, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("MemTotal not found in /proc/meminfo")
+}
+
+func isPortInUse(port int) bool {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return true
+	}
+	_ = ln.Close()
+	return false
+}
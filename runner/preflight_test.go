@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+)
+
+func stubPreflight(t *testing.T, cpus int, mem uint64, dir string, usedPorts []int) {
+	originalDir, originalNumCPU, originalMemoryMiB, originalPortInUse := manifestsDir, numCPU, memoryMiB, portInUse
+	t.Cleanup(func() {
+		manifestsDir, numCPU, memoryMiB, portInUse = originalDir, originalNumCPU, originalMemoryMiB, originalPortInUse
+	})
+
+	manifestsDir = dir
+	numCPU = func() int { return cpus }
+	memoryMiB = func() (uint64, error) { return mem, nil }
+	portInUse = func(port int) bool {
+		for _, p := range usedPorts {
+			if p == port {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TestRunPreflight tests the runPreflight function
+func TestRunPreflight(t *testing.T) {
+	tests := []struct {
+		name                  string
+		nodeRole              string
+		cpus                  int
+		mem                   uint64
+		manifests             []string
+		usedPorts             []int
+		ignorePreflightErrors []string
+		expected              []status.PreflightCheck
+	}{
+		{
+			name:     "all_checks_pass",
+			nodeRole: "init",
+			cpus:     4,
+			mem:      8192,
+		},
+		{
+			name:                  "small_control_plane_with_kube_vip",
+			nodeRole:              "init",
+			cpus:                  1,
+			mem:                   1024,
+			manifests:             []string{"kube-vip.yaml"},
+			ignorePreflightErrors: []string{"numcpu", "DirAvailable--etc-kubernetes-manifests"},
+			expected: []status.PreflightCheck{
+				{Name: "NumCPU", Error: "the number of available CPUs 1 is less than the required 2", Waived: true},
+				{Name: "Mem", Error: "the system RAM (1024 MB) is less than the minimum 1700 MB"},
+				{Name: "DirAvailable--etc-kubernetes-manifests", Error: "MANIFESTS is not empty", Waived: true},
+			},
+		},
+		{
+			name:      "worker_skips_control_plane_checks",
+			nodeRole:  "worker",
+			cpus:      1,
+			mem:       512,
+			usedPorts: []int{10250, 10257},
+			expected: []status.PreflightCheck{
+				{Name: "Port-10250", Error: "port 10250 is in use"},
+			},
+		},
+		{
+			name:                  "all_waives_every_check",
+			nodeRole:              "controlplane",
+			cpus:                  4,
+			mem:                   8192,
+			usedPorts:             []int{10259},
+			ignorePreflightErrors: []string{"all"},
+			expected: []status.PreflightCheck{
+				{Name: "Port-10259", Error: "port 10259 is in use", Waived: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rootPath := t.TempDir()
+			dir := filepath.Join(t.TempDir(), "manifests")
+			g.Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			for _, name := range tt.manifests {
+				g.Expect(os.WriteFile(filepath.Join(dir, name), []byte("kind: Pod\n"), 0644)).To(Succeed())
+			}
+			stubPreflight(t, tt.cpus, tt.mem, dir, tt.usedPorts)
+
+			runPreflight(Options{NodeRole: tt.nodeRole, RootPath: rootPath, IgnorePreflightErrors: tt.ignorePreflightErrors})
+
+			for i := range tt.expected {
+				if tt.expected[i].Error == "MANIFESTS is not empty" {
+					tt.expected[i].Error = dir + " is not empty"
+				}
+			}
+			nodeStatus, err := status.Read(rootPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(nodeStatus.Preflight).To(Equal(tt.expected))
+		})
+	}
+}
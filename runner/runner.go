@@ -0,0 +1,437 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/images"
+	"github.com/kairos-io/kairos/provider-kubeadm/reset"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	// Command is the provider subcommand that runs the kubeadm init or join runner.
+	Command = "kubeadm-run"
+
+	ActionInit = "init"
+	ActionJoin = "join"
+
+	ClassPreflight = "preflight"
+	ClassNetwork   = "network"
+	ClassEtcd      = "etcd"
+	ClassTimeout   = "timeout"
+	ClassUnknown   = "unknown"
+
+	// FailureMarker is written under the root path when the runner gives up.
+	FailureMarker = "opt/kubeadm/failure.json"
+
+	// CertificateKeysFile lists the certificate keys a control plane node can find the
+	// kubeadm-certs secret encrypted with while it joins, one per line.
+	CertificateKeysFile = "opt/kubeadm/certificate-keys"
+
+	// certificateKeyError is logged by kubeadm join when the kubeadm-certs secret was uploaded with
+	// another certificate key.
+	certificateKeyError = "error decoding secret data with provided key"
+
+	kubeVipManifest = "/etc/kubernetes/manifests/kube-vip.yaml"
+)
+
+// Options configures a kubeadm init or join run.
+type Options struct {
+	Action      string
+	NodeRole    string
+	RootPath    string
+	Retry       domain.RetryPolicy
+	HTTPProxy   string
+	HTTPSProxy  string
+	NoProxy     string
+	ProxyConfig bool
+	// IgnorePreflightErrors is passed to kubeadm, `all` waives every check.
+	IgnorePreflightErrors []string
+}
+
+// Failure is the content of the failure marker.
+type Failure struct {
+	Action   string    `json:"action"`
+	Class    string    `json:"class"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+var certificateKeyRegexp = regexp.MustCompile(`certificateKey: ([0-9a-f]+)`)
+
+// stubbed in tests
+var (
+	runKubeadm = func(opts Options, args []string) (string, error) {
+		kubeadm, err := utils.FindKubeadmBinary(opts.RootPath)
+		if err != nil {
+			return err.Error(), err
+		}
+
+		var output bytes.Buffer
+		cmd := exec.Command(kubeadm, args...)
+		cmd.Env = environment(opts)
+		cmd.Stdout = io.MultiWriter(&output, logrus.StandardLogger().Out)
+		cmd.Stderr = cmd.Stdout
+		err = cmd.Run()
+		return output.String(), err
+	}
+	resetNode = resetKubeadmNode
+	sleep     = time.Sleep
+	now       = time.Now
+	pkiDir    = "/etc/kubernetes/pki"
+)
+
+// Args returns the provider arguments that run the runner with the given options.
+func Args(opts Options) []string {
+	args := []string{
+		Command,
+		"--action", opts.Action,
+		"--role", opts.NodeRole,
+		"--root-path", opts.RootPath,
+		"--max-attempts", strconv.Itoa(opts.Retry.MaxAttempts),
+		"--backoff", opts.Retry.Backoff.String(),
+		"--max-backoff", opts.Retry.MaxBackoff.String(),
+	}
+	if len(opts.IgnorePreflightErrors) > 0 {
+		args = append(args, "--ignore-preflight-errors", strings.Join(opts.IgnorePreflightErrors, ","))
+	}
+	if opts.ProxyConfig {
+		args = append(args, "--http-proxy", opts.HTTPProxy, "--https-proxy", opts.HTTPSProxy, "--no-proxy", opts.NoProxy)
+	}
+	return args
+}
+
+// ParseArgs parses the arguments following the runner Command.
+func ParseArgs(args []string) (Options, error) {
+	var opts Options
+	var ignorePreflightErrors string
+
+	fs := flag.NewFlagSet(Command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.Action, "action", "", "init or join")
+	fs.StringVar(&opts.NodeRole, "role", "", "node role")
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.IntVar(&opts.Retry.MaxAttempts, "max-attempts", domain.DefaultKubeadmMaxAttempts, "maximum attempts, 0 retries forever")
+	fs.DurationVar(&opts.Retry.Backoff, "backoff", domain.DefaultKubeadmBackoff, "initial backoff between attempts")
+	fs.DurationVar(&opts.Retry.MaxBackoff, "max-backoff", domain.DefaultKubeadmMaxBackoff, "maximum backoff between attempts")
+	fs.StringVar(&ignorePreflightErrors, "ignore-preflight-errors", "", "comma separated preflight checks whose errors are ignored")
+	fs.StringVar(&opts.HTTPProxy, "http-proxy", "", "http proxy")
+	fs.StringVar(&opts.HTTPSProxy, "https-proxy", "", "https proxy")
+	fs.StringVar(&opts.NoProxy, "no-proxy", "", "no proxy")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if opts.Action != ActionInit && opts.Action != ActionJoin {
+		return opts, fmt.Errorf("invalid action %q, must be %s or %s", opts.Action, ActionInit, ActionJoin)
+	}
+
+	for _, check := range strings.Split(ignorePreflightErrors, ",") {
+		if check != "" {
+			opts.IgnorePreflightErrors = append(opts.IgnorePreflightErrors, check)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if strings.HasSuffix(f.Name, "proxy") {
+			opts.ProxyConfig = true
+		}
+	})
+	return opts, nil
+}
+
+// Run runs kubeadm init or join until it succeeds or the attempts are exhausted. Network
+// failures during preflight or discovery are retried as is and do not count toward the
+// attempts, so that a node which boots before the control plane is reachable keeps waiting for
+// it. Every other failure resets the node before the next attempt.
+// When the runner gives up a failure marker is written for operators.
+func Run(opts Options) error {
+	markerPath := filepath.Join(opts.RootPath, FailureMarker)
+	_ = os.Remove(markerPath)
+
+	phase := status.PhaseInit
+	if opts.Action == ActionJoin {
+		phase = status.PhaseJoin
+	}
+
+	runPreflight(opts)
+	if opts.Action == ActionJoin && skipsCAVerification(opts.RootPath) {
+		logrus.Warn("INSECURE: kubeadm join skips the verification of the cluster CA and trusts the first API server it reaches, set ca_cert_hashes or ca_cert to pin the CA")
+	}
+
+	backoff := opts.Retry.Backoff
+	failures := 0
+	for attempt := 1; ; attempt++ {
+		if opts.Action == ActionInit {
+			installClusterCA(opts.RootPath)
+		}
+
+		status.StartPhase(opts.RootPath, phase)
+		output, err := runKubeadm(opts, kubeadmArgs(opts))
+		if err == nil {
+			status.FinishPhase(opts.RootPath, phase, nil)
+			logrus.Infof("kubeadm %s succeeded after %d attempt(s)", opts.Action, attempt)
+			return nil
+		}
+
+		class := Classify(output)
+		status.FinishPhase(opts.RootPath, phase, fmt.Errorf("%s error: %s", class, errorLine(output)))
+		logrus.Errorf("kubeadm %s attempt %d failed with a %s error: %v", opts.Action, attempt, class, err)
+
+		if class != ClassNetwork {
+			failures++
+		}
+		if opts.Retry.MaxAttempts > 0 && failures >= opts.Retry.MaxAttempts {
+			failure := Failure{
+				Action:   opts.Action,
+				Class:    class,
+				Attempts: attempt,
+				Error:    errorLine(output),
+				Time:     now().UTC(),
+			}
+			if markerErr := writeFailureMarker(markerPath, failure); markerErr != nil {
+				logrus.Errorf("failed to write failure marker: %v", markerErr)
+			}
+			return fmt.Errorf("kubeadm %s failed after %d attempts with a %s error: %s", opts.Action, attempt, class, failure.Error)
+		}
+
+		if opts.Action == ActionJoin && strings.Contains(output, certificateKeyError) {
+			if keyErr := useNextCertificateKey(opts.RootPath); keyErr != nil {
+				logrus.Errorf("failed to switch to the certificate key of the next rotation period: %v", keyErr)
+			}
+		}
+
+		if class != ClassNetwork {
+			if resetErr := resetNode(opts); resetErr != nil {
+				logrus.Errorf("failed to reset node after kubeadm %s failure: %v", opts.Action, resetErr)
+			}
+		}
+
+		logrus.Infof("retrying kubeadm %s in %s", opts.Action, backoff)
+		sleep(backoff)
+
+		backoff *= 2
+		if opts.Retry.MaxBackoff > 0 && backoff > opts.Retry.MaxBackoff {
+			backoff = opts.Retry.MaxBackoff
+		}
+	}
+}
+
+// Classify returns the class of a failed kubeadm run from its output. Only failures before
+// kubeadm changed the node, in preflight or discovery, are classified as network errors.
+func Classify(output string) string {
+	line := strings.ToLower(errorLine(output))
+
+	if phase := failedPhase(line); phase == "" || phase == "preflight" || strings.HasPrefix(phase, "discovery") {
+		for _, s := range []string{"connection refused", "no route to host", "network is unreachable", "i/o timeout", "connection reset by peer", "tls handshake timeout", "no such host"} {
+			if strings.Contains(line, s) {
+				return ClassNetwork
+			}
+		}
+	}
+
+	switch {
+	case strings.Contains(line, "error execution phase preflight"):
+		return ClassPreflight
+	case strings.Contains(line, "etcd"):
+		return ClassEtcd
+	case strings.Contains(line, "wait-control-plane"), strings.Contains(line, "timed out"), strings.Contains(line, "deadline exceeded"):
+		return ClassTimeout
+	}
+	return ClassUnknown
+}
+
+// failedPhase returns the phase named in a kubeadm "error execution phase" line.
+func failedPhase(line string) string {
+	_, phase, found := strings.Cut(line, "error execution phase ")
+	if !found {
+		return ""
+	}
+	phase, _, _ = strings.Cut(phase, ":")
+	return strings.TrimSpace(phase)
+}
+
+// errorLine returns the line kubeadm reports its failure on.
+func errorLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.Contains(lines[i], "error execution phase") {
+			return strings.TrimSpace(lines[i])
+		}
+	}
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func kubeadmArgs(opts Options) []string {
+	args := []string{opts.Action, "--config", filepath.Join(opts.RootPath, "opt/kubeadm/kubeadm.yaml")}
+	if opts.Action == ActionInit {
+		args = append(args, "--upload-certs")
+	}
+	if len(opts.IgnorePreflightErrors) > 0 {
+		args = append(args, "--ignore-preflight-errors="+strings.Join(opts.IgnorePreflightErrors, ","))
+	}
+	return append(args, "-v=5")
+}
+
+func environment(opts Options) []string {
+	if !opts.ProxyConfig {
+		return utils.GetCommandEnv(opts.RootPath, nil)
+	}
+	return utils.GetCommandEnv(opts.RootPath, map[string]string{
+		"HTTP_PROXY":  opts.HTTPProxy,
+		"HTTPS_PROXY": opts.HTTPSProxy,
+		"NO_PROXY":    opts.NoProxy,
+	})
+}
+
+// resetKubeadmNode cleans up a failed kubeadm run, keeping the kube-vip manifest.
+func resetKubeadmNode(opts Options) error {
+	root := opts.RootPath
+	backup := filepath.Join(root, "opt/kubeadm/kube-vip.yaml")
+	keepKubeVip := opts.NodeRole != clusterplugin.RoleWorker
+
+	if keepKubeVip {
+		if err := copyFile(kubeVipManifest, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.Errorf("failed to back up kube-vip manifest: %v", err)
+		}
+	}
+
+	var errs []error
+	errs = append(errs, reset.KubeadmReset(root), reset.FlushIPTables())
+	for _, path := range []string{"/etc/kubernetes/etcd", "/etc/kubernetes/manifests", "/etc/kubernetes/pki", filepath.Join(root, "etc/cni/net.d")} {
+		errs = append(errs, os.RemoveAll(path))
+	}
+
+	if _, err := os.Stat("/run/systemd/system/etc-cni-net.d.mount"); err == nil {
+		errs = append(errs, os.MkdirAll(filepath.Join(root, "etc/cni/net.d"), 0755))
+		errs = append(errs, utils.RunCommand("systemctl", "restart", "etc-cni-net.d.mount"))
+	}
+
+	errs = append(errs, utils.RunCommand("systemctl", "daemon-reload"))
+	for _, unit := range []string{"spectro-containerd", "containerd"} {
+		if utils.RunCommand("systemctl", "cat", unit) == nil {
+			errs = append(errs, utils.RunCommand("systemctl", "restart", unit))
+		}
+	}
+	errs = append(errs, images.Import(context.Background(), images.Options{RootPath: root, Dir: filepath.Join(root, "opt/kube-images"), Concurrency: images.DefaultConcurrency}))
+
+	if keepKubeVip {
+		if err := copyFile(backup, kubeVipManifest); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to restore kube-vip manifest: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// useNextCertificateKey switches the join config to the next key of the certificate keys file. The
+// kubeadm-certs secret is re-uploaded with a new key at every bootstrap token rotation, so a node
+// which generated its join config before the rotation has to join with the key of the next period.
+func useNextCertificateKey(rootPath string) error {
+	content, err := os.ReadFile(filepath.Join(rootPath, CertificateKeysFile))
+	if err != nil {
+		return err
+	}
+	keys := strings.Fields(string(content))
+
+	configPath := filepath.Join(rootPath, "opt/kubeadm/kubeadm.yaml")
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	match := certificateKeyRegexp.FindSubmatch(config)
+	if match == nil {
+		return errors.New("join config has no certificate key")
+	}
+
+	// a key which is not listed is older than all of them
+	next := slices.Index(keys, string(match[1])) + 1
+	if next >= len(keys) {
+		return errors.New("no certificate key of a later rotation period")
+	}
+	logrus.Info("kubeadm-certs was uploaded with another certificate key, retrying with the key of the next rotation period")
+	config = bytes.Replace(config, match[0], []byte("certificateKey: "+keys[next]), 1)
+	return os.WriteFile(configPath, config, info.Mode().Perm())
+}
+
+// skipsCAVerification reports whether the join config discovers the cluster without verifying its CA.
+func skipsCAVerification(rootPath string) bool {
+	content, err := os.ReadFile(filepath.Join(rootPath, "opt/kubeadm/kubeadm.yaml"))
+	return err == nil && bytes.Contains(content, []byte("unsafeSkipCAVerification: true"))
+}
+
+// installClusterCA installs the CAs and service account key of the provider options before
+// kubeadm init. They have to be reinstalled after every reset.
+// A certificate is only installed with its key, the CA of an external etcd is not a cluster CA.
+func installClusterCA(rootPath string) {
+	for _, pair := range [][2]string{
+		{"ca.crt", "ca.key"},
+		{"front-proxy-ca.crt", "front-proxy-ca.key"},
+		{"etcd/ca.crt", "etcd/ca.key"},
+		{"sa.pub", "sa.key"},
+	} {
+		if _, err := os.Stat(filepath.Join(rootPath, "opt/kubeadm/pki", pair[1])); err != nil {
+			continue
+		}
+		for _, name := range pair {
+			target := filepath.Join(pkiDir, name)
+			if _, err := os.Stat(target); err == nil {
+				continue
+			}
+			if err := copyFile(filepath.Join(rootPath, "opt/kubeadm/pki", name), target); err != nil {
+				logrus.Errorf("failed to install %s: %v", name, err)
+			}
+		}
+	}
+}
+
+func writeFailureMarker(path string, failure Failure) error {
+	content, err := json.MarshalIndent(failure, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, content, info.Mode().Perm())
+}
@@ -0,0 +1,368 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+)
+
+// TestArgs tests that ParseArgs parses the arguments built by Args
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "without_proxy",
+			opts: Options{
+				Action:   ActionInit,
+				NodeRole: "init",
+				RootPath: "/persistent/spectro",
+				Retry:    domain.RetryPolicy{MaxAttempts: 5, Backoff: 10 * time.Second, MaxBackoff: time.Minute},
+			},
+		},
+		{
+			name: "with_proxy",
+			opts: Options{
+				Action:      ActionJoin,
+				NodeRole:    "worker",
+				RootPath:    "/",
+				Retry:       domain.RetryPolicy{MaxAttempts: 0, Backoff: time.Second, MaxBackoff: time.Second},
+				ProxyConfig: true,
+				HTTPProxy:   "http://proxy.example.com:8080",
+				NoProxy:     "10.0.0.0/8,.svc",
+			},
+		},
+		{
+			name: "with_ignored_preflight_errors",
+			opts: Options{
+				Action:                ActionInit,
+				NodeRole:              "init",
+				RootPath:              "/",
+				Retry:                 domain.RetryPolicy{MaxAttempts: 1, Backoff: time.Second, MaxBackoff: time.Second},
+				IgnorePreflightErrors: []string{"NumCPU", "Mem"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			args := Args(tt.opts)
+			g.Expect(args[0]).To(Equal(Command))
+
+			result, err := ParseArgs(args[1:])
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.opts))
+		})
+	}
+}
+
+// TestParseArgsInvalidAction tests that ParseArgs rejects unknown actions
+func TestParseArgsInvalidAction(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := ParseArgs([]string{"--action", "upgrade"})
+	g.Expect(err).To(MatchError(ContainSubstring(`invalid action "upgrade"`)))
+}
+
+// TestClassify tests the Classify function
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			name:     "preflight",
+			output:   "[preflight] Running pre-flight checks\nerror execution phase preflight: [preflight] Some fatal errors occurred:\n\t[ERROR Port-6443]: Port 6443 is in use",
+			expected: ClassPreflight,
+		},
+		{
+			name:     "discovery_network",
+			output:   `error execution phase preflight: couldn't validate the identity of the API Server: Get "https://10.0.0.1:6443/api/v1/namespaces/kube-public/configmaps/cluster-info?timeout=10s": dial tcp 10.0.0.1:6443: connect: connection refused`,
+			expected: ClassNetwork,
+		},
+		{
+			name:     "kubelet_start_network",
+			output:   `error execution phase kubelet-start: error uploading crisocket: Get "https://10.0.0.1:6443/api/v1/nodes/worker": dial tcp 10.0.0.1:6443: connect: connection refused`,
+			expected: ClassUnknown,
+		},
+		{
+			name:     "control_plane_join_network",
+			output:   `error execution phase control-plane-join/etcd: error creating local etcd static pod manifest file: dial tcp 10.0.0.1:2379: i/o timeout`,
+			expected: ClassEtcd,
+		},
+		{
+			name:     "upload_config_network",
+			output:   `error execution phase upload-config/kubelet: Get "https://10.0.0.1:6443/api/v1/namespaces/kube-system/configmaps/kubelet-config": net/http: TLS handshake timeout`,
+			expected: ClassUnknown,
+		},
+		{
+			name:     "etcd",
+			output:   "error execution phase control-plane-join/etcd: error creating local etcd static pod manifest file: etcdserver: re-configuration failed due to not enough started members",
+			expected: ClassEtcd,
+		},
+		{
+			name:     "timeout",
+			output:   "[kubelet-check] The kubelet is not healthy: Get \"http://127.0.0.1:10248/healthz\": dial tcp 127.0.0.1:10248: connect: connection refused\nerror execution phase wait-control-plane: couldn't initialize a Kubernetes cluster",
+			expected: ClassTimeout,
+		},
+		{
+			name:     "unknown",
+			output:   "something unexpected happened",
+			expected: ClassUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(Classify(tt.output)).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestRun tests the retry, reset and failure marker behaviour of Run
+func TestRun(t *testing.T) {
+	// a worker which boots long before the control plane is reachable
+	var unreachable []string
+	var unreachableSleeps []time.Duration
+	for i := 0; i < 12; i++ {
+		unreachable = append(unreachable, "dial tcp 10.0.0.1:6443: connect: connection refused")
+		unreachableSleeps = append(unreachableSleeps, min(10*time.Second<<i, 30*time.Second))
+	}
+
+	tests := []struct {
+		name             string
+		maxAttempts      int
+		outputs          []string
+		expectErr        bool
+		expectedAttempts int
+		expectedResets   int
+		expectedSleeps   []time.Duration
+		expectedClass    string
+	}{
+		{
+			name:             "success_after_network_errors",
+			maxAttempts:      5,
+			outputs:          []string{"dial tcp 10.0.0.1:6443: connect: no route to host", "dial tcp 10.0.0.1:6443: connect: connection refused", ""},
+			expectedAttempts: 3,
+			expectedResets:   0,
+			expectedSleeps:   []time.Duration{10 * time.Second, 20 * time.Second},
+		},
+		{
+			name:             "network_errors_do_not_count_toward_max_attempts",
+			maxAttempts:      10,
+			outputs:          append(unreachable, ""),
+			expectedAttempts: 13,
+			expectedResets:   0,
+			expectedSleeps:   unreachableSleeps,
+		},
+		{
+			name:        "reset_after_network_error_past_preflight",
+			maxAttempts: 5,
+			outputs: []string{
+				`error execution phase preflight: couldn't validate the identity of the API Server: dial tcp 10.0.0.1:6443: connect: connection refused`,
+				`error execution phase kubelet-start: error uploading crisocket: dial tcp 10.0.0.1:6443: connect: connection refused`,
+				"",
+			},
+			expectedAttempts: 3,
+			expectedResets:   1,
+			expectedSleeps:   []time.Duration{10 * time.Second, 20 * time.Second},
+		},
+		{
+			name:        "gives_up_after_max_attempts",
+			maxAttempts: 4,
+			outputs: []string{
+				"dial tcp 10.0.0.1:6443: connect: connection refused",
+				"error execution phase wait-control-plane: couldn't initialize a Kubernetes cluster",
+				"error execution phase wait-control-plane: couldn't initialize a Kubernetes cluster",
+				"error execution phase wait-control-plane: couldn't initialize a Kubernetes cluster",
+				"error execution phase wait-control-plane: couldn't initialize a Kubernetes cluster",
+			},
+			expectErr:        true,
+			expectedAttempts: 5,
+			expectedResets:   3,
+			expectedSleeps:   []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second},
+			expectedClass:    ClassTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rootPath := t.TempDir()
+			markerPath := filepath.Join(rootPath, FailureMarker)
+			g.Expect(os.MkdirAll(filepath.Dir(markerPath), 0755)).To(Succeed())
+			g.Expect(os.WriteFile(markerPath, []byte("{}"), 0644)).To(Succeed())
+
+			attempts, resets := 0, 0
+			var sleeps []time.Duration
+			stub(t,
+				func(_ Options, args []string) (string, error) {
+					g.Expect(args[0]).To(Equal("join"))
+					output := tt.outputs[attempts]
+					attempts++
+					if output == "" {
+						return "", nil
+					}
+					return output, errors.New("exit status 1")
+				},
+				func(Options) error {
+					resets++
+					return nil
+				},
+				func(d time.Duration) {
+					sleeps = append(sleeps, d)
+				},
+			)
+
+			runErr := Run(Options{
+				Action:   ActionJoin,
+				NodeRole: "worker",
+				RootPath: rootPath,
+				Retry:    domain.RetryPolicy{MaxAttempts: tt.maxAttempts, Backoff: 10 * time.Second, MaxBackoff: 30 * time.Second},
+			})
+
+			g.Expect(attempts).To(Equal(tt.expectedAttempts))
+			g.Expect(resets).To(Equal(tt.expectedResets))
+			g.Expect(sleeps).To(Equal(tt.expectedSleeps))
+
+			nodeStatus, err := status.Read(rootPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			phase := nodeStatus.Phase(status.PhaseJoin)
+			g.Expect(phase).ToNot(BeNil())
+			g.Expect(phase.Attempts).To(Equal(tt.expectedAttempts))
+
+			if !tt.expectErr {
+				g.Expect(phase.State).To(Equal(status.StateSucceeded))
+				g.Expect(runErr).ToNot(HaveOccurred())
+				g.Expect(markerPath).ToNot(BeAnExistingFile())
+				return
+			}
+
+			g.Expect(runErr).To(MatchError(ContainSubstring("kubeadm join failed after 5 attempts")))
+			g.Expect(phase.State).To(Equal(status.StateFailed))
+			g.Expect(phase.LastError).To(HavePrefix(tt.expectedClass + " error: error execution phase wait-control-plane"))
+
+			content, err := os.ReadFile(markerPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			var failure Failure
+			g.Expect(json.Unmarshal(content, &failure)).To(Succeed())
+			g.Expect(failure.Action).To(Equal(ActionJoin))
+			g.Expect(failure.Class).To(Equal(tt.expectedClass))
+			g.Expect(failure.Attempts).To(Equal(tt.expectedAttempts))
+			g.Expect(failure.Error).To(ContainSubstring("wait-control-plane"))
+		})
+	}
+}
+
+func stub(t *testing.T, kubeadm func(Options, []string) (string, error), reset func(Options) error, wait func(time.Duration)) {
+	originalRunKubeadm, originalResetNode, originalSleep := runKubeadm, resetNode, sleep
+	t.Cleanup(func() {
+		runKubeadm, resetNode, sleep = originalRunKubeadm, originalResetNode, originalSleep
+	})
+
+	runKubeadm, resetNode, sleep = kubeadm, reset, wait
+	stubPreflight(t, 4, 8192, t.TempDir(), nil)
+}
+
+// TestKubeadmArgs tests the kubeadmArgs function
+func TestKubeadmArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(kubeadmArgs(Options{Action: ActionInit, RootPath: "/", IgnorePreflightErrors: []string{"NumCPU", "Mem"}})).To(Equal([]string{
+		"init", "--config", "/opt/kubeadm/kubeadm.yaml", "--upload-certs", "--ignore-preflight-errors=NumCPU,Mem", "-v=5",
+	}))
+	g.Expect(kubeadmArgs(Options{Action: ActionJoin, RootPath: "/persistent/spectro"})).To(Equal([]string{
+		"join", "--config", "/persistent/spectro/opt/kubeadm/kubeadm.yaml", "-v=5",
+	}))
+}
+
+// TestUseNextCertificateKey tests that a join config falls back to the certificate key of the next rotation period
+func TestUseNextCertificateKey(t *testing.T) {
+	g := NewWithT(t)
+	rootPath := t.TempDir()
+	current, next := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	configPath := filepath.Join(rootPath, "opt/kubeadm/kubeadm.yaml")
+	g.Expect(os.MkdirAll(filepath.Dir(configPath), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(configPath, []byte("controlPlane:\n  certificateKey: "+current+"\n"), 0640)).To(Succeed())
+	g.Expect(useNextCertificateKey(rootPath)).ToNot(Succeed(), "the certificate keys file is missing")
+
+	g.Expect(os.WriteFile(filepath.Join(rootPath, CertificateKeysFile), []byte(current+"\n"+next+"\n"), 0600)).To(Succeed())
+	g.Expect(useNextCertificateKey(rootPath)).To(Succeed())
+	g.Expect(os.ReadFile(configPath)).To(Equal([]byte("controlPlane:\n  certificateKey: " + next + "\n")))
+	info, err := os.Stat(configPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+	// the key of the last period has no successor
+	g.Expect(useNextCertificateKey(rootPath)).To(MatchError("no certificate key of a later rotation period"))
+}
+
+// TestSkipsCAVerification tests that a join config without pinned CA hashes is detected
+func TestSkipsCAVerification(t *testing.T) {
+	g := NewWithT(t)
+	rootPath := t.TempDir()
+	g.Expect(skipsCAVerification(rootPath)).To(BeFalse())
+
+	configPath := filepath.Join(rootPath, "opt/kubeadm/kubeadm.yaml")
+	g.Expect(os.MkdirAll(filepath.Dir(configPath), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(configPath, []byte("discovery:\n  bootstrapToken:\n    unsafeSkipCAVerification: true\n"), 0600)).To(Succeed())
+	g.Expect(skipsCAVerification(rootPath)).To(BeTrue())
+
+	g.Expect(os.WriteFile(configPath, []byte("discovery:\n  bootstrapToken:\n    caCertHashes:\n    - sha256:7c8b2f\n"), 0600)).To(Succeed())
+	g.Expect(skipsCAVerification(rootPath)).To(BeFalse())
+}
+
+// TestInstallClusterCA tests that the staged CAs and service account key are installed with their keys
+func TestInstallClusterCA(t *testing.T) {
+	g := NewWithT(t)
+	originalPKIDir := pkiDir
+	t.Cleanup(func() { pkiDir = originalPKIDir })
+	pkiDir = t.TempDir()
+
+	rootPath := t.TempDir()
+	staged := filepath.Join(rootPath, "opt/kubeadm/pki")
+	for name, permissions := range map[string]os.FileMode{
+		"ca.crt":             0644,
+		"ca.key":             0600,
+		"front-proxy-ca.crt": 0644,
+		"front-proxy-ca.key": 0600,
+		"sa.key":             0600,
+		"sa.pub":             0644,
+		// the CA of an external etcd has no key
+		"etcd/ca.crt":                    0644,
+		"etcd/apiserver-etcd-client.crt": 0644,
+	} {
+		g.Expect(os.MkdirAll(filepath.Dir(filepath.Join(staged, name)), 0755)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(staged, name), []byte(name), permissions)).To(Succeed())
+	}
+
+	// an installed file is kept
+	g.Expect(os.WriteFile(filepath.Join(pkiDir, "ca.crt"), []byte("installed"), 0644)).To(Succeed())
+
+	installClusterCA(rootPath)
+
+	g.Expect(os.ReadFile(filepath.Join(pkiDir, "ca.crt"))).To(Equal([]byte("installed")))
+	for _, name := range []string{"ca.key", "front-proxy-ca.crt", "front-proxy-ca.key", "sa.key", "sa.pub"} {
+		g.Expect(os.ReadFile(filepath.Join(pkiDir, name))).To(Equal([]byte(name)))
+	}
+	info, err := os.Stat(filepath.Join(pkiDir, "sa.key"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	g.Expect(filepath.Join(pkiDir, "etcd")).ToNot(BeADirectory())
+}
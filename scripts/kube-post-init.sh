@@ -7,12 +7,19 @@ exec 19>> /var/log/kube-post-init.log
 export BASH_XTRACEFD="19"
 set -x
 
-root_path=$1
+source "$1"
+
+root_path=$ROOT_PATH
 
 export KUBECONFIG=/etc/kubernetes/admin.conf
 export PATH="$PATH:$root_path/usr/bin"
 export PATH="$PATH:$root_path/usr/local/bin"
 
+if [ -f "$root_path"/opt/kubeadm/token-rotation.env ]; then
+  echo "bootstrap token rotation is enabled, kubeadm-certs expiration is managed by kube-token-rotate.sh"
+  exit 0
+fi
+
 while true;
 do
   secret=$(kubectl get secrets kubeadm-certs -n kube-system -o jsonpath="{['metadata']['ownerReferences'][0]['name']}")
@@ -10,14 +10,22 @@ info() {
     echo "[INFO] " "$@"
 }
 
-node_role=$1
-certs_sans_revision=$2
-kubelet_envs=$3
-root_path=$4
-custom_node_ip=$5
-proxy_http=$6
-proxy_https=$7
-proxy_no=$8
+error() {
+    echo "[ERROR] " "$@" >&2
+}
+
+exit_code=0
+
+source "$1"
+
+node_role=$NODE_ROLE
+certs_sans_revision=$CERT_SANS_REVISION
+kubelet_envs=$KUBELET_ENVS
+root_path=$ROOT_PATH
+custom_node_ip=$CUSTOM_NODE_IP
+proxy_http=$PROXY_HTTP
+proxy_https=$PROXY_HTTPS
+proxy_no=$PROXY_NO
 
 export PATH="$PATH:$root_path/usr/bin"
 export PATH="$PATH:$root_path/usr/local/bin"
@@ -111,13 +119,50 @@ restart_kubelet() {
   systemctl restart kubelet
 }
 
+snapshot_etcd() {
+  if [ -z "$ETCD_SNAPSHOT_DIR" ]; then
+    return 0
+  fi
+
+  "$PROVIDER_PATH" etcd-snapshot --root-path "$root_path" --dir "$ETCD_SNAPSHOT_DIR" --retention "$ETCD_SNAPSHOT_RETENTION" --reason reconfigure
+}
+
+# etcd_manifest_changed renders the etcd manifest with a kubeadm dry run and compares it with the
+# current one, a failed dry run counts as a change
+etcd_manifest_changed() {
+  local dry_run_dir changed=0
+  dry_run_dir=$(mktemp -d)
+
+  if KUBEADM_INIT_DRYRUN_DIR="$dry_run_dir" kubeadm init phase etcd local --dry-run --config "$root_path"/opt/kubeadm/cluster-config.yaml > /dev/null &&
+    cmp -s "$dry_run_dir"/etcd.yaml /etc/kubernetes/manifests/etcd.yaml; then
+    changed=1
+  fi
+
+  rm -rf "$dry_run_dir"
+  return $changed
+}
+
 regenerate_etcd_manifests() {
+  if [ "$ETCD_EXTERNAL" = "true" ]; then
+    info "external etcd, not regenerating etcd manifest"
+    return
+  fi
+
   until kubectl --kubeconfig=/etc/kubernetes/admin.conf get cs > /dev/null
   do
     info "generating etcd manifests, cluster not accessible, retrying after 60 sec"
     sleep 60
     continue
   done
+  if ! etcd_manifest_changed; then
+    info "no change in etcd manifest"
+    return
+  fi
+  if ! snapshot_etcd; then
+    error "failed to take etcd snapshot, not regenerating etcd manifest"
+    exit_code=1
+    return
+  fi
   kubeadm init phase etcd local --config "$root_path"/opt/kubeadm/cluster-config.yaml
   info "regenerated etcd manifest"
   sleep 60
@@ -149,3 +194,5 @@ regenerate_kubelet_config
 regenerate_kubelet_envs
 update_file_permissions
 restart_kubelet
+
+exit $exit_code
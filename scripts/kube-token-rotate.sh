@@ -0,0 +1,56 @@
+#!/bin/bash
+
+exec   > >(tee -ia /var/log/kube-token-rotate.log)
+exec  2> >(tee -ia /var/log/kube-token-rotate.log >& 2)
+exec 19>> /var/log/kube-token-rotate.log
+
+export BASH_XTRACEFD="19"
+set -e
+
+root_path=$1
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+export PATH="$PATH:$root_path/usr/bin"
+export PATH="$PATH:$root_path/usr/local/bin"
+
+# CLUSTER_TOKEN, TOKEN_TTL_SECONDS and PROVIDER_PATH
+source "$root_path"/opt/kubeadm/token-rotation.env
+
+state_file="$root_path"/opt/kubeadm/token-rotation.epoch
+
+if [ ! -f "$KUBECONFIG" ] || ! kubectl get --raw /readyz >/dev/null 2>&1; then
+  echo "cluster is not ready yet, skipping bootstrap token rotation"
+  exit 0
+fi
+
+# EPOCH, TOKEN, TOKEN_TTL, NEXT_TOKEN, NEXT_TOKEN_TTL, CERTIFICATE_KEY and EXPIRATION of the current
+# rotation period, derived by the provider exactly like the tokens of the kubeadm config
+credentials=$(CLUSTER_TOKEN="$CLUSTER_TOKEN" TOKEN_TTL_SECONDS="$TOKEN_TTL_SECONDS" "$PROVIDER_PATH" kubeadm-token)
+eval "$credentials"
+
+# the token of the next period is created ahead of the rotation, nodes joining right after it
+# must not wait for the next run of the timer
+for pair in "$TOKEN $TOKEN_TTL" "$NEXT_TOKEN $NEXT_TOKEN_TTL"; do
+  read -r token ttl <<< "$pair"
+  token_id=${token%%.*}
+
+  if ! kubectl get secret -n kube-system "bootstrap-token-$token_id" >/dev/null 2>&1; then
+    kubeadm token create "$token" --ttl "${ttl}s" --description "provider-kubeadm rotated bootstrap token"
+    echo "created bootstrap token $token_id"
+  fi
+done
+
+if [ "$(cat "$state_file" 2>/dev/null)" != "$EPOCH" ]; then
+  # the certificate key changes with the period, control plane nodes still joining with the key of
+  # the previous period fall back to this one
+  kubeadm init phase upload-certs --upload-certs --certificate-key "$CERTIFICATE_KEY"
+
+  # the kubeadm-certs secret is removed together with the token that owns it
+  owner=$(kubectl get secrets kubeadm-certs -n kube-system -o jsonpath="{['metadata']['ownerReferences'][0]['name']}")
+  if [ "$owner" != "" ]; then
+    kubectl patch secret "$owner" -n kube-system --type merge -p "{\"stringData\":{\"expiration\":\"$EXPIRATION\"}}"
+  fi
+
+  echo "$EPOCH" > "$state_file"
+  echo "uploaded kubeadm-certs for rotation period $EPOCH valid until $EXPIRATION"
+fi
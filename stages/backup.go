@@ -0,0 +1,115 @@
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	"k8s.io/utils/ptr"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/etcd"
+)
+
+const (
+	etcdBackupUnit = "kubeadm-etcd-backup"
+)
+
+// GetEtcdBackupStage installs a systemd timer on control plane nodes which takes an etcd snapshot
+// every backup interval. The S3 credentials are passed to the service in an environment file.
+func GetEtcdBackupStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	backup := clusterCtx.EtcdBackup
+
+	opts := etcd.SnapshotOptions{
+		RootPath:  clusterCtx.RootPath,
+		Dir:       domain.DefaultEtcdBackupDir,
+		Retention: ptr.Deref(backup.Retention, domain.DefaultEtcdBackupRetention),
+		Reason:    "scheduled",
+		Compress:  backup.Compress,
+		S3:        backup.S3,
+	}
+	if backup.Dir != "" {
+		opts.Dir = filepath.Clean(strings.TrimPrefix(backup.Dir, "/"))
+	}
+
+	interval := domain.DefaultEtcdBackupInterval
+	if backup.Interval != nil {
+		interval = backup.Interval.Duration
+	}
+
+	envFile := filepath.Join(clusterCtx.RootPath, configurationPath, "etcd-backup.env")
+	var envContent string
+	if backup.S3 != nil {
+		envContent = fmt.Sprintf("%s=%s\n%s=%s\n", etcd.AccessKeyIDEnv, envFileQuote(backup.S3.AccessKeyID), etcd.SecretAccessKeyEnv, envFileQuote(backup.S3.SecretAccessKey))
+	}
+
+	service := fmt.Sprintf(`[Unit]
+Description=Take an etcd snapshot
+After=kubelet.service
+
+[Service]
+Type=oneshot
+EnvironmentFile=%s
+ExecStart=%s
+`, envFile, getProviderExecStart(clusterCtx, etcd.SnapshotArgs(opts)))
+
+	timer := fmt.Sprintf(`[Unit]
+Description=Take etcd snapshots periodically
+
+[Timer]
+OnActiveSec=10min
+OnUnitActiveSec=%ds
+`, int64(interval/time.Second))
+
+	return yip.Stage{
+		Name: "Setup Etcd Backup",
+		Files: []yip.File{
+			{
+				Path:        envFile,
+				Permissions: 0600,
+				Content:     envContent,
+			},
+			{
+				Path:        fmt.Sprintf("/run/systemd/system/%s.service", etcdBackupUnit),
+				Permissions: 0644,
+				Content:     service,
+			},
+			{
+				Path:        fmt.Sprintf("/run/systemd/system/%s.timer", etcdBackupUnit),
+				Permissions: 0644,
+				Content:     timer,
+			},
+		},
+		Commands: []string{
+			"systemctl daemon-reload",
+			fmt.Sprintf("systemctl start %s.timer", etcdBackupUnit),
+		},
+	}
+}
+
+// getProviderExecStart returns the ExecStart= command line that runs the provider with the given
+// arguments. systemd splits it itself, it is not passed to a shell.
+func getProviderExecStart(clusterCtx *domain.ClusterContext, providerArgs []string) string {
+	args := []string{systemdQuote(clusterCtx.ProviderPath)}
+	for _, arg := range providerArgs {
+		args = append(args, systemdQuote(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+// systemdQuote quotes s as a single word of a systemd command line, with its specifiers and
+// variable references escaped.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,@%+") == "" {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(s) + `"`
+}
+
+// envFileQuote quotes s as a value of a systemd EnvironmentFile=.
+func envFileQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s) + `"`
+}
@@ -0,0 +1,158 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+	"k8s.io/utils/ptr"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestGetEtcdBackupStage tests the GetEtcdBackupStage function
+func TestGetEtcdBackupStage(t *testing.T) {
+	tests := []struct {
+		name              string
+		backup            *domain.EtcdBackupConfiguration
+		expectedEnv       string
+		expectedExecStart string
+		expectedInterval  string
+	}{
+		{
+			name:              "defaults",
+			backup:            &domain.EtcdBackupConfiguration{},
+			expectedExecStart: "ExecStart=/usr/bin/agent-provider-kubeadm etcd-snapshot --root-path /persistent/spectro --dir opt/etcd-backups --retention 7 --reason scheduled\n",
+			expectedInterval:  "OnUnitActiveSec=21600s\n",
+		},
+		{
+			name: "compressed_s3_upload",
+			backup: &domain.EtcdBackupConfiguration{
+				Interval:  &metav1.Duration{Duration: time.Hour},
+				Dir:       "/var/lib/etcd-backups/",
+				Retention: ptr.To(3),
+				Compress:  true,
+				S3: &domain.S3Configuration{
+					Endpoint:        "http://minio.local:9000",
+					Bucket:          "etcd",
+					Prefix:          "site 1/%n",
+					AccessKeyID:     "minio",
+					SecretAccessKey: `min'io"$1\23`,
+				},
+			},
+			// systemd quoting, not shell quoting
+			expectedEnv: "AWS_ACCESS_KEY_ID=\"minio\"\nAWS_SECRET_ACCESS_KEY=\"min'io\\\"\\$1\\\\23\"\n",
+			expectedExecStart: "ExecStart=/usr/bin/agent-provider-kubeadm etcd-snapshot --root-path /persistent/spectro --dir var/lib/etcd-backups --retention 3 --reason scheduled " +
+				"--compress --s3-endpoint http://minio.local:9000 --s3-bucket etcd --s3-prefix \"site 1/%%n\"\n",
+			expectedInterval: "OnUnitActiveSec=3600s\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result := GetEtcdBackupStage(&domain.ClusterContext{
+				RootPath:     "/persistent/spectro",
+				NodeRole:     "init",
+				ProviderPath: "/usr/bin/agent-provider-kubeadm",
+				EtcdBackup:   tt.backup,
+			})
+
+			g.Expect(result.Name).To(Equal("Setup Etcd Backup"))
+			g.Expect(result.Files).To(HaveLen(3))
+			g.Expect(result.Files[0].Path).To(Equal("/persistent/spectro/opt/kubeadm/etcd-backup.env"))
+			g.Expect(result.Files[0].Permissions).To(Equal(uint32(0600)))
+			g.Expect(result.Files[0].Content).To(Equal(tt.expectedEnv))
+			g.Expect(result.Files[1].Path).To(Equal("/run/systemd/system/kubeadm-etcd-backup.service"))
+			g.Expect(result.Files[1].Content).To(ContainSubstring("EnvironmentFile=/persistent/spectro/opt/kubeadm/etcd-backup.env\n"))
+			g.Expect(result.Files[1].Content).To(ContainSubstring(tt.expectedExecStart))
+			g.Expect(result.Files[2].Path).To(Equal("/run/systemd/system/kubeadm-etcd-backup.timer"))
+			g.Expect(result.Files[2].Content).To(ContainSubstring(tt.expectedInterval))
+			g.Expect(result.Commands).To(Equal([]string{
+				"systemctl daemon-reload",
+				"systemctl start kubeadm-etcd-backup.timer",
+			}))
+		})
+	}
+}
+
+// TestEtcdBackupStageRoles tests which roles install the etcd backup timer
+func TestEtcdBackupStageRoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodeRole string
+		backup   *domain.EtcdBackupConfiguration
+		expected bool
+	}{
+		{
+			name:     "init",
+			nodeRole: "init",
+			backup:   &domain.EtcdBackupConfiguration{},
+			expected: true,
+		},
+		{
+			name:     "controlplane",
+			nodeRole: "controlplane",
+			backup:   &domain.EtcdBackupConfiguration{},
+			expected: true,
+		},
+		{
+			name:     "worker",
+			nodeRole: "worker",
+			backup:   &domain.EtcdBackupConfiguration{},
+			expected: false,
+		},
+		{
+			name:     "not_configured",
+			nodeRole: "init",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:         "/",
+				NodeRole:         tt.nodeRole,
+				ControlPlaneHost: "10.0.0.1:6443",
+				ClusterToken:     "abcdef.1234567890123456",
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{
+					Networking: kubeadmapiv4.Networking{
+						ServiceSubnet: "10.96.0.0/12",
+						PodSubnet:     "192.168.0.0/16",
+					},
+				},
+				ProviderConfiguration: domain.ProviderConfiguration{EtcdBackup: tt.backup},
+			})
+
+			var result []yip.Stage
+			var err error
+			if tt.nodeRole == "init" {
+				result, err = GetInitYipStages(clusterCtx, kubeadmAPI)
+			} else {
+				result, err = GetJoinYipStages(clusterCtx, kubeadmAPI)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			var names []string
+			for _, stage := range result {
+				names = append(names, stage.Name)
+			}
+
+			if tt.expected {
+				g.Expect(names).To(ContainElement("Setup Etcd Backup"))
+			} else {
+				g.Expect(names).ToNot(ContainElement("Setup Etcd Backup"))
+			}
+		})
+	}
+}
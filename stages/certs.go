@@ -0,0 +1,28 @@
+package stages
+
+import (
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/certs"
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+)
+
+// getCertificateRenewalStage checks the control plane certificates on every boot, after the
+// reconfiguration regenerated the api server certificate for new SANs.
+func getCertificateRenewalStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	opts := certs.Options{
+		RootPath:    clusterCtx.RootPath,
+		RenewBefore: domain.DefaultCertificateRenewBefore,
+	}
+	if clusterCtx.CertificateRenewal.RenewBefore != nil {
+		opts.RenewBefore = clusterCtx.CertificateRenewal.RenewBefore.Duration
+	}
+
+	return yip.Stage{
+		Name: "Run Certificate Renewal",
+		Commands: []string{
+			getPhaseCommand(clusterCtx, status.PhaseCertificates, getProviderCommand(clusterCtx, certs.Args(opts))),
+		},
+	}
+}
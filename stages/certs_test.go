@@ -0,0 +1,124 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+	"k8s.io/utils/ptr"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestGetCertificateRenewalStage tests the getCertificateRenewalStage function
+func TestGetCertificateRenewalStage(t *testing.T) {
+	tests := []struct {
+		name            string
+		renewal         domain.CertificateRenewalConfiguration
+		expectedCommand string
+	}{
+		{
+			name: "defaults",
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase certificates --role init --kubernetes-version v1.30.0 -- " +
+				"/usr/bin/agent-provider-kubeadm certs-check --root-path /persistent/spectro --renew-before 720h0m0s",
+		},
+		{
+			name:    "renew_before",
+			renewal: domain.CertificateRenewalConfiguration{RenewBefore: &metav1.Duration{Duration: 60 * 24 * time.Hour}},
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase certificates --role init --kubernetes-version v1.30.0 -- " +
+				"/usr/bin/agent-provider-kubeadm certs-check --root-path /persistent/spectro --renew-before 1440h0m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result := getCertificateRenewalStage(&domain.ClusterContext{
+				RootPath:           "/persistent/spectro",
+				NodeRole:           "init",
+				KubernetesVersion:  "v1.30.0",
+				ProviderPath:       "/usr/bin/agent-provider-kubeadm",
+				CertificateRenewal: tt.renewal,
+			})
+
+			g.Expect(result.Name).To(Equal("Run Certificate Renewal"))
+			g.Expect(result.Commands).To(Equal([]string{tt.expectedCommand}))
+		})
+	}
+}
+
+// TestCertificateRenewalStageRoles tests which nodes check their certificates on boot
+func TestCertificateRenewalStageRoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodeRole string
+		enabled  *bool
+		expected bool
+	}{
+		{
+			name:     "init",
+			nodeRole: "init",
+			expected: true,
+		},
+		{
+			name:     "controlplane",
+			nodeRole: "controlplane",
+			expected: true,
+		},
+		{
+			name:     "worker",
+			nodeRole: "worker",
+			expected: false,
+		},
+		{
+			name:     "disabled",
+			nodeRole: "init",
+			enabled:  ptr.To(false),
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:         "/",
+				NodeRole:         tt.nodeRole,
+				ControlPlaneHost: "10.0.0.1:6443",
+				ClusterToken:     "abcdef.1234567890123456",
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{
+					Networking: kubeadmapiv4.Networking{
+						ServiceSubnet: "10.96.0.0/12",
+						PodSubnet:     "192.168.0.0/16",
+					},
+				},
+				ProviderConfiguration: domain.ProviderConfiguration{
+					CertificateRenewal: domain.CertificateRenewalConfiguration{Enabled: tt.enabled},
+				},
+			})
+
+			var result []yip.Stage
+			var err error
+			if tt.nodeRole == "init" {
+				result, err = GetInitYipStages(clusterCtx, kubeadmAPI)
+			} else {
+				result, err = GetJoinYipStages(clusterCtx, kubeadmAPI)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tt.expected {
+				g.Expect(result[len(result)-1].Name).To(Equal("Run Certificate Renewal"))
+			} else {
+				g.Expect(result[len(result)-1].Name).ToNot(Equal("Run Certificate Renewal"))
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package stages
+
+import (
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/containerd"
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// GetPreKubeadmContainerdConfigStage writes the config.toml of the containerd service from the
+// containerd block on every boot, the pre kubeadm commands then restart containerd with it. It
+// must only be added if the block is set.
+func GetPreKubeadmContainerdConfigStage(clusterCtx *domain.ClusterContext, cfg *domain.ContainerdConfiguration) yip.Stage {
+	serviceName := clusterCtx.ContainerdServiceFolderName
+
+	return yip.Stage{
+		Name: "Generate Containerd Config",
+		Files: []yip.File{
+			{
+				Path:        containerd.ConfigPath(serviceName),
+				Permissions: 0644,
+				Content:     containerd.Config(serviceName, *cfg),
+			},
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package stages
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestGetPreKubeadmContainerdConfigStage tests the GetPreKubeadmContainerdConfigStage function
+func TestGetPreKubeadmContainerdConfigStage(t *testing.T) {
+	tests := []struct {
+		name                        string
+		containerdServiceFolderName string
+		config                      domain.KubeadmConfigBeta4
+		expectedPath                string
+		expectedContent             []string
+	}{
+		{
+			name:                        "containerd_defaults",
+			containerdServiceFolderName: "containerd",
+			config: domain.KubeadmConfigBeta4{
+				ProviderConfiguration: domain.ProviderConfiguration{Containerd: &domain.ContainerdConfiguration{}},
+			},
+			expectedPath: "/etc/containerd/config.toml",
+			expectedContent: []string{
+				`root = "/opt/containerd"`,
+				`sandbox_image = "registry.k8s.io/pause:3.10"`,
+				"SystemdCgroup = true",
+				`config_path = "/etc/containerd/certs.d"`,
+			},
+		},
+		{
+			name:                        "spectro_containerd_with_cluster_config",
+			containerdServiceFolderName: "spectro-containerd",
+			config: domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{ImageRepository: "registry.local:5000/k8s"},
+				ProviderConfiguration: domain.ProviderConfiguration{
+					Containerd: &domain.ContainerdConfiguration{CgroupDriver: "cgroupfs", Snapshotter: "native"},
+				},
+			},
+			expectedPath: "/etc/spectro-containerd/config.toml",
+			expectedContent: []string{
+				`imports = ["/etc/spectro-containerd/conf.d/*.toml"]`,
+				`sandbox_image = "registry.local:5000/k8s/pause:3.10"`,
+				`snapshotter = "native"`,
+				"SystemdCgroup = false",
+				`config_path = "/etc/spectro-containerd/certs.d"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				KubernetesVersion:           "v1.33.2",
+				ContainerdServiceFolderName: tt.containerdServiceFolderName,
+			}
+
+			stage := GetPreKubeadmContainerdConfigStage(clusterCtx, kubeadm.NewV1Beta4(tt.config).Containerd(clusterCtx))
+			g.Expect(stage.Name).To(Equal("Generate Containerd Config"))
+			g.Expect(stage.Files).To(HaveLen(1))
+			g.Expect(stage.Files[0].Path).To(Equal(tt.expectedPath))
+			g.Expect(stage.Files[0].Permissions).To(Equal(uint32(0644)))
+			for _, expected := range tt.expectedContent {
+				g.Expect(stage.Files[0].Content).To(ContainSubstring(expected))
+			}
+			if tt.containerdServiceFolderName != "containerd" {
+				g.Expect(stage.Files[0].Content).ToNot(ContainSubstring("root = "))
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+// reconfigureEnv is sourced by kube-reconfigure.sh.
+type reconfigureEnv struct {
+	NodeRole              string `env:"NODE_ROLE"`
+	RootPath              string `env:"ROOT_PATH"`
+	CertSansRevision      string `env:"CERT_SANS_REVISION"`
+	KubeletEnvs           string `env:"KUBELET_ENVS"`
+	CustomNodeIP          string `env:"CUSTOM_NODE_IP"`
+	HTTPProxy             string `env:"PROXY_HTTP"`
+	HTTPSProxy            string `env:"PROXY_HTTPS"`
+	NoProxy               string `env:"PROXY_NO"`
+	EtcdExternal          bool   `env:"ETCD_EXTERNAL"`
+	ProviderPath          string `env:"PROVIDER_PATH"`
+	EtcdSnapshotDir       string `env:"ETCD_SNAPSHOT_DIR"`
+	EtcdSnapshotRetention int    `env:"ETCD_SNAPSHOT_RETENTION"`
+}
+
+// tokenRotationEnv is sourced by kube-token-rotate.sh.
+type tokenRotationEnv struct {
+	ClusterToken    string `env:"CLUSTER_TOKEN"`
+	TokenTTLSeconds int    `env:"TOKEN_TTL_SECONDS"`
+	ProviderPath    string `env:"PROVIDER_PATH"`
+}
+
+// postInitEnv is sourced by kube-post-init.sh.
+type postInitEnv struct {
+	RootPath string `env:"ROOT_PATH"`
+}
+
+// getReconfigureEnvStage writes the env file of kube-reconfigure.sh. A local etcd is
+// snapshotted before its manifest is regenerated, an external etcd is left alone.
+func getReconfigureEnvStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	env := reconfigureEnv{
+		NodeRole:         clusterCtx.NodeRole,
+		RootPath:         clusterCtx.RootPath,
+		CertSansRevision: clusterCtx.CertSansRevision,
+		KubeletEnvs:      clusterCtx.KubeletArgs,
+		CustomNodeIP:     clusterCtx.CustomNodeIp,
+	}
+
+	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
+		env.HTTPProxy = clusterCtx.EnvConfig["HTTP_PROXY"]
+		env.HTTPSProxy = clusterCtx.EnvConfig["HTTPS_PROXY"]
+		env.NoProxy = utils.GetNoProxyConfig(clusterCtx)
+	}
+
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker {
+		env.EtcdExternal = clusterCtx.ExternalEtcd != nil
+		if clusterCtx.ExternalEtcd == nil && clusterCtx.EtcdSnapshot.Dir != "" {
+			env.ProviderPath = clusterCtx.ProviderPath
+			env.EtcdSnapshotDir = clusterCtx.EtcdSnapshot.Dir
+			env.EtcdSnapshotRetention = clusterCtx.EtcdSnapshot.Retention
+		}
+	}
+
+	return utils.GetFileStage("Generate Kubeadm Reconfiguration Env File", getReconfigureEnvPath(clusterCtx.RootPath), getEnvFileContent(env))
+}
+
+func getPostInitEnvStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	env := postInitEnv{
+		RootPath: clusterCtx.RootPath,
+	}
+	return utils.GetFileStage("Generate Post Kubeadm Init Env File", getPostInitEnvPath(clusterCtx.RootPath), getEnvFileContent(env))
+}
+
+func getReconfigureEnvPath(rootPath string) string {
+	return filepath.Join(rootPath, configurationPath, "reconfigure.env")
+}
+
+func getPostInitEnvPath(rootPath string) string {
+	return filepath.Join(rootPath, configurationPath, "post-init.env")
+}
+
+// getEnvFileContent renders the fields of an env struct as shell-quoted assignments, one per
+// line, named by their env tag.
+func getEnvFileContent(env any) string {
+	v := reflect.ValueOf(env)
+	t := v.Type()
+
+	var content strings.Builder
+	for i := 0; i < t.NumField(); i++ {
+		var value string
+		switch field := v.Field(i); field.Kind() {
+		case reflect.String:
+			value = field.String()
+		case reflect.Bool:
+			value = strconv.FormatBool(field.Bool())
+		case reflect.Int:
+			value = strconv.FormatInt(field.Int(), 10)
+		default:
+			panic(fmt.Sprintf("unsupported env field %s of kind %s", t.Field(i).Name, field.Kind()))
+		}
+		fmt.Fprintf(&content, "%s=%s\n", t.Field(i).Tag.Get("env"), shellQuote(value))
+	}
+	return content.String()
+}
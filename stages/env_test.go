@@ -0,0 +1,134 @@
+package stages
+
+import (
+	"testing"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestGetReconfigureEnvStage tests the getReconfigureEnvStage function
+func TestGetReconfigureEnvStage(t *testing.T) {
+	tests := []struct {
+		name            string
+		clusterCtx      *domain.ClusterContext
+		expectedPath    string
+		expectedContent string
+	}{
+		{
+			name: "worker_without_proxy",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:         "/",
+				NodeRole:         "worker",
+				CertSansRevision: "3f2a9c",
+				KubeletArgs:      `KUBELET_KUBEADM_ARGS="--node-ip=10.0.0.2"`,
+				EnvConfig:        map[string]string{},
+				EtcdSnapshot:     domain.EtcdSnapshotPolicy{Dir: "opt/etcd-snapshots", Retention: 5},
+			},
+			expectedPath: "/opt/kubeadm/reconfigure.env",
+			expectedContent: "NODE_ROLE=worker\n" +
+				"ROOT_PATH=/\n" +
+				"CERT_SANS_REVISION=3f2a9c\n" +
+				`KUBELET_ENVS='KUBELET_KUBEADM_ARGS="--node-ip=10.0.0.2"'` + "\n" +
+				"CUSTOM_NODE_IP=''\n" +
+				"PROXY_HTTP=''\n" +
+				"PROXY_HTTPS=''\n" +
+				"PROXY_NO=''\n" +
+				"ETCD_EXTERNAL=false\n" +
+				"PROVIDER_PATH=''\n" +
+				"ETCD_SNAPSHOT_DIR=''\n" +
+				"ETCD_SNAPSHOT_RETENTION=0\n",
+		},
+		{
+			name: "odd_values",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:         "/persistent/spectro",
+				NodeRole:         "controlplane",
+				ProviderPath:     "/usr/bin/agent-provider-kubeadm",
+				CertSansRevision: "",
+				KubeletArgs:      `KUBELET_KUBEADM_ARGS="--node-labels=team=it's,tier=$HOME --pod-infra-container-image=registry.k8s.io/pause:3.9"`,
+				CustomNodeIp:     "10.0.0.3",
+				ClusterCidr:      "192.168.0.0/16",
+				ServiceCidr:      "10.96.0.0/12",
+				EnvConfig: map[string]string{
+					"HTTP_PROXY":  "",
+					"HTTPS_PROXY": "http://user:p@ss word@proxy.example.com:3128",
+					"NO_PROXY":    "*.svc;$(reboot)",
+				},
+				EtcdSnapshot: domain.EtcdSnapshotPolicy{Dir: "opt/etcd snapshots", Retention: 3},
+			},
+			expectedPath: "/persistent/spectro/opt/kubeadm/reconfigure.env",
+			expectedContent: "NODE_ROLE=controlplane\n" +
+				"ROOT_PATH=/persistent/spectro\n" +
+				"CERT_SANS_REVISION=''\n" +
+				`KUBELET_ENVS='KUBELET_KUBEADM_ARGS="--node-labels=team=it'\''s,tier=$HOME --pod-infra-container-image=registry.k8s.io/pause:3.9"'` + "\n" +
+				"CUSTOM_NODE_IP=10.0.0.3\n" +
+				"PROXY_HTTP=''\n" +
+				"PROXY_HTTPS='http://user:p@ss word@proxy.example.com:3128'\n" +
+				"PROXY_NO='192.168.0.0/16,10.96.0.0/12,.svc,.svc.cluster,.svc.cluster.local,*.svc;$(reboot)'\n" +
+				"ETCD_EXTERNAL=false\n" +
+				"PROVIDER_PATH=/usr/bin/agent-provider-kubeadm\n" +
+				"ETCD_SNAPSHOT_DIR='opt/etcd snapshots'\n" +
+				"ETCD_SNAPSHOT_RETENTION=3\n",
+		},
+		{
+			name: "external_etcd",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:     "/",
+				NodeRole:     "init",
+				ProviderPath: "/usr/bin/agent-provider-kubeadm",
+				EnvConfig:    map[string]string{},
+				EtcdSnapshot: domain.EtcdSnapshotPolicy{Dir: "opt/etcd-snapshots", Retention: 5},
+				ExternalEtcd: &domain.ExternalEtcdConfiguration{Endpoints: []string{"https://10.0.0.5:2379"}},
+			},
+			expectedPath: "/opt/kubeadm/reconfigure.env",
+			expectedContent: "NODE_ROLE=init\n" +
+				"ROOT_PATH=/\n" +
+				"CERT_SANS_REVISION=''\n" +
+				"KUBELET_ENVS=''\n" +
+				"CUSTOM_NODE_IP=''\n" +
+				"PROXY_HTTP=''\n" +
+				"PROXY_HTTPS=''\n" +
+				"PROXY_NO=''\n" +
+				"ETCD_EXTERNAL=true\n" +
+				"PROVIDER_PATH=''\n" +
+				"ETCD_SNAPSHOT_DIR=''\n" +
+				"ETCD_SNAPSHOT_RETENTION=0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result := getReconfigureEnvStage(tt.clusterCtx)
+
+			g.Expect(result.Name).To(Equal("Generate Kubeadm Reconfiguration Env File"))
+			g.Expect(result.Files).To(Equal([]yip.File{
+				{
+					Path:        tt.expectedPath,
+					Permissions: 0640,
+					Content:     tt.expectedContent,
+				},
+			}))
+		})
+	}
+}
+
+// TestGetPostInitEnvStage tests the getPostInitEnvStage function
+func TestGetPostInitEnvStage(t *testing.T) {
+	g := NewWithT(t)
+
+	result := getPostInitEnvStage(&domain.ClusterContext{RootPath: "/mnt/custom root"})
+
+	g.Expect(result.Name).To(Equal("Generate Post Kubeadm Init Env File"))
+	g.Expect(result.Files).To(Equal([]yip.File{
+		{
+			Path:        "/mnt/custom root/opt/kubeadm/post-init.env",
+			Permissions: 0640,
+			Content:     "ROOT_PATH='/mnt/custom root'\n",
+		},
+	}))
+}
@@ -0,0 +1,48 @@
+package stages
+
+import (
+	"strings"
+
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+// getExternalEtcdCertsStage writes the external etcd certificates of the externalEtcd block.
+func getExternalEtcdCertsStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	external := clusterCtx.ExternalEtcd
+	caFile, certFile, keyFile := utils.ExternalEtcdCertFiles(clusterCtx.RootPath)
+
+	return yip.Stage{
+		Name: "Generate External Etcd Certificates",
+		Files: []yip.File{
+			{
+				Path:        caFile,
+				Permissions: 0644,
+				Content:     pemContent(external.CACert),
+			},
+			{
+				Path:        certFile,
+				Permissions: 0644,
+				Content:     pemContent(external.ClientCert),
+			},
+			{
+				Path:        keyFile,
+				Permissions: 0600,
+				Content:     pemContent(external.ClientKey),
+			},
+		},
+	}
+}
+
+// hasExternalEtcdCerts returns whether the certificates of the external etcd come from the
+// externalEtcd block, which requires them. The certificate files of
+// clusterConfiguration.etcd.external are managed by the user.
+func hasExternalEtcdCerts(clusterCtx *domain.ClusterContext) bool {
+	return clusterCtx.ExternalEtcd != nil && clusterCtx.ExternalEtcd.CACert != ""
+}
+
+func pemContent(pem string) string {
+	return strings.TrimSpace(pem) + "\n"
+}
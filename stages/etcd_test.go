@@ -0,0 +1,140 @@
+package stages
+
+import (
+	"testing"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestGetExternalEtcdCertsStage tests the getExternalEtcdCertsStage function
+func TestGetExternalEtcdCertsStage(t *testing.T) {
+	g := NewWithT(t)
+
+	result := getExternalEtcdCertsStage(&domain.ClusterContext{
+		RootPath: "/persistent",
+		ExternalEtcd: &domain.ExternalEtcdConfiguration{
+			Endpoints:  []string{"https://10.0.0.5:2379"},
+			CACert:     "ca\n\n",
+			ClientCert: "  cert",
+			ClientKey:  "key",
+		},
+	})
+
+	g.Expect(result.Name).To(Equal("Generate External Etcd Certificates"))
+	g.Expect(result.Files).To(Equal([]yip.File{
+		{Path: "/persistent/opt/kubeadm/pki/etcd/ca.crt", Permissions: 0644, Content: "ca\n"},
+		{Path: "/persistent/opt/kubeadm/pki/etcd/apiserver-etcd-client.crt", Permissions: 0644, Content: "cert\n"},
+		{Path: "/persistent/opt/kubeadm/pki/etcd/apiserver-etcd-client.key", Permissions: 0600, Content: "key\n"},
+	}))
+}
+
+// TestExternalEtcdStageUserManagedCerts tests that the certificate files of
+// clusterConfiguration.etcd.external are not written
+func TestExternalEtcdStageUserManagedCerts(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterCtx := &domain.ClusterContext{
+		RootPath:         "/",
+		NodeRole:         "init",
+		ControlPlaneHost: "10.0.0.1:6443",
+		ClusterToken:     "abcdef.1234567890123456",
+	}
+	kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+		ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{
+			Etcd: kubeadmapiv4.Etcd{
+				External: &kubeadmapiv4.ExternalEtcd{
+					Endpoints: []string{"https://10.0.0.5:2379"},
+					CAFile:    "/etc/etcd/ca.crt",
+					CertFile:  "/etc/etcd/client.crt",
+					KeyFile:   "/etc/etcd/client.key",
+				},
+			},
+		},
+	})
+
+	result, err := GetInitYipStages(clusterCtx, kubeadmAPI)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(clusterCtx.ExternalEtcd).ToNot(BeNil())
+	g.Expect(result).ToNot(ContainElement(HaveField("Name", "Generate External Etcd Certificates")))
+}
+
+// TestExternalEtcdStageRoles tests which roles write the external etcd certificates
+func TestExternalEtcdStageRoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodeRole string
+		expected bool
+	}{
+		{
+			name:     "init",
+			nodeRole: "init",
+			expected: true,
+		},
+		{
+			name:     "controlplane",
+			nodeRole: "controlplane",
+			expected: true,
+		},
+		{
+			name:     "worker",
+			nodeRole: "worker",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:         "/",
+				NodeRole:         tt.nodeRole,
+				ControlPlaneHost: "10.0.0.1:6443",
+				ClusterToken:     "abcdef.1234567890123456",
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{
+					Networking: kubeadmapiv4.Networking{
+						ServiceSubnet: "10.96.0.0/12",
+						PodSubnet:     "192.168.0.0/16",
+					},
+				},
+				ProviderConfiguration: domain.ProviderConfiguration{
+					ExternalEtcd: &domain.ExternalEtcdConfiguration{
+						Endpoints:  []string{"https://10.0.0.5:2379"},
+						CACert:     "ca",
+						ClientCert: "cert",
+						ClientKey:  "key",
+					},
+				},
+			})
+
+			var result []yip.Stage
+			var err error
+			if tt.nodeRole == "init" {
+				result, err = GetInitYipStages(clusterCtx, kubeadmAPI)
+			} else {
+				result, err = GetJoinYipStages(clusterCtx, kubeadmAPI)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			var names []string
+			for _, stage := range result {
+				names = append(names, stage.Name)
+			}
+
+			if tt.expected {
+				g.Expect(names).To(ContainElement("Generate External Etcd Certificates"))
+				g.Expect(clusterCtx.ExternalEtcd).ToNot(BeNil())
+			} else {
+				g.Expect(names).ToNot(ContainElement("Generate External Etcd Certificates"))
+				g.Expect(clusterCtx.ExternalEtcd).To(BeNil())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/images"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+)
+
+// getVerifyImagesStage checks that containerd holds the images kubeadm needs before the node is
+// set up. It runs after the image import stages, and no longer once kubeadm succeeded since the
+// kubelet may garbage collect the images the node does not run.
+func getVerifyImagesStage(clusterCtx *domain.ClusterContext, kubeadmAPI kubeadm.API) yip.Stage {
+	opts := images.VerifyOptions{
+		RootPath: clusterCtx.RootPath,
+		NodeRole: clusterCtx.NodeRole,
+		Config:   filepath.Join(clusterCtx.RootPath, images.VerifyConfigFile),
+	}
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker && clusterCtx.KubeVip != nil {
+		opts.Images = append(opts.Images, clusterCtx.KubeVip.Image)
+	}
+
+	marker := "opt/kubeadm.join"
+	if clusterCtx.NodeRole == clusterplugin.RoleInit {
+		marker = "opt/kubeadm.init"
+	}
+
+	return yip.Stage{
+		Name: "Run Verify Kube Images",
+		If:   fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterCtx.RootPath, marker)),
+		Files: []yip.File{
+			{
+				Path:        opts.Config,
+				Permissions: 0640,
+				Content:     kubeadmAPI.ImagesConfig(),
+			},
+		},
+		Commands: []string{
+			getPhaseCommand(clusterCtx, status.PhaseImageVerify, getProviderCommand(clusterCtx, images.VerifyArgs(opts))),
+		},
+	}
+}
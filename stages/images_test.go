@@ -0,0 +1,97 @@
+package stages
+
+import (
+	"testing"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestGetVerifyImagesStage tests the getVerifyImagesStage function
+func TestGetVerifyImagesStage(t *testing.T) {
+	tests := []struct {
+		name              string
+		nodeRole          string
+		kubeVip           *domain.KubeVip
+		verifyImages      bool
+		expectedCondition string
+		expectedCommand   string
+	}{
+		{
+			name:              "init_with_kube_vip",
+			nodeRole:          "init",
+			kubeVip:           &domain.KubeVip{Address: "10.0.0.100", Image: "ghcr.io/kube-vip/kube-vip:v0.8.9"},
+			verifyImages:      true,
+			expectedCondition: "[ ! -f /persistent/spectro/opt/kubeadm.init ]",
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase image-verify --role init --kubernetes-version v1.33.2 -- " +
+				"/usr/bin/agent-provider-kubeadm images-verify --root-path /persistent/spectro --role init --config /persistent/spectro/opt/kubeadm/images-config.yaml --images ghcr.io/kube-vip/kube-vip:v0.8.9",
+		},
+		{
+			name:              "worker_without_kube_vip",
+			nodeRole:          "worker",
+			kubeVip:           &domain.KubeVip{Address: "10.0.0.100", Image: "ghcr.io/kube-vip/kube-vip:v0.8.9"},
+			verifyImages:      true,
+			expectedCondition: "[ ! -f /persistent/spectro/opt/kubeadm.join ]",
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase image-verify --role worker --kubernetes-version v1.33.2 -- " +
+				"/usr/bin/agent-provider-kubeadm images-verify --root-path /persistent/spectro --role worker --config /persistent/spectro/opt/kubeadm/images-config.yaml",
+		},
+		{
+			name:     "disabled",
+			nodeRole: "controlplane",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:          "/persistent/spectro",
+				NodeRole:          tt.nodeRole,
+				ControlPlaneHost:  "10.0.0.1:6443",
+				ClusterToken:      "abcdef.1234567890123456",
+				KubernetesVersion: "v1.33.2",
+				ProviderPath:      "/usr/bin/agent-provider-kubeadm",
+				KubeVip:           tt.kubeVip,
+				VerifyImages:      tt.verifyImages,
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{
+					ImageRepository: "registry.local:5000/k8s",
+				},
+			})
+
+			var result []yip.Stage
+			var err error
+			if tt.nodeRole == "init" {
+				result, err = GetInitYipStages(clusterCtx, kubeadmAPI)
+			} else {
+				result, err = GetJoinYipStages(clusterCtx, kubeadmAPI)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if !tt.verifyImages {
+				for _, stage := range result {
+					g.Expect(stage.Name).ToNot(Equal("Run Verify Kube Images"))
+				}
+				return
+			}
+
+			// the images are verified after the registry config is written
+			g.Expect(result[0].Name).To(Equal("Generate Registry Config"))
+			stage := result[1]
+			g.Expect(stage.Name).To(Equal("Run Verify Kube Images"))
+			g.Expect(stage.If).To(Equal(tt.expectedCondition))
+			g.Expect(stage.Commands).To(Equal([]string{tt.expectedCommand}))
+			g.Expect(stage.Files).To(HaveLen(1))
+			g.Expect(stage.Files[0].Path).To(Equal("/persistent/spectro/opt/kubeadm/images-config.yaml"))
+			g.Expect(stage.Files[0].Content).To(ContainSubstring("kind: ClusterConfiguration"))
+			g.Expect(stage.Files[0].Content).To(ContainSubstring("imageRepository: registry.local:5000/k8s"))
+			g.Expect(stage.Files[0].Content).To(ContainSubstring("kubernetesVersion: v1.33.2"))
+		})
+	}
+}
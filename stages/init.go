@@ -1,260 +1,204 @@
 package stages
 
 import (
-	"bytes"
 	"fmt"
 	"path/filepath"
 
-	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+	yip "github.com/mudler/yip/pkg/schema"
+	"k8s.io/utils/ptr"
 
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
-
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+	"github.com/kairos-io/kairos/provider-kubeadm/runner"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
 	"github.com/kairos-io/kairos/provider-kubeadm/utils"
-	yip "github.com/mudler/yip/pkg/schema"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/cli-runtime/pkg/printers"
-	bootstraputil "k8s.io/cluster-bootstrap/token/util"
-	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
-	bootstraptokenv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/bootstraptoken/v1"
-	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
 )
 
-var (
-	scheme = runtime.NewScheme()
-)
-
-func init() {
-	_ = kubeadmapiv3.AddToScheme(scheme)
-	_ = kubeadmapiv4.AddToScheme(scheme)
-	_ = kubeletv1beta1.AddToScheme(scheme)
-}
-
 const (
 	configurationPath = "opt/kubeadm"
 )
 
-func GetInitYipStagesV1Beta3(clusterCtx *domain.ClusterContext, kubeadmConfig domain.KubeadmConfigBeta3) []yip.Stage {
-	utils.MutateClusterConfigBeta3Defaults(clusterCtx, &kubeadmConfig.ClusterConfiguration)
-	utils.MutateKubeletDefaults(clusterCtx, &kubeadmConfig.KubeletConfiguration)
-
-	clusterCtx.KubeletArgs = utils.RegenerateKubeletKubeadmArgsUsingBeta3Config(&kubeadmConfig.InitConfiguration.NodeRegistration, clusterCtx.NodeRole)
-	clusterCtx.CertSansRevision = utils.GetCertSansRevision(kubeadmConfig.ClusterConfiguration.APIServer.CertSANs)
-	clusterCtx.CustomNodeIp = utils.ValueOrDefaultString(kubeadmConfig.InitConfiguration.NodeRegistration.KubeletExtraArgs["node-ip"], "''")
-
-	return []yip.Stage{
-		getKubeadmInitConfigStage(getInitNodeConfigurationBeta3(clusterCtx, kubeadmConfig.InitConfiguration, kubeadmConfig.ClusterConfiguration, kubeadmConfig.KubeletConfiguration), clusterCtx.RootPath),
-		getKubeadmInitStage(clusterCtx),
-		getKubeadmPostInitStage(clusterCtx.RootPath),
-		getKubeadmInitCreateClusterConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, clusterCtx.RootPath),
-		getKubeadmInitCreateKubeletConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, &kubeadmConfig.KubeletConfiguration, clusterCtx.RootPath),
-		getKubeadmInitUpgradeStage(clusterCtx),
-		getKubeadmInitReconfigureStage(clusterCtx),
+func GetInitYipStages(clusterCtx *domain.ClusterContext, kubeadmAPI kubeadm.API) ([]yip.Stage, error) {
+	clusterCtx.ServiceCidr, clusterCtx.ClusterCidr = kubeadmAPI.Networking()
+	clusterCtx.ExternalEtcd = kubeadmAPI.ExternalEtcd()
+	if clusterCtx.ExternalEtcd != nil && clusterCtx.PKI != nil && clusterCtx.PKI.EtcdCACert != "" {
+		return nil, fmt.Errorf("%s cannot be used with an external etcd", domain.EtcdCACertOption)
 	}
-}
-
-func GetInitYipStagesV1Beta4(clusterCtx *domain.ClusterContext, kubeadmConfig domain.KubeadmConfigBeta4) []yip.Stage {
-	clusterCtx.ServiceCidr = kubeadmConfig.ClusterConfiguration.Networking.ServiceSubnet
-	clusterCtx.ClusterCidr = kubeadmConfig.ClusterConfiguration.Networking.PodSubnet
 
-	utils.MutateClusterConfigBeta4Defaults(clusterCtx, &kubeadmConfig.ClusterConfiguration)
-	utils.MutateKubeletDefaults(clusterCtx, &kubeadmConfig.KubeletConfiguration)
+	kubeadmAPI.ApplyDefaults(clusterCtx)
 
-	clusterCtx.KubeletArgs = utils.RegenerateKubeletKubeadmArgsUsingBeta4Config(&kubeadmConfig.InitConfiguration.NodeRegistration, clusterCtx.NodeRole)
-	clusterCtx.CertSansRevision = utils.GetCertSansRevision(kubeadmConfig.ClusterConfiguration.APIServer.CertSANs)
-	clusterCtx.CustomNodeIp = utils.ValueOrDefaultString(getArgValue(kubeadmConfig.InitConfiguration.NodeRegistration.KubeletExtraArgs, "node-ip"), "''")
-
-	return []yip.Stage{
-		getKubeadmInitConfigStage(getInitNodeConfigurationBeta4(clusterCtx, kubeadmConfig.InitConfiguration, kubeadmConfig.ClusterConfiguration, kubeadmConfig.KubeletConfiguration), clusterCtx.RootPath),
-		getKubeadmInitStage(clusterCtx),
-		getKubeadmPostInitStage(clusterCtx.RootPath),
-		getKubeadmInitCreateClusterConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, clusterCtx.RootPath),
-		getKubeadmInitCreateKubeletConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, &kubeadmConfig.KubeletConfiguration, clusterCtx.RootPath),
-		getKubeadmInitUpgradeStage(clusterCtx),
-		getKubeadmInitReconfigureStage(clusterCtx),
+	clusterCtx.KubeletArgs = kubeadmAPI.KubeletArgs(clusterCtx.NodeRole)
+	clusterCtx.CertSansRevision = utils.GetCertSansRevision(kubeadmAPI.CertSANs())
+	clusterCtx.CustomNodeIp = kubeadmAPI.NodeIP(clusterCtx.NodeRole)
+	clusterCtx.IgnorePreflightErrors = utils.MergeIgnorePreflightErrors(clusterCtx.IgnorePreflightErrors, kubeadmAPI.IgnorePreflightErrors(clusterCtx.NodeRole))
+	if clusterCtx.KubeVip != nil {
+		// the kube-vip manifest is written before kubeadm init runs
+		clusterCtx.IgnorePreflightErrors = utils.MergeIgnorePreflightErrors(clusterCtx.IgnorePreflightErrors, []string{utils.PreflightManifestsDir})
 	}
-}
-
-func getKubeadmInitConfigStage(kubeadmCfg, rootPath string) yip.Stage {
-	return utils.GetFileStage("Generate Kubeadm Init Config File", filepath.Join(rootPath, configurationPath, "kubeadm.yaml"), kubeadmCfg)
-}
+	clusterCtx.EtcdBackup = kubeadmAPI.EtcdBackup()
+	clusterCtx.CertificateRenewal = kubeadmAPI.CertificateRenewal()
 
-func getKubeadmInitStage(clusterCtx *domain.ClusterContext) yip.Stage {
-	clusterRootPath := clusterCtx.RootPath
+	// the user provided CAs are only installed into the default certificates directory
+	if kubeadmAPI.CustomCertificatesDir() && clusterCtx.PKI != nil {
+		return nil, fmt.Errorf("%s and the other PKI options cannot be used with a custom certificatesDir", domain.CACertOption)
+	}
 
-	initStage := yip.Stage{
-		Name: "Run Kubeadm Init",
-		If:   fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterRootPath, "opt/kubeadm.init")),
+	var initStg []yip.Stage
+	initStg = append(initStg, getRegistriesStage(clusterCtx, kubeadmAPI))
+	if clusterCtx.VerifyImages {
+		initStg = append(initStg, getVerifyImagesStage(clusterCtx, kubeadmAPI))
 	}
 
-	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
-		proxy := clusterCtx.EnvConfig
-		initStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %t %s %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-init.sh"), clusterRootPath, true, proxy["HTTP_PROXY"], proxy["HTTPS_PROXY"], utils.GetNoProxyConfig(clusterCtx)),
-			fmt.Sprintf("touch %s", filepath.Join(clusterRootPath, "opt/kubeadm.init")),
-		}
-	} else {
-		initStage.Commands = []string{
-			fmt.Sprintf("bash %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-init.sh"), clusterRootPath),
-			fmt.Sprintf("touch %s", filepath.Join(clusterRootPath, "opt/kubeadm.init")),
+	initStg = append(initStg, getKubeadmInitConfigStage(kubeadmAPI.InitConfig(clusterCtx), clusterCtx.RootPath))
+	if clusterCtx.PKI != nil {
+		caStage, err := getKubeadmInitCAStage(clusterCtx)
+		if err != nil {
+			return nil, err
 		}
+		initStg = append(initStg, caStage)
 	}
-	return initStage
-}
 
-func getKubeadmPostInitStage(clusterRootPath string) yip.Stage {
-	return yip.Stage{
-		Name: "Run Post Kubeadm Init",
-		If:   fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterRootPath, "opt/post-kubeadm.init")),
-		Commands: []string{
-			fmt.Sprintf("bash %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-post-init.sh"), clusterRootPath),
-			fmt.Sprintf("touch %s", filepath.Join(clusterRootPath, "opt/post-kubeadm.init")),
-		},
+	if hasExternalEtcdCerts(clusterCtx) {
+		initStg = append(initStg, getExternalEtcdCertsStage(clusterCtx))
 	}
-}
 
-func getKubeadmInitUpgradeStage(clusterCtx *domain.ClusterContext) yip.Stage {
-	upgradeStage := yip.Stage{
-		Name: "Run Kubeadm Init Upgrade",
+	if clusterCtx.BootstrapTokenTTL > 0 {
+		initStg = append(initStg, GetBootstrapTokenRotationStage(clusterCtx))
 	}
-	clusterRootPath := clusterCtx.RootPath
 
-	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
-		upgradeStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s %t %s %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-upgrade.sh"), clusterCtx.NodeRole, clusterRootPath, true, clusterCtx.EnvConfig["HTTP_PROXY"], clusterCtx.EnvConfig["HTTPS_PROXY"], utils.GetNoProxyConfig(clusterCtx)),
-		}
-	} else {
-		upgradeStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-upgrade.sh"), clusterCtx.NodeRole, clusterRootPath),
-		}
+	if clusterCtx.EtcdBackup != nil {
+		initStg = append(initStg, GetEtcdBackupStage(clusterCtx))
 	}
-	return upgradeStage
-}
 
-func getKubeadmInitCreateClusterConfigStage(clusterCfgObj, initCfgObj runtime.Object, rootPath string) yip.Stage {
-	return utils.GetFileStage("Generate Cluster Config File", filepath.Join(rootPath, configurationPath, "cluster-config.yaml"), getUpdatedInitClusterConfig(clusterCfgObj, initCfgObj))
-}
-
-func getKubeadmInitCreateKubeletConfigStage(clusterCfgObj, initCfg, kubeletCfg runtime.Object, rootPath string) yip.Stage {
-	return utils.GetFileStage("Generate Kubelet Config File", filepath.Join(rootPath, configurationPath, "kubelet-config.yaml"), getUpdatedKubeletConfig(clusterCfgObj, initCfg, kubeletCfg))
-}
-
-func getKubeadmInitReconfigureStage(clusterCtx *domain.ClusterContext) yip.Stage {
-	reconfigureStage := yip.Stage{
-		Name: "Run Kubeadm Reconfiguration",
+	if clusterCtx.KubeVip != nil {
+		kubeVipStage, err := GetKubeVipStage(clusterCtx)
+		if err != nil {
+			return nil, err
+		}
+		initStg = append(initStg, kubeVipStage)
 	}
 
-	clusterRootPath := clusterCtx.RootPath
+	initStg = append(initStg, getKubeadmInitStage(clusterCtx))
 
-	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
-		proxy := clusterCtx.EnvConfig
-		reconfigureStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s %s %s %s %s %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-reconfigure.sh"), clusterCtx.NodeRole,
-				clusterCtx.CertSansRevision, clusterCtx.KubeletArgs, clusterRootPath, clusterCtx.CustomNodeIp, proxy["HTTP_PROXY"], proxy["HTTPS_PROXY"],
-				utils.GetNoProxyConfig(clusterCtx)),
-		}
-	} else {
-		reconfigureStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s %s %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-reconfigure.sh"), clusterCtx.NodeRole,
-				clusterCtx.CertSansRevision, clusterCtx.KubeletArgs, clusterRootPath, clusterCtx.CustomNodeIp),
+	if clusterCtx.KubeVip != nil && utils.KubeVipNeedsSuperAdmin(clusterCtx) {
+		kubeVipStage, err := getKubeVipAdminConfigStage(clusterCtx)
+		if err != nil {
+			return nil, err
 		}
+		initStg = append(initStg, kubeVipStage)
 	}
-	return reconfigureStage
-}
 
-func getInitNodeConfigurationBeta3(clusterCtx *domain.ClusterContext, initCfg kubeadmapiv3.InitConfiguration, clusterCfg kubeadmapiv3.ClusterConfiguration, kubeletCfg kubeletv1beta1.KubeletConfiguration) string {
-	certificateKey := utils.GetCertificateKey(clusterCtx.ClusterToken)
-	substrs := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(clusterCtx.ClusterToken)
+	initStg = append(initStg,
+		getPostInitEnvStage(clusterCtx),
+		getKubeadmPostInitStage(clusterCtx),
+		getKubeadmInitCreateClusterConfigStage(kubeadmAPI.ClusterConfig(clusterCtx.NodeRole), clusterCtx.RootPath),
+		getKubeadmInitCreateKubeletConfigStage(kubeadmAPI.KubeletConfig(), clusterCtx.RootPath),
+		getKubeadmInitUpgradeStage(clusterCtx),
+		getReconfigureEnvStage(clusterCtx),
+		getKubeadmInitReconfigureStage(clusterCtx))
 
-	initCfg.BootstrapTokens = []bootstraptokenv1.BootstrapToken{
-		{
-			Token: &bootstraptokenv1.BootstrapTokenString{
-				ID:     substrs[1],
-				Secret: substrs[2],
-			},
-			TTL: &metav1.Duration{
-				Duration: 0,
-			},
-		},
+	if ptr.Deref(clusterCtx.CertificateRenewal.Enabled, true) {
+		initStg = append(initStg, getCertificateRenewalStage(clusterCtx))
 	}
-	initCfg.CertificateKey = certificateKey
+	return initStg, nil
+}
+
+func getKubeadmInitConfigStage(kubeadmCfg, rootPath string) yip.Stage {
+	return utils.GetFileStage("Generate Kubeadm Init Config File", filepath.Join(rootPath, configurationPath, "kubeadm.yaml"), kubeadmCfg)
+}
 
-	var apiEndpoint kubeadmapiv3.APIEndpoint
+// getKubeadmInitCAStage writes the CAs and the service account key of the provider options, which
+// the kubeadm runner installs before kubeadm init. kubeadm generates the ones that are not set.
+func getKubeadmInitCAStage(clusterCtx *domain.ClusterContext) (yip.Stage, error) {
+	pki := *clusterCtx.PKI
 
-	if initCfg.LocalAPIEndpoint.AdvertiseAddress == "" {
-		apiEndpoint.AdvertiseAddress = domain.DefaultAPIAdvertiseAddress
-	} else {
-		apiEndpoint.AdvertiseAddress = initCfg.LocalAPIEndpoint.AdvertiseAddress
+	var serviceAccountPub string
+	if pki.ServiceAccountKey != "" {
+		var err error
+		if serviceAccountPub, err = utils.GetServiceAccountPublicKey(pki.ServiceAccountKey); err != nil {
+			return yip.Stage{}, fmt.Errorf("invalid %s: %w", domain.ServiceAccountKeyOption, err)
+		}
 	}
 
-	if initCfg.LocalAPIEndpoint.BindPort != 0 {
-		apiEndpoint.BindPort = initCfg.LocalAPIEndpoint.BindPort
+	var files []yip.File
+	for _, file := range []struct {
+		name        string
+		content     string
+		permissions uint32
+	}{
+		{"ca.crt", pki.CACert, 0644},
+		{"ca.key", pki.CAKey, 0600},
+		{"front-proxy-ca.crt", pki.FrontProxyCACert, 0644},
+		{"front-proxy-ca.key", pki.FrontProxyCAKey, 0600},
+		{"etcd/ca.crt", pki.EtcdCACert, 0644},
+		{"etcd/ca.key", pki.EtcdCAKey, 0600},
+		{"sa.key", pki.ServiceAccountKey, 0600},
+		{"sa.pub", serviceAccountPub, 0644},
+	} {
+		if file.content == "" {
+			continue
+		}
+		files = append(files, yip.File{
+			Path:        filepath.Join(clusterCtx.RootPath, configurationPath, "pki", file.name),
+			Permissions: file.permissions,
+			Content:     pemContent(file.content),
+		})
 	}
 
-	initCfg.LocalAPIEndpoint = apiEndpoint
-
-	return printObj([]runtime.Object{&clusterCfg, &initCfg, &kubeletCfg})
+	return yip.Stage{
+		Name:  "Generate Kubeadm Cluster CA",
+		If:    fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterCtx.RootPath, "opt/kubeadm.init")),
+		Files: files,
+	}, nil
 }
 
-func getInitNodeConfigurationBeta4(clusterCtx *domain.ClusterContext, initCfg kubeadmapiv4.InitConfiguration, clusterCfg kubeadmapiv4.ClusterConfiguration, kubeletCfg kubeletv1beta1.KubeletConfiguration) string {
-	certificateKey := utils.GetCertificateKey(clusterCtx.ClusterToken)
-	substrs := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(clusterCtx.ClusterToken)
+func getKubeadmInitStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	clusterRootPath := clusterCtx.RootPath
 
-	initCfg.BootstrapTokens = []bootstraptokenv1.BootstrapToken{
-		{
-			Token: &bootstraptokenv1.BootstrapTokenString{
-				ID:     substrs[1],
-				Secret: substrs[2],
-			},
-			TTL: &metav1.Duration{
-				Duration: 0,
-			},
+	return yip.Stage{
+		Name: "Run Kubeadm Init",
+		If:   fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterRootPath, "opt/kubeadm.init")),
+		Commands: []string{
+			fmt.Sprintf("%s && touch %s", getKubeadmRunnerCommand(clusterCtx, runner.ActionInit), filepath.Join(clusterRootPath, "opt/kubeadm.init")),
 		},
 	}
-	initCfg.CertificateKey = certificateKey
-
-	var apiEndpoint kubeadmapiv4.APIEndpoint
+}
 
-	if initCfg.LocalAPIEndpoint.AdvertiseAddress == "" {
-		apiEndpoint.AdvertiseAddress = domain.DefaultAPIAdvertiseAddress
-	} else {
-		apiEndpoint.AdvertiseAddress = initCfg.LocalAPIEndpoint.AdvertiseAddress
-	}
+func getKubeadmPostInitStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	clusterRootPath := clusterCtx.RootPath
 
-	if initCfg.LocalAPIEndpoint.BindPort != 0 {
-		apiEndpoint.BindPort = initCfg.LocalAPIEndpoint.BindPort
+	return yip.Stage{
+		Name: "Run Post Kubeadm Init",
+		If:   fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterRootPath, "opt/post-kubeadm.init")),
+		Commands: []string{
+			getPhaseCommand(clusterCtx, status.PhasePostInit, fmt.Sprintf("bash %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-post-init.sh"), shellQuote(getPostInitEnvPath(clusterRootPath)))),
+			fmt.Sprintf("touch %s", filepath.Join(clusterRootPath, "opt/post-kubeadm.init")),
+		},
 	}
-
-	initCfg.LocalAPIEndpoint = apiEndpoint
-
-	return printObj([]runtime.Object{&clusterCfg, &initCfg, &kubeletCfg})
 }
 
-func getUpdatedInitClusterConfig(clusterCfgObj, initCfgObj runtime.Object) string {
-	return printObj([]runtime.Object{clusterCfgObj, initCfgObj})
+func getKubeadmInitUpgradeStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	return yip.Stage{
+		Name: "Run Kubeadm Init Upgrade",
+		Commands: []string{
+			getPhaseCommand(clusterCtx, status.PhaseUpgrade, getKubeadmUpgradeCommand(clusterCtx)),
+		},
+	}
 }
 
-func getUpdatedKubeletConfig(clusterCfgObj, initCfg, kubeletCfg runtime.Object) string {
-	return printObj([]runtime.Object{clusterCfgObj, initCfg, kubeletCfg})
+func getKubeadmInitCreateClusterConfigStage(clusterCfg, rootPath string) yip.Stage {
+	return utils.GetFileStage("Generate Cluster Config File", filepath.Join(rootPath, configurationPath, "cluster-config.yaml"), clusterCfg)
 }
 
-func printObj(objects []runtime.Object) string {
-	initPrintr := printers.NewTypeSetter(scheme).ToPrinter(&printers.YAMLPrinter{})
-	out := bytes.NewBuffer([]byte{})
-
-	for _, obj := range objects {
-		_ = initPrintr.PrintObj(obj, out)
-	}
-
-	return out.String()
+func getKubeadmInitCreateKubeletConfigStage(kubeletCfg, rootPath string) yip.Stage {
+	return utils.GetFileStage("Generate Kubelet Config File", filepath.Join(rootPath, configurationPath, "kubelet-config.yaml"), kubeletCfg)
 }
 
-func getArgValue(args []kubeadmapiv4.Arg, name string) string {
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		if arg.Name == name {
-			return arg.Value
-		}
+func getKubeadmInitReconfigureStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	return yip.Stage{
+		Name: "Run Kubeadm Reconfiguration",
+		Commands: []string{
+			getPhaseCommand(clusterCtx, status.PhaseReconfigure, fmt.Sprintf("bash %s %s", filepath.Join(clusterCtx.RootPath, helperScriptPath, "kube-reconfigure.sh"), shellQuote(getReconfigureEnvPath(clusterCtx.RootPath)))),
+		},
 	}
-	return ""
 }
@@ -1,25 +1,36 @@
 package stages
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
 	. "github.com/onsi/gomega"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
 	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
 )
 
-// TestGetInitYipStagesV1Beta3 tests the GetInitYipStagesV1Beta3 function
+// TestGetInitYipStagesV1Beta3 tests the GetInitYipStages function with the v1beta3 api
 func TestGetInitYipStagesV1Beta3(t *testing.T) {
 	t.Run("init_stages_v1beta3", func(t *testing.T) {
 		g := NewWithT(t)
 
 		clusterCtx := &domain.ClusterContext{
-			RootPath:         "/",
-			NodeRole:         "init",
-			ControlPlaneHost: "10.0.0.1",
-			ClusterToken:     "abcdef.1234567890123456",
+			RootPath:              "/",
+			NodeRole:              "init",
+			ControlPlaneHost:      "10.0.0.1",
+			ClusterToken:          "abcdef.1234567890123456",
+			IgnorePreflightErrors: []string{"NumCPU", "Mem"},
 			EnvConfig: map[string]string{
 				"HTTP_PROXY": "http://proxy.example.com:8080",
 			},
@@ -36,34 +47,43 @@ func TestGetInitYipStagesV1Beta3(t *testing.T) {
 					KubeletExtraArgs: map[string]string{
 						"node-ip": "10.0.0.1",
 					},
+					IgnorePreflightErrors: []string{"mem", "Swap"},
 				},
 			},
 			KubeletConfiguration: kubeletv1beta1.KubeletConfiguration{},
 		}
 
-		result := GetInitYipStagesV1Beta3(clusterCtx, kubeadmConfig)
+		result, err := GetInitYipStages(clusterCtx, kubeadm.NewV1Beta3(kubeadmConfig))
+		g.Expect(err).ToNot(HaveOccurred())
 
 		// Validate that we get the expected number of stages
-		g.Expect(result).To(HaveLen(7))
+		g.Expect(result).To(HaveLen(11))
 
 		// Validate stage names
 		expectedStageNames := []string{
+			"Generate Registry Config",
 			"Generate Kubeadm Init Config File",
 			"Run Kubeadm Init",
+			"Generate Post Kubeadm Init Env File",
 			"Run Post Kubeadm Init",
 			"Generate Cluster Config File",
 			"Generate Kubelet Config File",
 			"Run Kubeadm Init Upgrade",
+			"Generate Kubeadm Reconfiguration Env File",
 			"Run Kubeadm Reconfiguration",
+			"Run Certificate Renewal",
 		}
 
 		for i, expectedName := range expectedStageNames {
 			g.Expect(result[i].Name).To(Equal(expectedName))
 		}
+
+		g.Expect(clusterCtx.IgnorePreflightErrors).To(Equal([]string{"NumCPU", "Mem", "Swap"}))
+		g.Expect(result[2].Commands[0]).To(ContainSubstring("--ignore-preflight-errors NumCPU,Mem,Swap"))
 	})
 }
 
-// TestGetInitYipStagesV1Beta4 tests the GetInitYipStagesV1Beta4 function
+// TestGetInitYipStagesV1Beta4 tests the GetInitYipStages function with the v1beta4 api
 func TestGetInitYipStagesV1Beta4(t *testing.T) {
 	t.Run("init_stages_v1beta4", func(t *testing.T) {
 		g := NewWithT(t)
@@ -98,20 +118,25 @@ func TestGetInitYipStagesV1Beta4(t *testing.T) {
 			KubeletConfiguration: kubeletv1beta1.KubeletConfiguration{},
 		}
 
-		result := GetInitYipStagesV1Beta4(clusterCtx, kubeadmConfig)
+		result, err := GetInitYipStages(clusterCtx, kubeadm.NewV1Beta4(kubeadmConfig))
+		g.Expect(err).ToNot(HaveOccurred())
 
 		// Validate that we get the expected number of stages
-		g.Expect(result).To(HaveLen(7))
+		g.Expect(result).To(HaveLen(11))
 
 		// Validate stage names
 		expectedStageNames := []string{
+			"Generate Registry Config",
 			"Generate Kubeadm Init Config File",
 			"Run Kubeadm Init",
+			"Generate Post Kubeadm Init Env File",
 			"Run Post Kubeadm Init",
 			"Generate Cluster Config File",
 			"Generate Kubelet Config File",
 			"Run Kubeadm Init Upgrade",
+			"Generate Kubeadm Reconfiguration Env File",
 			"Run Kubeadm Reconfiguration",
+			"Run Certificate Renewal",
 		}
 
 		for i, expectedName := range expectedStageNames {
@@ -124,6 +149,30 @@ func TestGetInitYipStagesV1Beta4(t *testing.T) {
 	})
 }
 
+// TestGetInitYipStagesCustomCertificatesDir tests that GetInitYipStages rejects the CAs of the
+// provider options with a custom certificates directory
+func TestGetInitYipStagesCustomCertificatesDir(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterCtx := &domain.ClusterContext{
+		RootPath:         "/",
+		NodeRole:         "init",
+		ControlPlaneHost: "10.0.0.1:6443",
+		ClusterToken:     "abcdef.1234567890123456",
+	}
+	kubeadmConfig := domain.KubeadmConfigBeta4{
+		ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{CertificatesDir: "/var/lib/kubernetes/pki"},
+	}
+
+	_, err := GetInitYipStages(clusterCtx, kubeadm.NewV1Beta4(kubeadmConfig))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// the CAs of the provider options would not be used by kubeadm
+	clusterCtx.PKI = &domain.ClusterPKI{ServiceAccountKey: "key"}
+	_, err = GetInitYipStages(clusterCtx, kubeadm.NewV1Beta4(kubeadmConfig))
+	g.Expect(err).To(MatchError("ca_cert and the other PKI options cannot be used with a custom certificatesDir"))
+}
+
 // TestGetKubeadmInitConfigStage tests the getKubeadmInitConfigStage function
 func TestGetKubeadmInitConfigStage(t *testing.T) {
 	tests := []struct {
@@ -167,6 +216,72 @@ func TestGetKubeadmInitConfigStage(t *testing.T) {
 	}
 }
 
+// TestGetKubeadmInitCAStage tests that the CAs and service account key of the provider options are written
+func TestGetKubeadmInitCAStage(t *testing.T) {
+	g := NewWithT(t)
+
+	caCert, caKey := testCA(t)
+	frontProxyCACert, frontProxyCAKey := testCA(t)
+	_, saKey := testCA(t)
+
+	clusterCtx := &domain.ClusterContext{
+		RootPath:     "/persistent/spectro",
+		ClusterToken: "abcdef.1234567890123456",
+		PKI: &domain.ClusterPKI{
+			CACert:            caCert,
+			CAKey:             caKey,
+			FrontProxyCACert:  frontProxyCACert,
+			FrontProxyCAKey:   frontProxyCAKey,
+			ServiceAccountKey: saKey,
+		},
+	}
+
+	result, err := getKubeadmInitCAStage(clusterCtx)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(result.Name).To(Equal("Generate Kubeadm Cluster CA"))
+	g.Expect(result.If).To(Equal("[ ! -f /persistent/spectro/opt/kubeadm.init ]"))
+	var paths []string
+	permissions := map[string]uint32{}
+	contents := map[string]string{}
+	for _, file := range result.Files {
+		paths = append(paths, file.Path)
+		permissions[filepath.Base(file.Path)] = file.Permissions
+		contents[filepath.Base(file.Path)] = file.Content
+	}
+	g.Expect(paths).To(Equal([]string{
+		"/persistent/spectro/opt/kubeadm/pki/ca.crt",
+		"/persistent/spectro/opt/kubeadm/pki/ca.key",
+		"/persistent/spectro/opt/kubeadm/pki/front-proxy-ca.crt",
+		"/persistent/spectro/opt/kubeadm/pki/front-proxy-ca.key",
+		"/persistent/spectro/opt/kubeadm/pki/sa.key",
+		"/persistent/spectro/opt/kubeadm/pki/sa.pub",
+	}))
+	g.Expect(permissions).To(Equal(map[string]uint32{
+		"ca.crt": 0644, "ca.key": 0600, "front-proxy-ca.crt": 0644, "front-proxy-ca.key": 0600, "sa.key": 0600, "sa.pub": 0644,
+	}))
+	g.Expect(contents["ca.crt"]).To(Equal(caCert))
+	g.Expect(contents["front-proxy-ca.key"]).To(Equal(frontProxyCAKey))
+	g.Expect(contents["sa.pub"]).To(HavePrefix("-----BEGIN PUBLIC KEY-----"))
+
+	// the stage is only added for the CAs of the provider options, kubeadm generates the others
+	clusterCtx.NodeRole = "init"
+	clusterCtx.ControlPlaneHost = "10.0.0.1:6443"
+	stages, err := GetInitYipStages(clusterCtx, kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{}))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stages[2].Name).To(Equal("Generate Kubeadm Cluster CA"))
+	g.Expect(stages[3].Name).To(Equal("Run Kubeadm Init"))
+
+	// the etcd CA of the provider options conflicts with an external etcd
+	clusterCtx.PKI = &domain.ClusterPKI{EtcdCACert: caCert, EtcdCAKey: caKey}
+	_, err = GetInitYipStages(clusterCtx, kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+		ProviderConfiguration: domain.ProviderConfiguration{
+			ExternalEtcd: &domain.ExternalEtcdConfiguration{Endpoints: []string{"https://10.0.0.5:2379"}},
+		},
+	}))
+	g.Expect(err).To(MatchError("etcd_ca_cert cannot be used with an external etcd"))
+}
+
 // TestGetKubeadmInitStage tests the getKubeadmInitStage function
 func TestGetKubeadmInitStage(t *testing.T) {
 	tests := []struct {
@@ -180,7 +295,10 @@ func TestGetKubeadmInitStage(t *testing.T) {
 		{
 			name: "with_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath: "/",
+				RootPath:     "/",
+				NodeRole:     "init",
+				ProviderPath: "/system/providers/agent-provider-kubeadm",
+				KubeadmRetry: domain.RetryPolicy{MaxAttempts: 10, Backoff: 10 * time.Second, MaxBackoff: 5 * time.Minute},
 				EnvConfig: map[string]string{
 					"HTTP_PROXY":  "http://proxy.example.com:8080",
 					"HTTPS_PROXY": "https://proxy.example.com:8080",
@@ -188,27 +306,29 @@ func TestGetKubeadmInitStage(t *testing.T) {
 			},
 			expectedName:         "Run Kubeadm Init",
 			expectedCondition:    "[ ! -f /opt/kubeadm.init ]",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /opt/kubeadm/scripts/kube-init.sh / true"))
-				g.Expect(commands[0]).To(ContainSubstring("http://proxy.example.com:8080"))
-				g.Expect(commands[1]).To(Equal("touch /opt/kubeadm.init"))
+				g.Expect(commands[0]).To(HavePrefix("/system/providers/agent-provider-kubeadm kubeadm-run --action init --role init --root-path / --max-attempts 10 --backoff 10s --max-backoff 5m0s"))
+				g.Expect(commands[0]).To(ContainSubstring("--http-proxy http://proxy.example.com:8080 --https-proxy https://proxy.example.com:8080"))
+				g.Expect(commands[0]).To(HaveSuffix(" && touch /opt/kubeadm.init"))
 			},
 		},
 		{
 			name: "without_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath:  "/persistent/spectro",
-				EnvConfig: map[string]string{},
+				RootPath:     "/persistent/spectro",
+				NodeRole:     "init",
+				ProviderPath: "/system/providers/agent-provider-kubeadm",
+				KubeadmRetry: domain.RetryPolicy{MaxAttempts: 0, Backoff: 10 * time.Second, MaxBackoff: time.Minute},
+				EnvConfig:    map[string]string{},
 			},
 			expectedName:         "Run Kubeadm Init",
 			expectedCondition:    "[ ! -f /persistent/spectro/opt/kubeadm.init ]",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("bash /persistent/spectro/opt/kubeadm/scripts/kube-init.sh /persistent/spectro"))
-				g.Expect(commands[1]).To(Equal("touch /persistent/spectro/opt/kubeadm.init"))
+				g.Expect(commands[0]).To(Equal("/system/providers/agent-provider-kubeadm kubeadm-run --action init --role init --root-path /persistent/spectro --max-attempts 0 --backoff 10s --max-backoff 1m0s && touch /persistent/spectro/opt/kubeadm.init"))
 			},
 		},
 	}
@@ -246,7 +366,7 @@ func TestGetKubeadmPostInitStage(t *testing.T) {
 			expectedCommandCount: 2,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("bash /opt/kubeadm/scripts/kube-post-init.sh /"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path / --phase post-init --role init --kubernetes-version '' -- bash /opt/kubeadm/scripts/kube-post-init.sh /opt/kubeadm/post-init.env"))
 				g.Expect(commands[1]).To(Equal("touch /opt/post-kubeadm.init"))
 			},
 		},
@@ -258,7 +378,7 @@ func TestGetKubeadmPostInitStage(t *testing.T) {
 			expectedCommandCount: 2,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("bash /persistent/spectro/opt/kubeadm/scripts/kube-post-init.sh /persistent/spectro"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase post-init --role init --kubernetes-version '' -- bash /persistent/spectro/opt/kubeadm/scripts/kube-post-init.sh /persistent/spectro/opt/kubeadm/post-init.env"))
 				g.Expect(commands[1]).To(Equal("touch /persistent/spectro/opt/post-kubeadm.init"))
 			},
 		},
@@ -268,7 +388,7 @@ func TestGetKubeadmPostInitStage(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
 
-			result := getKubeadmPostInitStage(tt.clusterRootPath)
+			result := getKubeadmPostInitStage(&domain.ClusterContext{RootPath: tt.clusterRootPath, NodeRole: "init", ProviderPath: "/usr/bin/agent-provider-kubeadm"})
 
 			// Validate stage structure
 			g.Expect(result.Name).To(Equal(tt.expectedName))
@@ -302,22 +422,23 @@ func TestGetKubeadmInitUpgradeStage(t *testing.T) {
 			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /opt/kubeadm/scripts/kube-upgrade.sh init / true"))
-				g.Expect(commands[0]).To(ContainSubstring("http://proxy.example.com:8080"))
+				g.Expect(commands[0]).To(ContainSubstring("-- '' kubeadm-upgrade --role init --root-path / --http-proxy http://proxy.example.com:8080 --https-proxy https://proxy.example.com:8080 --no-proxy"))
 			},
 		},
 		{
 			name: "without_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath:  "/persistent/spectro",
-				NodeRole:  "init",
-				EnvConfig: map[string]string{},
+				RootPath:          "/persistent/spectro",
+				NodeRole:          "init",
+				KubernetesVersion: "v1.30.4",
+				ProviderPath:      "/usr/bin/agent-provider-kubeadm",
+				EnvConfig:         map[string]string{},
 			},
 			expectedName:         "Run Kubeadm Init Upgrade",
 			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("bash /persistent/spectro/opt/kubeadm/scripts/kube-upgrade.sh init /persistent/spectro"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase upgrade --role init --kubernetes-version v1.30.4 -- /usr/bin/agent-provider-kubeadm kubeadm-upgrade --role init --root-path /persistent/spectro"))
 			},
 		},
 	}
@@ -341,11 +462,10 @@ func TestGetKubeadmInitCreateClusterConfigStage(t *testing.T) {
 	t.Run("create_cluster_config_stage", func(t *testing.T) {
 		g := NewWithT(t)
 
-		clusterCfg := &kubeadmapiv3.ClusterConfiguration{}
-		initCfg := &kubeadmapiv3.InitConfiguration{}
+		clusterCfg := kubeadm.NewV1Beta3(domain.KubeadmConfigBeta3{}).ClusterConfig("init")
 		rootPath := "/"
 
-		result := getKubeadmInitCreateClusterConfigStage(clusterCfg, initCfg, rootPath)
+		result := getKubeadmInitCreateClusterConfigStage(clusterCfg, rootPath)
 
 		// Validate stage structure
 		g.Expect(result.Name).To(Equal("Generate Cluster Config File"))
@@ -360,12 +480,10 @@ func TestGetKubeadmInitCreateKubeletConfigStage(t *testing.T) {
 	t.Run("create_kubelet_config_stage", func(t *testing.T) {
 		g := NewWithT(t)
 
-		clusterCfg := &kubeadmapiv3.ClusterConfiguration{}
-		initCfg := &kubeadmapiv3.InitConfiguration{}
-		kubeletCfg := &kubeletv1beta1.KubeletConfiguration{}
+		kubeletCfg := kubeadm.NewV1Beta3(domain.KubeadmConfigBeta3{}).KubeletConfig()
 		rootPath := "/"
 
-		result := getKubeadmInitCreateKubeletConfigStage(clusterCfg, initCfg, kubeletCfg, rootPath)
+		result := getKubeadmInitCreateKubeletConfigStage(kubeletCfg, rootPath)
 
 		// Validate stage structure
 		g.Expect(result.Name).To(Equal("Generate Kubelet Config File"))
@@ -387,8 +505,9 @@ func TestGetKubeadmInitReconfigureStage(t *testing.T) {
 		{
 			name: "with_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath: "/",
-				NodeRole: "init",
+				RootPath:     "/",
+				NodeRole:     "init",
+				ProviderPath: "/usr/bin/agent-provider-kubeadm",
 				EnvConfig: map[string]string{
 					"HTTP_PROXY":  "http://proxy.example.com:8080",
 					"HTTPS_PROXY": "https://proxy.example.com:8080",
@@ -398,22 +517,22 @@ func TestGetKubeadmInitReconfigureStage(t *testing.T) {
 			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /opt/kubeadm/scripts/kube-reconfigure.sh init"))
-				g.Expect(commands[0]).To(ContainSubstring("http://proxy.example.com:8080"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path / --phase reconfigure --role init --kubernetes-version '' -- bash /opt/kubeadm/scripts/kube-reconfigure.sh /opt/kubeadm/reconfigure.env"))
 			},
 		},
 		{
 			name: "without_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath:  "/persistent/spectro",
-				NodeRole:  "init",
-				EnvConfig: map[string]string{},
+				RootPath:     "/persistent/spectro",
+				NodeRole:     "init",
+				ProviderPath: "/usr/bin/agent-provider-kubeadm",
+				EnvConfig:    map[string]string{},
 			},
 			expectedName:         "Run Kubeadm Reconfiguration",
 			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /persistent/spectro/opt/kubeadm/scripts/kube-reconfigure.sh init"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase reconfigure --role init --kubernetes-version '' -- bash /persistent/spectro/opt/kubeadm/scripts/kube-reconfigure.sh /persistent/spectro/opt/kubeadm/reconfigure.env"))
 			},
 		},
 	}
@@ -431,3 +550,30 @@ func TestGetKubeadmInitReconfigureStage(t *testing.T) {
 		})
 	}
 }
+
+// testCA returns a PEM encoded self-signed CA certificate and its key.
+func testCA(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
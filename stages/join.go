@@ -1,146 +1,94 @@
 package stages
 
 import (
-	"bytes"
 	"fmt"
 	"path/filepath"
-
-	"k8s.io/apimachinery/pkg/runtime"
-
-	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
-
-	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"strings"
+	"time"
 
 	"github.com/kairos-io/kairos-sdk/clusterplugin"
 	yip "github.com/mudler/yip/pkg/schema"
-	"k8s.io/cli-runtime/pkg/printers"
-	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
+	"k8s.io/utils/ptr"
 
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+	"github.com/kairos-io/kairos/provider-kubeadm/runner"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
 	"github.com/kairos-io/kairos/provider-kubeadm/utils"
 )
 
-func GetJoinYipStagesV1Beta3(clusterCtx *domain.ClusterContext, kubeadmConfig domain.KubeadmConfigBeta3) []yip.Stage {
-	utils.MutateClusterConfigBeta3Defaults(clusterCtx, &kubeadmConfig.ClusterConfiguration)
-	utils.MutateKubeletDefaults(clusterCtx, &kubeadmConfig.KubeletConfiguration)
-
-	clusterCtx.KubeletArgs = utils.RegenerateKubeletKubeadmArgsUsingBeta3Config(&kubeadmConfig.JoinConfiguration.NodeRegistration, clusterCtx.NodeRole)
-	clusterCtx.CertSansRevision = utils.GetCertSansRevision(kubeadmConfig.ClusterConfiguration.APIServer.CertSANs)
-	clusterCtx.CustomNodeIp = utils.ValueOrDefaultString(kubeadmConfig.JoinConfiguration.NodeRegistration.KubeletExtraArgs["node-ip"], "''")
-
-	joinStg := []yip.Stage{
-		getKubeadmJoinConfigStage(getJoinNodeConfigurationBeta3(clusterCtx, kubeadmConfig.JoinConfiguration), clusterCtx.RootPath),
-		getKubeadmJoinStage(clusterCtx),
-	}
-
+func GetJoinYipStages(clusterCtx *domain.ClusterContext, kubeadmAPI kubeadm.API) ([]yip.Stage, error) {
 	if clusterCtx.NodeRole != clusterplugin.RoleWorker {
-		joinStg = append(joinStg,
-			getKubeadmJoinCreateClusterConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, &kubeadmConfig.JoinConfiguration, clusterCtx.RootPath),
-			getKubeadmJoinCreateKubeletConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, &kubeadmConfig.KubeletConfiguration, clusterCtx.RootPath))
+		clusterCtx.ExternalEtcd = kubeadmAPI.ExternalEtcd()
 	}
 
-	return append(joinStg,
-		getKubeadmJoinUpgradeStage(clusterCtx),
-		getKubeadmJoinReconfigureStage(clusterCtx))
-}
-
-func GetJoinYipStagesV1Beta4(clusterCtx *domain.ClusterContext, kubeadmConfig domain.KubeadmConfigBeta4) []yip.Stage {
-	utils.MutateClusterConfigBeta4Defaults(clusterCtx, &kubeadmConfig.ClusterConfiguration)
-	utils.MutateKubeletDefaults(clusterCtx, &kubeadmConfig.KubeletConfiguration)
+	// the init node only installs the user provided CAs into the default certificates directory
+	if kubeadmAPI.CustomCertificatesDir() && clusterCtx.PKI != nil {
+		return nil, fmt.Errorf("%s cannot be used with a custom certificatesDir", domain.CACertOption)
+	}
 
-	clusterCtx.KubeletArgs = utils.RegenerateKubeletKubeadmArgsUsingBeta4Config(&kubeadmConfig.JoinConfiguration.NodeRegistration, clusterCtx.NodeRole)
-	clusterCtx.CertSansRevision = utils.GetCertSansRevision(kubeadmConfig.ClusterConfiguration.APIServer.CertSANs)
-	clusterCtx.CustomNodeIp = utils.ValueOrDefaultString(getArgValue(kubeadmConfig.JoinConfiguration.NodeRegistration.KubeletExtraArgs, "node-ip"), "''")
+	kubeadmAPI.ApplyDefaults(clusterCtx)
 
-	joinStg := []yip.Stage{
-		getKubeadmJoinConfigStage(getJoinNodeConfigurationBeta4(clusterCtx, kubeadmConfig.JoinConfiguration), clusterCtx.RootPath),
-		getKubeadmJoinStage(clusterCtx),
+	clusterCtx.KubeletArgs = kubeadmAPI.KubeletArgs(clusterCtx.NodeRole)
+	clusterCtx.CertSansRevision = utils.GetCertSansRevision(kubeadmAPI.CertSANs())
+	clusterCtx.CustomNodeIp = kubeadmAPI.NodeIP(clusterCtx.NodeRole)
+	clusterCtx.IgnorePreflightErrors = utils.MergeIgnorePreflightErrors(clusterCtx.IgnorePreflightErrors, kubeadmAPI.IgnorePreflightErrors(clusterCtx.NodeRole))
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker && clusterCtx.KubeVip != nil {
+		// the kube-vip manifest is written before kubeadm join runs
+		clusterCtx.IgnorePreflightErrors = utils.MergeIgnorePreflightErrors(clusterCtx.IgnorePreflightErrors, []string{utils.PreflightManifestsDir})
 	}
+	clusterCtx.Drain = kubeadmAPI.Drain()
+	clusterCtx.EtcdBackup = kubeadmAPI.EtcdBackup()
+	clusterCtx.CertificateRenewal = kubeadmAPI.CertificateRenewal()
 
-	if clusterCtx.NodeRole != clusterplugin.RoleWorker {
-		joinStg = append(joinStg,
-			getKubeadmJoinCreateClusterConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, &kubeadmConfig.JoinConfiguration, clusterCtx.RootPath),
-			getKubeadmJoinCreateKubeletConfigStage(&kubeadmConfig.ClusterConfiguration, &kubeadmConfig.InitConfiguration, &kubeadmConfig.KubeletConfiguration, clusterCtx.RootPath))
+	var joinStg []yip.Stage
+	joinStg = append(joinStg, getRegistriesStage(clusterCtx, kubeadmAPI))
+	if clusterCtx.VerifyImages {
+		joinStg = append(joinStg, getVerifyImagesStage(clusterCtx, kubeadmAPI))
 	}
 
-	return append(joinStg,
-		getKubeadmJoinUpgradeStage(clusterCtx),
-		getKubeadmJoinReconfigureStage(clusterCtx))
-}
-
-func getJoinNodeConfigurationBeta3(clusterCtx *domain.ClusterContext, joinCfg kubeadmapiv3.JoinConfiguration) string {
-	if joinCfg.Discovery.BootstrapToken == nil {
-		joinCfg.Discovery.BootstrapToken = &kubeadmapiv3.BootstrapTokenDiscovery{
-			Token:                    clusterCtx.ClusterToken,
-			APIServerEndpoint:        clusterCtx.ControlPlaneHost,
-			UnsafeSkipCAVerification: true,
-		}
+	joinStg = append(joinStg, getKubeadmJoinConfigStage(kubeadmAPI.JoinConfig(clusterCtx), clusterCtx.RootPath))
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker && clusterCtx.BootstrapTokenTTL > 0 {
+		joinStg = append(joinStg, getCertificateKeysStage(clusterCtx))
 	}
 
-	if clusterCtx.NodeRole == clusterplugin.RoleControlPlane {
-		if joinCfg.ControlPlane == nil {
-			joinCfg.ControlPlane = &kubeadmapiv3.JoinControlPlane{}
-		}
-		joinCfg.ControlPlane.CertificateKey = utils.GetCertificateKey(clusterCtx.ClusterToken)
-
-		var apiEndpoint kubeadmapiv3.APIEndpoint
-
-		if joinCfg.ControlPlane.LocalAPIEndpoint.AdvertiseAddress == "" {
-			apiEndpoint.AdvertiseAddress = domain.DefaultAPIAdvertiseAddress
-		} else {
-			apiEndpoint.AdvertiseAddress = joinCfg.ControlPlane.LocalAPIEndpoint.AdvertiseAddress
-		}
-
-		if joinCfg.ControlPlane.LocalAPIEndpoint.BindPort != 0 {
-			apiEndpoint.BindPort = joinCfg.ControlPlane.LocalAPIEndpoint.BindPort
-		}
-
-		joinCfg.ControlPlane.LocalAPIEndpoint = apiEndpoint
+	if hasExternalEtcdCerts(clusterCtx) {
+		joinStg = append(joinStg, getExternalEtcdCertsStage(clusterCtx))
 	}
 
-	joinPrinter := printers.NewTypeSetter(scheme).ToPrinter(&printers.YAMLPrinter{})
-
-	out := bytes.NewBuffer([]byte{})
-	_ = joinPrinter.PrintObj(&joinCfg, out)
-
-	return out.String()
-}
-
-func getJoinNodeConfigurationBeta4(clusterCtx *domain.ClusterContext, joinCfg kubeadmapiv4.JoinConfiguration) string {
-	if joinCfg.Discovery.BootstrapToken == nil {
-		joinCfg.Discovery.BootstrapToken = &kubeadmapiv4.BootstrapTokenDiscovery{
-			Token:                    clusterCtx.ClusterToken,
-			APIServerEndpoint:        clusterCtx.ControlPlaneHost,
-			UnsafeSkipCAVerification: true,
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker && clusterCtx.KubeVip != nil {
+		kubeVipStage, err := GetKubeVipStage(clusterCtx)
+		if err != nil {
+			return nil, err
 		}
+		joinStg = append(joinStg, kubeVipStage)
 	}
 
-	if clusterCtx.NodeRole == clusterplugin.RoleControlPlane {
-		if joinCfg.ControlPlane == nil {
-			joinCfg.ControlPlane = &kubeadmapiv4.JoinControlPlane{}
-		}
-		joinCfg.ControlPlane.CertificateKey = utils.GetCertificateKey(clusterCtx.ClusterToken)
-
-		var apiEndpoint kubeadmapiv4.APIEndpoint
+	joinStg = append(joinStg, getKubeadmJoinStage(clusterCtx))
 
-		if joinCfg.ControlPlane.LocalAPIEndpoint.AdvertiseAddress == "" {
-			apiEndpoint.AdvertiseAddress = domain.DefaultAPIAdvertiseAddress
-		} else {
-			apiEndpoint.AdvertiseAddress = joinCfg.ControlPlane.LocalAPIEndpoint.AdvertiseAddress
-		}
-
-		if joinCfg.ControlPlane.LocalAPIEndpoint.BindPort != 0 {
-			apiEndpoint.BindPort = joinCfg.ControlPlane.LocalAPIEndpoint.BindPort
-		}
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker && clusterCtx.BootstrapTokenTTL > 0 {
+		joinStg = append(joinStg, GetBootstrapTokenRotationStage(clusterCtx))
+	}
 
-		joinCfg.ControlPlane.LocalAPIEndpoint = apiEndpoint
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker && clusterCtx.EtcdBackup != nil {
+		joinStg = append(joinStg, GetEtcdBackupStage(clusterCtx))
 	}
 
-	joinPrinter := printers.NewTypeSetter(scheme).ToPrinter(&printers.YAMLPrinter{})
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker {
+		joinStg = append(joinStg,
+			getKubeadmJoinCreateClusterConfigStage(kubeadmAPI.ClusterConfig(clusterCtx.NodeRole), clusterCtx.RootPath),
+			getKubeadmJoinCreateKubeletConfigStage(kubeadmAPI.KubeletConfig(), clusterCtx.RootPath))
+	}
 
-	out := bytes.NewBuffer([]byte{})
-	_ = joinPrinter.PrintObj(&joinCfg, out)
+	joinStg = append(joinStg,
+		getKubeadmJoinUpgradeStage(clusterCtx),
+		getReconfigureEnvStage(clusterCtx),
+		getKubeadmJoinReconfigureStage(clusterCtx))
 
-	return out.String()
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker && ptr.Deref(clusterCtx.CertificateRenewal.Enabled, true) {
+		joinStg = append(joinStg, getCertificateRenewalStage(clusterCtx))
+	}
+	return joinStg, nil
 }
 
 func getKubeadmJoinConfigStage(kubeadmCfg, rootPath string) yip.Stage {
@@ -156,93 +104,56 @@ func getKubeadmJoinConfigStage(kubeadmCfg, rootPath string) yip.Stage {
 	}
 }
 
+// getCertificateKeysStage writes the certificate keys the runner falls back to when kubeadm-certs
+// was re-uploaded with the key of the next rotation period before the node joined.
+func getCertificateKeysStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	keys := utils.GetJoinCertificateKeys(clusterCtx.ClusterToken, clusterCtx.BootstrapTokenTTL, time.Now())
+	return yip.Stage{
+		Name: "Generate Kubeadm Certificate Keys File",
+		Files: []yip.File{
+			{
+				Path:        filepath.Join(clusterCtx.RootPath, runner.CertificateKeysFile),
+				Permissions: 0600,
+				Content:     strings.Join(keys, "\n") + "\n",
+			},
+		},
+	}
+}
+
 func getKubeadmJoinStage(clusterCtx *domain.ClusterContext) yip.Stage {
 	clusterRootPath := clusterCtx.RootPath
 
-	joinStage := yip.Stage{
+	return yip.Stage{
 		Name: "Run Kubeadm Join",
 		If:   fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterRootPath, "opt/kubeadm.join")),
+		Commands: []string{
+			fmt.Sprintf("%s && touch %s", getKubeadmRunnerCommand(clusterCtx, runner.ActionJoin), filepath.Join(clusterRootPath, "opt/kubeadm.join")),
+		},
 	}
-
-	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
-		proxy := clusterCtx.EnvConfig
-		joinStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s %t %s %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-join.sh"), clusterCtx.NodeRole, clusterRootPath, true, proxy["HTTP_PROXY"], proxy["HTTPS_PROXY"], utils.GetNoProxyConfig(clusterCtx)),
-			fmt.Sprintf("touch %s", filepath.Join(clusterRootPath, "opt/kubeadm.join")),
-		}
-	} else {
-		joinStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s", filepath.Join(clusterRootPath, helperScriptPath, "kube-join.sh"), clusterCtx.NodeRole, clusterRootPath),
-			fmt.Sprintf("touch %s", filepath.Join(clusterRootPath, "opt/kubeadm.join")),
-		}
-	}
-	return joinStage
 }
 
 func getKubeadmJoinUpgradeStage(clusterCtx *domain.ClusterContext) yip.Stage {
-	upgradeStage := yip.Stage{
+	return yip.Stage{
 		Name: "Run Kubeadm Join Upgrade",
+		Commands: []string{
+			getPhaseCommand(clusterCtx, status.PhaseUpgrade, getKubeadmUpgradeCommand(clusterCtx)),
+		},
 	}
-
-	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
-		proxy := clusterCtx.EnvConfig
-		upgradeStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s %t %s %s %s", filepath.Join(clusterCtx.RootPath, helperScriptPath, "kube-upgrade.sh"), clusterCtx.NodeRole, clusterCtx.RootPath, true, proxy["HTTP_PROXY"], proxy["HTTPS_PROXY"], utils.GetNoProxyConfig(clusterCtx)),
-		}
-	} else {
-		upgradeStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s", filepath.Join(clusterCtx.RootPath, helperScriptPath, "kube-upgrade.sh"), clusterCtx.NodeRole, clusterCtx.RootPath),
-		}
-	}
-	return upgradeStage
 }
 
-func getKubeadmJoinCreateClusterConfigStage(clusterCfgObj, initCfgObj, joinCfgObj runtime.Object, rootPath string) yip.Stage {
-	return utils.GetFileStage("Generate Cluster Config File", filepath.Join(rootPath, configurationPath, "cluster-config.yaml"), getUpdatedJoinClusterConfig(clusterCfgObj, initCfgObj, joinCfgObj))
+func getKubeadmJoinCreateClusterConfigStage(clusterCfg, rootPath string) yip.Stage {
+	return utils.GetFileStage("Generate Cluster Config File", filepath.Join(rootPath, configurationPath, "cluster-config.yaml"), clusterCfg)
 }
 
-func getKubeadmJoinCreateKubeletConfigStage(clusterCfgObj, initCfg, kubeletCfg runtime.Object, rootPath string) yip.Stage {
-	return utils.GetFileStage("Generate Kubelet Config File", filepath.Join(rootPath, configurationPath, "kubelet-config.yaml"), getUpdatedKubeletConfig(clusterCfgObj, initCfg, kubeletCfg))
+func getKubeadmJoinCreateKubeletConfigStage(kubeletCfg, rootPath string) yip.Stage {
+	return utils.GetFileStage("Generate Kubelet Config File", filepath.Join(rootPath, configurationPath, "kubelet-config.yaml"), kubeletCfg)
 }
 
 func getKubeadmJoinReconfigureStage(clusterCtx *domain.ClusterContext) yip.Stage {
-	reconfigureStage := yip.Stage{
+	return yip.Stage{
 		Name: "Run Kubeadm Join Reconfiguration",
+		Commands: []string{
+			getPhaseCommand(clusterCtx, status.PhaseReconfigure, fmt.Sprintf("bash %s %s", filepath.Join(clusterCtx.RootPath, helperScriptPath, "kube-reconfigure.sh"), shellQuote(getReconfigureEnvPath(clusterCtx.RootPath)))),
+		},
 	}
-
-	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
-		proxy := clusterCtx.EnvConfig
-		reconfigureStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s %s %s %s %s %s %s", filepath.Join(clusterCtx.RootPath, helperScriptPath, "kube-reconfigure.sh"), clusterCtx.NodeRole,
-				clusterCtx.CertSansRevision, clusterCtx.KubeletArgs, clusterCtx.RootPath, clusterCtx.CustomNodeIp,
-				proxy["HTTP_PROXY"], proxy["HTTPS_PROXY"], utils.GetNoProxyConfig(clusterCtx)),
-		}
-	} else {
-		reconfigureStage.Commands = []string{
-			fmt.Sprintf("bash %s %s %s %s %s %s", filepath.Join(clusterCtx.RootPath, helperScriptPath, "kube-reconfigure.sh"), clusterCtx.NodeRole,
-				clusterCtx.CertSansRevision, clusterCtx.KubeletArgs, clusterCtx.RootPath, clusterCtx.CustomNodeIp),
-		}
-	}
-	return reconfigureStage
-}
-
-func getUpdatedJoinClusterConfig(clusterCfgObj, initCfgObj, joinCfgObj runtime.Object) string {
-	switch initCfgObj.(type) {
-	case *kubeadmapiv3.InitConfiguration:
-		initCfg := initCfgObj.(*kubeadmapiv3.InitConfiguration)
-		joinCfg := joinCfgObj.(*kubeadmapiv3.JoinConfiguration)
-		if joinCfg.ControlPlane != nil {
-			initCfg.LocalAPIEndpoint.AdvertiseAddress = joinCfg.ControlPlane.LocalAPIEndpoint.AdvertiseAddress
-			initCfg.LocalAPIEndpoint.BindPort = joinCfg.ControlPlane.LocalAPIEndpoint.BindPort
-		}
-	case *kubeadmapiv4.InitConfiguration:
-		initCfg := initCfgObj.(*kubeadmapiv4.InitConfiguration)
-		joinCfg := joinCfgObj.(*kubeadmapiv4.JoinConfiguration)
-		if joinCfg.ControlPlane != nil {
-			initCfg.LocalAPIEndpoint.AdvertiseAddress = joinCfg.ControlPlane.LocalAPIEndpoint.AdvertiseAddress
-			initCfg.LocalAPIEndpoint.BindPort = joinCfg.ControlPlane.LocalAPIEndpoint.BindPort
-		}
-	}
-
-	return printObj([]runtime.Object{clusterCfgObj, initCfgObj, joinCfgObj})
 }
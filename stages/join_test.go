@@ -1,17 +1,22 @@
 package stages
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
 	yip "github.com/mudler/yip/pkg/schema"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 	kubeadmapiv3 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
 	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+	"k8s.io/utils/ptr"
 )
 
-// TestGetJoinYipStagesV1Beta3 tests the GetJoinYipStagesV1Beta3 function
+// TestGetJoinYipStagesV1Beta3 tests the GetJoinYipStages function with the v1beta3 api
 func TestGetJoinYipStagesV1Beta3(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -46,13 +51,15 @@ func TestGetJoinYipStagesV1Beta3(t *testing.T) {
 				},
 				KubeletConfiguration: kubeletv1beta1.KubeletConfiguration{},
 			},
-			expectedStageCount: 4, // 2 base + 2 additional stages
+			expectedStageCount: 6, // 3 base + 3 additional stages
 			validateStages: func(t *testing.T, stages []yip.Stage) {
 				g := NewWithT(t)
 				expectedNames := []string{
+					"Generate Registry Config",
 					"Generate Kubeadm Join Config File",
 					"Run Kubeadm Join",
 					"Run Kubeadm Join Upgrade",
+					"Generate Kubeadm Reconfiguration Env File",
 					"Run Kubeadm Join Reconfiguration",
 				}
 				for i, expectedName := range expectedNames {
@@ -86,16 +93,19 @@ func TestGetJoinYipStagesV1Beta3(t *testing.T) {
 				},
 				KubeletConfiguration: kubeletv1beta1.KubeletConfiguration{},
 			},
-			expectedStageCount: 6, // 2 base + 2 additional + 2 controlplane stages
+			expectedStageCount: 9, // 3 base + 3 additional + 3 controlplane stages
 			validateStages: func(t *testing.T, stages []yip.Stage) {
 				g := NewWithT(t)
 				expectedNames := []string{
+					"Generate Registry Config",
 					"Generate Kubeadm Join Config File",
 					"Run Kubeadm Join",
 					"Generate Cluster Config File",
 					"Generate Kubelet Config File",
 					"Run Kubeadm Join Upgrade",
+					"Generate Kubeadm Reconfiguration Env File",
 					"Run Kubeadm Join Reconfiguration",
+					"Run Certificate Renewal",
 				}
 				for i, expectedName := range expectedNames {
 					g.Expect(stages[i].Name).To(Equal(expectedName))
@@ -108,7 +118,8 @@ func TestGetJoinYipStagesV1Beta3(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
 
-			result := GetJoinYipStagesV1Beta3(tt.clusterCtx, tt.kubeadmConfig)
+			result, err := GetJoinYipStages(tt.clusterCtx, kubeadm.NewV1Beta3(tt.kubeadmConfig))
+			g.Expect(err).ToNot(HaveOccurred())
 
 			// Validate stage count
 			g.Expect(result).To(HaveLen(tt.expectedStageCount))
@@ -117,7 +128,7 @@ func TestGetJoinYipStagesV1Beta3(t *testing.T) {
 	}
 }
 
-// TestGetJoinYipStagesV1Beta4 tests the GetJoinYipStagesV1Beta4 function
+// TestGetJoinYipStagesV1Beta4 tests the GetJoinYipStages function with the v1beta4 api
 func TestGetJoinYipStagesV1Beta4(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -152,13 +163,15 @@ func TestGetJoinYipStagesV1Beta4(t *testing.T) {
 				},
 				KubeletConfiguration: kubeletv1beta1.KubeletConfiguration{},
 			},
-			expectedStageCount: 4, // 2 base + 2 additional stages
+			expectedStageCount: 6, // 3 base + 3 additional stages
 			validateStages: func(t *testing.T, stages []yip.Stage) {
 				g := NewWithT(t)
 				expectedNames := []string{
+					"Generate Registry Config",
 					"Generate Kubeadm Join Config File",
 					"Run Kubeadm Join",
 					"Run Kubeadm Join Upgrade",
+					"Generate Kubeadm Reconfiguration Env File",
 					"Run Kubeadm Join Reconfiguration",
 				}
 				for i, expectedName := range expectedNames {
@@ -192,16 +205,19 @@ func TestGetJoinYipStagesV1Beta4(t *testing.T) {
 				},
 				KubeletConfiguration: kubeletv1beta1.KubeletConfiguration{},
 			},
-			expectedStageCount: 6, // 2 base + 2 additional + 2 controlplane stages
+			expectedStageCount: 9, // 3 base + 3 additional + 3 controlplane stages
 			validateStages: func(t *testing.T, stages []yip.Stage) {
 				g := NewWithT(t)
 				expectedNames := []string{
+					"Generate Registry Config",
 					"Generate Kubeadm Join Config File",
 					"Run Kubeadm Join",
 					"Generate Cluster Config File",
 					"Generate Kubelet Config File",
 					"Run Kubeadm Join Upgrade",
+					"Generate Kubeadm Reconfiguration Env File",
 					"Run Kubeadm Join Reconfiguration",
+					"Run Certificate Renewal",
 				}
 				for i, expectedName := range expectedNames {
 					g.Expect(stages[i].Name).To(Equal(expectedName))
@@ -214,7 +230,8 @@ func TestGetJoinYipStagesV1Beta4(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
 
-			result := GetJoinYipStagesV1Beta4(tt.clusterCtx, tt.kubeadmConfig)
+			result, err := GetJoinYipStages(tt.clusterCtx, kubeadm.NewV1Beta4(tt.kubeadmConfig))
+			g.Expect(err).ToNot(HaveOccurred())
 
 			// Validate stage count
 			g.Expect(result).To(HaveLen(tt.expectedStageCount))
@@ -223,6 +240,77 @@ func TestGetJoinYipStagesV1Beta4(t *testing.T) {
 	}
 }
 
+// TestGetJoinYipStagesCACertPinning tests that GetJoinYipStages only pins the CA hashes of the
+// provider options
+func TestGetJoinYipStagesCACertPinning(t *testing.T) {
+	hash := "sha256:" + strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name            string
+		certificatesDir string
+		caCertHashes    []string
+		pki             *domain.ClusterPKI
+		expectedPinning bool
+		expectedError   string
+	}{
+		{
+			name: "unknown_ca",
+		},
+		{
+			name:            "ca_cert_hashes",
+			caCertHashes:    []string{hash},
+			expectedPinning: true,
+		},
+		{
+			name:            "ca_cert_hashes_with_custom_certificates_dir",
+			certificatesDir: "/var/lib/kubernetes/pki",
+			caCertHashes:    []string{hash},
+			expectedPinning: true,
+		},
+		{
+			name:            "ca_cert_with_custom_certificates_dir",
+			certificatesDir: "/var/lib/kubernetes/pki",
+			pki:             &domain.ClusterPKI{CACert: "ca"},
+			expectedError:   "ca_cert cannot be used with a custom certificatesDir",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:         t.TempDir(),
+				NodeRole:         "worker",
+				ControlPlaneHost: "10.0.0.1:6443",
+				ClusterToken:     "abcdef.1234567890123456",
+				CACertHashes:     tt.caCertHashes,
+				PKI:              tt.pki,
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{CertificatesDir: tt.certificatesDir},
+			})
+
+			result, err := GetJoinYipStages(clusterCtx, kubeadmAPI)
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(tt.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			joinCfg := result[1]
+			g.Expect(joinCfg.Name).To(Equal("Generate Kubeadm Join Config File"))
+			if tt.expectedPinning {
+				g.Expect(joinCfg.Files[0].Content).To(ContainSubstring("- " + hash))
+				g.Expect(joinCfg.Files[0].Content).ToNot(ContainSubstring("unsafeSkipCAVerification"))
+			} else {
+				g.Expect(joinCfg.Files[0].Content).ToNot(ContainSubstring("caCertHashes"))
+				g.Expect(joinCfg.Files[0].Content).To(ContainSubstring("unsafeSkipCAVerification: true"))
+			}
+		})
+	}
+}
+
 // TestGetKubeadmJoinConfigStage tests the getKubeadmJoinConfigStage function
 func TestGetKubeadmJoinConfigStage(t *testing.T) {
 	tests := []struct {
@@ -266,6 +354,24 @@ func TestGetKubeadmJoinConfigStage(t *testing.T) {
 	}
 }
 
+// TestGetCertificateKeysStage tests the getCertificateKeysStage function
+func TestGetCertificateKeysStage(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterCtx := &domain.ClusterContext{
+		RootPath:          "/persistent/spectro",
+		ClusterToken:      "abcdef.1234567890123456",
+		BootstrapTokenTTL: 24 * time.Hour,
+	}
+	result := getCertificateKeysStage(clusterCtx)
+
+	g.Expect(result.Name).To(Equal("Generate Kubeadm Certificate Keys File"))
+	g.Expect(result.Files).To(HaveLen(1))
+	g.Expect(result.Files[0].Path).To(Equal("/persistent/spectro/opt/kubeadm/certificate-keys"))
+	g.Expect(result.Files[0].Permissions).To(Equal(uint32(0600)))
+	g.Expect(result.Files[0].Content).To(MatchRegexp(`^[a-f0-9]{64}\n[a-f0-9]{64}\n$`))
+}
+
 // TestGetKubeadmJoinStage tests the getKubeadmJoinStage function
 func TestGetKubeadmJoinStage(t *testing.T) {
 	tests := []struct {
@@ -278,33 +384,38 @@ func TestGetKubeadmJoinStage(t *testing.T) {
 		{
 			name: "with_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath: "/",
-				NodeRole: "worker",
+				RootPath:     "/",
+				NodeRole:     "worker",
+				ProviderPath: "/system/providers/agent-provider-kubeadm",
+				KubeadmRetry: domain.RetryPolicy{MaxAttempts: 10, Backoff: 10 * time.Second, MaxBackoff: 5 * time.Minute},
 				EnvConfig: map[string]string{
 					"HTTP_PROXY":  "http://proxy.example.com:8080",
 					"HTTPS_PROXY": "https://proxy.example.com:8080",
 				},
 			},
 			expectedName:         "Run Kubeadm Join",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /opt/kubeadm/scripts/kube-join.sh worker"))
-				g.Expect(commands[0]).To(ContainSubstring("http://proxy.example.com:8080"))
+				g.Expect(commands[0]).To(HavePrefix("/system/providers/agent-provider-kubeadm kubeadm-run --action join --role worker --root-path /"))
+				g.Expect(commands[0]).To(ContainSubstring("--http-proxy http://proxy.example.com:8080"))
+				g.Expect(commands[0]).To(HaveSuffix(" && touch /opt/kubeadm.join"))
 			},
 		},
 		{
 			name: "without_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath:  "/persistent/spectro",
-				NodeRole:  "controlplane",
-				EnvConfig: map[string]string{},
+				RootPath:     "/persistent/spectro",
+				NodeRole:     "controlplane",
+				ProviderPath: "/system/providers/agent-provider-kubeadm",
+				KubeadmRetry: domain.RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Second, MaxBackoff: time.Minute},
+				EnvConfig:    map[string]string{},
 			},
 			expectedName:         "Run Kubeadm Join",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("bash /persistent/spectro/opt/kubeadm/scripts/kube-join.sh controlplane /persistent/spectro"))
+				g.Expect(commands[0]).To(Equal("/system/providers/agent-provider-kubeadm kubeadm-run --action join --role controlplane --root-path /persistent/spectro --max-attempts 3 --backoff 10s --max-backoff 1m0s && touch /persistent/spectro/opt/kubeadm.join"))
 			},
 		},
 	}
@@ -330,13 +441,15 @@ func TestGetKubeadmJoinUpgradeStage(t *testing.T) {
 		clusterCtx           *domain.ClusterContext
 		expectedName         string
 		expectedCommandCount int
+		expectedFiles        []yip.File
 		validateCommands     func(*testing.T, []string)
 	}{
 		{
 			name: "with_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath: "/",
-				NodeRole: "worker",
+				RootPath:     "/",
+				NodeRole:     "worker",
+				EtcdSnapshot: domain.EtcdSnapshotPolicy{Dir: "opt/etcd-snapshots", Retention: 5},
 				EnvConfig: map[string]string{
 					"HTTP_PROXY":  "http://proxy.example.com:8080",
 					"HTTPS_PROXY": "https://proxy.example.com:8080",
@@ -346,22 +459,73 @@ func TestGetKubeadmJoinUpgradeStage(t *testing.T) {
 			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /opt/kubeadm/scripts/kube-upgrade.sh worker / true"))
-				g.Expect(commands[0]).To(ContainSubstring("http://proxy.example.com:8080"))
+				g.Expect(commands[0]).To(ContainSubstring("-- '' kubeadm-upgrade --role worker --root-path / --drain --drain-timeout 5m0s --http-proxy http://proxy.example.com:8080 --https-proxy https://proxy.example.com:8080 --no-proxy"))
+			},
+		},
+		{
+			name: "worker_drain_configuration",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:     "/",
+				NodeRole:     "worker",
+				ProviderPath: "/usr/bin/agent-provider-kubeadm",
+				Drain: domain.DrainConfiguration{
+					Timeout:               &metav1.Duration{Duration: 0},
+					EvictLocalStoragePods: true,
+				},
+			},
+			expectedName:         "Run Kubeadm Join Upgrade",
+			expectedCommandCount: 1,
+			validateCommands: func(t *testing.T, commands []string) {
+				g := NewWithT(t)
+				g.Expect(commands[0]).To(HaveSuffix("-- /usr/bin/agent-provider-kubeadm kubeadm-upgrade --role worker --root-path / --drain --drain-timeout 0s --evict-local-storage-pods"))
+			},
+		},
+		{
+			name: "worker_drain_disabled",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:     "/",
+				NodeRole:     "worker",
+				ProviderPath: "/usr/bin/agent-provider-kubeadm",
+				Drain:        domain.DrainConfiguration{Enabled: ptr.To(false)},
+			},
+			expectedName:         "Run Kubeadm Join Upgrade",
+			expectedCommandCount: 1,
+			validateCommands: func(t *testing.T, commands []string) {
+				g := NewWithT(t)
+				g.Expect(commands[0]).To(HaveSuffix("-- /usr/bin/agent-provider-kubeadm kubeadm-upgrade --role worker --root-path /"))
+			},
+		},
+		{
+			name: "control_plane_etcd_snapshot",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:          "/",
+				NodeRole:          "controlplane",
+				KubernetesVersion: "v1.30.4",
+				ProviderPath:      "/usr/bin/agent-provider-kubeadm",
+				EnvConfig:         map[string]string{},
+				EtcdSnapshot:      domain.EtcdSnapshotPolicy{Dir: "opt/etcd-snapshots", Retention: 5},
+			},
+			expectedName:         "Run Kubeadm Join Upgrade",
+			expectedCommandCount: 1,
+			validateCommands: func(t *testing.T, commands []string) {
+				g := NewWithT(t)
+				g.Expect(commands[0]).To(HaveSuffix("-- /usr/bin/agent-provider-kubeadm kubeadm-upgrade --role controlplane --root-path / --etcd-snapshot-dir opt/etcd-snapshots --etcd-snapshot-retention 5"))
 			},
 		},
 		{
 			name: "without_proxy_configuration",
 			clusterCtx: &domain.ClusterContext{
-				RootPath:  "/persistent/spectro",
-				NodeRole:  "controlplane",
-				EnvConfig: map[string]string{},
+				RootPath:          "/persistent/spectro",
+				NodeRole:          "controlplane",
+				KubernetesVersion: "v1.30.4",
+				ProviderPath:      "/usr/bin/agent-provider-kubeadm",
+				EnvConfig:         map[string]string{},
 			},
 			expectedName:         "Run Kubeadm Join Upgrade",
 			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("bash /persistent/spectro/opt/kubeadm/scripts/kube-upgrade.sh controlplane /persistent/spectro"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase upgrade --role controlplane --kubernetes-version v1.30.4 -- /usr/bin/agent-provider-kubeadm kubeadm-upgrade --role controlplane --root-path /persistent/spectro"))
 			},
 		},
 	}
@@ -385,12 +549,10 @@ func TestGetKubeadmJoinCreateClusterConfigStage(t *testing.T) {
 	t.Run("create_cluster_config_stage", func(t *testing.T) {
 		g := NewWithT(t)
 
-		clusterCfg := &kubeadmapiv3.ClusterConfiguration{}
-		initCfg := &kubeadmapiv3.InitConfiguration{}
-		joinCfg := &kubeadmapiv3.JoinConfiguration{}
+		clusterCfg := kubeadm.NewV1Beta3(domain.KubeadmConfigBeta3{}).ClusterConfig("controlplane")
 		rootPath := "/"
 
-		result := getKubeadmJoinCreateClusterConfigStage(clusterCfg, initCfg, joinCfg, rootPath)
+		result := getKubeadmJoinCreateClusterConfigStage(clusterCfg, rootPath)
 
 		// Validate stage structure
 		g.Expect(result.Name).To(Equal("Generate Cluster Config File"))
@@ -405,12 +567,10 @@ func TestGetKubeadmJoinCreateKubeletConfigStage(t *testing.T) {
 	t.Run("create_kubelet_config_stage", func(t *testing.T) {
 		g := NewWithT(t)
 
-		clusterCfg := &kubeadmapiv3.ClusterConfiguration{}
-		initCfg := &kubeadmapiv3.InitConfiguration{}
-		kubeletCfg := &kubeletv1beta1.KubeletConfiguration{}
+		kubeletCfg := kubeadm.NewV1Beta3(domain.KubeadmConfigBeta3{}).KubeletConfig()
 		rootPath := "/"
 
-		result := getKubeadmJoinCreateKubeletConfigStage(clusterCfg, initCfg, kubeletCfg, rootPath)
+		result := getKubeadmJoinCreateKubeletConfigStage(kubeletCfg, rootPath)
 
 		// Validate stage structure
 		g.Expect(result.Name).To(Equal("Generate Kubelet Config File"))
@@ -423,14 +583,12 @@ func TestGetKubeadmJoinCreateKubeletConfigStage(t *testing.T) {
 // TestGetKubeadmJoinReconfigureStage tests the getKubeadmJoinReconfigureStage function
 func TestGetKubeadmJoinReconfigureStage(t *testing.T) {
 	tests := []struct {
-		name                 string
-		clusterCtx           *domain.ClusterContext
-		expectedName         string
-		expectedCommandCount int
-		validateCommands     func(*testing.T, []string)
+		name            string
+		clusterCtx      *domain.ClusterContext
+		expectedCommand string
 	}{
 		{
-			name: "with_proxy_configuration",
+			name: "worker",
 			clusterCtx: &domain.ClusterContext{
 				RootPath: "/",
 				NodeRole: "worker",
@@ -439,40 +597,29 @@ func TestGetKubeadmJoinReconfigureStage(t *testing.T) {
 					"HTTPS_PROXY": "https://proxy.example.com:8080",
 				},
 			},
-			expectedName:         "Run Kubeadm Join Reconfiguration",
-			expectedCommandCount: 1,
-			validateCommands: func(t *testing.T, commands []string) {
-				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /opt/kubeadm/scripts/kube-reconfigure.sh worker"))
-				g.Expect(commands[0]).To(ContainSubstring("http://proxy.example.com:8080"))
-			},
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path / --phase reconfigure --role worker --kubernetes-version '' -- bash /opt/kubeadm/scripts/kube-reconfigure.sh /opt/kubeadm/reconfigure.env",
 		},
 		{
-			name: "without_proxy_configuration",
+			name: "controlplane_agent_mode",
 			clusterCtx: &domain.ClusterContext{
 				RootPath:  "/persistent/spectro",
 				NodeRole:  "controlplane",
 				EnvConfig: map[string]string{},
 			},
-			expectedName:         "Run Kubeadm Join Reconfiguration",
-			expectedCommandCount: 1,
-			validateCommands: func(t *testing.T, commands []string) {
-				g := NewWithT(t)
-				g.Expect(commands[0]).To(ContainSubstring("bash /persistent/spectro/opt/kubeadm/scripts/kube-reconfigure.sh controlplane"))
-			},
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase reconfigure --role controlplane --kubernetes-version '' -- bash /persistent/spectro/opt/kubeadm/scripts/kube-reconfigure.sh /persistent/spectro/opt/kubeadm/reconfigure.env",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
+			tt.clusterCtx.ProviderPath = "/usr/bin/agent-provider-kubeadm"
 
 			result := getKubeadmJoinReconfigureStage(tt.clusterCtx)
 
-			// Validate stage structure
-			g.Expect(result.Name).To(Equal(tt.expectedName))
-			g.Expect(result.Commands).To(HaveLen(tt.expectedCommandCount))
-			tt.validateCommands(t, result.Commands)
+			g.Expect(result.Name).To(Equal("Run Kubeadm Join Reconfiguration"))
+			g.Expect(result.Files).To(BeEmpty())
+			g.Expect(result.Commands).To(Equal([]string{tt.expectedCommand}))
 		})
 	}
 }
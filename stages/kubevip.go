@@ -0,0 +1,64 @@
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	kubeVipManifestPath = "/etc/kubernetes/manifests/kube-vip.yaml"
+)
+
+// GetKubeVipStage writes the kube-vip static pod manifest on every boot, so that it follows
+// changes to the provider options. kubeadm init and join keep it across resets. If kube-vip needs
+// super-admin.conf, the stage only runs until kubeadm init has finished, afterwards
+// getKubeVipAdminConfigStage writes the manifest with admin.conf.
+func GetKubeVipStage(clusterCtx *domain.ClusterContext) (yip.Stage, error) {
+	superAdmin := utils.KubeVipNeedsSuperAdmin(clusterCtx)
+	manifest, err := utils.GetKubeVipManifest(clusterCtx, superAdmin)
+	if err != nil {
+		return yip.Stage{}, err
+	}
+
+	stage := yip.Stage{
+		Name: "Generate Kube-Vip Manifest",
+		Files: []yip.File{
+			{
+				Path:        kubeVipManifestPath,
+				Permissions: 0600,
+				Content:     manifest,
+			},
+		},
+	}
+	if superAdmin {
+		stage.If = fmt.Sprintf("[ ! -f %s ]", filepath.Join(clusterCtx.RootPath, "opt/kubeadm.init"))
+	}
+	return stage, nil
+}
+
+// getKubeVipAdminConfigStage switches the kube-vip manifest of the init node from
+// super-admin.conf to admin.conf once kubeadm init has finished, both right after kubeadm init
+// and on every later boot.
+func getKubeVipAdminConfigStage(clusterCtx *domain.ClusterContext) (yip.Stage, error) {
+	manifest, err := utils.GetKubeVipManifest(clusterCtx, false)
+	if err != nil {
+		return yip.Stage{}, err
+	}
+
+	return yip.Stage{
+		Name: "Switch Kube-Vip To Admin Kubeconfig",
+		If:   fmt.Sprintf("[ -f %s ]", filepath.Join(clusterCtx.RootPath, "opt/kubeadm.init")),
+		Files: []yip.File{
+			{
+				Path:        kubeVipManifestPath,
+				Permissions: 0600,
+				Content:     manifest,
+			},
+		},
+	}, nil
+}
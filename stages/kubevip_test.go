@@ -0,0 +1,117 @@
+package stages
+
+import (
+	"slices"
+	"testing"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestKubeVipStageRoles tests which roles write the kube-vip manifest and where it is written
+func TestKubeVipStageRoles(t *testing.T) {
+	tests := []struct {
+		name          string
+		nodeRole      string
+		expected      bool
+		expectedAfter string
+	}{
+		{
+			name:          "init",
+			nodeRole:      "init",
+			expected:      true,
+			expectedAfter: "Generate Kubeadm Init Config File",
+		},
+		{
+			name:          "controlplane",
+			nodeRole:      "controlplane",
+			expected:      true,
+			expectedAfter: "Generate Kubeadm Join Config File",
+		},
+		{
+			name:     "worker",
+			nodeRole: "worker",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:          "/",
+				NodeRole:          tt.nodeRole,
+				ControlPlaneHost:  "10.0.0.100:6443",
+				ClusterToken:      "abcdef.1234567890123456",
+				KubernetesVersion: "v1.31.2",
+				// ignore_preflight_errors replaced the defaults
+				IgnorePreflightErrors: []string{"NumCPU"},
+				KubeVip: &domain.KubeVip{
+					Address:   "10.0.0.100",
+					Port:      "6443",
+					Interface: "eth0",
+					Mode:      domain.KubeVipModeARP,
+					Image:     domain.DefaultKubeVipImage,
+				},
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{
+					Networking: kubeadmapiv4.Networking{
+						ServiceSubnet: "10.96.0.0/12",
+						PodSubnet:     "192.168.0.0/16",
+					},
+				},
+			})
+
+			var result []yip.Stage
+			var err error
+			if tt.nodeRole == "init" {
+				result, err = GetInitYipStages(clusterCtx, kubeadmAPI)
+			} else {
+				result, err = GetJoinYipStages(clusterCtx, kubeadmAPI)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			var names []string
+			for _, stage := range result {
+				names = append(names, stage.Name)
+			}
+
+			if !tt.expected {
+				g.Expect(names).ToNot(ContainElement("Generate Kube-Vip Manifest"))
+				g.Expect(clusterCtx.IgnorePreflightErrors).To(Equal([]string{"NumCPU"}))
+				return
+			}
+			g.Expect(clusterCtx.IgnorePreflightErrors).To(Equal([]string{"NumCPU", "DirAvailable--etc-kubernetes-manifests"}))
+
+			// the manifest has to be in place before kubeadm init or join runs
+			i := slices.Index(names, "Generate Kube-Vip Manifest")
+			g.Expect(i).To(BeNumerically(">", 0), "kube-vip stage not found in %v", names)
+			g.Expect(names[i-1]).To(Equal(tt.expectedAfter))
+			g.Expect(names[i+1]).To(HavePrefix("Run Kubeadm"))
+			g.Expect(result[i].Files[0].Path).To(Equal("/etc/kubernetes/manifests/kube-vip.yaml"))
+			g.Expect(result[i].Files[0].Content).To(ContainSubstring("value: 10.0.0.100"))
+
+			// only the init node uses super-admin.conf, until kubeadm init has finished
+			j := slices.Index(names, "Switch Kube-Vip To Admin Kubeconfig")
+			if tt.nodeRole != "init" {
+				g.Expect(result[i].If).To(BeEmpty())
+				g.Expect(result[i].Files[0].Content).To(ContainSubstring("path: /etc/kubernetes/admin.conf"))
+				g.Expect(j).To(Equal(-1))
+				return
+			}
+			g.Expect(result[i].If).To(Equal("[ ! -f /opt/kubeadm.init ]"))
+			g.Expect(result[i].Files[0].Content).To(ContainSubstring("path: /etc/kubernetes/super-admin.conf"))
+			g.Expect(names[j-1]).To(Equal("Run Kubeadm Init"))
+			g.Expect(result[j].If).To(Equal("[ -f /opt/kubeadm.init ]"))
+			g.Expect(result[j].Files[0].Path).To(Equal("/etc/kubernetes/manifests/kube-vip.yaml"))
+			g.Expect(result[j].Files[0].Content).To(ContainSubstring("path: /etc/kubernetes/admin.conf"))
+			g.Expect(result[j].Files[0].Content).ToNot(ContainSubstring("super-admin.conf"))
+		})
+	}
+}
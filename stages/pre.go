@@ -5,19 +5,26 @@ import (
 	"path/filepath"
 
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/images"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
 
 	yip "github.com/mudler/yip/pkg/schema"
 )
 
 const (
 	helperScriptPath = "opt/kubeadm/scripts"
+
+	// localImagesPublicKeyFile is written under the cluster root path for the local images import.
+	localImagesPublicKeyFile = "opt/kubeadm/local-images.pub"
 )
 
-func GetPreKubeadmCommandStages(rootPath string) yip.Stage {
+func GetPreKubeadmCommandStages(clusterCtx *domain.ClusterContext) yip.Stage {
+	rootPath := clusterCtx.RootPath
+
 	return yip.Stage{
 		Name: "Run Pre Kubeadm Commands",
 		Commands: []string{
-			fmt.Sprintf("/bin/bash %s %s", filepath.Join(rootPath, helperScriptPath, "kube-pre-init.sh"), rootPath),
+			getPhaseCommand(clusterCtx, status.PhasePre, fmt.Sprintf("/bin/bash %s %s", filepath.Join(rootPath, helperScriptPath, "kube-pre-init.sh"), rootPath)),
 		},
 	}
 }
@@ -33,25 +40,41 @@ func GetPreKubeadmSwapOffDisableStage() yip.Stage {
 }
 
 func GetPreKubeadmImportLocalImageStage(clusterCtx *domain.ClusterContext) yip.Stage {
-	clusterRootPath := clusterCtx.RootPath
 	localImagesPath := clusterCtx.LocalImagesPath
 
+	opts := images.Options{
+		RootPath:    clusterCtx.RootPath,
+		Dir:         localImagesPath,
+		Concurrency: images.DefaultConcurrency,
+	}
+
+	var files []yip.File
+	if clusterCtx.LocalImagesPublicKey != "" {
+		opts.PublicKey = filepath.Join(clusterCtx.RootPath, localImagesPublicKeyFile)
+		files = append(files, yip.File{Path: opts.PublicKey, Permissions: 0644, Content: clusterCtx.LocalImagesPublicKey})
+	}
+
 	return yip.Stage{
-		Name: "Run Import Local Images",
+		Name:  "Run Import Local Images",
+		Files: files,
 		Commands: []string{
-			fmt.Sprintf("chmod +x %s", filepath.Join(clusterRootPath, helperScriptPath, "import.sh")),
-			fmt.Sprintf("/bin/bash %s %s /var/log/import.log", filepath.Join(clusterRootPath, helperScriptPath, "import.sh"), localImagesPath),
+			getPhaseCommand(clusterCtx, status.PhaseLocalImageImport, getProviderCommand(clusterCtx, images.Args(opts))),
 		},
 		If: fmt.Sprintf("[ -d %s ]", localImagesPath),
 	}
 }
 
-func GetPreKubeadmImportCoreK8sImageStage(rootPath string) yip.Stage {
+func GetPreKubeadmImportCoreK8sImageStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	opts := images.Options{
+		RootPath:    clusterCtx.RootPath,
+		Dir:         filepath.Join(clusterCtx.RootPath, "opt/kube-images"),
+		Concurrency: images.DefaultConcurrency,
+	}
+
 	return yip.Stage{
 		Name: "Run Load Kube Images",
 		Commands: []string{
-			fmt.Sprintf("chmod +x %s", filepath.Join(rootPath, helperScriptPath, "import.sh")),
-			fmt.Sprintf("/bin/bash %s %s /var/log/import-kube-images.log", filepath.Join(rootPath, helperScriptPath, "import.sh"), filepath.Join(rootPath, "opt/kube-images")),
+			getPhaseCommand(clusterCtx, status.PhaseImageImport, getProviderCommand(clusterCtx, images.Args(opts))),
 		},
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	yip "github.com/mudler/yip/pkg/schema"
 	. "github.com/onsi/gomega"
 )
 
@@ -19,19 +20,19 @@ func TestGetPreKubeadmCommandStages(t *testing.T) {
 			name:            "standard_root_path",
 			rootPath:        "/",
 			expectedName:    "Run Pre Kubeadm Commands",
-			expectedCommand: "/bin/bash /opt/kubeadm/scripts/kube-pre-init.sh /",
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path / --phase pre --role init --kubernetes-version '' -- /bin/bash /opt/kubeadm/scripts/kube-pre-init.sh /",
 		},
 		{
 			name:            "custom_root_path",
 			rootPath:        "/persistent/spectro",
 			expectedName:    "Run Pre Kubeadm Commands",
-			expectedCommand: "/bin/bash /persistent/spectro/opt/kubeadm/scripts/kube-pre-init.sh /persistent/spectro",
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase pre --role init --kubernetes-version '' -- /bin/bash /persistent/spectro/opt/kubeadm/scripts/kube-pre-init.sh /persistent/spectro",
 		},
 		{
 			name:            "agent_mode_path",
 			rootPath:        "/mnt/custom",
 			expectedName:    "Run Pre Kubeadm Commands",
-			expectedCommand: "/bin/bash /mnt/custom/opt/kubeadm/scripts/kube-pre-init.sh /mnt/custom",
+			expectedCommand: "/usr/bin/agent-provider-kubeadm phase-run --root-path /mnt/custom --phase pre --role init --kubernetes-version '' -- /bin/bash /mnt/custom/opt/kubeadm/scripts/kube-pre-init.sh /mnt/custom",
 		},
 	}
 
@@ -39,7 +40,7 @@ func TestGetPreKubeadmCommandStages(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
 
-			result := GetPreKubeadmCommandStages(tt.rootPath)
+			result := GetPreKubeadmCommandStages(&domain.ClusterContext{RootPath: tt.rootPath, NodeRole: "init", ProviderPath: "/usr/bin/agent-provider-kubeadm"})
 
 			// Validate stage structure
 			g.Expect(result.Name).To(Equal(tt.expectedName))
@@ -72,6 +73,7 @@ func TestGetPreKubeadmImportLocalImageStage(t *testing.T) {
 		expectedName         string
 		expectedCommandCount int
 		expectedCondition    string
+		expectedFiles        []yip.File
 		validateCommands     func(*testing.T, []string)
 	}{
 		{
@@ -79,14 +81,15 @@ func TestGetPreKubeadmImportLocalImageStage(t *testing.T) {
 			clusterCtx: &domain.ClusterContext{
 				RootPath:        "/",
 				LocalImagesPath: "/opt/content/images",
+				NodeRole:        "init",
+				ProviderPath:    "/usr/bin/agent-provider-kubeadm",
 			},
 			expectedName:         "Run Import Local Images",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			expectedCondition:    "[ -d /opt/content/images ]",
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("chmod +x /opt/kubeadm/scripts/import.sh"))
-				g.Expect(commands[1]).To(Equal("/bin/bash /opt/kubeadm/scripts/import.sh /opt/content/images /var/log/import.log"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path / --phase local-image-import --role init --kubernetes-version '' -- /usr/bin/agent-provider-kubeadm images-import --root-path / --dir /opt/content/images --concurrency 4"))
 			},
 		},
 		{
@@ -94,14 +97,15 @@ func TestGetPreKubeadmImportLocalImageStage(t *testing.T) {
 			clusterCtx: &domain.ClusterContext{
 				RootPath:        "/persistent/spectro",
 				LocalImagesPath: "/persistent/spectro/opt/content/images",
+				NodeRole:        "init",
+				ProviderPath:    "/usr/bin/agent-provider-kubeadm",
 			},
 			expectedName:         "Run Import Local Images",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			expectedCondition:    "[ -d /persistent/spectro/opt/content/images ]",
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("chmod +x /persistent/spectro/opt/kubeadm/scripts/import.sh"))
-				g.Expect(commands[1]).To(Equal("/bin/bash /persistent/spectro/opt/kubeadm/scripts/import.sh /persistent/spectro/opt/content/images /var/log/import.log"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase local-image-import --role init --kubernetes-version '' -- /usr/bin/agent-provider-kubeadm images-import --root-path /persistent/spectro --dir /persistent/spectro/opt/content/images --concurrency 4"))
 			},
 		},
 		{
@@ -109,14 +113,35 @@ func TestGetPreKubeadmImportLocalImageStage(t *testing.T) {
 			clusterCtx: &domain.ClusterContext{
 				RootPath:        "/mnt/custom",
 				LocalImagesPath: "/custom/images/path",
+				NodeRole:        "init",
+				ProviderPath:    "/usr/bin/agent-provider-kubeadm",
 			},
 			expectedName:         "Run Import Local Images",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			expectedCondition:    "[ -d /custom/images/path ]",
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("chmod +x /mnt/custom/opt/kubeadm/scripts/import.sh"))
-				g.Expect(commands[1]).To(Equal("/bin/bash /mnt/custom/opt/kubeadm/scripts/import.sh /custom/images/path /var/log/import.log"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /mnt/custom --phase local-image-import --role init --kubernetes-version '' -- /usr/bin/agent-provider-kubeadm images-import --root-path /mnt/custom --dir /custom/images/path --concurrency 4"))
+			},
+		},
+		{
+			name: "signed_local_images",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:             "/",
+				LocalImagesPath:      "/opt/content/images",
+				LocalImagesPublicKey: "-----BEGIN PUBLIC KEY-----\nkey\n-----END PUBLIC KEY-----",
+				NodeRole:             "init",
+				ProviderPath:         "/usr/bin/agent-provider-kubeadm",
+			},
+			expectedName:         "Run Import Local Images",
+			expectedCommandCount: 1,
+			expectedCondition:    "[ -d /opt/content/images ]",
+			expectedFiles: []yip.File{
+				{Path: "/opt/kubeadm/local-images.pub", Permissions: 0644, Content: "-----BEGIN PUBLIC KEY-----\nkey\n-----END PUBLIC KEY-----"},
+			},
+			validateCommands: func(t *testing.T, commands []string) {
+				g := NewWithT(t)
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path / --phase local-image-import --role init --kubernetes-version '' -- /usr/bin/agent-provider-kubeadm images-import --root-path / --dir /opt/content/images --concurrency 4 --public-key /opt/kubeadm/local-images.pub"))
 			},
 		},
 	}
@@ -131,6 +156,7 @@ func TestGetPreKubeadmImportLocalImageStage(t *testing.T) {
 			g.Expect(result.Name).To(Equal(tt.expectedName))
 			g.Expect(result.Commands).To(HaveLen(tt.expectedCommandCount))
 			g.Expect(result.If).To(Equal(tt.expectedCondition))
+			g.Expect(result.Files).To(Equal(tt.expectedFiles))
 			tt.validateCommands(t, result.Commands)
 		})
 	}
@@ -149,33 +175,30 @@ func TestGetPreKubeadmImportCoreK8sImageStage(t *testing.T) {
 			name:                 "standard_root_path",
 			rootPath:             "/",
 			expectedName:         "Run Load Kube Images",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("chmod +x /opt/kubeadm/scripts/import.sh"))
-				g.Expect(commands[1]).To(Equal("/bin/bash /opt/kubeadm/scripts/import.sh /opt/kube-images /var/log/import-kube-images.log"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path / --phase image-import --role init --kubernetes-version '' -- /usr/bin/agent-provider-kubeadm images-import --root-path / --dir /opt/kube-images --concurrency 4"))
 			},
 		},
 		{
 			name:                 "agent_mode_root_path",
 			rootPath:             "/persistent/spectro",
 			expectedName:         "Run Load Kube Images",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("chmod +x /persistent/spectro/opt/kubeadm/scripts/import.sh"))
-				g.Expect(commands[1]).To(Equal("/bin/bash /persistent/spectro/opt/kubeadm/scripts/import.sh /persistent/spectro/opt/kube-images /var/log/import-kube-images.log"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /persistent/spectro --phase image-import --role init --kubernetes-version '' -- /usr/bin/agent-provider-kubeadm images-import --root-path /persistent/spectro --dir /persistent/spectro/opt/kube-images --concurrency 4"))
 			},
 		},
 		{
 			name:                 "custom_root_path",
 			rootPath:             "/mnt/custom",
 			expectedName:         "Run Load Kube Images",
-			expectedCommandCount: 2,
+			expectedCommandCount: 1,
 			validateCommands: func(t *testing.T, commands []string) {
 				g := NewWithT(t)
-				g.Expect(commands[0]).To(Equal("chmod +x /mnt/custom/opt/kubeadm/scripts/import.sh"))
-				g.Expect(commands[1]).To(Equal("/bin/bash /mnt/custom/opt/kubeadm/scripts/import.sh /mnt/custom/opt/kube-images /var/log/import-kube-images.log"))
+				g.Expect(commands[0]).To(Equal("/usr/bin/agent-provider-kubeadm phase-run --root-path /mnt/custom --phase image-import --role init --kubernetes-version '' -- /usr/bin/agent-provider-kubeadm images-import --root-path /mnt/custom --dir /mnt/custom/opt/kube-images --concurrency 4"))
 			},
 		},
 	}
@@ -184,7 +207,7 @@ func TestGetPreKubeadmImportCoreK8sImageStage(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
 
-			result := GetPreKubeadmImportCoreK8sImageStage(tt.rootPath)
+			result := GetPreKubeadmImportCoreK8sImageStage(&domain.ClusterContext{RootPath: tt.rootPath, NodeRole: "init", ProviderPath: "/usr/bin/agent-provider-kubeadm"})
 
 			// Validate stage structure
 			g.Expect(result.Name).To(Equal(tt.expectedName))
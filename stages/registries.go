@@ -0,0 +1,59 @@
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/containerd"
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// getRegistriesStage writes the registry hosts.toml files to the registry config path of containerd
+// on every boot, so that changes to the registries block apply without a containerd restart. The
+// directories of upstream registries removed from the block are deleted, also when the block is
+// empty. Directories that were not written from the block are left alone.
+func getRegistriesStage(clusterCtx *domain.ClusterContext, kubeadmAPI kubeadm.API) yip.Stage {
+	configPath := containerd.RegistryConfigPath(clusterCtx.ContainerdServiceFolderName)
+	if cfg := kubeadmAPI.Containerd(clusterCtx); cfg != nil {
+		configPath = cfg.RegistryConfigPath
+	}
+	registries := kubeadmAPI.Registries()
+
+	return yip.Stage{
+		Name:     "Generate Registry Config",
+		Files:    containerd.RegistryFiles(configPath, registries),
+		Commands: getStaleRegistriesCommands(configPath, registries),
+	}
+}
+
+// getStaleRegistriesCommands removes the directories listed in the registry marker file that are
+// not in the registries block, and then lists the current ones in the marker file. The commands
+// run after the hosts.toml files have been written.
+func getStaleRegistriesCommands(configPath string, registries []domain.RegistryConfiguration) []string {
+	marker := shellQuote(filepath.Join(configPath, containerd.RegistryMarkerFile))
+
+	upstreams := make([]string, len(registries))
+	for i, registry := range registries {
+		upstreams[i] = registry.Upstream
+	}
+	current := " " + strings.Join(upstreams, " ") + " "
+
+	// the upstreams are validated host[:port] names, the checks only guard against edited markers
+	cleanup := fmt.Sprintf(`if [ -f %[1]s ]; then while read -r upstream; do case "$upstream" in ""|.|..|*/*) continue ;; esac; `+
+		`case %[2]s in *" $upstream "*) ;; *) rm -rf %[3]s/"$upstream" ;; esac; done < %[1]s; fi`,
+		marker, shellQuote(current), shellQuote(configPath))
+
+	if len(upstreams) == 0 {
+		return []string{cleanup, "rm -f " + marker}
+	}
+
+	quoted := make([]string, len(upstreams))
+	for i, upstream := range upstreams {
+		quoted[i] = shellQuote(upstream)
+	}
+	return []string{cleanup, fmt.Sprintf("printf '%%s\\n' %s > %s", strings.Join(quoted, " "), marker)}
+}
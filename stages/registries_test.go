@@ -0,0 +1,173 @@
+package stages
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestGetRegistriesStage tests that the registry hosts.toml files are written for the containerd service
+func TestGetRegistriesStage(t *testing.T) {
+	tests := []struct {
+		name                        string
+		nodeRole                    string
+		containerdServiceFolderName string
+		registries                  []domain.RegistryConfiguration
+		registryConfigPath          string
+		expectedPath                string
+	}{
+		{
+			name:                        "init_containerd",
+			nodeRole:                    "init",
+			containerdServiceFolderName: "containerd",
+			registries:                  []domain.RegistryConfiguration{{Upstream: "docker.io", Mirrors: []domain.RegistryMirror{{Endpoint: "https://mirror.local"}}}},
+			expectedPath:                "/etc/containerd/certs.d/docker.io/hosts.toml",
+		},
+		{
+			name:                        "worker_spectro_containerd",
+			nodeRole:                    "worker",
+			containerdServiceFolderName: "spectro-containerd",
+			registries:                  []domain.RegistryConfiguration{{Upstream: "docker.io", Mirrors: []domain.RegistryMirror{{Endpoint: "https://mirror.local"}}}},
+			expectedPath:                "/etc/spectro-containerd/certs.d/docker.io/hosts.toml",
+		},
+		{
+			name:                        "registry_config_path",
+			nodeRole:                    "controlplane",
+			containerdServiceFolderName: "containerd",
+			registries:                  []domain.RegistryConfiguration{{Upstream: "docker.io", Mirrors: []domain.RegistryMirror{{Endpoint: "https://mirror.local"}}}},
+			registryConfigPath:          "/etc/registries",
+			expectedPath:                "/etc/registries/docker.io/hosts.toml",
+		},
+		{
+			name:                        "no_registries",
+			nodeRole:                    "controlplane",
+			containerdServiceFolderName: "containerd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:                    "/",
+				NodeRole:                    tt.nodeRole,
+				ControlPlaneHost:            "10.0.0.1:6443",
+				ClusterToken:                "abcdef.1234567890123456",
+				KubernetesVersion:           "v1.33.2",
+				ContainerdServiceFolderName: tt.containerdServiceFolderName,
+			}
+			config := domain.KubeadmConfigBeta4{
+				ProviderConfiguration: domain.ProviderConfiguration{Registries: tt.registries},
+			}
+			if tt.registryConfigPath != "" {
+				config.Containerd = &domain.ContainerdConfiguration{RegistryConfigPath: tt.registryConfigPath}
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(config)
+
+			var result []yip.Stage
+			var err error
+			if tt.nodeRole == "init" {
+				result, err = GetInitYipStages(clusterCtx, kubeadmAPI)
+			} else {
+				result, err = GetJoinYipStages(clusterCtx, kubeadmAPI)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// the stage removes the directories of registries dropped from the block
+			stage := result[0]
+			g.Expect(stage.Name).To(Equal("Generate Registry Config"))
+			g.Expect(stage.Commands).To(HaveLen(2))
+			if tt.registries == nil {
+				g.Expect(stage.Files).To(BeEmpty())
+				g.Expect(stage.Commands[1]).To(Equal("rm -f /etc/containerd/certs.d/.provider-kubeadm-registries"))
+				return
+			}
+
+			g.Expect(stage.Files).To(HaveLen(1))
+			g.Expect(stage.Files[0].Path).To(Equal(tt.expectedPath))
+			g.Expect(stage.Files[0].Content).To(ContainSubstring(`[host."https://mirror.local"]`))
+		})
+	}
+}
+
+// TestGetStaleRegistriesCommands tests that the commands only remove the registry directories
+// written from an earlier registries block
+func TestGetStaleRegistriesCommands(t *testing.T) {
+	tests := []struct {
+		name            string
+		previous        string
+		registries      []domain.RegistryConfiguration
+		expectedDirs    []string
+		expectedMarker  string
+		expectedRemoved bool
+	}{
+		{
+			name:           "registry_removed",
+			previous:       "docker.io\nquay.io\n",
+			registries:     []domain.RegistryConfiguration{{Upstream: "docker.io"}, {Upstream: "registry.local:5000"}},
+			expectedDirs:   []string{"docker.io", "ghcr.io", "registry.local:5000"},
+			expectedMarker: "docker.io\nregistry.local:5000\n",
+		},
+		{
+			name:            "block_emptied",
+			previous:        "docker.io\nquay.io\n",
+			expectedDirs:    []string{"ghcr.io", "registry.local:5000"},
+			expectedRemoved: true,
+		},
+		{
+			name:           "edited_marker",
+			previous:       "..\n/\n\nquay.io\n",
+			registries:     []domain.RegistryConfiguration{{Upstream: "docker.io"}},
+			expectedDirs:   []string{"docker.io", "ghcr.io", "registry.local:5000"},
+			expectedMarker: "docker.io\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			root := t.TempDir()
+			configPath := filepath.Join(root, "certs.d")
+			marker := filepath.Join(configPath, ".provider-kubeadm-registries")
+			// ghcr.io and registry.local:5000 were not written from the registries block
+			for _, dir := range []string{"docker.io", "quay.io", "ghcr.io", "registry.local:5000"} {
+				g.Expect(os.MkdirAll(filepath.Join(configPath, dir), 0755)).To(Succeed())
+				g.Expect(os.WriteFile(filepath.Join(configPath, dir, "hosts.toml"), nil, 0644)).To(Succeed())
+			}
+			g.Expect(os.WriteFile(marker, []byte(tt.previous), 0644)).To(Succeed())
+
+			for _, command := range getStaleRegistriesCommands(configPath, tt.registries) {
+				out, err := exec.Command("sh", "-c", command).CombinedOutput()
+				g.Expect(err).ToNot(HaveOccurred(), string(out))
+			}
+
+			entries, err := os.ReadDir(configPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			var dirs []string
+			for _, entry := range entries {
+				if entry.IsDir() {
+					dirs = append(dirs, entry.Name())
+				}
+			}
+			g.Expect(dirs).To(Equal(tt.expectedDirs))
+			g.Expect(root).To(BeADirectory())
+
+			if tt.expectedRemoved {
+				g.Expect(marker).ToNot(BeAnExistingFile())
+				return
+			}
+			content, err := os.ReadFile(marker)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(content)).To(Equal(tt.expectedMarker))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package stages
+
+import (
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"k8s.io/utils/ptr"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/runner"
+	"github.com/kairos-io/kairos/provider-kubeadm/upgrade"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+// getKubeadmRunnerCommand returns the provider command that runs kubeadm init or join with retries.
+func getKubeadmRunnerCommand(clusterCtx *domain.ClusterContext, action string) string {
+	opts := runner.Options{
+		Action:                action,
+		NodeRole:              clusterCtx.NodeRole,
+		RootPath:              clusterCtx.RootPath,
+		Retry:                 clusterCtx.KubeadmRetry,
+		IgnorePreflightErrors: clusterCtx.IgnorePreflightErrors,
+	}
+
+	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
+		opts.ProxyConfig = true
+		opts.HTTPProxy = clusterCtx.EnvConfig["HTTP_PROXY"]
+		opts.HTTPSProxy = clusterCtx.EnvConfig["HTTPS_PROXY"]
+		opts.NoProxy = utils.GetNoProxyConfig(clusterCtx)
+	}
+
+	return getProviderCommand(clusterCtx, runner.Args(opts))
+}
+
+// getKubeadmUpgradeCommand returns the provider command that upgrades the node.
+func getKubeadmUpgradeCommand(clusterCtx *domain.ClusterContext) string {
+	opts := upgrade.Options{
+		NodeRole: clusterCtx.NodeRole,
+		RootPath: clusterCtx.RootPath,
+	}
+
+	if clusterCtx.NodeRole != clusterplugin.RoleWorker {
+		opts.EtcdSnapshotDir = clusterCtx.EtcdSnapshot.Dir
+		opts.EtcdSnapshotRetention = clusterCtx.EtcdSnapshot.Retention
+	}
+
+	if clusterCtx.NodeRole == clusterplugin.RoleWorker && ptr.Deref(clusterCtx.Drain.Enabled, true) {
+		opts.Drain = true
+		opts.DrainTimeout = domain.DefaultDrainTimeout
+		if clusterCtx.Drain.Timeout != nil {
+			opts.DrainTimeout = clusterCtx.Drain.Timeout.Duration
+		}
+		opts.EvictDaemonSetPods = clusterCtx.Drain.EvictDaemonSetPods
+		opts.EvictLocalStoragePods = clusterCtx.Drain.EvictLocalStoragePods
+	}
+
+	if utils.IsProxyConfigured(clusterCtx.EnvConfig) {
+		opts.ProxyConfig = true
+		opts.HTTPProxy = clusterCtx.EnvConfig["HTTP_PROXY"]
+		opts.HTTPSProxy = clusterCtx.EnvConfig["HTTPS_PROXY"]
+		opts.NoProxy = utils.GetNoProxyConfig(clusterCtx)
+	}
+
+	return getProviderCommand(clusterCtx, upgrade.Args(opts))
+}
+
+// getProviderCommand returns the shell command that runs the provider with the given arguments.
+func getProviderCommand(clusterCtx *domain.ClusterContext, providerArgs []string) string {
+	args := []string{shellQuote(clusterCtx.ProviderPath)}
+	for _, arg := range providerArgs {
+		args = append(args, shellQuote(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,@%+") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
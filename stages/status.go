@@ -0,0 +1,18 @@
+package stages
+
+import (
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/status"
+)
+
+// getPhaseCommand wraps a stage command so that its progress is recorded in the node status.
+func getPhaseCommand(clusterCtx *domain.ClusterContext, phase, command string) string {
+	opts := status.PhaseOptions{
+		RootPath:          clusterCtx.RootPath,
+		Phase:             phase,
+		NodeRole:          clusterCtx.NodeRole,
+		KubernetesVersion: clusterCtx.KubernetesVersion,
+	}
+
+	return getProviderCommand(clusterCtx, status.PhaseArgs(opts)) + " " + command
+}
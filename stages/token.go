@@ -0,0 +1,70 @@
+package stages
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	yip "github.com/mudler/yip/pkg/schema"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+const (
+	tokenRotationUnit = "kubeadm-token-rotate"
+)
+
+// GetBootstrapTokenRotationStage installs a systemd timer on control plane nodes which keeps the
+// bootstrap tokens of the current and the next rotation period and the kubeadm-certs secret
+// available in the cluster.
+func GetBootstrapTokenRotationStage(clusterCtx *domain.ClusterContext) yip.Stage {
+	clusterRootPath := clusterCtx.RootPath
+
+	env := tokenRotationEnv{
+		ClusterToken:    clusterCtx.ClusterToken,
+		TokenTTLSeconds: int(clusterCtx.BootstrapTokenTTL / time.Second),
+		ProviderPath:    clusterCtx.ProviderPath,
+	}
+
+	service := fmt.Sprintf(`[Unit]
+Description=Rotate the kubeadm bootstrap token
+After=kubelet.service
+
+[Service]
+Type=oneshot
+ExecStart=/bin/bash %s %s
+`, systemdQuote(filepath.Join(clusterRootPath, helperScriptPath, "kube-token-rotate.sh")), systemdQuote(clusterRootPath))
+
+	timer := `[Unit]
+Description=Rotate the kubeadm bootstrap token periodically
+
+[Timer]
+OnActiveSec=1min
+OnUnitActiveSec=15min
+`
+
+	return yip.Stage{
+		Name: "Setup Bootstrap Token Rotation",
+		Files: []yip.File{
+			{
+				Path:        filepath.Join(clusterRootPath, configurationPath, "token-rotation.env"),
+				Permissions: 0600,
+				Content:     getEnvFileContent(env),
+			},
+			{
+				Path:        fmt.Sprintf("/run/systemd/system/%s.service", tokenRotationUnit),
+				Permissions: 0644,
+				Content:     service,
+			},
+			{
+				Path:        fmt.Sprintf("/run/systemd/system/%s.timer", tokenRotationUnit),
+				Permissions: 0644,
+				Content:     timer,
+			},
+		},
+		Commands: []string{
+			"systemctl daemon-reload",
+			fmt.Sprintf("systemctl start %s.timer", tokenRotationUnit),
+		},
+	}
+}
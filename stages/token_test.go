@@ -0,0 +1,154 @@
+package stages
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	yip "github.com/mudler/yip/pkg/schema"
+	. "github.com/onsi/gomega"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/kubeadm"
+)
+
+// TestGetBootstrapTokenRotationStage tests the GetBootstrapTokenRotationStage function
+func TestGetBootstrapTokenRotationStage(t *testing.T) {
+	tests := []struct {
+		name              string
+		clusterCtx        *domain.ClusterContext
+		expectedEnvPath   string
+		expectedEnv       string
+		expectedExecStart string
+	}{
+		{
+			name: "agent_mode",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:          "/persistent/spectro",
+				ProviderPath:      "/usr/bin/agent-provider-kubeadm",
+				ClusterToken:      "abcdef.1234567890123456",
+				BootstrapTokenTTL: 24 * time.Hour,
+			},
+			expectedEnvPath:   "/persistent/spectro/opt/kubeadm/token-rotation.env",
+			expectedEnv:       "CLUSTER_TOKEN=abcdef.1234567890123456\nTOKEN_TTL_SECONDS=86400\nPROVIDER_PATH=/usr/bin/agent-provider-kubeadm\n",
+			expectedExecStart: "ExecStart=/bin/bash /persistent/spectro/opt/kubeadm/scripts/kube-token-rotate.sh /persistent/spectro\n",
+		},
+		{
+			name: "odd_values",
+			clusterCtx: &domain.ClusterContext{
+				RootPath:          "/persistent/site 1/%n",
+				ProviderPath:      "/usr/bin/agent-provider-kubeadm",
+				ClusterToken:      "it's $HOME;$(reboot) `reboot`",
+				BootstrapTokenTTL: time.Hour,
+			},
+			expectedEnvPath:   "/persistent/site 1/%n/opt/kubeadm/token-rotation.env",
+			expectedEnv:       "CLUSTER_TOKEN='it'\\''s $HOME;$(reboot) `reboot`'\nTOKEN_TTL_SECONDS=3600\nPROVIDER_PATH=/usr/bin/agent-provider-kubeadm\n",
+			expectedExecStart: `ExecStart=/bin/bash "/persistent/site 1/%%n/opt/kubeadm/scripts/kube-token-rotate.sh" "/persistent/site 1/%%n"` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result := GetBootstrapTokenRotationStage(tt.clusterCtx)
+
+			g.Expect(result.Name).To(Equal("Setup Bootstrap Token Rotation"))
+			g.Expect(result.Files).To(HaveLen(3))
+			g.Expect(result.Files[0].Path).To(Equal(tt.expectedEnvPath))
+			g.Expect(result.Files[0].Permissions).To(Equal(uint32(0600)))
+			g.Expect(result.Files[0].Content).To(Equal(tt.expectedEnv))
+
+			// kube-token-rotate.sh sources the env file
+			envFile := filepath.Join(t.TempDir(), "token-rotation.env")
+			g.Expect(os.WriteFile(envFile, []byte(result.Files[0].Content), 0600)).To(Succeed())
+			out, err := exec.Command("bash", "-c", `source "$1" && printf '%s' "$CLUSTER_TOKEN"`, "bash", envFile).CombinedOutput()
+			g.Expect(err).ToNot(HaveOccurred(), string(out))
+			g.Expect(string(out)).To(Equal(tt.clusterCtx.ClusterToken))
+			g.Expect(result.Files[1].Path).To(Equal("/run/systemd/system/kubeadm-token-rotate.service"))
+			g.Expect(result.Files[1].Content).To(ContainSubstring(tt.expectedExecStart))
+			g.Expect(result.Files[2].Path).To(Equal("/run/systemd/system/kubeadm-token-rotate.timer"))
+			g.Expect(result.Commands).To(Equal([]string{
+				"systemctl daemon-reload",
+				"systemctl start kubeadm-token-rotate.timer",
+			}))
+		})
+	}
+}
+
+// TestBootstrapTokenRotationStageRoles tests which roles install the bootstrap token rotation
+func TestBootstrapTokenRotationStageRoles(t *testing.T) {
+	tests := []struct {
+		name                    string
+		nodeRole                string
+		expected                bool
+		expectedCertificateKeys bool
+	}{
+		{
+			name:     "init",
+			nodeRole: "init",
+			expected: true,
+		},
+		{
+			name:                    "controlplane",
+			nodeRole:                "controlplane",
+			expected:                true,
+			expectedCertificateKeys: true,
+		},
+		{
+			name:     "worker",
+			nodeRole: "worker",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterCtx := &domain.ClusterContext{
+				RootPath:          "/",
+				NodeRole:          tt.nodeRole,
+				ControlPlaneHost:  "10.0.0.1:6443",
+				ClusterToken:      "abcdef.1234567890123456",
+				BootstrapTokenTTL: 24 * time.Hour,
+			}
+			kubeadmAPI := kubeadm.NewV1Beta4(domain.KubeadmConfigBeta4{
+				ClusterConfiguration: kubeadmapiv4.ClusterConfiguration{
+					Networking: kubeadmapiv4.Networking{
+						ServiceSubnet: "10.96.0.0/12",
+						PodSubnet:     "192.168.0.0/16",
+					},
+				},
+			})
+
+			var result []yip.Stage
+			var err error
+			if tt.nodeRole == "init" {
+				result, err = GetInitYipStages(clusterCtx, kubeadmAPI)
+			} else {
+				result, err = GetJoinYipStages(clusterCtx, kubeadmAPI)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			var names []string
+			for _, stage := range result {
+				names = append(names, stage.Name)
+			}
+
+			if tt.expected {
+				g.Expect(names).To(ContainElement("Setup Bootstrap Token Rotation"))
+			} else {
+				g.Expect(names).ToNot(ContainElement("Setup Bootstrap Token Rotation"))
+			}
+			if tt.expectedCertificateKeys {
+				g.Expect(names).To(ContainElement("Generate Kubeadm Certificate Keys File"))
+			} else {
+				g.Expect(names).ToNot(ContainElement("Generate Kubeadm Certificate Keys File"))
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/version"
+)
+
+const (
+	// Command is the provider subcommand that prints the node status.
+	Command = "status"
+	// PhaseCommand is the provider subcommand that runs a stage command and records it as a phase.
+	PhaseCommand = "phase-run"
+
+	// File is written under the cluster root path.
+	File = "opt/kubeadm/status.json"
+
+	PhasePre              = "pre"
+	PhaseImageImport      = "image-import"
+	PhaseLocalImageImport = "local-image-import"
+	PhaseImageVerify      = "image-verify"
+	PhaseInit             = "init"
+	PhaseJoin             = "join"
+	PhasePostInit         = "post-init"
+	PhaseUpgrade          = "upgrade"
+	PhaseReconfigure      = "reconfigure"
+	PhaseCertificates     = "certificates"
+
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+
+	outputTailSize = 4096
+)
+
+// Status is the bootstrap status of a node.
+type Status struct {
+	NodeRole          string    `json:"nodeRole,omitempty"`
+	KubernetesVersion string    `json:"kubernetesVersion,omitempty"`
+	ProviderVersion   string    `json:"providerVersion,omitempty"`
+	CurrentPhase      string    `json:"currentPhase,omitempty"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+	Phases            []Phase   `json:"phases"`
+	// Certificates is recorded by the certificate check of control plane nodes.
+	Certificates []Certificate `json:"certificates,omitempty"`
+	// Preflight is recorded by the kubeadm runner before the first init or join attempt.
+	Preflight []PreflightCheck `json:"preflight,omitempty"`
+}
+
+// Phase records the last run of a bootstrap phase. Attempts counts every run since the node
+// was reset, phases which run on every boot keep counting across reboots.
+type Phase struct {
+	Name       string     `json:"name"`
+	State      string     `json:"state"`
+	Attempts   int        `json:"attempts"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+}
+
+// Certificate records the expiry of a control plane certificate, and when the provider last renewed it.
+type Certificate struct {
+	Name      string     `json:"name"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RenewedAt *time.Time `json:"renewedAt,omitempty"`
+}
+
+// PreflightCheck records a failed preflight check, and whether the ignored preflight errors waived it.
+type PreflightCheck struct {
+	Name   string `json:"name"`
+	Error  string `json:"error"`
+	Waived bool   `json:"waived"`
+}
+
+// PhaseOptions configures a phase run.
+type PhaseOptions struct {
+	RootPath          string
+	Phase             string
+	NodeRole          string
+	KubernetesVersion string
+	Command           []string
+}
+
+// stubbed in tests
+var now = time.Now
+
+// Start marks the phase as running.
+func (s *Status) Start(name string, t time.Time) {
+	p := s.phase(name)
+	p.State = StateRunning
+	p.Attempts++
+	p.StartedAt = t
+	p.FinishedAt = nil
+	s.CurrentPhase = name
+}
+
+// Finish marks the phase as succeeded, or failed if err is set.
+func (s *Status) Finish(name string, t time.Time, err error) {
+	p := s.phase(name)
+	p.FinishedAt = &t
+	if err != nil {
+		p.State = StateFailed
+		p.LastError = err.Error()
+		return
+	}
+	p.State = StateSucceeded
+	p.LastError = ""
+}
+
+// Phase returns the named phase, or nil if it never ran.
+func (s *Status) Phase(name string) *Phase {
+	for i := range s.Phases {
+		if s.Phases[i].Name == name {
+			return &s.Phases[i]
+		}
+	}
+	return nil
+}
+
+func (s *Status) phase(name string) *Phase {
+	if p := s.Phase(name); p != nil {
+		return p
+	}
+	s.Phases = append(s.Phases, Phase{Name: name})
+	return &s.Phases[len(s.Phases)-1]
+}
+
+// Read returns the status recorded under the root path.
+func Read(rootPath string) (Status, error) {
+	var s Status
+
+	content, err := os.ReadFile(filepath.Join(rootPath, File))
+	if err != nil {
+		return s, err
+	}
+	if err = json.Unmarshal(content, &s); err != nil {
+		return s, fmt.Errorf("failed to parse %s: %w", filepath.Join(rootPath, File), err)
+	}
+	return s, nil
+}
+
+// Update applies fn to the status recorded under the root path and writes it back. The phases of
+// concurrent stages update the status under an exclusive lock, so that no update is lost.
+func Update(rootPath string, fn func(*Status)) error {
+	path := filepath.Join(rootPath, File)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	unlock, err := lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := Read(rootPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logrus.Errorf("discarding unreadable node status: %v", err)
+		s = Status{}
+	}
+
+	fn(&s)
+	s.ProviderVersion = version.Version
+	s.UpdatedAt = now().UTC()
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that readers never see a partial status
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err = errors.Join(err, tmp.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lock takes an exclusive lock on the file, the returned function releases it.
+func lock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	// closing the file releases the lock
+	return func() { f.Close() }, nil
+}
+
+// StartPhase records the start of a phase, errors are only logged so they never fail the phase.
+func StartPhase(rootPath, name string) {
+	logrus.Infof("phase %s started", name)
+	if err := Update(rootPath, func(s *Status) { s.Start(name, now().UTC()) }); err != nil {
+		logrus.Errorf("failed to record start of phase %s: %v", name, err)
+	}
+}
+
+// FinishPhase records the result of a phase, errors are only logged so they never fail the phase.
+func FinishPhase(rootPath, name string, phaseErr error) {
+	if phaseErr != nil {
+		logrus.Errorf("phase %s failed: %v", name, phaseErr)
+	} else {
+		logrus.Infof("phase %s succeeded", name)
+	}
+	if err := Update(rootPath, func(s *Status) { s.Finish(name, now().UTC(), phaseErr) }); err != nil {
+		logrus.Errorf("failed to record result of phase %s: %v", name, err)
+	}
+}
+
+// PhaseArgs returns the provider arguments that run the command as the given phase.
+func PhaseArgs(opts PhaseOptions) []string {
+	args := []string{
+		PhaseCommand,
+		"--root-path", opts.RootPath,
+		"--phase", opts.Phase,
+		"--role", opts.NodeRole,
+		"--kubernetes-version", opts.KubernetesVersion,
+		"--",
+	}
+	return append(args, opts.Command...)
+}
+
+// ParsePhaseArgs parses the arguments following the PhaseCommand.
+func ParsePhaseArgs(args []string) (PhaseOptions, error) {
+	var opts PhaseOptions
+
+	fs := flag.NewFlagSet(PhaseCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.StringVar(&opts.Phase, "phase", "", "phase name")
+	fs.StringVar(&opts.NodeRole, "role", "", "node role")
+	fs.StringVar(&opts.KubernetesVersion, "kubernetes-version", "", "kubernetes version")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if opts.Phase == "" {
+		return opts, errors.New("phase is required")
+	}
+	opts.Command = fs.Args()
+	if len(opts.Command) == 0 {
+		return opts, errors.New("command is required")
+	}
+	return opts, nil
+}
+
+// RunPhase runs the phase command and records its start and result in the node status.
+func RunPhase(opts PhaseOptions) error {
+	if err := Update(opts.RootPath, func(s *Status) {
+		if opts.NodeRole != "" {
+			s.NodeRole = opts.NodeRole
+		}
+		if opts.KubernetesVersion != "" {
+			s.KubernetesVersion = opts.KubernetesVersion
+		}
+	}); err != nil {
+		logrus.Errorf("failed to record node status: %v", err)
+	}
+
+	StartPhase(opts.RootPath, opts.Phase)
+
+	// the last line written to stderr is recorded as the phase error
+	stderr := &tailWriter{size: outputTailSize}
+	cmd := exec.Command(opts.Command[0], opts.Command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+
+	err := cmd.Run()
+	if err != nil {
+		if line := stderr.lastLine(); line != "" {
+			err = fmt.Errorf("%w: %s", err, line)
+		}
+	}
+
+	FinishPhase(opts.RootPath, opts.Phase, err)
+	return err
+}
+
+// tailWriter keeps the last size bytes written to it.
+type tailWriter struct {
+	size int
+	buf  []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.size {
+		w.buf = w.buf[len(w.buf)-w.size:]
+	}
+	return len(p), nil
+}
+
+func (w *tailWriter) lastLine() string {
+	lines := strings.Split(strings.TrimSpace(string(w.buf)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
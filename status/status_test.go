@@ -0,0 +1,179 @@
+package status
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// TestPhaseArgs tests that ParsePhaseArgs parses the arguments built by PhaseArgs
+func TestPhaseArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	opts := PhaseOptions{
+		RootPath:          "/persistent/spectro",
+		Phase:             PhaseUpgrade,
+		NodeRole:          "controlplane",
+		KubernetesVersion: "v1.31.2",
+		Command:           []string{"bash", "/persistent/spectro/opt/kubeadm/scripts/kube-upgrade.sh", "--role", "controlplane"},
+	}
+
+	args := PhaseArgs(opts)
+	g.Expect(args[0]).To(Equal(PhaseCommand))
+
+	result, err := ParsePhaseArgs(args[1:])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(opts))
+}
+
+// TestParsePhaseArgsInvalid tests that ParsePhaseArgs rejects incomplete arguments
+func TestParsePhaseArgsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "missing_phase",
+			args:     []string{"--", "true"},
+			expected: "phase is required",
+		},
+		{
+			name:     "missing_command",
+			args:     []string{"--phase", PhasePre, "--"},
+			expected: "command is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := ParsePhaseArgs(tt.args)
+			g.Expect(err).To(MatchError(tt.expected))
+		})
+	}
+}
+
+// TestStatusStartFinish tests the Start and Finish methods
+func TestStatusStartFinish(t *testing.T) {
+	g := NewWithT(t)
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(time.Minute)
+
+	var s Status
+	s.Start(PhasePre, start)
+	s.Finish(PhasePre, end, nil)
+	s.Start(PhaseInit, start)
+	s.Finish(PhaseInit, end, errors.New("connection refused"))
+	s.Start(PhaseInit, end)
+
+	g.Expect(s.CurrentPhase).To(Equal(PhaseInit))
+	g.Expect(s.Phases).To(HaveLen(2))
+	g.Expect(s.Phase(PhasePre)).To(Equal(&Phase{Name: PhasePre, State: StateSucceeded, Attempts: 1, StartedAt: start, FinishedAt: &end}))
+	g.Expect(s.Phase(PhaseInit)).To(Equal(&Phase{Name: PhaseInit, State: StateRunning, Attempts: 2, StartedAt: end, LastError: "connection refused"}))
+	g.Expect(s.Phase(PhaseUpgrade)).To(BeNil())
+
+	s.Finish(PhaseInit, end, nil)
+	g.Expect(s.Phase(PhaseInit).LastError).To(BeEmpty())
+}
+
+// TestUpdateConcurrent tests that concurrent updates of the status are not lost
+func TestUpdateConcurrent(t *testing.T) {
+	g := NewWithT(t)
+
+	rootPath := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Expect(Update(rootPath, func(s *Status) { s.Start(PhasePre, time.Now()) })).To(Succeed())
+		}()
+	}
+	wg.Wait()
+
+	s, err := Read(rootPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(s.Phase(PhasePre).Attempts).To(Equal(20))
+
+	entries, err := os.ReadDir(filepath.Dir(filepath.Join(rootPath, File)))
+	g.Expect(err).ToNot(HaveOccurred())
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	g.Expect(names).To(ConsistOf("status.json", "status.json.lock"))
+}
+
+// TestRunPhase tests the RunPhase function
+func TestRunPhase(t *testing.T) {
+	tests := []struct {
+		name          string
+		command       []string
+		expectedState string
+		expectedError string
+	}{
+		{
+			name:          "succeeded",
+			command:       []string{"sh", "-c", "echo done"},
+			expectedState: StateSucceeded,
+		},
+		{
+			name:          "failed",
+			command:       []string{"sh", "-c", "echo starting; echo upgrade lock held by node-2 >&2; exit 3"},
+			expectedState: StateFailed,
+			expectedError: "exit status 3: upgrade lock held by node-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			if _, err := exec.LookPath("sh"); err != nil {
+				t.Skip("sh not available")
+			}
+
+			rootPath := t.TempDir()
+			opts := PhaseOptions{
+				RootPath:          rootPath,
+				Phase:             PhaseUpgrade,
+				NodeRole:          "init",
+				KubernetesVersion: "v1.30.4",
+				Command:           tt.command,
+			}
+
+			err := RunPhase(opts)
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(tt.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			s, err := Read(rootPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(s.NodeRole).To(Equal("init"))
+			g.Expect(s.KubernetesVersion).To(Equal("v1.30.4"))
+			g.Expect(s.CurrentPhase).To(Equal(PhaseUpgrade))
+
+			phase := s.Phase(PhaseUpgrade)
+			g.Expect(phase).ToNot(BeNil())
+			g.Expect(phase.State).To(Equal(tt.expectedState))
+			g.Expect(phase.Attempts).To(Equal(1))
+			g.Expect(phase.FinishedAt).ToNot(BeNil())
+			g.Expect(phase.LastError).To(Equal(tt.expectedError))
+
+			_, err = os.Stat(filepath.Join(rootPath, File+".tmp"))
+			g.Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	}
+}
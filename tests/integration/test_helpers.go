@@ -7,6 +7,9 @@ import (
 
 	yip "github.com/mudler/yip/pkg/schema"
 	"github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/runner"
+	"github.com/kairos-io/kairos/provider-kubeadm/upgrade"
 )
 
 // Helper functions
@@ -316,16 +319,26 @@ func (v *ComprehensiveYipValidator) validateKubeadmExecutionStage(stage yip.Stag
 	command := stage.Commands[0]
 	expectedRootPath := getRootPath(scenario.environmentMode)
 
-	// Validate script path in command
-	expectedScriptPath := fmt.Sprintf("%s/opt/kubeadm/scripts/kube-", expectedRootPath)
-	if !strings.Contains(command, expectedScriptPath) {
-		result.ValidationErrors = append(result.ValidationErrors,
-			fmt.Sprintf("Command should contain script path %s", expectedScriptPath))
+	// Validate provider command and its arguments
+	expectedAction := runner.ActionInit
+	if stage.Name == "Run Kubeadm Join" {
+		expectedAction = runner.ActionJoin
+	}
+	for _, expected := range []string{
+		" " + runner.Command + " ",
+		"--action " + expectedAction,
+		"--role " + scenario.nodeRole,
+		"--root-path " + expectedRootPath,
+	} {
+		if !strings.Contains(command, expected) {
+			result.ValidationErrors = append(result.ValidationErrors,
+				fmt.Sprintf("Command should contain %q", strings.TrimSpace(expected)))
+		}
 	}
 
 	// Validate proxy parameters if proxy is configured
 	if scenario.proxyConfig != "" {
-		if !strings.Contains(command, "true") || !strings.Contains(command, "proxy.example.com") {
+		if !strings.Contains(command, "--http-proxy") || !strings.Contains(command, "proxy.example.com") {
 			result.ValidationErrors = append(result.ValidationErrors, "Missing proxy parameters in kubeadm command")
 		}
 	}
@@ -347,17 +360,18 @@ func (v *ComprehensiveYipValidator) validateKubeadmUpgradeStage(stage yip.Stage,
 	command := stage.Commands[0]
 	expectedRootPath := getRootPath(scenario.environmentMode)
 
-	// Validate script path
-	expectedScriptPath := fmt.Sprintf("%s/opt/kubeadm/scripts/kube-upgrade.sh", expectedRootPath)
-	if !strings.Contains(command, expectedScriptPath) {
+	// Validate provider command
+	if !strings.Contains(command, " "+upgrade.Command+" ") {
 		result.ValidationErrors = append(result.ValidationErrors,
-			fmt.Sprintf("Upgrade command should contain script path %s", expectedScriptPath))
+			fmt.Sprintf("Upgrade command should contain provider command %s", upgrade.Command))
 	}
 
-	// Validate node role parameter
-	if !strings.Contains(command, scenario.nodeRole) {
-		result.ValidationErrors = append(result.ValidationErrors,
-			fmt.Sprintf("Upgrade command should contain node role %s", scenario.nodeRole))
+	// Validate node role and root path flags
+	for _, expected := range []string{"--role " + scenario.nodeRole, "--root-path " + expectedRootPath} {
+		if !strings.Contains(command, expected) {
+			result.ValidationErrors = append(result.ValidationErrors,
+				fmt.Sprintf("Upgrade command should contain %q", expected))
+		}
 	}
 }
 
@@ -377,16 +391,11 @@ func (v *ComprehensiveYipValidator) validateKubeadmReconfigureStage(stage yip.St
 			fmt.Sprintf("Reconfigure command should contain script path %s", expectedScriptPath))
 	}
 
-	// Validate parameters count
-	paramCount := len(strings.Fields(command))
-	expectedParamCount := 6 // Base parameters
-	if scenario.proxyConfig != "" {
-		expectedParamCount = 9 // Additional proxy parameters
-	}
-
-	if paramCount < expectedParamCount {
+	// Validate env file path
+	expectedEnvPath := fmt.Sprintf("%s/opt/kubeadm/reconfigure.env", expectedRootPath)
+	if !strings.HasSuffix(command, " "+expectedEnvPath) {
 		result.ValidationErrors = append(result.ValidationErrors,
-			fmt.Sprintf("Reconfigure command should have at least %d parameters, got %d", expectedParamCount, paramCount))
+			fmt.Sprintf("Reconfigure command should pass env file %s", expectedEnvPath))
 	}
 }
 
@@ -404,11 +413,10 @@ func (v *ComprehensiveYipValidator) validateLocalImagesStage(stage yip.Stage, sc
 	command := stage.Commands[0]
 	expectedRootPath := getRootPath(scenario.environmentMode)
 
-	// Validate script path
-	expectedScriptPath := fmt.Sprintf("%s/opt/kubeadm/scripts/import.sh", expectedRootPath)
-	if !strings.Contains(command, expectedScriptPath) {
+	// Validate the provider import command
+	if !strings.Contains(command, " images-import --root-path ") {
 		result.ValidationErrors = append(result.ValidationErrors,
-			fmt.Sprintf("Import command should contain script path %s", expectedScriptPath))
+			"Import command should run the provider images-import command")
 	}
 
 	// Validate conditional execution based on local images path
@@ -0,0 +1,60 @@
+package token
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	// Command is the provider subcommand that prints the bootstrap tokens and the certificate key
+	// of the current rotation period, kube-token-rotate.sh evaluates its output.
+	Command = "kubeadm-token"
+
+	// The cluster token and the rotation period are read from the environment rather than from
+	// flags, so that the cluster token does not show up in the process list.
+	ClusterTokenEnv = "CLUSTER_TOKEN"
+	TTLEnv          = "TOKEN_TTL_SECONDS"
+)
+
+// Options configures the bootstrap token rotation.
+type Options struct {
+	ClusterToken string
+	TTL          time.Duration
+}
+
+// OptionsFromEnv reads the options from the environment.
+func OptionsFromEnv(getenv func(string) string) (Options, error) {
+	opts := Options{ClusterToken: getenv(ClusterTokenEnv)}
+	if opts.ClusterToken == "" {
+		return opts, fmt.Errorf("%s is not set", ClusterTokenEnv)
+	}
+
+	seconds, err := strconv.ParseInt(getenv(TTLEnv), 10, 64)
+	if err != nil || seconds <= 0 {
+		return opts, fmt.Errorf("invalid %s %q: must be a positive number of seconds", TTLEnv, getenv(TTLEnv))
+	}
+	opts.TTL = time.Duration(seconds) * time.Second
+	return opts, nil
+}
+
+// Print writes the credentials of the rotation period containing now as shell assignments: the
+// EPOCH of the period, the TOKEN and NEXT_TOKEN with their TOKEN_TTL and NEXT_TOKEN_TTL in seconds,
+// the CERTIFICATE_KEY of the period, and the EXPIRATION of the kubeadm-certs secret, which ends
+// with the grace window of the token. The values never need quoting.
+func Print(w io.Writer, opts Options, now time.Time) error {
+	now = now.Truncate(time.Second)
+	token, tokenTTL := utils.GetBootstrapToken(opts.ClusterToken, opts.TTL, now)
+	nextToken, nextTokenTTL := utils.GetNextBootstrapToken(opts.ClusterToken, opts.TTL, now)
+
+	_, err := fmt.Fprintf(w, "EPOCH=%d\nTOKEN=%s\nTOKEN_TTL=%d\nNEXT_TOKEN=%s\nNEXT_TOKEN_TTL=%d\nCERTIFICATE_KEY=%s\nEXPIRATION=%s\n",
+		utils.GetRotationEpoch(opts.TTL, now),
+		token, int64(tokenTTL/time.Second),
+		nextToken, int64(nextTokenTTL/time.Second),
+		utils.GetRotatedCertificateKey(opts.ClusterToken, opts.TTL, now),
+		now.Add(tokenTTL).UTC().Format(time.RFC3339))
+	return err
+}
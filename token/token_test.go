@@ -0,0 +1,82 @@
+package token
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+// TestOptionsFromEnv tests the OptionsFromEnv function
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		expected      Options
+		expectedError string
+	}{
+		{
+			name:     "valid",
+			env:      map[string]string{"CLUSTER_TOKEN": "abcdef.1234567890123456", "TOKEN_TTL_SECONDS": "86400"},
+			expected: Options{ClusterToken: "abcdef.1234567890123456", TTL: 24 * time.Hour},
+		},
+		{
+			name:          "missing_cluster_token",
+			env:           map[string]string{"TOKEN_TTL_SECONDS": "86400"},
+			expectedError: "CLUSTER_TOKEN is not set",
+		},
+		{
+			name:          "no_rotation",
+			env:           map[string]string{"CLUSTER_TOKEN": "abcdef.1234567890123456", "TOKEN_TTL_SECONDS": "0"},
+			expectedError: `invalid TOKEN_TTL_SECONDS "0": must be a positive number of seconds`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			opts, err := OptionsFromEnv(func(key string) string { return tt.env[key] })
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(tt.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(opts).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestPrint tests that Print matches the tokens and the certificate key of the kubeadm config
+func TestPrint(t *testing.T) {
+	g := NewWithT(t)
+
+	opts := Options{ClusterToken: "abcdef.1234567890123456", TTL: 24 * time.Hour}
+	now := time.Unix(20000*86400+3600, 500)
+
+	var out bytes.Buffer
+	g.Expect(Print(&out, opts, now)).To(Succeed())
+
+	token, _ := utils.GetBootstrapToken(opts.ClusterToken, opts.TTL, now)
+	nextToken, _ := utils.GetNextBootstrapToken(opts.ClusterToken, opts.TTL, now)
+	g.Expect(out.String()).To(Equal(strings.Join([]string{
+		"EPOCH=20000",
+		"TOKEN=" + token,
+		"TOKEN_TTL=169200",
+		"NEXT_TOKEN=" + nextToken,
+		"NEXT_TOKEN_TTL=255600",
+		"CERTIFICATE_KEY=" + utils.GetRotatedCertificateKey(opts.ClusterToken, opts.TTL, now),
+		"EXPIRATION=" + time.Unix(20002*86400, 0).UTC().Format(time.RFC3339),
+	}, "\n") + "\n"))
+
+	// kube-token-rotate.sh evaluates the output
+	script := out.String() + `printf '%s %s' "$NEXT_TOKEN" "$EXPIRATION"`
+	evaluated, err := exec.Command("bash", "-c", script).CombinedOutput()
+	g.Expect(err).ToNot(HaveOccurred(), string(evaluated))
+	g.Expect(string(evaluated)).To(Equal(nextToken + " 2024-10-06T00:00:00Z"))
+}
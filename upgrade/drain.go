@@ -0,0 +1,191 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CordonMarker is written when the upgrade cordons the node, so that a resumed upgrade
+	// uncordons it even though the node was already unschedulable when it started.
+	CordonMarker = "opt/kubeadm/upgrade-cordoned"
+
+	drainPollInterval = 5 * time.Second
+)
+
+// drainNode cordons the node and evicts its pods. Evictions are retried until they no longer
+// violate a PodDisruptionBudget or the drain timeout expires.
+func drainNode(ctx context.Context, client kubernetes.Interface, opts Options) error {
+	cordoned, err := setUnschedulable(ctx, client, opts.NodeName, true)
+	if err != nil {
+		return fmt.Errorf("failed to cordon node %s: %w", opts.NodeName, err)
+	}
+	if cordoned {
+		logrus.Infof("cordoned node %s", opts.NodeName)
+		if err = os.WriteFile(filepath.Join(opts.RootPath, CordonMarker), nil, 0644); err != nil {
+			return fmt.Errorf("failed to record that node %s was cordoned: %w", opts.NodeName, err)
+		}
+	}
+
+	var deadline time.Time
+	if opts.DrainTimeout > 0 {
+		deadline = now().Add(opts.DrainTimeout)
+	}
+
+	logged := map[string]bool{}
+	for {
+		remaining, err := evictPods(ctx, client, opts, logged)
+		if err == nil && len(remaining) == 0 {
+			logrus.Infof("drained node %s", opts.NodeName)
+			return nil
+		}
+		if err != nil {
+			logrus.Errorf("failed to drain node %s: %v", opts.NodeName, err)
+		}
+
+		if !deadline.IsZero() && !now().Before(deadline) {
+			if err == nil {
+				err = fmt.Errorf("remaining pods %s", strings.Join(remaining, ", "))
+			}
+			return fmt.Errorf("timed out after %s draining node %s: %w", opts.DrainTimeout, opts.NodeName, err)
+		}
+		if err = sleep(ctx, drainPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// evictPods requests the eviction of every pod on the node which is not skipped and returns the
+// pods which are still running. Pods which are already terminating are waited for.
+func evictPods(ctx context.Context, client kubernetes.Interface, opts Options, logged map[string]bool) ([]string, error) {
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", opts.NodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var remaining []string
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != opts.NodeName {
+			continue
+		}
+
+		name := pod.Namespace + "/" + pod.Name
+		if reason := skipReason(pod, opts); reason != "" {
+			if !logged[name] {
+				logrus.Infof("not evicting pod %s: %s", name, reason)
+				logged[name] = true
+			}
+			continue
+		}
+
+		remaining = append(remaining, name)
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		err = client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		})
+		switch {
+		case err == nil:
+			logrus.Infof("evicted pod %s", name)
+		case apierrors.IsNotFound(err):
+		case apierrors.IsTooManyRequests(err):
+			logrus.Infof("cannot evict pod %s yet, it would violate its disruption budget", name)
+		default:
+			logrus.Errorf("failed to evict pod %s: %v", name, err)
+		}
+	}
+	return remaining, nil
+}
+
+// skipReason returns why a pod is not evicted, or an empty string if it is.
+func skipReason(pod corev1.Pod, opts Options) string {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return "pod is finished"
+	}
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return "static pod"
+	}
+	if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" && !opts.EvictDaemonSetPods {
+		return "DaemonSet pod"
+	}
+	if !opts.EvictLocalStoragePods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.EmptyDir != nil {
+				return fmt.Sprintf("pod uses local storage in volume %s", volume.Name)
+			}
+		}
+	}
+	return ""
+}
+
+// uncordonNode waits until the kubelet reported the node Ready after it was restarted and then
+// uncordons the node if the upgrade cordoned it.
+func uncordonNode(ctx context.Context, client kubernetes.Interface, opts Options, restarted time.Time) error {
+	marker := filepath.Join(opts.RootPath, CordonMarker)
+	if _, err := os.Stat(marker); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	logrus.Infof("waiting for node %s to be ready", opts.NodeName)
+	for {
+		node, err := client.CoreV1().Nodes().Get(ctx, opts.NodeName, metav1.GetOptions{})
+		if err == nil && nodeReady(node, restarted) {
+			break
+		}
+		if err = sleep(ctx, kubeletPollInterval); err != nil {
+			return err
+		}
+	}
+
+	if _, err := setUnschedulable(ctx, client, opts.NodeName, false); err != nil {
+		return fmt.Errorf("failed to uncordon node %s: %w", opts.NodeName, err)
+	}
+	logrus.Infof("uncordoned node %s", opts.NodeName)
+	return os.Remove(marker)
+}
+
+// nodeReady reports whether the node is Ready according to a heartbeat sent after the kubelet
+// restarted, the condition of the previous kubelet is stale.
+func nodeReady(node *corev1.Node, restarted time.Time) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue && !condition.LastHeartbeatTime.Time.Before(restarted.Truncate(time.Second))
+		}
+	}
+	return false
+}
+
+// setUnschedulable patches the node and reports whether it was changed.
+func setUnschedulable(ctx context.Context, client kubernetes.Interface, nodeName string, unschedulable bool) (bool, error) {
+	node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if node.Spec.Unschedulable == unschedulable {
+		return false, nil
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	if _, err = client.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
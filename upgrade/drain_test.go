@@ -0,0 +1,217 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func testPod(name, nodeName string, mutate func(*corev1.Pod)) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: name, Controller: ptr.To(true)},
+			},
+		},
+		Spec:   corev1.PodSpec{NodeName: nodeName},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if mutate != nil {
+		mutate(pod)
+	}
+	return pod
+}
+
+// stubEvictions deletes evicted pods, the evictions of a pod fail with a disruption budget
+// violation as many times as given in blocked.
+func stubEvictions(client *fake.Clientset, blocked map[string]int) *[]string {
+	var evicted []string
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		if blocked[eviction.Name] > 0 {
+			blocked[eviction.Name]--
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+		}
+		evicted = append(evicted, eviction.Name)
+		return true, nil, client.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+	})
+	return &evicted
+}
+
+// TestDrainNode tests the drainNode function, evicted pods are listed once more before they are gone
+func TestDrainNode(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            Options
+		unschedulable   bool
+		blocked         map[string]int
+		expectedEvicted []string
+		expectedSleeps  int
+		expectedError   string
+		expectMarker    bool
+	}{
+		{
+			name:            "skips_daemonset_local_storage_static_and_finished_pods",
+			opts:            Options{DrainTimeout: time.Minute},
+			expectedEvicted: []string{"app"},
+			expectedSleeps:  1,
+			expectMarker:    true,
+		},
+		{
+			name: "evicts_daemonset_and_local_storage_pods",
+			opts: Options{
+				DrainTimeout:          time.Minute,
+				EvictDaemonSetPods:    true,
+				EvictLocalStoragePods: true,
+			},
+			expectedEvicted: []string{"app", "cache", "logs"},
+			expectedSleeps:  1,
+			expectMarker:    true,
+		},
+		{
+			name:            "waits_for_disruption_budget",
+			opts:            Options{DrainTimeout: time.Minute},
+			blocked:         map[string]int{"app": 2},
+			expectedEvicted: []string{"app"},
+			expectedSleeps:  3,
+			expectMarker:    true,
+		},
+		{
+			name:           "times_out",
+			opts:           Options{DrainTimeout: 10 * time.Second},
+			blocked:        map[string]int{"app": 10},
+			expectedSleeps: 2,
+			expectedError:  "timed out after 10s draining node node-1: remaining pods default/app",
+			expectMarker:   true,
+		},
+		{
+			name:            "already_cordoned_node",
+			opts:            Options{DrainTimeout: time.Minute},
+			unschedulable:   true,
+			expectedEvicted: []string{"app"},
+			expectedSleeps:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			stubNow(t, testNow)
+
+			client := fake.NewClientset(
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: corev1.NodeSpec{Unschedulable: tt.unschedulable}},
+				testPod("app", "node-1", nil),
+				testPod("other-node", "node-2", nil),
+				testPod("logs", "node-1", func(pod *corev1.Pod) {
+					pod.OwnerReferences[0].Kind = "DaemonSet"
+				}),
+				testPod("cache", "node-1", func(pod *corev1.Pod) {
+					pod.Spec.Volumes = []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+				}),
+				testPod("kube-proxy", "node-1", func(pod *corev1.Pod) {
+					pod.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+				}),
+				testPod("job", "node-1", func(pod *corev1.Pod) {
+					pod.Status.Phase = corev1.PodSucceeded
+				}),
+			)
+			evicted := stubEvictions(client, tt.blocked)
+
+			var sleeps int
+			stubSleep(t, func(_ context.Context, d time.Duration) error {
+				g.Expect(d).To(Equal(drainPollInterval))
+				sleeps++
+				stubNow(t, testNow.Add(time.Duration(sleeps)*d))
+				return nil
+			})
+
+			opts := tt.opts
+			opts.NodeName = "node-1"
+			opts.RootPath = t.TempDir()
+			g.Expect(os.MkdirAll(filepath.Join(opts.RootPath, "opt/kubeadm"), 0755)).To(Succeed())
+
+			err := drainNode(context.Background(), client, opts)
+			if tt.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(tt.expectedError))
+			}
+			g.Expect(*evicted).To(ConsistOf(tt.expectedEvicted))
+			g.Expect(sleeps).To(Equal(tt.expectedSleeps))
+
+			node, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(node.Spec.Unschedulable).To(BeTrue())
+
+			_, err = os.Stat(filepath.Join(opts.RootPath, CordonMarker))
+			g.Expect(err == nil).To(Equal(tt.expectMarker))
+		})
+	}
+}
+
+// TestUncordonNode tests that uncordonNode waits for a heartbeat of the restarted kubelet
+func TestUncordonNode(t *testing.T) {
+	g := NewWithT(t)
+	restarted := testNow
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec:       corev1.NodeSpec{Unschedulable: true},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastHeartbeatTime: metav1.NewTime(restarted.Add(-time.Minute))},
+			},
+		},
+	}
+	client := fake.NewClientset(node)
+
+	opts := Options{NodeName: "node-1", RootPath: t.TempDir()}
+	marker := filepath.Join(opts.RootPath, CordonMarker)
+	g.Expect(os.MkdirAll(filepath.Dir(marker), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(marker, nil, 0644)).To(Succeed())
+
+	var sleeps int
+	stubSleep(t, func(_ context.Context, d time.Duration) error {
+		g.Expect(d).To(Equal(kubeletPollInterval))
+		sleeps++
+		node.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(restarted.Add(10 * time.Second))
+		_, err := client.CoreV1().Nodes().UpdateStatus(context.Background(), node, metav1.UpdateOptions{})
+		return err
+	})
+
+	g.Expect(uncordonNode(context.Background(), client, opts, restarted)).To(Succeed())
+	g.Expect(sleeps).To(Equal(1))
+
+	result, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Spec.Unschedulable).To(BeFalse())
+
+	_, err = os.Stat(marker)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	// a node cordoned by an administrator is left cordoned
+	_, err = client.CoreV1().Nodes().Patch(context.Background(), "node-1", types.MergePatchType, []byte(`{"spec":{"unschedulable":true}}`), metav1.PatchOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(uncordonNode(context.Background(), client, opts, restarted)).To(Succeed())
+	result, err = client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Spec.Unschedulable).To(BeTrue())
+}
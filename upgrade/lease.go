@@ -0,0 +1,208 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// LeaseName is the coordination.k8s.io Lease that serializes control plane upgrades.
+	LeaseName      = "kubeadm-upgrade"
+	LeaseNamespace = "kube-system"
+
+	// legacyLockName is the ConfigMap lock created by the kube-upgrade.sh script of earlier
+	// releases. It has no expiry, so a lock of another node is only honored until it is
+	// legacyLockMaxAge old.
+	legacyLockName   = "upgrade-lock"
+	legacyLockMaxAge = time.Hour
+)
+
+// ErrLeaseLost is returned when another node took over the upgrade lease.
+var ErrLeaseLost = errors.New("upgrade lease lost")
+
+// Lock is an upgrade lock backed by a Lease. The holder renews the lease while it upgrades,
+// a lease which was not renewed within its duration is expired and can be taken over.
+type Lock struct {
+	Client        kubernetes.Interface
+	Holder        string
+	LeaseDuration time.Duration
+	RetryInterval time.Duration
+}
+
+// Acquire blocks until the lock is held or the context is done.
+func (l *Lock) Acquire(ctx context.Context) error {
+	for {
+		holder, acquired, err := l.TryAcquire(ctx)
+		switch {
+		case err != nil:
+			logrus.Errorf("failed to acquire upgrade lease: %v", err)
+		case acquired:
+			logrus.Infof("acquired upgrade lease %s/%s", LeaseNamespace, LeaseName)
+			return nil
+		default:
+			logrus.Infof("upgrade is in progress on node %s, retrying in %s", holder, l.RetryInterval)
+		}
+
+		if err = sleep(ctx, l.RetryInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// TryAcquire tries to acquire the lock once. When the lock is held by another node its holder
+// is returned.
+func (l *Lock) TryAcquire(ctx context.Context) (string, bool, error) {
+	holder, err := l.checkLegacyLock(ctx)
+	if err != nil || holder != "" {
+		return holder, false, err
+	}
+
+	leases := l.Client.CoordinationV1().Leases(LeaseNamespace)
+	t := metav1.NewMicroTime(now())
+
+	lease, err := leases.Get(ctx, LeaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: LeaseName, Namespace: LeaseNamespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(l.Holder),
+				LeaseDurationSeconds: ptr.To(int32(l.LeaseDuration / time.Second)),
+				AcquireTime:          &t,
+				RenewTime:            &t,
+				LeaseTransitions:     ptr.To(int32(0)),
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return "", false, nil
+		}
+		return "", err == nil, err
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	current := ptr.Deref(lease.Spec.HolderIdentity, "")
+	switch {
+	case current == l.Holder:
+		logrus.Infof("resuming upgrade, node %s already holds the upgrade lease", l.Holder)
+	case current != "" && !expired(lease):
+		return current, false, nil
+	default:
+		if current != "" {
+			logrus.Warnf("taking over the upgrade lease from node %s, it was last renewed at %s", current, lease.Spec.RenewTime.UTC())
+		}
+		lease.Spec.HolderIdentity = ptr.To(l.Holder)
+		lease.Spec.AcquireTime = &t
+		lease.Spec.LeaseTransitions = ptr.To(ptr.Deref(lease.Spec.LeaseTransitions, 0) + 1)
+	}
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(l.LeaseDuration / time.Second))
+	lease.Spec.RenewTime = &t
+
+	// the update fails with a conflict if another node changed the lease since it was read
+	if _, err = leases.Update(ctx, lease, metav1.UpdateOptions{}); apierrors.IsConflict(err) {
+		return "", false, nil
+	}
+	return "", err == nil, err
+}
+
+// Renew extends the lease, it returns ErrLeaseLost if another node holds it.
+func (l *Lock) Renew(ctx context.Context) error {
+	leases := l.Client.CoordinationV1().Leases(LeaseNamespace)
+
+	lease, err := leases.Get(ctx, LeaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return ErrLeaseLost
+	}
+	if err != nil {
+		return err
+	}
+	if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != l.Holder {
+		return fmt.Errorf("%w to node %s", ErrLeaseLost, holder)
+	}
+
+	lease.Spec.RenewTime = ptr.To(metav1.NewMicroTime(now()))
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// KeepAlive renews the lease until the context is done. If the lease is lost, lost is called
+// with the error and renewing stops.
+func (l *Lock) KeepAlive(ctx context.Context, lost func(error)) {
+	interval := l.LeaseDuration / 3
+	for sleep(ctx, interval) == nil {
+		err := l.Renew(ctx)
+		switch {
+		case errors.Is(err, ErrLeaseLost):
+			lost(err)
+			return
+		case err != nil:
+			logrus.Errorf("failed to renew upgrade lease: %v", err)
+		}
+	}
+}
+
+// Release gives up the lease if it is still held.
+func (l *Lock) Release(ctx context.Context) error {
+	leases := l.Client.CoordinationV1().Leases(LeaseNamespace)
+
+	lease, err := leases.Get(ctx, LeaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != l.Holder {
+		return nil
+	}
+
+	err = leases.Delete(ctx, LeaseName, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// checkLegacyLock returns the node holding the legacy ConfigMap lock. A lock of this
+// node is removed, it was left behind by an upgrade which is now resumed.
+func (l *Lock) checkLegacyLock(ctx context.Context) (string, error) {
+	configMaps := l.Client.CoreV1().ConfigMaps(LeaseNamespace)
+
+	cm, err := configMaps.Get(ctx, legacyLockName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	holder := cm.Data["node"]
+	if holder != l.Holder && now().Sub(cm.CreationTimestamp.Time) < legacyLockMaxAge {
+		return holder, nil
+	}
+
+	logrus.Infof("removing %s lock of node %s", legacyLockName, holder)
+	if err = configMaps.Delete(ctx, legacyLockName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	return "", nil
+}
+
+func expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return now().After(lease.Spec.RenewTime.Add(duration))
+}
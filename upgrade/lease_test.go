@@ -0,0 +1,180 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testLease(holder string, renewed time.Time) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: LeaseName, Namespace: LeaseNamespace},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To(holder),
+			LeaseDurationSeconds: ptr.To(int32(60)),
+			RenewTime:            ptr.To(metav1.NewMicroTime(renewed)),
+			LeaseTransitions:     ptr.To(int32(2)),
+		},
+	}
+}
+
+func testLegacyLock(holder string, created time.Time) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: legacyLockName, Namespace: LeaseNamespace, CreationTimestamp: metav1.NewTime(created)},
+		Data:       map[string]string{"node": holder},
+	}
+}
+
+// TestTryAcquire tests the TryAcquire function
+func TestTryAcquire(t *testing.T) {
+	tests := []struct {
+		name                string
+		objects             []runtime.Object
+		expectedAcquired    bool
+		expectedHolder      string
+		expectedTransitions int32
+		expectLegacyLock    bool
+	}{
+		{
+			name:                "no_lease",
+			expectedAcquired:    true,
+			expectedTransitions: 0,
+		},
+		{
+			name:                "held_by_this_node",
+			objects:             []runtime.Object{testLease("cp-1", testNow.Add(-5*time.Minute))},
+			expectedAcquired:    true,
+			expectedTransitions: 2,
+		},
+		{
+			name:           "held_by_another_node",
+			objects:        []runtime.Object{testLease("cp-2", testNow.Add(-30*time.Second))},
+			expectedHolder: "cp-2",
+		},
+		{
+			name:                "expired_lease_is_taken_over",
+			objects:             []runtime.Object{testLease("cp-2", testNow.Add(-2*time.Minute))},
+			expectedAcquired:    true,
+			expectedTransitions: 3,
+		},
+		{
+			name:             "legacy_lock_of_another_node",
+			objects:          []runtime.Object{testLegacyLock("cp-2", testNow.Add(-10*time.Minute))},
+			expectedHolder:   "cp-2",
+			expectLegacyLock: true,
+		},
+		{
+			name:                "stale_legacy_lock_is_removed",
+			objects:             []runtime.Object{testLegacyLock("cp-2", testNow.Add(-2*time.Hour))},
+			expectedAcquired:    true,
+			expectedTransitions: 0,
+		},
+		{
+			name:                "legacy_lock_of_this_node_is_removed",
+			objects:             []runtime.Object{testLegacyLock("cp-1", testNow.Add(-10*time.Minute))},
+			expectedAcquired:    true,
+			expectedTransitions: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			stubNow(t, testNow)
+
+			client := fake.NewClientset(tt.objects...)
+			lock := &Lock{Client: client, Holder: "cp-1", LeaseDuration: time.Minute}
+
+			holder, acquired, err := lock.TryAcquire(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(acquired).To(Equal(tt.expectedAcquired))
+			g.Expect(holder).To(Equal(tt.expectedHolder))
+
+			_, err = client.CoreV1().ConfigMaps(LeaseNamespace).Get(context.Background(), legacyLockName, metav1.GetOptions{})
+			g.Expect(apierrors.IsNotFound(err)).To(Equal(!tt.expectLegacyLock))
+
+			if !tt.expectedAcquired {
+				return
+			}
+
+			lease, err := client.CoordinationV1().Leases(LeaseNamespace).Get(context.Background(), LeaseName, metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(*lease.Spec.HolderIdentity).To(Equal("cp-1"))
+			g.Expect(*lease.Spec.LeaseDurationSeconds).To(Equal(int32(60)))
+			g.Expect(lease.Spec.RenewTime.Time).To(BeTemporally("==", testNow))
+			g.Expect(*lease.Spec.LeaseTransitions).To(Equal(tt.expectedTransitions))
+		})
+	}
+}
+
+// TestRenewAndRelease tests the Renew and Release functions
+func TestRenewAndRelease(t *testing.T) {
+	g := NewWithT(t)
+	stubNow(t, testNow)
+	ctx := context.Background()
+
+	client := fake.NewClientset(testLease("cp-1", testNow.Add(-30*time.Second)))
+	lock := &Lock{Client: client, Holder: "cp-1", LeaseDuration: time.Minute}
+	other := &Lock{Client: client, Holder: "cp-2", LeaseDuration: time.Minute}
+
+	g.Expect(lock.Renew(ctx)).To(Succeed())
+	lease, err := client.CoordinationV1().Leases(LeaseNamespace).Get(ctx, LeaseName, metav1.GetOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(lease.Spec.RenewTime.Time).To(BeTemporally("==", testNow))
+
+	g.Expect(other.Renew(ctx)).To(MatchError(ErrLeaseLost))
+	g.Expect(other.Release(ctx)).To(Succeed())
+	_, err = client.CoordinationV1().Leases(LeaseNamespace).Get(ctx, LeaseName, metav1.GetOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(lock.Release(ctx)).To(Succeed())
+	_, err = client.CoordinationV1().Leases(LeaseNamespace).Get(ctx, LeaseName, metav1.GetOptions{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	g.Expect(lock.Renew(ctx)).To(MatchError(ErrLeaseLost))
+	g.Expect(lock.Release(ctx)).To(Succeed())
+}
+
+// TestAcquireWaitsForHolder tests that Acquire waits until the lease of another node expires
+func TestAcquireWaitsForHolder(t *testing.T) {
+	g := NewWithT(t)
+	stubNow(t, testNow)
+
+	client := fake.NewClientset(testLease("cp-2", testNow))
+	lock := &Lock{Client: client, Holder: "cp-1", LeaseDuration: time.Minute, RetryInterval: 30 * time.Second}
+
+	var waits int
+	stubSleep(t, func(_ context.Context, d time.Duration) error {
+		g.Expect(d).To(Equal(30 * time.Second))
+		waits++
+		stubNow(t, testNow.Add(time.Duration(waits)*d))
+		return nil
+	})
+
+	g.Expect(lock.Acquire(context.Background())).To(Succeed())
+	// cp-2 renewed at testNow, its lease expires after 60s
+	g.Expect(waits).To(Equal(3))
+}
+
+func stubNow(t *testing.T, fixed time.Time) {
+	original := now
+	t.Cleanup(func() { now = original })
+	now = func() time.Time { return fixed }
+}
+
+func stubSleep(t *testing.T, fn func(context.Context, time.Duration) error) {
+	original := sleep
+	t.Cleanup(func() { sleep = original })
+	sleep = fn
+}
@@ -0,0 +1,67 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+)
+
+// ErrUnsupportedUpgrade is returned when an upgrade violates the Kubernetes version skew policy.
+// Retrying does not help, the node needs an image with a supported kubeadm version.
+var ErrUnsupportedUpgrade = errors.New("unsupported upgrade")
+
+// CheckUpgradePath checks that the node upgrades from its deployed version to the target
+// version across at most one minor version and does not downgrade to an older minor version.
+func CheckUpgradePath(deployedVersion, targetVersion string) error {
+	deployed, target, err := parseVersions(deployedVersion, targetVersion)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case deployed.Major() != target.Major():
+		return fmt.Errorf("%w: node version %s and target version %s have a different major version", ErrUnsupportedUpgrade, deployedVersion, targetVersion)
+	case target.Minor() < deployed.Minor():
+		return fmt.Errorf("%w: downgrading the node from %s to %s is not supported", ErrUnsupportedUpgrade, deployedVersion, targetVersion)
+	case target.Minor() > deployed.Minor()+1:
+		return fmt.Errorf("%w: upgrading the node from %s to %s skips minor versions, upgrade to v%d.%d first", ErrUnsupportedUpgrade, deployedVersion, targetVersion, deployed.Major(), deployed.Minor()+1)
+	}
+	return nil
+}
+
+// CheckControlPlaneSkew checks the target version of the node against the version of the API
+// server. Workers must not be newer than the control plane, control plane nodes may be at most
+// one minor version ahead while the control plane is upgraded.
+func CheckControlPlaneSkew(nodeRole, targetVersion, controlPlaneVersion string) error {
+	controlPlane, target, err := parseVersions(controlPlaneVersion, targetVersion)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case controlPlane.Major() != target.Major():
+		return fmt.Errorf("%w: control plane version %s and target version %s have a different major version", ErrUnsupportedUpgrade, controlPlaneVersion, targetVersion)
+	case nodeRole == clusterplugin.RoleWorker && target.Minor() > controlPlane.Minor():
+		return fmt.Errorf("%w: worker version %s would be newer than the control plane version %s, upgrade the control plane first", ErrUnsupportedUpgrade, targetVersion, controlPlaneVersion)
+	case nodeRole != clusterplugin.RoleWorker && target.Minor() < controlPlane.Minor():
+		return fmt.Errorf("%w: control plane node version %s would be older than the control plane version %s", ErrUnsupportedUpgrade, targetVersion, controlPlaneVersion)
+	case nodeRole != clusterplugin.RoleWorker && target.Minor() > controlPlane.Minor()+1:
+		return fmt.Errorf("%w: upgrading the control plane from %s to %s skips minor versions, upgrade to v%d.%d first", ErrUnsupportedUpgrade, controlPlaneVersion, targetVersion, controlPlane.Major(), controlPlane.Minor()+1)
+	}
+	return nil
+}
+
+func parseVersions(currentVersion, targetVersion string) (*version.Version, *version.Version, error) {
+	current, err := version.ParseGeneric(currentVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse version %q: %w", currentVersion, err)
+	}
+	target, err := version.ParseGeneric(targetVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse version %q: %w", targetVersion, err)
+	}
+	return current, target, nil
+}
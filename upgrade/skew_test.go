@@ -0,0 +1,140 @@
+package upgrade
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// TestCheckUpgradePath tests the CheckUpgradePath function
+func TestCheckUpgradePath(t *testing.T) {
+	tests := []struct {
+		name            string
+		deployedVersion string
+		targetVersion   string
+		expectedError   string
+	}{
+		{
+			name:            "patch_upgrade",
+			deployedVersion: "v1.30.4",
+			targetVersion:   "v1.30.6",
+		},
+		{
+			name:            "minor_upgrade",
+			deployedVersion: "v1.30.4",
+			targetVersion:   "v1.31.2",
+		},
+		{
+			name:            "patch_downgrade",
+			deployedVersion: "v1.31.2",
+			targetVersion:   "v1.31.1",
+		},
+		{
+			name:            "skipped_minor_versions",
+			deployedVersion: "v1.29.4",
+			targetVersion:   "v1.32.0",
+			expectedError:   "unsupported upgrade: upgrading the node from v1.29.4 to v1.32.0 skips minor versions, upgrade to v1.30 first",
+		},
+		{
+			name:            "minor_downgrade",
+			deployedVersion: "v1.31.2",
+			targetVersion:   "v1.30.4",
+			expectedError:   "unsupported upgrade: downgrading the node from v1.31.2 to v1.30.4 is not supported",
+		},
+		{
+			name:            "major_upgrade",
+			deployedVersion: "v1.31.2",
+			targetVersion:   "v2.0.0",
+			expectedError:   "unsupported upgrade: node version v1.31.2 and target version v2.0.0 have a different major version",
+		},
+		{
+			name:            "invalid_version",
+			deployedVersion: "latest",
+			targetVersion:   "v1.31.2",
+			expectedError:   `failed to parse version "latest": could not parse "latest" as version`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := CheckUpgradePath(tt.deployedVersion, tt.targetVersion)
+			if tt.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(tt.expectedError))
+		})
+	}
+}
+
+// TestCheckControlPlaneSkew tests the CheckControlPlaneSkew function
+func TestCheckControlPlaneSkew(t *testing.T) {
+	tests := []struct {
+		name                string
+		nodeRole            string
+		targetVersion       string
+		controlPlaneVersion string
+		expectedError       string
+	}{
+		{
+			name:                "worker_on_control_plane_version",
+			nodeRole:            "worker",
+			targetVersion:       "v1.31.2",
+			controlPlaneVersion: "v1.31.2",
+		},
+		{
+			name:                "worker_behind_control_plane",
+			nodeRole:            "worker",
+			targetVersion:       "v1.30.4",
+			controlPlaneVersion: "v1.31.2",
+		},
+		{
+			name:                "worker_newer_patch",
+			nodeRole:            "worker",
+			targetVersion:       "v1.31.3",
+			controlPlaneVersion: "v1.31.2",
+		},
+		{
+			name:                "worker_ahead_of_control_plane",
+			nodeRole:            "worker",
+			targetVersion:       "v1.32.0",
+			controlPlaneVersion: "v1.31.2",
+			expectedError:       "unsupported upgrade: worker version v1.32.0 would be newer than the control plane version v1.31.2, upgrade the control plane first",
+		},
+		{
+			name:                "control_plane_one_minor_ahead",
+			nodeRole:            "init",
+			targetVersion:       "v1.32.0",
+			controlPlaneVersion: "v1.31.2+k3s1",
+		},
+		{
+			name:                "control_plane_skips_minor_versions",
+			nodeRole:            "controlplane",
+			targetVersion:       "v1.32.0",
+			controlPlaneVersion: "v1.30.4",
+			expectedError:       "unsupported upgrade: upgrading the control plane from v1.30.4 to v1.32.0 skips minor versions, upgrade to v1.31 first",
+		},
+		{
+			name:                "control_plane_behind_cluster",
+			nodeRole:            "controlplane",
+			targetVersion:       "v1.30.4",
+			controlPlaneVersion: "v1.31.2",
+			expectedError:       "unsupported upgrade: control plane node version v1.30.4 would be older than the control plane version v1.31.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := CheckControlPlaneSkew(tt.nodeRole, tt.targetVersion, tt.controlPlaneVersion)
+			if tt.expectedError == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(tt.expectedError))
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/etcd"
+	"github.com/kairos-io/kairos/provider-kubeadm/utils"
+)
+
+const (
+	// Command is the provider subcommand that upgrades the node to the installed kubeadm version.
+	Command = "kubeadm-upgrade"
+
+	// VersionSentinel holds the kubeadm version the node was last deployed or upgraded with.
+	VersionSentinel = "opt/sentinel_kubeadmversion"
+
+	// DefaultLeaseDuration outlasts the restart of the API server by `kubeadm upgrade`, during
+	// which the lease cannot be renewed.
+	DefaultLeaseDuration = 5 * time.Minute
+	DefaultRetryInterval = time.Minute
+
+	adminKubeConfig     = "/etc/kubernetes/admin.conf"
+	kubeletKubeConfig   = "/etc/kubernetes/kubelet.conf"
+	kubeletPollInterval = 10 * time.Second
+)
+
+// Options configures a node upgrade.
+type Options struct {
+	NodeRole      string
+	NodeName      string
+	RootPath      string
+	LeaseDuration time.Duration
+	RetryInterval time.Duration
+
+	// Drain cordons and drains a worker before its kubelet is upgraded.
+	Drain                 bool
+	DrainTimeout          time.Duration
+	EvictDaemonSetPods    bool
+	EvictLocalStoragePods bool
+
+	// EtcdSnapshotDir is relative to the root path, a snapshot is taken before `upgrade apply`.
+	EtcdSnapshotDir       string
+	EtcdSnapshotRetention int
+
+	HTTPProxy   string
+	HTTPSProxy  string
+	NoProxy     string
+	ProxyConfig bool
+}
+
+// stubbed in tests
+var (
+	runCommand = func(ctx context.Context, opts Options, name string, args ...string) error {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Env = environment(opts)
+		cmd.Stdout = logrus.StandardLogger().Out
+		cmd.Stderr = cmd.Stdout
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+		}
+		return nil
+	}
+	commandOutput = func(ctx context.Context, opts Options, name string, args ...string) (string, error) {
+		var out bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Env = environment(opts)
+		cmd.Stdout = &out
+		cmd.Stderr = logrus.StandardLogger().Out
+		err := cmd.Run()
+		return strings.TrimSpace(out.String()), err
+	}
+	newClient = func(kubeconfig string) (kubernetes.Interface, error) {
+		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return kubernetes.NewForConfig(config)
+	}
+	findKubeadm  = utils.FindKubeadmBinary
+	snapshotEtcd = etcd.Snapshot
+	now          = time.Now
+	sleep        = func(ctx context.Context, d time.Duration) error {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(d):
+			return nil
+		}
+	}
+)
+
+// Args returns the provider arguments that run the upgrade with the given options.
+func Args(opts Options) []string {
+	args := []string{
+		Command,
+		"--role", opts.NodeRole,
+		"--root-path", opts.RootPath,
+	}
+	if opts.EtcdSnapshotDir != "" {
+		args = append(args, "--etcd-snapshot-dir", opts.EtcdSnapshotDir, "--etcd-snapshot-retention", strconv.Itoa(opts.EtcdSnapshotRetention))
+	}
+	if opts.Drain {
+		args = append(args, "--drain", "--drain-timeout", opts.DrainTimeout.String())
+		if opts.EvictDaemonSetPods {
+			args = append(args, "--evict-daemonset-pods")
+		}
+		if opts.EvictLocalStoragePods {
+			args = append(args, "--evict-local-storage-pods")
+		}
+	}
+	if opts.ProxyConfig {
+		args = append(args, "--http-proxy", opts.HTTPProxy, "--https-proxy", opts.HTTPSProxy, "--no-proxy", opts.NoProxy)
+	}
+	return args
+}
+
+// ParseArgs parses the arguments following the upgrade Command.
+func ParseArgs(args []string) (Options, error) {
+	var opts Options
+
+	fs := flag.NewFlagSet(Command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.NodeRole, "role", "", "node role")
+	fs.StringVar(&opts.NodeName, "node-name", "", "node name, defaults to the content of /etc/hostname")
+	fs.StringVar(&opts.RootPath, "root-path", domain.DefaultRootPath, "cluster root path")
+	fs.DurationVar(&opts.LeaseDuration, "lease-duration", DefaultLeaseDuration, "duration of the upgrade lease")
+	fs.DurationVar(&opts.RetryInterval, "retry-interval", DefaultRetryInterval, "interval between upgrade attempts")
+	fs.StringVar(&opts.EtcdSnapshotDir, "etcd-snapshot-dir", domain.DefaultEtcdSnapshotDir, "etcd snapshot directory relative to the root path")
+	fs.IntVar(&opts.EtcdSnapshotRetention, "etcd-snapshot-retention", domain.DefaultEtcdSnapshotRetention, "number of etcd snapshots to keep")
+	fs.BoolVar(&opts.Drain, "drain", false, "drain the worker before upgrading the kubelet")
+	fs.DurationVar(&opts.DrainTimeout, "drain-timeout", domain.DefaultDrainTimeout, "drain timeout, 0 waits until every pod is evicted")
+	fs.BoolVar(&opts.EvictDaemonSetPods, "evict-daemonset-pods", false, "evict DaemonSet pods when draining")
+	fs.BoolVar(&opts.EvictLocalStoragePods, "evict-local-storage-pods", false, "evict pods using emptyDir volumes when draining")
+	fs.StringVar(&opts.HTTPProxy, "http-proxy", "", "http proxy")
+	fs.StringVar(&opts.HTTPSProxy, "https-proxy", "", "https proxy")
+	fs.StringVar(&opts.NoProxy, "no-proxy", "", "no proxy")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if opts.NodeRole == "" {
+		return opts, errors.New("role is required")
+	}
+	if opts.LeaseDuration < time.Second {
+		return opts, fmt.Errorf("invalid lease duration %s, must be at least 1s", opts.LeaseDuration)
+	}
+	if opts.EtcdSnapshotRetention < 1 {
+		return opts, fmt.Errorf("invalid etcd snapshot retention %d, must be at least 1", opts.EtcdSnapshotRetention)
+	}
+	if opts.DrainTimeout < 0 {
+		return opts, fmt.Errorf("invalid drain timeout %s, must not be negative", opts.DrainTimeout)
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if strings.HasSuffix(f.Name, "proxy") {
+			opts.ProxyConfig = true
+		}
+	})
+	return opts, nil
+}
+
+// Run upgrades the node when the installed kubeadm version differs from the version it was
+// deployed with. Control plane nodes upgrade one at a time while holding the upgrade lease, the
+// first of them runs `kubeadm upgrade apply`, every other node runs `kubeadm upgrade node`.
+// Upgrades which violate the version skew policy are refused with ErrUnsupportedUpgrade. A
+// worker is drained before its kubelet is upgraded when Drain is set.
+func Run(ctx context.Context, opts Options) error {
+	sentinel := filepath.Join(opts.RootPath, VersionSentinel)
+
+	content, err := os.ReadFile(sentinel)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	oldVersion := strings.TrimSpace(string(content))
+
+	kubeadm, err := findKubeadm(opts.RootPath)
+	if err != nil {
+		return err
+	}
+
+	currentVersion, err := commandOutput(ctx, opts, kubeadm, "version", "-o", "short")
+	if err != nil {
+		return fmt.Errorf("failed to get kubeadm version: %w", err)
+	}
+
+	if currentVersion == oldVersion {
+		logrus.Infof("node is on the latest version %s", currentVersion)
+		return nil
+	}
+	logrus.Infof("upgrading %s node from %s to %s", opts.NodeRole, oldVersion, currentVersion)
+
+	if oldVersion != "" {
+		if err = CheckUpgradePath(oldVersion, currentVersion); err != nil {
+			return err
+		}
+	}
+
+	if opts.NodeName == "" {
+		if opts.NodeName, err = nodeName(); err != nil {
+			return err
+		}
+	}
+
+	client, err := startKubelet(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	serverVersion, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get the control plane version: %w", err)
+	}
+	if err = CheckControlPlaneSkew(opts.NodeRole, currentVersion, serverVersion.GitVersion); err != nil {
+		return err
+	}
+
+	if opts.NodeRole != clusterplugin.RoleWorker {
+		lock := &Lock{
+			Client:        client,
+			Holder:        opts.NodeName,
+			LeaseDuration: opts.LeaseDuration,
+			RetryInterval: opts.RetryInterval,
+		}
+		if err = lock.Acquire(ctx); err != nil {
+			return err
+		}
+
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		go lock.KeepAlive(ctx, cancel)
+
+		// the lease is held until the kubelet is upgraded as well
+		defer func() {
+			cancel(nil)
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer releaseCancel()
+			if err := lock.Release(releaseCtx); err != nil {
+				logrus.Errorf("failed to release upgrade lease, it expires in %s: %v", opts.LeaseDuration, err)
+			}
+		}()
+	}
+
+	// a snapshot is taken once, a retried upgrade apply must not rotate out the snapshot of the
+	// state before the upgrade
+	snapshotTaken := false
+	snapshot := func() error {
+		if snapshotTaken {
+			return nil
+		}
+		_, err := snapshotEtcd(ctx, etcd.SnapshotOptions{
+			RootPath:  opts.RootPath,
+			Dir:       opts.EtcdSnapshotDir,
+			Retention: opts.EtcdSnapshotRetention,
+			Reason:    "upgrade",
+		})
+		if errors.Is(err, etcd.ErrNoLocalEtcd) {
+			logrus.Info("skipping etcd snapshot, the node does not run a local etcd member")
+			err = nil
+		}
+		snapshotTaken = err == nil
+		return err
+	}
+
+	for oldVersion != currentVersion {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		args, apply, err := upgradeArgs(ctx, client, opts, kubeadm, oldVersion, currentVersion, snapshot)
+		if err != nil {
+			logrus.Errorf("%v, retrying in %s", err, opts.RetryInterval)
+			if err = sleep(ctx, opts.RetryInterval); err != nil {
+				return err
+			}
+			continue
+		}
+
+		logrus.Infof("upgrading node from %s to %s using kubeadm %s", oldVersion, currentVersion, strings.Join(args, " "))
+		if err = runCommand(ctx, opts, kubeadm, args...); err != nil {
+			logrus.Errorf("upgrade failed: %v", err)
+			if apply {
+				revertKubeadmConfig(ctx, opts, kubeadm)
+			}
+			logrus.Infof("retrying in %s", opts.RetryInterval)
+			if err = sleep(ctx, opts.RetryInterval); err != nil {
+				return err
+			}
+			continue
+		}
+
+		oldVersion = currentVersion
+		logrus.Info("upgrade success")
+	}
+
+	if opts.NodeRole == clusterplugin.RoleWorker && opts.Drain {
+		if err = drainNode(ctx, client, opts); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	restarted := now()
+	// the kubelet upgrade is not interrupted halfway
+	if err = upgradeKubelet(context.WithoutCancel(ctx), opts); err != nil {
+		return err
+	}
+
+	if opts.NodeRole == clusterplugin.RoleWorker {
+		if err = uncordonNode(ctx, client, opts, restarted); err != nil {
+			return err
+		}
+	}
+
+	// the version is recorded last, so that an interrupted upgrade is resumed on the next boot
+	if err = os.WriteFile(sentinel, []byte(currentVersion+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record upgraded version: %w", err)
+	}
+	return nil
+}
+
+// upgradeArgs returns the kubeadm upgrade arguments. A control plane node runs `upgrade apply`
+// unless the kubeadm-config ConfigMap already has the target version, which happens when another
+// node applied the upgrade. A stale ConfigMap of a failed upgrade is applied again. The etcd
+// snapshot is taken before the new cluster configuration is uploaded.
+func upgradeArgs(ctx context.Context, client kubernetes.Interface, opts Options, kubeadm, oldVersion, currentVersion string, snapshot func() error) ([]string, bool, error) {
+	if opts.NodeRole == clusterplugin.RoleWorker {
+		return []string{"upgrade", "node"}, false, nil
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(ctx, "kubeadm-config", metav1.GetOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get kubeadm-config: %w", err)
+	}
+
+	var clusterConfig struct {
+		KubernetesVersion string `json:"kubernetesVersion"`
+	}
+	if err = yaml.Unmarshal([]byte(cm.Data["ClusterConfiguration"]), &clusterConfig); err != nil || clusterConfig.KubernetesVersion == "" {
+		return nil, false, errors.New("kubeadm-config has no kubernetes version")
+	}
+
+	if clusterConfig.KubernetesVersion == currentVersion {
+		return []string{"upgrade", "node"}, false, nil
+	}
+	if clusterConfig.KubernetesVersion != oldVersion {
+		logrus.Warnf("kubeadm-config kubernetesVersion %s does not match the expected %s, it is stale from a previous incomplete upgrade", clusterConfig.KubernetesVersion, oldVersion)
+	}
+
+	if err = snapshot(); err != nil {
+		return nil, false, fmt.Errorf("failed to take etcd snapshot: %w", err)
+	}
+
+	// keep the current cluster configuration to revert to if the upgrade fails
+	existing := filepath.Join(opts.RootPath, "opt/kubeadm/existing-cluster-config.yaml")
+	if err = os.WriteFile(existing, []byte(cm.Data["ClusterConfiguration"]), 0600); err != nil {
+		return nil, false, fmt.Errorf("failed to save the cluster configuration: %w", err)
+	}
+	if err = runCommand(ctx, opts, kubeadm, "init", "phase", "upload-config", "kubeadm", "--config", filepath.Join(opts.RootPath, "opt/kubeadm/cluster-config.yaml")); err != nil {
+		return nil, false, fmt.Errorf("failed to upload the new cluster configuration: %w", err)
+	}
+
+	return []string{"upgrade", "apply", "-y", currentVersion}, true, nil
+}
+
+func revertKubeadmConfig(ctx context.Context, opts Options, kubeadm string) {
+	logrus.Info("reverting kubeadm config")
+	if err := runCommand(ctx, opts, kubeadm, "init", "phase", "upload-config", "kubeadm", "--config", filepath.Join(opts.RootPath, "opt/kubeadm/existing-cluster-config.yaml")); err != nil {
+		logrus.Errorf("failed to revert kubeadm config: %v", err)
+	}
+}
+
+// startKubelet starts the kubelet and waits until the API server can be reached. Workers have
+// no admin.conf and check their own Node with the kubelet credentials.
+func startKubelet(ctx context.Context, opts Options) (kubernetes.Interface, error) {
+	if runCommand(ctx, opts, "systemctl", "is-enabled", "--quiet", "kubelet") != nil {
+		if err := runCommand(ctx, opts, "systemctl", "enable", "kubelet"); err != nil {
+			logrus.Errorf("failed to enable kubelet: %v", err)
+		}
+	}
+	if runCommand(ctx, opts, "systemctl", "is-active", "--quiet", "kubelet") != nil {
+		if err := runCommand(ctx, opts, "systemctl", "start", "kubelet"); err != nil {
+			logrus.Errorf("failed to start kubelet: %v", err)
+		}
+	}
+
+	kubeconfig := adminKubeConfig
+	if opts.NodeRole == clusterplugin.RoleWorker {
+		kubeconfig = kubeletKubeConfig
+	}
+
+	logrus.Info("waiting for kubelet to be ready")
+	for {
+		client, err := newClient(kubeconfig)
+		if err == nil {
+			if opts.NodeRole == clusterplugin.RoleWorker {
+				_, err = client.CoreV1().Nodes().Get(ctx, opts.NodeName, metav1.GetOptions{})
+			} else {
+				_, err = client.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 1})
+			}
+		}
+		if err == nil && runCommand(ctx, opts, "systemctl", "is-active", "--quiet", "kubelet") == nil {
+			logrus.Info("kubelet is ready")
+			return client, nil
+		}
+
+		logrus.Infof("kubelet or API server not ready yet, retrying in %s", kubeletPollInterval)
+		if err = sleep(ctx, kubeletPollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func upgradeKubelet(ctx context.Context, opts Options) error {
+	logrus.Info("upgrading kubelet")
+
+	var errs []error
+	errs = append(errs,
+		runCommand(ctx, opts, "systemctl", "stop", "kubelet"),
+		runCommand(ctx, opts, "cp", filepath.Join(opts.RootPath, "opt/kubeadm/bin/kubelet"), filepath.Join(opts.RootPath, "usr/local/bin/kubelet")),
+		runCommand(ctx, opts, "systemctl", "daemon-reload"),
+		runCommand(ctx, opts, "systemctl", "restart", "kubelet"),
+	)
+	for _, unit := range []string{"spectro-containerd", "containerd"} {
+		if runCommand(ctx, opts, "systemctl", "cat", unit) == nil {
+			errs = append(errs, runCommand(ctx, opts, "systemctl", "restart", unit))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to upgrade kubelet: %w", err)
+	}
+	logrus.Info("kubelet upgraded")
+	return nil
+}
+
+func nodeName() (string, error) {
+	content, err := os.ReadFile("/etc/hostname")
+	if err == nil && strings.TrimSpace(string(content)) != "" {
+		return strings.TrimSpace(string(content)), nil
+	}
+	return os.Hostname()
+}
+
+func environment(opts Options) []string {
+	if !opts.ProxyConfig {
+		return utils.GetCommandEnv(opts.RootPath, nil)
+	}
+	return utils.GetCommandEnv(opts.RootPath, map[string]string{
+		"HTTP_PROXY":  opts.HTTPProxy,
+		"HTTPS_PROXY": opts.HTTPSProxy,
+		"NO_PROXY":    opts.NoProxy,
+	})
+}
@@ -0,0 +1,387 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+	"github.com/kairos-io/kairos/provider-kubeadm/etcd"
+)
+
+// TestArgs tests that ParseArgs parses the arguments built by Args
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "without_proxy",
+			opts: Options{NodeRole: "init", RootPath: "/persistent/spectro"},
+		},
+		{
+			name: "with_drain",
+			opts: Options{
+				NodeRole:              "worker",
+				RootPath:              "/",
+				Drain:                 true,
+				DrainTimeout:          10 * time.Minute,
+				EvictDaemonSetPods:    true,
+				EvictLocalStoragePods: true,
+			},
+		},
+		{
+			name: "with_etcd_snapshot",
+			opts: Options{
+				NodeRole:              "init",
+				RootPath:              "/",
+				EtcdSnapshotDir:       "var/lib/etcd-snapshots",
+				EtcdSnapshotRetention: 3,
+			},
+		},
+		{
+			name: "with_proxy",
+			opts: Options{
+				NodeRole:    "worker",
+				RootPath:    "/",
+				ProxyConfig: true,
+				HTTPSProxy:  "http://proxy.example.com:8080",
+				NoProxy:     "10.0.0.0/8,.svc",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			args := Args(tt.opts)
+			g.Expect(args[0]).To(Equal(Command))
+
+			expected := tt.opts
+			expected.LeaseDuration = DefaultLeaseDuration
+			expected.RetryInterval = DefaultRetryInterval
+			if !expected.Drain {
+				expected.DrainTimeout = domain.DefaultDrainTimeout
+			}
+			if expected.EtcdSnapshotDir == "" {
+				expected.EtcdSnapshotDir = domain.DefaultEtcdSnapshotDir
+				expected.EtcdSnapshotRetention = domain.DefaultEtcdSnapshotRetention
+			}
+
+			result, err := ParseArgs(args[1:])
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(expected))
+		})
+	}
+}
+
+// TestRun tests the Run function
+func TestRun(t *testing.T) {
+	kubeadmConfig := func(version string) runtime.Object {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "kubeadm-config", Namespace: "kube-system"},
+			Data:       map[string]string{"ClusterConfiguration": "apiVersion: kubeadm.k8s.io/v1beta4\nkind: ClusterConfiguration\nkubernetesVersion: " + version + "\n"},
+		}
+	}
+
+	tests := []struct {
+		name              string
+		nodeRole          string
+		deployedVersion   string
+		serverVersion     string
+		objects           []runtime.Object
+		failures          map[string]int
+		expectedCommands  []string
+		expectedSnapshots int
+		expectedSleeps    []time.Duration
+	}{
+		{
+			name:            "up_to_date",
+			nodeRole:        "init",
+			deployedVersion: "v1.31.2",
+		},
+		{
+			name:            "worker",
+			nodeRole:        "worker",
+			deployedVersion: "v1.30.4",
+			serverVersion:   "v1.31.2",
+			objects:         []runtime.Object{&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}},
+			expectedCommands: []string{
+				"kubeadm upgrade node",
+			},
+		},
+		{
+			name:            "first_control_plane_applies",
+			nodeRole:        "init",
+			deployedVersion: "v1.30.4",
+			serverVersion:   "v1.30.4",
+			objects:         []runtime.Object{kubeadmConfig("v1.30.4")},
+			expectedCommands: []string{
+				"kubeadm init phase upload-config kubeadm --config ROOT/opt/kubeadm/cluster-config.yaml",
+				"kubeadm upgrade apply -y v1.31.2",
+			},
+			expectedSnapshots: 1,
+		},
+		{
+			name:            "next_control_plane_upgrades_node",
+			nodeRole:        "controlplane",
+			deployedVersion: "v1.30.4",
+			serverVersion:   "v1.31.2",
+			objects:         []runtime.Object{kubeadmConfig("v1.31.2")},
+			expectedCommands: []string{
+				"kubeadm upgrade node",
+			},
+		},
+		{
+			name:            "failed_apply_is_reverted_and_retried",
+			nodeRole:        "init",
+			deployedVersion: "v1.30.4",
+			serverVersion:   "v1.30.4",
+			objects:         []runtime.Object{kubeadmConfig("v1.30.4")},
+			failures:        map[string]int{"kubeadm upgrade apply -y v1.31.2": 1},
+			expectedCommands: []string{
+				"kubeadm init phase upload-config kubeadm --config ROOT/opt/kubeadm/cluster-config.yaml",
+				"kubeadm upgrade apply -y v1.31.2",
+				"kubeadm init phase upload-config kubeadm --config ROOT/opt/kubeadm/existing-cluster-config.yaml",
+				"kubeadm init phase upload-config kubeadm --config ROOT/opt/kubeadm/cluster-config.yaml",
+				"kubeadm upgrade apply -y v1.31.2",
+			},
+			expectedSnapshots: 1,
+			expectedSleeps:    []time.Duration{time.Minute},
+		},
+		{
+			name:            "failed_snapshot_is_retried",
+			nodeRole:        "init",
+			deployedVersion: "v1.30.4",
+			serverVersion:   "v1.30.4",
+			objects:         []runtime.Object{kubeadmConfig("v1.30.4")},
+			failures:        map[string]int{"etcd-snapshot upgrade": 1},
+			expectedCommands: []string{
+				"kubeadm init phase upload-config kubeadm --config ROOT/opt/kubeadm/cluster-config.yaml",
+				"kubeadm upgrade apply -y v1.31.2",
+			},
+			expectedSnapshots: 2,
+			expectedSleeps:    []time.Duration{time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			stubNow(t, testNow)
+
+			rootPath := t.TempDir()
+			g.Expect(os.MkdirAll(filepath.Join(rootPath, "opt/kubeadm"), 0755)).To(Succeed())
+			g.Expect(os.WriteFile(filepath.Join(rootPath, VersionSentinel), []byte(tt.deployedVersion+"\n"), 0644)).To(Succeed())
+
+			client := fake.NewClientset(tt.objects...)
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: tt.serverVersion}
+			commands := stubCommands(t, client, tt.failures)
+
+			var sleeps []time.Duration
+			stubSleep(t, func(ctx context.Context, d time.Duration) error {
+				// the lease is renewed every LeaseDuration/3 until the upgrade is done
+				if d == 20*time.Second {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				sleeps = append(sleeps, d)
+				return nil
+			})
+
+			err := Run(context.Background(), Options{
+				NodeRole:      tt.nodeRole,
+				NodeName:      "node-1",
+				RootPath:      rootPath,
+				LeaseDuration: DefaultLeaseDuration,
+				RetryInterval: DefaultRetryInterval,
+			})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(sleeps).To(Equal(tt.expectedSleeps))
+
+			var kubeadmCommands []string
+			for _, command := range *commands {
+				if strings.HasPrefix(command, "kubeadm ") {
+					kubeadmCommands = append(kubeadmCommands, strings.ReplaceAll(command, rootPath, "ROOT"))
+				}
+			}
+			g.Expect(kubeadmCommands).To(Equal(tt.expectedCommands))
+			var snapshots int
+			for _, command := range *commands {
+				if command == "etcd-snapshot upgrade" {
+					snapshots++
+				}
+			}
+			g.Expect(snapshots).To(Equal(tt.expectedSnapshots))
+
+			content, err := os.ReadFile(filepath.Join(rootPath, VersionSentinel))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(content)).To(HavePrefix("v1.31.2"))
+
+			if len(tt.expectedCommands) > 0 {
+				g.Expect(*commands).To(ContainElement("systemctl restart kubelet"))
+			}
+
+			// the lease is released once the node is upgraded
+			_, err = client.CoordinationV1().Leases(LeaseNamespace).Get(context.Background(), LeaseName, metav1.GetOptions{})
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	}
+}
+
+// TestRunWaitsForLease tests that a control plane node does not upgrade while another node holds the lease
+func TestRunWaitsForLease(t *testing.T) {
+	g := NewWithT(t)
+	stubNow(t, testNow)
+
+	rootPath := t.TempDir()
+	g.Expect(os.MkdirAll(filepath.Join(rootPath, "opt/kubeadm"), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(rootPath, VersionSentinel), []byte("v1.30.4\n"), 0644)).To(Succeed())
+
+	client := fake.NewClientset(testLease("cp-2", testNow))
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.4"}
+	commands := stubCommands(t, client, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stubSleep(t, func(context.Context, time.Duration) error {
+		cancel()
+		return context.Canceled
+	})
+
+	err := Run(ctx, Options{
+		NodeRole:      "controlplane",
+		NodeName:      "cp-1",
+		RootPath:      rootPath,
+		LeaseDuration: DefaultLeaseDuration,
+		RetryInterval: DefaultRetryInterval,
+	})
+	g.Expect(err).To(MatchError(context.Canceled))
+	g.Expect(*commands).ToNot(ContainElement(HavePrefix("kubeadm upgrade")))
+
+	lease, err := client.CoordinationV1().Leases(LeaseNamespace).Get(context.Background(), LeaseName, metav1.GetOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(*lease.Spec.HolderIdentity).To(Equal("cp-2"))
+}
+
+// TestRunCommandStopsWithContext tests that a command is killed once the lease is lost
+func TestRunCommandStopsWithContext(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(100*time.Millisecond, func() { cancel(ErrLeaseLost) })
+
+	started := time.Now()
+	g.Expect(runCommand(ctx, Options{}, "sleep", "10")).ToNot(Succeed())
+	g.Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+}
+
+// TestRunRefusesUnsupportedUpgrade tests that Run does not upgrade across the version skew policy
+func TestRunRefusesUnsupportedUpgrade(t *testing.T) {
+	tests := []struct {
+		name            string
+		nodeRole        string
+		deployedVersion string
+		serverVersion   string
+		expectedError   string
+	}{
+		{
+			name:            "skipped_minor_version",
+			nodeRole:        "init",
+			deployedVersion: "v1.29.4",
+			serverVersion:   "v1.29.4",
+			expectedError:   "unsupported upgrade: upgrading the node from v1.29.4 to v1.31.2 skips minor versions, upgrade to v1.30 first",
+		},
+		{
+			name:            "worker_ahead_of_control_plane",
+			nodeRole:        "worker",
+			deployedVersion: "v1.30.4",
+			serverVersion:   "v1.30.4",
+			expectedError:   "unsupported upgrade: worker version v1.31.2 would be newer than the control plane version v1.30.4, upgrade the control plane first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rootPath := t.TempDir()
+			g.Expect(os.MkdirAll(filepath.Join(rootPath, "opt/kubeadm"), 0755)).To(Succeed())
+			g.Expect(os.WriteFile(filepath.Join(rootPath, VersionSentinel), []byte(tt.deployedVersion+"\n"), 0644)).To(Succeed())
+
+			client := fake.NewClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: tt.serverVersion}
+			commands := stubCommands(t, client, nil)
+			stubSleep(t, func(context.Context, time.Duration) error {
+				t.Fatal("unsupported upgrades must not be retried")
+				return nil
+			})
+
+			err := Run(context.Background(), Options{
+				NodeRole:      tt.nodeRole,
+				NodeName:      "node-1",
+				RootPath:      rootPath,
+				LeaseDuration: DefaultLeaseDuration,
+				RetryInterval: DefaultRetryInterval,
+			})
+			g.Expect(err).To(MatchError(ErrUnsupportedUpgrade))
+			g.Expect(err.Error()).To(Equal(tt.expectedError))
+			g.Expect(*commands).ToNot(ContainElement(HavePrefix("kubeadm")))
+
+			content, err := os.ReadFile(filepath.Join(rootPath, VersionSentinel))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(content)).To(Equal(tt.deployedVersion + "\n"))
+		})
+	}
+}
+
+func stubCommands(t *testing.T, client kubernetes.Interface, failures map[string]int) *[]string {
+	originalRunCommand, originalCommandOutput, originalNewClient, originalFindKubeadm, originalSnapshotEtcd := runCommand, commandOutput, newClient, findKubeadm, snapshotEtcd
+	t.Cleanup(func() {
+		runCommand, commandOutput, newClient, findKubeadm, snapshotEtcd = originalRunCommand, originalCommandOutput, originalNewClient, originalFindKubeadm, originalSnapshotEtcd
+	})
+
+	var commands []string
+	runCommand = func(_ context.Context, _ Options, name string, args ...string) error {
+		command := strings.Join(append([]string{name}, args...), " ")
+		commands = append(commands, command)
+		if failures[command] > 0 {
+			failures[command]--
+			return errors.New("exit status 1")
+		}
+		return nil
+	}
+	commandOutput = func(context.Context, Options, string, ...string) (string, error) {
+		return "v1.31.2", nil
+	}
+	newClient = func(string) (kubernetes.Interface, error) {
+		return client, nil
+	}
+	findKubeadm = func(string) (string, error) {
+		return "kubeadm", nil
+	}
+	snapshotEtcd = func(_ context.Context, opts etcd.SnapshotOptions) (string, error) {
+		command := "etcd-snapshot " + opts.Reason
+		commands = append(commands, command)
+		if failures[command] > 0 {
+			failures[command]--
+			return "", errors.New("etcd container was not running after 5m0s")
+		}
+		return filepath.Join(opts.RootPath, opts.Dir, "etcd-snapshot.db"), nil
+	}
+	return &commands
+}
@@ -5,8 +5,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
 )
 
+const minBootstrapTokenTTL = time.Hour
+
 func GetCertificateKey(token string) string {
 	hasher := sha256.New()
 	hasher.Write([]byte(token))
@@ -26,3 +31,77 @@ func GetCertSansRevision(certsan []string) string {
 	h.Write(v)
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
+
+// GetBootstrapTokenTTL returns the bootstrap token rotation period from the provider options.
+// Zero means a single bootstrap token that never expires.
+func GetBootstrapTokenTTL(options map[string]string) (time.Duration, error) {
+	value := options[domain.BootstrapTokenTTLOption]
+	if value == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", domain.BootstrapTokenTTLOption, value, err)
+	}
+	if ttl != 0 && ttl < minBootstrapTokenTTL {
+		return 0, fmt.Errorf("invalid %s %q: must be 0 or at least %s", domain.BootstrapTokenTTLOption, value, minBootstrapTokenTTL)
+	}
+	return ttl.Truncate(time.Second), nil
+}
+
+// GetBootstrapToken returns the bootstrap token for the rotation period containing now, and how
+// long it stays valid. A token is valid for its own period and the next one, which is the grace
+// window for nodes that generated their join config just before a rotation.
+func GetBootstrapToken(clusterToken string, ttl time.Duration, now time.Time) (string, time.Duration) {
+	if ttl == 0 {
+		return clusterToken, 0
+	}
+	return rotatedBootstrapToken(clusterToken, ttl, now, 0)
+}
+
+// GetNextBootstrapToken returns the bootstrap token of the rotation period after the one
+// containing now, and how long it stays valid. Control plane nodes create it ahead of the
+// rotation, so that nodes joining at the start of the next period find it. It is empty if the
+// bootstrap token is not rotated.
+func GetNextBootstrapToken(clusterToken string, ttl time.Duration, now time.Time) (string, time.Duration) {
+	if ttl == 0 {
+		return "", 0
+	}
+	return rotatedBootstrapToken(clusterToken, ttl, now, 1)
+}
+
+func rotatedBootstrapToken(clusterToken string, ttl time.Duration, now time.Time, offset int64) (string, time.Duration) {
+	epoch := GetRotationEpoch(ttl, now) + offset
+	expires := time.Unix((epoch+2)*int64(ttl/time.Second), 0)
+	return TransformToken(fmt.Sprintf("%s-%d", clusterToken, epoch)), expires.Sub(now).Truncate(time.Second)
+}
+
+// GetRotatedCertificateKey returns the key the kubeadm-certs secret is encrypted with in the
+// rotation period containing now. Without rotation it is derived from the cluster token alone. The
+// rotated key is not derived from the same input as the bootstrap token, which is public.
+func GetRotatedCertificateKey(clusterToken string, ttl time.Duration, now time.Time) string {
+	if ttl == 0 {
+		return GetCertificateKey(clusterToken)
+	}
+	return GetCertificateKey(fmt.Sprintf("%s-certificate-key-%d", clusterToken, GetRotationEpoch(ttl, now)))
+}
+
+// GetJoinCertificateKeys returns the certificate keys of the rotation period containing now and of
+// the next one. A control plane node joining in the grace window of its bootstrap token finds the
+// kubeadm-certs secret encrypted with either of them. It is empty if the bootstrap token is not
+// rotated.
+func GetJoinCertificateKeys(clusterToken string, ttl time.Duration, now time.Time) []string {
+	if ttl == 0 {
+		return nil
+	}
+	return []string{
+		GetRotatedCertificateKey(clusterToken, ttl, now),
+		GetRotatedCertificateKey(clusterToken, ttl, now.Add(ttl)),
+	}
+}
+
+// GetRotationEpoch returns the number of the bootstrap token rotation period containing now.
+func GetRotationEpoch(ttl time.Duration, now time.Time) int64 {
+	return now.Unix() / int64(ttl/time.Second)
+}
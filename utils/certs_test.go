@@ -2,6 +2,7 @@ package utils
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 )
@@ -126,3 +127,135 @@ func TestGetCertSansRevision(t *testing.T) {
 		})
 	}
 }
+
+// TestGetBootstrapTokenTTL tests the GetBootstrapTokenTTL function
+func TestGetBootstrapTokenTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{
+			name:     "not_set",
+			options:  map[string]string{},
+			expected: 0,
+		},
+		{
+			name:     "never_expires",
+			options:  map[string]string{"bootstrap_token_ttl": "0"},
+			expected: 0,
+		},
+		{
+			name:     "finite",
+			options:  map[string]string{"bootstrap_token_ttl": "24h"},
+			expected: 24 * time.Hour,
+		},
+		{
+			name:      "too_short",
+			options:   map[string]string{"bootstrap_token_ttl": "10m"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid",
+			options:   map[string]string{"bootstrap_token_ttl": "one day"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetBootstrapTokenTTL(tt.options)
+
+			if tt.expectErr {
+				g.Expect(err).To(MatchError(ContainSubstring("invalid bootstrap_token_ttl")))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestGetBootstrapToken tests the GetBootstrapToken function
+func TestGetBootstrapToken(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterToken := "abcdef.1234567890123456"
+	ttl := 24 * time.Hour
+	periodStart := time.Unix(20000*int64(ttl/time.Second), 0)
+
+	// a token that never expires is the cluster token itself
+	token, validity := GetBootstrapToken(clusterToken, 0, periodStart)
+	g.Expect(token).To(Equal(clusterToken))
+	g.Expect(validity).To(BeZero())
+
+	token, validity = GetBootstrapToken(clusterToken, ttl, periodStart)
+	g.Expect(token).To(MatchRegexp(`^[a-f0-9]{6}\.[a-f0-9]{16}$`))
+	g.Expect(token).To(Equal(TransformToken(clusterToken + "-20000")))
+	g.Expect(validity).To(Equal(2 * ttl))
+
+	// the same token is used for the whole period and stays valid through the next one
+	sameToken, validity := GetBootstrapToken(clusterToken, ttl, periodStart.Add(ttl-time.Second))
+	g.Expect(sameToken).To(Equal(token))
+	g.Expect(validity).To(Equal(ttl + time.Second))
+
+	nextToken, _ := GetBootstrapToken(clusterToken, ttl, periodStart.Add(ttl))
+	g.Expect(nextToken).ToNot(Equal(token))
+}
+
+// TestGetNextBootstrapToken tests the GetNextBootstrapToken function
+func TestGetNextBootstrapToken(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterToken := "abcdef.1234567890123456"
+	ttl := 24 * time.Hour
+	periodStart := time.Unix(20000*int64(ttl/time.Second), 0)
+	boundary := periodStart.Add(ttl)
+
+	token, validity := GetNextBootstrapToken(clusterToken, 0, periodStart)
+	g.Expect(token).To(BeEmpty())
+	g.Expect(validity).To(BeZero())
+
+	// the token a node joins with right after the rotation already exists before it
+	nextToken, validity := GetNextBootstrapToken(clusterToken, ttl, boundary.Add(-time.Second))
+	joinToken, _ := GetBootstrapToken(clusterToken, ttl, boundary)
+	g.Expect(nextToken).To(Equal(joinToken))
+	g.Expect(validity).To(Equal(2*ttl + time.Second))
+
+	// the token of the previous period is still valid right after the rotation
+	previousToken, validity := GetBootstrapToken(clusterToken, ttl, boundary.Add(-time.Second))
+	g.Expect(previousToken).ToNot(Equal(joinToken))
+	g.Expect(boundary.Add(-time.Second).Add(validity).After(boundary)).To(BeTrue())
+}
+
+// TestGetRotatedCertificateKey tests the GetRotatedCertificateKey and GetJoinCertificateKeys functions
+func TestGetRotatedCertificateKey(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterToken := "abcdef.1234567890123456"
+	ttl := 24 * time.Hour
+	periodStart := time.Unix(20000*int64(ttl/time.Second), 0)
+	boundary := periodStart.Add(ttl)
+
+	// without rotation the key is derived from the cluster token alone
+	g.Expect(GetRotatedCertificateKey(clusterToken, 0, periodStart)).To(Equal(GetCertificateKey(clusterToken)))
+	g.Expect(GetJoinCertificateKeys(clusterToken, 0, periodStart)).To(BeEmpty())
+
+	key := GetRotatedCertificateKey(clusterToken, ttl, periodStart)
+	g.Expect(key).To(MatchRegexp(`^[a-f0-9]{64}$`))
+	g.Expect(key).ToNot(Equal(GetCertificateKey(clusterToken)))
+	g.Expect(GetRotatedCertificateKey(clusterToken, ttl, boundary.Add(-time.Second))).To(Equal(key))
+
+	// the bootstrap token does not reveal any part of the key
+	token, _ := GetBootstrapToken(clusterToken, ttl, periodStart)
+	g.Expect(key).ToNot(ContainSubstring(token[7:]))
+
+	// a node joining in the grace window of its token accepts the key of the current and the previous period
+	nextKey := GetRotatedCertificateKey(clusterToken, ttl, boundary)
+	g.Expect(nextKey).ToNot(Equal(key))
+	g.Expect(GetJoinCertificateKeys(clusterToken, ttl, boundary.Add(-time.Second))).To(Equal([]string{key, nextKey}))
+}
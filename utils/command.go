@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SpectroContainerdSocket is the socket of the spectro-containerd service. When it exists, the
+// container runtime tools are pointed at it instead of the default containerd socket.
+const SpectroContainerdSocket = "/run/spectro/containerd/containerd.sock"
+
+// OptBinDir holds the container runtime tools on images that do not ship them in /usr/bin.
+const OptBinDir = "/opt/bin"
+
+// FindBinary returns the binary under the cluster root path or in /opt/bin, falling back to PATH.
+// The systemd services and subcommands of the provider do not have these directories on PATH.
+func FindBinary(rootPath, name string) (string, error) {
+	for _, path := range []string{
+		filepath.Join(rootPath, "usr/bin", name),
+		filepath.Join(rootPath, "usr/local/bin", name),
+		filepath.Join(OptBinDir, name),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s binary not found", name)
+	}
+	return path, nil
+}
+
+// RunCommand runs the command, its combined output is part of the returned error.
+func RunCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CommandOutput returns the trimmed standard output of the command, its standard error is part
+// of the returned error.
+func CommandOutput(name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// SpectroContainerd reports whether the spectro-containerd socket exists.
+func SpectroContainerd() bool {
+	_, err := os.Stat(SpectroContainerdSocket)
+	return err == nil
+}
+
+// CrictlArgs returns the crictl arguments, with the runtime endpoint of spectro-containerd if its
+// socket exists.
+func CrictlArgs(args ...string) []string {
+	if SpectroContainerd() {
+		return append([]string{"--runtime-endpoint", "unix://" + SpectroContainerdSocket}, args...)
+	}
+	return args
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// TestFindBinary tests that a binary under the cluster root path is preferred over PATH
+func TestFindBinary(t *testing.T) {
+	g := NewWithT(t)
+	rootPath := t.TempDir()
+
+	_, err := FindBinary(rootPath, "crictl-missing")
+	g.Expect(err).To(MatchError("crictl-missing binary not found"))
+
+	g.Expect(os.MkdirAll(filepath.Join(rootPath, "usr/local/bin"), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(rootPath, "usr/local/bin/sh"), []byte("#!/bin/sh\n"), 0755)).To(Succeed())
+	g.Expect(FindBinary(rootPath, "sh")).To(Equal(filepath.Join(rootPath, "usr/local/bin/sh")))
+
+	g.Expect(os.MkdirAll(filepath.Join(rootPath, "usr/bin"), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(rootPath, "usr/bin/sh"), []byte("#!/bin/sh\n"), 0755)).To(Succeed())
+	g.Expect(FindBinary(rootPath, "sh")).To(Equal(filepath.Join(rootPath, "usr/bin/sh")))
+}
+
+// TestRunCommand tests that the RunCommand error holds the output of the command
+func TestRunCommand(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(RunCommand("sh", "-c", "true")).To(Succeed())
+	g.Expect(RunCommand("sh", "-c", "echo failed; exit 2")).To(MatchError("sh -c echo failed; exit 2: exit status 2: failed"))
+}
+
+// TestCommandOutput tests that CommandOutput returns the standard output and the standard error on failure
+func TestCommandOutput(t *testing.T) {
+	g := NewWithT(t)
+
+	output, err := CommandOutput("sh", "-c", "echo 3f2a9c; echo ignored >&2")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(output).To(Equal("3f2a9c"))
+
+	_, err = CommandOutput("sh", "-c", "echo failed >&2; exit 1")
+	g.Expect(err).To(MatchError("sh -c echo failed >&2; exit 1: exit status 1: failed"))
+}
+
+// TestCrictlArgs tests the CrictlArgs function on a host without spectro-containerd
+func TestCrictlArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	if SpectroContainerd() {
+		t.Skip("the host runs spectro-containerd")
+	}
+	g.Expect(CrictlArgs("ps", "-q")).To(Equal([]string{"ps", "-q"}))
+}
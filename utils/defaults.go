@@ -9,6 +9,7 @@ import (
 
 	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
 
+	"github.com/kairos-io/kairos/provider-kubeadm/containerd"
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -27,11 +28,31 @@ func MutateClusterConfigBeta3Defaults(clusterCtx *domain.ClusterContext, cluster
 		host = clusterCtx.ControlPlaneHost
 	}
 	clusterCfg.APIServer.CertSANs = appendIfNotPresent(clusterCfg.APIServer.CertSANs, host)
+	if clusterCtx.KubeVip != nil {
+		clusterCfg.APIServer.CertSANs = appendIfNotPresent(clusterCfg.APIServer.CertSANs, clusterCtx.KubeVip.Address)
+	}
 	clusterCfg.ControlPlaneEndpoint = clusterCtx.ControlPlaneHost
 
 	if clusterCfg.ImageRepository == "" {
 		clusterCfg.ImageRepository = kubeadmapiv3.DefaultImageRepository
 	}
+
+	// the resolved version also replaces a configured one that is not a semantic version, such as "latest"
+	if clusterCtx.KubernetesVersion != "" {
+		clusterCfg.KubernetesVersion = clusterCtx.KubernetesVersion
+	}
+
+	if clusterCtx.ExternalEtcd != nil && clusterCfg.Etcd.External == nil {
+		caFile, certFile, keyFile := ExternalEtcdCertFiles(clusterCtx.RootPath)
+		clusterCfg.Etcd = kubeadmapiv3.Etcd{
+			External: &kubeadmapiv3.ExternalEtcd{
+				Endpoints: clusterCtx.ExternalEtcd.Endpoints,
+				CAFile:    caFile,
+				CertFile:  certFile,
+				KeyFile:   keyFile,
+			},
+		}
+	}
 }
 
 func MutateClusterConfigBeta4Defaults(clusterCtx *domain.ClusterContext, clusterCfg *kubeadmapiv4.ClusterConfiguration) {
@@ -42,11 +63,37 @@ func MutateClusterConfigBeta4Defaults(clusterCtx *domain.ClusterContext, cluster
 		host = clusterCtx.ControlPlaneHost
 	}
 	clusterCfg.APIServer.CertSANs = appendIfNotPresent(clusterCfg.APIServer.CertSANs, host)
+	if clusterCtx.KubeVip != nil {
+		clusterCfg.APIServer.CertSANs = appendIfNotPresent(clusterCfg.APIServer.CertSANs, clusterCtx.KubeVip.Address)
+	}
 	clusterCfg.ControlPlaneEndpoint = clusterCtx.ControlPlaneHost
 
 	if clusterCfg.ImageRepository == "" {
 		clusterCfg.ImageRepository = kubeadmapiv4.DefaultImageRepository
 	}
+
+	// the resolved version also replaces a configured one that is not a semantic version, such as "latest"
+	if clusterCtx.KubernetesVersion != "" {
+		clusterCfg.KubernetesVersion = clusterCtx.KubernetesVersion
+	}
+
+	if clusterCtx.ExternalEtcd != nil && clusterCfg.Etcd.External == nil {
+		caFile, certFile, keyFile := ExternalEtcdCertFiles(clusterCtx.RootPath)
+		clusterCfg.Etcd = kubeadmapiv4.Etcd{
+			External: &kubeadmapiv4.ExternalEtcd{
+				Endpoints: clusterCtx.ExternalEtcd.Endpoints,
+				CAFile:    caFile,
+				CertFile:  certFile,
+				KeyFile:   keyFile,
+			},
+		}
+	}
+}
+
+// ExternalEtcdCertFiles returns the CA, client certificate and client key files of the externalEtcd block.
+func ExternalEtcdCertFiles(rootPath string) (string, string, string) {
+	dir := filepath.Join(rootPath, domain.ExternalEtcdCertsPath)
+	return filepath.Join(dir, "ca.crt"), filepath.Join(dir, "apiserver-etcd-client.crt"), filepath.Join(dir, "apiserver-etcd-client.key")
 }
 
 func MutateKubeletDefaults(clusterCtx *domain.ClusterContext, kubeletCfg *kubeletv1beta1.KubeletConfiguration) {
@@ -128,6 +175,54 @@ func MutateKubeletDefaults(clusterCtx *domain.ClusterContext, kubeletCfg *kubele
 	}
 }
 
+// MutateContainerdDefaults defaults the containerd configuration of the node. The cgroup driver
+// falls back to the one of the kubelet configuration, the kubelet then uses the resulting driver.
+func MutateContainerdDefaults(clusterCtx *domain.ClusterContext, cfg *domain.ContainerdConfiguration, imageRepository, kubeletCgroupDriver string) {
+	if cfg.CgroupDriver == "" {
+		cfg.CgroupDriver = ValueOrDefaultString(kubeletCgroupDriver, constants.CgroupDriverSystemd)
+	}
+
+	// the root of other containerd services, e.g. spectro-containerd, is left to the service
+	if cfg.Root == "" && clusterCtx.ContainerdServiceFolderName == "containerd" {
+		cfg.Root = domain.DefaultContainerdRoot
+	}
+
+	if cfg.SandboxImage == "" {
+		cfg.SandboxImage = GetPauseImage(ValueOrDefaultString(imageRepository, kubeadmapiv4.DefaultImageRepository), clusterCtx.KubernetesVersion)
+	}
+
+	if cfg.Snapshotter == "" {
+		cfg.Snapshotter = domain.DefaultContainerdSnapshotter
+	}
+
+	if cfg.RegistryConfigPath == "" {
+		cfg.RegistryConfigPath = containerd.RegistryConfigPath(clusterCtx.ContainerdServiceFolderName)
+	}
+
+	if cfg.DefaultRuntime == "" {
+		cfg.DefaultRuntime = domain.DefaultContainerdRuntime
+	}
+
+	runtimes := []domain.ContainerdRuntime{
+		{
+			Name:       domain.DefaultContainerdRuntime,
+			Type:       domain.DefaultContainerdRuntimeType,
+			BinaryName: domain.DefaultRuncBinaryName,
+		},
+	}
+	for _, runtime := range cfg.Runtimes {
+		if runtime.Type == "" {
+			runtime.Type = domain.DefaultContainerdRuntimeType
+		}
+		if runtime.Name == domain.DefaultContainerdRuntime {
+			runtimes[0] = runtime
+			continue
+		}
+		runtimes = append(runtimes, runtime)
+	}
+	cfg.Runtimes = runtimes
+}
+
 func ValueOrDefaultString(value, defaultValue string) string {
 	if value == "" {
 		return defaultValue
@@ -52,6 +52,80 @@ func TestMutateClusterConfigBeta4Defaults(t *testing.T) {
 	})
 }
 
+// TestMutateClusterConfigDefaultsKubernetesVersion tests that the resolved kubernetes version replaces an invalid configured one
+func TestMutateClusterConfigDefaultsKubernetesVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterCtx := &domain.ClusterContext{
+		ControlPlaneHost:  "10.0.0.1:6443",
+		KubernetesVersion: "v1.33.2",
+	}
+
+	beta3 := &kubeadmapiv3.ClusterConfiguration{KubernetesVersion: "latest"}
+	MutateClusterConfigBeta3Defaults(clusterCtx, beta3)
+	g.Expect(beta3.KubernetesVersion).To(Equal("v1.33.2"))
+
+	beta4 := &kubeadmapiv4.ClusterConfiguration{KubernetesVersion: " v1.33.2"}
+	MutateClusterConfigBeta4Defaults(clusterCtx, beta4)
+	g.Expect(beta4.KubernetesVersion).To(Equal("v1.33.2"))
+
+	// without a resolved version the configured one is kept
+	beta4 = &kubeadmapiv4.ClusterConfiguration{KubernetesVersion: "v1.33.2"}
+	MutateClusterConfigBeta4Defaults(&domain.ClusterContext{ControlPlaneHost: "10.0.0.1:6443"}, beta4)
+	g.Expect(beta4.KubernetesVersion).To(Equal("v1.33.2"))
+}
+
+// TestMutateClusterConfigDefaultsKubeVip tests that the kube-vip address is added to the certSANs
+func TestMutateClusterConfigDefaultsKubeVip(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterCtx := &domain.ClusterContext{
+		ControlPlaneHost: "cluster.example.com:6443",
+		KubeVip:          &domain.KubeVip{Address: "10.0.0.100"},
+	}
+
+	beta3Config := &kubeadmapiv3.ClusterConfiguration{}
+	MutateClusterConfigBeta3Defaults(clusterCtx, beta3Config)
+	g.Expect(beta3Config.APIServer.CertSANs).To(Equal([]string{"cluster.example.com", "10.0.0.100"}))
+	g.Expect(beta3Config.ControlPlaneEndpoint).To(Equal("cluster.example.com:6443"))
+
+	beta4Config := &kubeadmapiv4.ClusterConfiguration{}
+	beta4Config.APIServer.CertSANs = []string{"10.0.0.100"}
+	MutateClusterConfigBeta4Defaults(clusterCtx, beta4Config)
+	g.Expect(beta4Config.APIServer.CertSANs).To(Equal([]string{"10.0.0.100", "cluster.example.com"}))
+}
+
+// TestMutateClusterConfigDefaultsExternalEtcd tests that the external etcd files of the externalEtcd block are configured
+func TestMutateClusterConfigDefaultsExternalEtcd(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterCtx := &domain.ClusterContext{
+		RootPath:         "/persistent",
+		ControlPlaneHost: "10.0.0.1",
+		ExternalEtcd:     &domain.ExternalEtcdConfiguration{Endpoints: []string{"https://10.0.0.5:2379"}},
+	}
+
+	beta3Config := &kubeadmapiv3.ClusterConfiguration{}
+	MutateClusterConfigBeta3Defaults(clusterCtx, beta3Config)
+	g.Expect(beta3Config.Etcd.External).To(Equal(&kubeadmapiv3.ExternalEtcd{
+		Endpoints: []string{"https://10.0.0.5:2379"},
+		CAFile:    "/persistent/opt/kubeadm/pki/etcd/ca.crt",
+		CertFile:  "/persistent/opt/kubeadm/pki/etcd/apiserver-etcd-client.crt",
+		KeyFile:   "/persistent/opt/kubeadm/pki/etcd/apiserver-etcd-client.key",
+	}))
+
+	beta4Config := &kubeadmapiv4.ClusterConfiguration{}
+	MutateClusterConfigBeta4Defaults(clusterCtx, beta4Config)
+	g.Expect(beta4Config.Etcd.Local).To(BeNil())
+	g.Expect(beta4Config.Etcd.External.CAFile).To(Equal("/persistent/opt/kubeadm/pki/etcd/ca.crt"))
+
+	// files managed by the user are kept
+	userExternal := &kubeadmapiv4.ExternalEtcd{Endpoints: []string{"https://10.0.0.5:2379"}, CAFile: "/etc/etcd/ca.crt"}
+	beta4Config = &kubeadmapiv4.ClusterConfiguration{Etcd: kubeadmapiv4.Etcd{External: userExternal}}
+	MutateClusterConfigBeta4Defaults(clusterCtx, beta4Config)
+	g.Expect(beta4Config.Etcd.External).To(BeIdenticalTo(userExternal))
+}
+
 // TestMutateKubeletDefaults tests the MutateKubeletDefaults function
 func TestMutateKubeletDefaults(t *testing.T) {
 	t.Run("mutate_kubelet_defaults", func(t *testing.T) {
@@ -72,6 +146,100 @@ func TestMutateKubeletDefaults(t *testing.T) {
 	})
 }
 
+// TestMutateContainerdDefaults tests the MutateContainerdDefaults function
+func TestMutateContainerdDefaults(t *testing.T) {
+	tests := []struct {
+		name                string
+		serviceName         string
+		cfg                 domain.ContainerdConfiguration
+		imageRepository     string
+		kubeletCgroupDriver string
+		expected            domain.ContainerdConfiguration
+	}{
+		{
+			name: "defaults",
+			expected: domain.ContainerdConfiguration{
+				CgroupDriver:       "systemd",
+				SandboxImage:       "registry.k8s.io/pause:3.10",
+				Snapshotter:        "overlayfs",
+				RegistryConfigPath: "/etc/spectro-containerd/certs.d",
+				DefaultRuntime:     "runc",
+				Runtimes:           []domain.ContainerdRuntime{{Name: "runc", Type: "io.containerd.runc.v2", BinaryName: "/opt/bin/runc"}},
+			},
+		},
+		{
+			name: "configured",
+			cfg: domain.ContainerdConfiguration{
+				SandboxImage:       "registry.local:5000/pause:3.10",
+				Snapshotter:        "native",
+				RegistryConfigPath: "/etc/registries",
+				DefaultRuntime:     "nvidia",
+				Runtimes: []domain.ContainerdRuntime{
+					{Name: "nvidia", BinaryName: "/usr/bin/nvidia-container-runtime"},
+					{Name: "runc", BinaryName: "/usr/sbin/runc"},
+				},
+			},
+			imageRepository:     "registry.local:5000/k8s",
+			kubeletCgroupDriver: "cgroupfs",
+			expected: domain.ContainerdConfiguration{
+				CgroupDriver:       "cgroupfs",
+				SandboxImage:       "registry.local:5000/pause:3.10",
+				Snapshotter:        "native",
+				RegistryConfigPath: "/etc/registries",
+				DefaultRuntime:     "nvidia",
+				Runtimes: []domain.ContainerdRuntime{
+					{Name: "runc", Type: "io.containerd.runc.v2", BinaryName: "/usr/sbin/runc"},
+					{Name: "nvidia", Type: "io.containerd.runc.v2", BinaryName: "/usr/bin/nvidia-container-runtime"},
+				},
+			},
+		},
+		{
+			name:        "root_of_the_containerd_service",
+			serviceName: "containerd",
+			expected: domain.ContainerdConfiguration{
+				Root:               "/opt/containerd",
+				CgroupDriver:       "systemd",
+				SandboxImage:       "registry.k8s.io/pause:3.10",
+				Snapshotter:        "overlayfs",
+				RegistryConfigPath: "/etc/containerd/certs.d",
+				DefaultRuntime:     "runc",
+				Runtimes:           []domain.ContainerdRuntime{{Name: "runc", Type: "io.containerd.runc.v2", BinaryName: "/opt/bin/runc"}},
+			},
+		},
+		{
+			name:            "sandbox_image_of_the_image_repository",
+			imageRepository: "registry.local:5000/k8s",
+			expected: domain.ContainerdConfiguration{
+				CgroupDriver:       "systemd",
+				SandboxImage:       "registry.local:5000/k8s/pause:3.10",
+				Snapshotter:        "overlayfs",
+				RegistryConfigPath: "/etc/spectro-containerd/certs.d",
+				DefaultRuntime:     "runc",
+				Runtimes:           []domain.ContainerdRuntime{{Name: "runc", Type: "io.containerd.runc.v2", BinaryName: "/opt/bin/runc"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			serviceName := tt.serviceName
+			if serviceName == "" {
+				serviceName = "spectro-containerd"
+			}
+			clusterCtx := &domain.ClusterContext{
+				KubernetesVersion:           "v1.33.2",
+				ContainerdServiceFolderName: serviceName,
+			}
+
+			cfg := tt.cfg
+			MutateContainerdDefaults(clusterCtx, &cfg, tt.imageRepository, tt.kubeletCgroupDriver)
+			g.Expect(cfg).To(Equal(tt.expected))
+		})
+	}
+}
+
 // TestValueOrDefaultString tests the ValueOrDefaultString function
 func TestValueOrDefaultString(t *testing.T) {
 	tests := []struct {
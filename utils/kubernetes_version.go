@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+const (
+	KubernetesVersionSourceClusterConfig  = "clusterConfiguration.kubernetesVersion"
+	KubernetesVersionSourceProviderOption = "providerConfig." + domain.KubernetesVersionOption
+	KubernetesVersionSourceKubeadm        = "kubeadm version"
+	KubernetesVersionSourceSentinel       = "opt/sentinel_kubeadmversion"
+)
+
+// pauseVersions are the pause image versions of kubeadm by the kubernetes version they start with,
+// newest first. The vendored kubeadm constants only hold the version of a single release.
+var pauseVersions = []struct {
+	kubernetesVersion string
+	pauseVersion      string
+}{
+	{"v1.34.0", "3.10.1"},
+	{"v1.31.0", "3.10"},
+	{"v1.26.0", "3.9"},
+	{"v1.25.0", "3.8"},
+	{"v1.24.0", "3.7"},
+}
+
+// kubeadmVersion runs the kubeadm binary at path and returns its short version,
+// it is a variable so tests can stub the binary out.
+var kubeadmVersion = func(path string) (string, error) {
+	out, err := exec.Command(path, "version", "-o", "short").Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// KubernetesVersionAttempt records why a single version source could not be used.
+type KubernetesVersionAttempt struct {
+	Source string
+	Value  string
+	Err    error
+}
+
+// KubernetesVersionError is returned when none of the version sources yield a
+// valid semantic version.
+type KubernetesVersionError struct {
+	Attempts []KubernetesVersionAttempt
+}
+
+func (e *KubernetesVersionError) Error() string {
+	var reasons []string
+	for _, attempt := range e.Attempts {
+		if attempt.Value == "" {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", attempt.Source, attempt.Err))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("%s: %q: %v", attempt.Source, attempt.Value, attempt.Err))
+		}
+	}
+	return fmt.Sprintf("unable to resolve kubernetes version: %s", strings.Join(reasons, "; "))
+}
+
+// ResolveKubernetesVersion returns the kubernetes version to configure the node with. The
+// version from the cluster configuration wins, then the provider option, then the version
+// of the kubeadm binary shipped in the image and finally the version recorded by kube-pre-init.sh.
+func ResolveKubernetesVersion(configured string, providerOptions map[string]string, rootPath string) (string, error) {
+	var attempts []KubernetesVersionAttempt
+
+	candidates := []struct {
+		source string
+		value  func() (string, error)
+	}{
+		{KubernetesVersionSourceClusterConfig, func() (string, error) { return configured, nil }},
+		{KubernetesVersionSourceProviderOption, func() (string, error) { return providerOptions[domain.KubernetesVersionOption], nil }},
+		{KubernetesVersionSourceKubeadm, func() (string, error) { return getKubeadmBinaryVersion(rootPath) }},
+		{KubernetesVersionSourceSentinel, func() (string, error) { return getSentinelKubeadmVersion(rootPath) }},
+	}
+
+	for _, candidate := range candidates {
+		value, err := candidate.value()
+		value = strings.TrimSpace(value)
+		if err == nil && value == "" {
+			err = errors.New("not set")
+		}
+		if err == nil {
+			if _, err = version.ParseSemantic(value); err == nil {
+				if candidate.source != KubernetesVersionSourceClusterConfig {
+					logrus.Infof("resolved kubernetes version %s from %s", value, candidate.source)
+				}
+				return value, nil
+			}
+			logrus.Warnf("ignoring invalid kubernetes version %q from %s: %v", value, candidate.source, err)
+		}
+		attempts = append(attempts, KubernetesVersionAttempt{Source: candidate.source, Value: value, Err: err})
+	}
+
+	return "", &KubernetesVersionError{Attempts: attempts}
+}
+
+func getKubeadmBinaryVersion(rootPath string) (string, error) {
+	path, err := FindKubeadmBinary(rootPath)
+	if err != nil {
+		return "", err
+	}
+	return kubeadmVersion(path)
+}
+
+// FindKubeadmBinary returns the kubeadm binary under the cluster root path, falling back to PATH.
+func FindKubeadmBinary(rootPath string) (string, error) {
+	return FindBinary(rootPath, "kubeadm")
+}
+
+func getSentinelKubeadmVersion(rootPath string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(rootPath, "opt/sentinel_kubeadmversion"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.New("not found")
+		}
+		return "", err
+	}
+	return string(content), nil
+}
+
+// GetPauseImage returns the pause image kubeadm uses for the kubernetes version, so that the
+// containerd sandbox image is the one kubeadm pulls and pins.
+func GetPauseImage(imageRepository, kubernetesVersion string) string {
+	pauseVersion := constants.PauseVersion
+	if v, err := version.ParseSemantic(kubernetesVersion); err == nil {
+		for _, entry := range pauseVersions {
+			pauseVersion = entry.pauseVersion
+			if v.AtLeast(version.MustParseSemantic(entry.kubernetesVersion)) {
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("%s/pause:%s", imageRepository, pauseVersion)
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/images"
+)
+
+// TestResolveKubernetesVersion tests the ResolveKubernetesVersion function
+func TestResolveKubernetesVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		configured      string
+		providerOptions map[string]string
+		kubeadmBinary   string
+		kubeadmErr      error
+		sentinel        string
+		expectedVersion string
+		expectedErrs    []string
+	}{
+		{
+			name:            "configured_version",
+			configured:      "v1.30.11",
+			providerOptions: map[string]string{"kubernetes_version": "v1.31.0"},
+			kubeadmBinary:   "v1.32.0",
+			expectedVersion: "v1.30.11",
+		},
+		{
+			name:            "provider_option_fallback",
+			providerOptions: map[string]string{"kubernetes_version": "v1.31.0"},
+			kubeadmBinary:   "v1.32.0",
+			expectedVersion: "v1.31.0",
+		},
+		{
+			name:            "invalid_configured_version_falls_back",
+			configured:      "latest",
+			kubeadmBinary:   "v1.32.0\n",
+			expectedVersion: "v1.32.0",
+		},
+		{
+			name:            "sentinel_fallback",
+			kubeadmErr:      errors.New("exec format error"),
+			sentinel:        "v1.29.4\n",
+			expectedVersion: "v1.29.4",
+		},
+		{
+			name:       "nothing_resolvable",
+			configured: "1.x",
+			kubeadmErr: errors.New("exec format error"),
+			expectedErrs: []string{
+				`clusterConfiguration.kubernetesVersion: "1.x"`,
+				"providerConfig.kubernetes_version: not set",
+				"kubeadm version: exec format error",
+				"opt/sentinel_kubeadmversion: not found",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rootPath := t.TempDir()
+			g.Expect(os.MkdirAll(filepath.Join(rootPath, "usr/bin"), 0755)).To(Succeed())
+			g.Expect(os.WriteFile(filepath.Join(rootPath, "usr/bin/kubeadm"), nil, 0755)).To(Succeed())
+
+			if tt.sentinel != "" {
+				g.Expect(os.MkdirAll(filepath.Join(rootPath, "opt"), 0755)).To(Succeed())
+				g.Expect(os.WriteFile(filepath.Join(rootPath, "opt/sentinel_kubeadmversion"), []byte(tt.sentinel), 0644)).To(Succeed())
+			}
+
+			original := kubeadmVersion
+			defer func() { kubeadmVersion = original }()
+			kubeadmVersion = func(path string) (string, error) {
+				g.Expect(path).To(Equal(filepath.Join(rootPath, "usr/bin/kubeadm")))
+				return tt.kubeadmBinary, tt.kubeadmErr
+			}
+
+			result, err := ResolveKubernetesVersion(tt.configured, tt.providerOptions, rootPath)
+
+			if len(tt.expectedErrs) > 0 {
+				var versionErr *KubernetesVersionError
+				g.Expect(errors.As(err, &versionErr)).To(BeTrue())
+				g.Expect(versionErr.Attempts).To(HaveLen(4))
+				for _, expected := range tt.expectedErrs {
+					g.Expect(err.Error()).To(ContainSubstring(expected))
+				}
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expectedVersion))
+		})
+	}
+}
+
+// TestGetPauseImage tests the GetPauseImage function
+func TestGetPauseImage(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(GetPauseImage("registry.k8s.io", "v1.34.1")).To(Equal("registry.k8s.io/pause:3.10.1"))
+	g.Expect(GetPauseImage("registry.k8s.io", "v1.33.2")).To(Equal("registry.k8s.io/pause:3.10"))
+	g.Expect(GetPauseImage("registry.local:5000/k8s", "v1.30.11")).To(Equal("registry.local:5000/k8s/pause:3.9"))
+	g.Expect(GetPauseImage("registry.k8s.io", "v1.23.0")).To(Equal("registry.k8s.io/pause:3.7"))
+	g.Expect(GetPauseImage("registry.k8s.io", "")).To(Equal("registry.k8s.io/pause:" + constants.PauseVersion))
+
+	// the table has to agree with the vendored kubeadm
+	g.Expect(GetPauseImage("registry.k8s.io", "v1.33.0")).To(Equal(images.GetPauseImage(&kubeadmapi.ClusterConfiguration{ImageRepository: "registry.k8s.io"})))
+}
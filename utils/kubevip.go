@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+const (
+	adminKubeConfig      = "/etc/kubernetes/admin.conf"
+	superAdminKubeConfig = "/etc/kubernetes/super-admin.conf"
+)
+
+// GetKubeVipConfig returns the kube-vip configuration from the provider options, or nil when
+// kube-vip is not enabled. The VIP defaults to the control plane host and must match it when
+// the control plane host is an IP address.
+func GetKubeVipConfig(options map[string]string, controlPlaneHost string) (*domain.KubeVip, error) {
+	if enabled, _ := strconv.ParseBool(options[domain.KubeVipEnabledOption]); !enabled {
+		return nil, nil
+	}
+
+	host, port, err := net.SplitHostPort(controlPlaneHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control plane host %q: %w", controlPlaneHost, err)
+	}
+
+	kubeVip := &domain.KubeVip{
+		Address:   options[domain.KubeVipAddressOption],
+		Port:      port,
+		Interface: options[domain.KubeVipInterfaceOption],
+		Mode:      ValueOrDefaultString(options[domain.KubeVipModeOption], domain.KubeVipModeARP),
+		Image:     ValueOrDefaultString(options[domain.KubeVipImageOption], domain.DefaultKubeVipImage),
+	}
+
+	hostIP := net.ParseIP(host)
+	switch {
+	case kubeVip.Address == "" && hostIP == nil:
+		return nil, fmt.Errorf("%s is required when the control plane host %q is not an IP address", domain.KubeVipAddressOption, host)
+	case kubeVip.Address == "":
+		kubeVip.Address = host
+	case net.ParseIP(kubeVip.Address) == nil:
+		return nil, fmt.Errorf("invalid %s %q: must be an IP address", domain.KubeVipAddressOption, kubeVip.Address)
+	case hostIP != nil && !hostIP.Equal(net.ParseIP(kubeVip.Address)):
+		return nil, fmt.Errorf("%s %q does not match the control plane host %q", domain.KubeVipAddressOption, kubeVip.Address, host)
+	}
+
+	if kubeVip.Interface == "" {
+		return nil, fmt.Errorf("%s is required when kube-vip is enabled", domain.KubeVipInterfaceOption)
+	}
+
+	switch kubeVip.Mode {
+	case domain.KubeVipModeARP:
+	case domain.KubeVipModeBGP:
+		kubeVip.BGPAS = domain.DefaultKubeVipBGPAS
+		if value := options[domain.KubeVipBGPASOption]; value != "" {
+			as, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: must be an AS number", domain.KubeVipBGPASOption, value)
+			}
+			kubeVip.BGPAS = uint32(as)
+		}
+		kubeVip.BGPRouterID = options[domain.KubeVipBGPRouterIDOption]
+		kubeVip.BGPPeers = options[domain.KubeVipBGPPeersOption]
+		if kubeVip.BGPPeers == "" {
+			return nil, fmt.Errorf("%s is required in %s mode", domain.KubeVipBGPPeersOption, domain.KubeVipModeBGP)
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s %q: must be %s or %s", domain.KubeVipModeOption, kubeVip.Mode, domain.KubeVipModeARP, domain.KubeVipModeBGP)
+	}
+
+	return kubeVip, nil
+}
+
+// GetKubeVipManifest renders the kube-vip static pod manifest for a control plane node. It mounts
+// super-admin.conf instead of admin.conf if superAdmin is set, see KubeVipNeedsSuperAdmin.
+func GetKubeVipManifest(clusterCtx *domain.ClusterContext, superAdmin bool) (string, error) {
+	kubeVip := clusterCtx.KubeVip
+	kubeConfig := adminKubeConfig
+	if superAdmin {
+		kubeConfig = superAdminKubeConfig
+	}
+
+	cidr := "32"
+	if net.ParseIP(kubeVip.Address).To4() == nil {
+		cidr = "128"
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "address", Value: kubeVip.Address},
+		{Name: "port", Value: kubeVip.Port},
+		{Name: "vip_interface", Value: kubeVip.Interface},
+		{Name: "vip_cidr", Value: cidr},
+		{Name: "cp_enable", Value: "true"},
+		{Name: "cp_namespace", Value: "kube-system"},
+		{Name: "prometheus_server", Value: ":2112"},
+	}
+
+	if kubeVip.Mode == domain.KubeVipModeBGP {
+		env = append(env,
+			corev1.EnvVar{Name: "vip_arp", Value: "false"},
+			corev1.EnvVar{Name: "bgp_enable", Value: "true"},
+			corev1.EnvVar{Name: "bgp_as", Value: strconv.FormatUint(uint64(kubeVip.BGPAS), 10)},
+			corev1.EnvVar{Name: "bgp_peers", Value: kubeVip.BGPPeers},
+		)
+		if kubeVip.BGPRouterID != "" {
+			env = append(env, corev1.EnvVar{Name: "bgp_routerid", Value: kubeVip.BGPRouterID})
+		}
+	} else {
+		env = append(env,
+			corev1.EnvVar{Name: "vip_arp", Value: "true"},
+			corev1.EnvVar{Name: "vip_leaderelection", Value: "true"},
+			corev1.EnvVar{Name: "vip_leasename", Value: "plndr-cp-lock"},
+			corev1.EnvVar{Name: "vip_leaseduration", Value: "5"},
+			corev1.EnvVar{Name: "vip_renewdeadline", Value: "3"},
+			corev1.EnvVar{Name: "vip_retryperiod", Value: "1"},
+		)
+	}
+
+	pod := corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kube-vip",
+			Namespace: "kube-system",
+		},
+		Spec: corev1.PodSpec{
+			HostNetwork: true,
+			HostAliases: []corev1.HostAlias{
+				{IP: "127.0.0.1", Hostnames: []string{"kubernetes"}},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:            "kube-vip",
+					Image:           kubeVip.Image,
+					ImagePullPolicy: corev1.PullIfNotPresent,
+					Args:            []string{"manager"},
+					Env:             env,
+					SecurityContext: &corev1.SecurityContext{
+						Capabilities: &corev1.Capabilities{
+							Add: []corev1.Capability{"NET_ADMIN", "NET_RAW"},
+						},
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "kubeconfig", MountPath: adminKubeConfig},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "kubeconfig",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: kubeConfig},
+					},
+				},
+			},
+		},
+	}
+
+	out, err := yaml.Marshal(pod)
+	if err != nil {
+		return "", fmt.Errorf("failed to render kube-vip manifest: %w", err)
+	}
+	return string(out), nil
+}
+
+// KubeVipNeedsSuperAdmin returns whether kube-vip has to use super-admin.conf until kubeadm init
+// has finished. Since kubernetes v1.29 admin.conf is only authorized once kubeadm init has
+// finished, which waits for the VIP kube-vip provides.
+func KubeVipNeedsSuperAdmin(clusterCtx *domain.ClusterContext) bool {
+	if clusterCtx.NodeRole != clusterplugin.RoleInit {
+		return false
+	}
+
+	v, err := version.ParseSemantic(clusterCtx.KubernetesVersion)
+	return err == nil && !v.LessThan(version.MustParseSemantic("v1.29.0"))
+}
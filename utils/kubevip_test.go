@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestGetKubeVipConfig tests the GetKubeVipConfig function
+func TestGetKubeVipConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		options          map[string]string
+		controlPlaneHost string
+		expected         *domain.KubeVip
+		expectedErr      string
+	}{
+		{
+			name:             "disabled",
+			options:          map[string]string{domain.KubeVipAddressOption: "10.0.0.100"},
+			controlPlaneHost: "10.0.0.100:6443",
+		},
+		{
+			name: "arp_defaults_to_control_plane_host",
+			options: map[string]string{
+				domain.KubeVipEnabledOption:   "true",
+				domain.KubeVipInterfaceOption: "eth0",
+			},
+			controlPlaneHost: "10.0.0.100:6443",
+			expected: &domain.KubeVip{
+				Address:   "10.0.0.100",
+				Port:      "6443",
+				Interface: "eth0",
+				Mode:      domain.KubeVipModeARP,
+				Image:     domain.DefaultKubeVipImage,
+			},
+		},
+		{
+			name: "bgp_with_dns_control_plane_host",
+			options: map[string]string{
+				domain.KubeVipEnabledOption:     "true",
+				domain.KubeVipAddressOption:     "10.0.0.100",
+				domain.KubeVipInterfaceOption:   "lo",
+				domain.KubeVipModeOption:        "bgp",
+				domain.KubeVipBGPASOption:       "64512",
+				domain.KubeVipBGPRouterIDOption: "10.0.0.11",
+				domain.KubeVipBGPPeersOption:    "10.0.0.1:64513::false",
+				domain.KubeVipImageOption:       "registry.example.com/kube-vip:v0.8.9",
+			},
+			controlPlaneHost: "cluster.example.com:8443",
+			expected: &domain.KubeVip{
+				Address:     "10.0.0.100",
+				Port:        "8443",
+				Interface:   "lo",
+				Mode:        domain.KubeVipModeBGP,
+				Image:       "registry.example.com/kube-vip:v0.8.9",
+				BGPAS:       64512,
+				BGPRouterID: "10.0.0.11",
+				BGPPeers:    "10.0.0.1:64513::false",
+			},
+		},
+		{
+			name: "address_does_not_match_control_plane_host",
+			options: map[string]string{
+				domain.KubeVipEnabledOption:   "true",
+				domain.KubeVipAddressOption:   "10.0.0.200",
+				domain.KubeVipInterfaceOption: "eth0",
+			},
+			controlPlaneHost: "10.0.0.100:6443",
+			expectedErr:      `kube_vip_address "10.0.0.200" does not match the control plane host "10.0.0.100"`,
+		},
+		{
+			name: "address_required_with_dns_control_plane_host",
+			options: map[string]string{
+				domain.KubeVipEnabledOption:   "true",
+				domain.KubeVipInterfaceOption: "eth0",
+			},
+			controlPlaneHost: "cluster.example.com:6443",
+			expectedErr:      `kube_vip_address is required when the control plane host "cluster.example.com" is not an IP address`,
+		},
+		{
+			name: "interface_required",
+			options: map[string]string{
+				domain.KubeVipEnabledOption: "true",
+			},
+			controlPlaneHost: "10.0.0.100:6443",
+			expectedErr:      "kube_vip_interface is required when kube-vip is enabled",
+		},
+		{
+			name: "bgp_peers_required",
+			options: map[string]string{
+				domain.KubeVipEnabledOption:   "true",
+				domain.KubeVipInterfaceOption: "lo",
+				domain.KubeVipModeOption:      "bgp",
+			},
+			controlPlaneHost: "10.0.0.100:6443",
+			expectedErr:      "kube_vip_bgp_peers is required in bgp mode",
+		},
+		{
+			name: "invalid_mode",
+			options: map[string]string{
+				domain.KubeVipEnabledOption:   "true",
+				domain.KubeVipInterfaceOption: "eth0",
+				domain.KubeVipModeOption:      "table",
+			},
+			controlPlaneHost: "10.0.0.100:6443",
+			expectedErr:      `invalid kube_vip_mode "table": must be arp or bgp`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetKubeVipConfig(tt.options, tt.controlPlaneHost)
+			if tt.expectedErr != "" {
+				g.Expect(err).To(MatchError(tt.expectedErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestGetKubeVipManifest tests the GetKubeVipManifest function
+func TestGetKubeVipManifest(t *testing.T) {
+	tests := []struct {
+		name               string
+		clusterCtx         *domain.ClusterContext
+		expectedKubeConfig string
+		expectedEnv        []corev1.EnvVar
+		unexpectedEnv      []string
+	}{
+		{
+			name: "arp_init_node",
+			clusterCtx: &domain.ClusterContext{
+				NodeRole:          "init",
+				KubernetesVersion: "v1.30.4",
+				KubeVip: &domain.KubeVip{
+					Address:   "10.0.0.100",
+					Port:      "6443",
+					Interface: "eth0",
+					Mode:      domain.KubeVipModeARP,
+					Image:     domain.DefaultKubeVipImage,
+				},
+			},
+			expectedKubeConfig: "/etc/kubernetes/super-admin.conf",
+			expectedEnv: []corev1.EnvVar{
+				{Name: "address", Value: "10.0.0.100"},
+				{Name: "port", Value: "6443"},
+				{Name: "vip_interface", Value: "eth0"},
+				{Name: "vip_cidr", Value: "32"},
+				{Name: "vip_arp", Value: "true"},
+				{Name: "vip_leaderelection", Value: "true"},
+			},
+			unexpectedEnv: []string{"bgp_enable"},
+		},
+		{
+			name: "bgp_control_plane_node",
+			clusterCtx: &domain.ClusterContext{
+				NodeRole:          "controlplane",
+				KubernetesVersion: "v1.30.4",
+				KubeVip: &domain.KubeVip{
+					Address:   "fd00::100",
+					Port:      "6443",
+					Interface: "lo",
+					Mode:      domain.KubeVipModeBGP,
+					Image:     domain.DefaultKubeVipImage,
+					BGPAS:     64512,
+					BGPPeers:  "10.0.0.1:64513::false",
+				},
+			},
+			expectedKubeConfig: "/etc/kubernetes/admin.conf",
+			expectedEnv: []corev1.EnvVar{
+				{Name: "address", Value: "fd00::100"},
+				{Name: "vip_cidr", Value: "128"},
+				{Name: "vip_arp", Value: "false"},
+				{Name: "bgp_enable", Value: "true"},
+				{Name: "bgp_as", Value: "64512"},
+				{Name: "bgp_peers", Value: "10.0.0.1:64513::false"},
+			},
+			unexpectedEnv: []string{"vip_leaderelection", "bgp_routerid"},
+		},
+		{
+			name: "init_node_before_super_admin",
+			clusterCtx: &domain.ClusterContext{
+				NodeRole:          "init",
+				KubernetesVersion: "v1.28.9",
+				KubeVip: &domain.KubeVip{
+					Address:   "10.0.0.100",
+					Port:      "6443",
+					Interface: "eth0",
+					Mode:      domain.KubeVipModeARP,
+					Image:     domain.DefaultKubeVipImage,
+				},
+			},
+			expectedKubeConfig: "/etc/kubernetes/admin.conf",
+			expectedEnv: []corev1.EnvVar{
+				{Name: "vip_arp", Value: "true"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			manifest, err := GetKubeVipManifest(tt.clusterCtx, KubeVipNeedsSuperAdmin(tt.clusterCtx))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			var pod corev1.Pod
+			g.Expect(yaml.UnmarshalStrict([]byte(manifest), &pod)).To(Succeed())
+			g.Expect(pod.Name).To(Equal("kube-vip"))
+			g.Expect(pod.Namespace).To(Equal("kube-system"))
+			g.Expect(pod.Spec.HostNetwork).To(BeTrue())
+			g.Expect(pod.Spec.Volumes[0].HostPath.Path).To(Equal(tt.expectedKubeConfig))
+
+			container := pod.Spec.Containers[0]
+			g.Expect(container.Image).To(Equal(tt.clusterCtx.KubeVip.Image))
+			g.Expect(container.VolumeMounts[0].MountPath).To(Equal("/etc/kubernetes/admin.conf"))
+			for _, env := range tt.expectedEnv {
+				g.Expect(container.Env).To(ContainElement(env))
+			}
+			for _, name := range tt.unexpectedEnv {
+				g.Expect(container.Env).ToNot(ContainElement(HaveField("Name", name)))
+			}
+		})
+	}
+}
+
+// TestKubeVipNeedsSuperAdmin tests the KubeVipNeedsSuperAdmin function
+func TestKubeVipNeedsSuperAdmin(t *testing.T) {
+	tests := []struct {
+		name              string
+		nodeRole          string
+		kubernetesVersion string
+		expected          bool
+	}{
+		{name: "init_node", nodeRole: "init", kubernetesVersion: "v1.29.0", expected: true},
+		{name: "init_node_before_super_admin", nodeRole: "init", kubernetesVersion: "v1.28.9", expected: false},
+		{name: "init_node_unknown_version", nodeRole: "init", kubernetesVersion: "", expected: false},
+		{name: "control_plane_node", nodeRole: "controlplane", kubernetesVersion: "v1.30.4", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result := KubeVipNeedsSuperAdmin(&domain.ClusterContext{NodeRole: tt.nodeRole, KubernetesVersion: tt.kubernetesVersion})
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
@@ -2,8 +2,10 @@ package utils
 
 import (
 	"fmt"
-
-	"k8s.io/apimachinery/pkg/util/version"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kairos-io/kairos-sdk/clusterplugin"
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
@@ -17,11 +19,80 @@ func GetClusterRootPath(cluster clusterplugin.Cluster) string {
 	return rootpath
 }
 
-func IsKubeadmVersionGreaterThan131(kubernetesVersion string) (int, error) {
-	v1, err := version.ParseSemantic(kubernetesVersion)
+// GetKubeadmRetryPolicy returns the kubeadm init/join retry policy from the provider options.
+func GetKubeadmRetryPolicy(options map[string]string) (domain.RetryPolicy, error) {
+	policy := domain.RetryPolicy{
+		MaxAttempts: domain.DefaultKubeadmMaxAttempts,
+		Backoff:     domain.DefaultKubeadmBackoff,
+		MaxBackoff:  domain.DefaultKubeadmMaxBackoff,
+	}
+
+	if value := options[domain.KubeadmMaxAttemptsOption]; value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 0 {
+			return policy, fmt.Errorf("invalid %s %q: must be 0 or a positive number", domain.KubeadmMaxAttemptsOption, value)
+		}
+		policy.MaxAttempts = attempts
+	}
+
+	for _, duration := range []struct {
+		option string
+		value  *time.Duration
+	}{
+		{domain.KubeadmBackoffOption, &policy.Backoff},
+		{domain.KubeadmMaxBackoffOption, &policy.MaxBackoff},
+	} {
+		value := options[duration.option]
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return policy, fmt.Errorf("invalid %s %q: must be a positive duration", duration.option, value)
+		}
+		*duration.value = d
+	}
+
+	if policy.MaxBackoff < policy.Backoff {
+		return policy, fmt.Errorf("invalid %s %q: must not be lower than %s", domain.KubeadmMaxBackoffOption, policy.MaxBackoff, domain.KubeadmBackoffOption)
+	}
+	return policy, nil
+}
+
+// GetVerifyImages reports whether the required images are verified before kubeadm runs.
+func GetVerifyImages(options map[string]string) (bool, error) {
+	value := options[domain.VerifyImagesOption]
+	if value == "" {
+		return false, nil
+	}
+	verify, err := strconv.ParseBool(value)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse kubernetes version %q: %w", kubernetesVersion, err)
+		return false, fmt.Errorf("invalid %s %q: must be true or false", domain.VerifyImagesOption, value)
+	}
+	return verify, nil
+}
+
+// GetEtcdSnapshotPolicy returns the etcd snapshot directory and retention from the provider options.
+func GetEtcdSnapshotPolicy(options map[string]string) (domain.EtcdSnapshotPolicy, error) {
+	policy := domain.EtcdSnapshotPolicy{
+		Dir:       domain.DefaultEtcdSnapshotDir,
+		Retention: domain.DefaultEtcdSnapshotRetention,
+	}
+
+	if value := options[domain.EtcdSnapshotDirOption]; value != "" {
+		dir := filepath.Clean(strings.TrimPrefix(value, "/"))
+		if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") {
+			return policy, fmt.Errorf("invalid %s %q: must be a directory under the cluster root path", domain.EtcdSnapshotDirOption, value)
+		}
+		policy.Dir = dir
 	}
 
-	return v1.Compare("v1.31.0")
+	if value := options[domain.EtcdSnapshotRetentionOption]; value != "" {
+		retention, err := strconv.Atoi(value)
+		if err != nil || retention < 1 {
+			return policy, fmt.Errorf("invalid %s %q: must be a positive number", domain.EtcdSnapshotRetentionOption, value)
+		}
+		policy.Retention = retention
+	}
+	return policy, nil
 }
@@ -2,9 +2,12 @@ package utils
 
 import (
 	"testing"
+	"time"
 
 	"github.com/kairos-io/kairos-sdk/clusterplugin"
 	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
 )
 
 // TestGetClusterRootPath tests the GetClusterRootPath function
@@ -59,33 +62,83 @@ func TestGetClusterRootPath(t *testing.T) {
 	}
 }
 
-// TestIsKubeadmVersionGreaterThan131 compares kubernetesVersion against v1.31.0 (see k8s.io/apimachinery/pkg/util/version.Version.Compare).
-func TestIsKubeadmVersionGreaterThan131(t *testing.T) {
+// TestGetKubeadmRetryPolicy tests the GetKubeadmRetryPolicy function
+func TestGetKubeadmRetryPolicy(t *testing.T) {
 	tests := []struct {
 		name            string
-		k8sVersion      string
-		wantCmpSign     string // "<", "=", ">" relative to v1.31.0
+		options         map[string]string
+		expected        domain.RetryPolicy
 		wantErrContains string
 	}{
 		{
-			name:        "less_than_1_31",
-			k8sVersion:  "v1.30.0",
-			wantCmpSign: "<",
+			name:     "defaults",
+			options:  map[string]string{},
+			expected: domain.RetryPolicy{MaxAttempts: 10, Backoff: 10 * time.Second, MaxBackoff: 5 * time.Minute},
+		},
+		{
+			name: "custom",
+			options: map[string]string{
+				"kubeadm_max_attempts":      "0",
+				"kubeadm_retry_backoff":     "30s",
+				"kubeadm_retry_max_backoff": "10m",
+			},
+			expected: domain.RetryPolicy{MaxAttempts: 0, Backoff: 30 * time.Second, MaxBackoff: 10 * time.Minute},
+		},
+		{
+			name:            "invalid_max_attempts",
+			options:         map[string]string{"kubeadm_max_attempts": "-1"},
+			wantErrContains: "invalid kubeadm_max_attempts",
+		},
+		{
+			name:            "invalid_backoff",
+			options:         map[string]string{"kubeadm_retry_backoff": "soon"},
+			wantErrContains: "invalid kubeadm_retry_backoff",
 		},
 		{
-			name:        "equal_1_31",
-			k8sVersion:  "v1.31.0",
-			wantCmpSign: "=",
+			name:            "max_backoff_lower_than_backoff",
+			options:         map[string]string{"kubeadm_retry_backoff": "10m", "kubeadm_retry_max_backoff": "1m"},
+			wantErrContains: "invalid kubeadm_retry_max_backoff",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetKubeadmRetryPolicy(tt.options)
+
+			if tt.wantErrContains != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErrContains)))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestGetVerifyImages tests the GetVerifyImages function
+func TestGetVerifyImages(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         map[string]string
+		expected        bool
+		wantErrContains string
+	}{
+		{
+			name:    "unset",
+			options: map[string]string{},
 		},
 		{
-			name:        "greater_than_1_31",
-			k8sVersion:  "v1.32.4",
-			wantCmpSign: ">",
+			name:     "enabled",
+			options:  map[string]string{"verify_images": "true"},
+			expected: true,
 		},
 		{
-			name:            "invalid_version",
-			k8sVersion:      "/",
-			wantErrContains: "failed to parse kubernetes version",
+			name:            "invalid",
+			options:         map[string]string{"verify_images": "yes"},
+			wantErrContains: `invalid verify_images "yes"`,
 		},
 	}
 
@@ -93,28 +146,70 @@ func TestIsKubeadmVersionGreaterThan131(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			g := NewWithT(t)
 
-			result, err := IsKubeadmVersionGreaterThan131(tt.k8sVersion)
+			result, err := GetVerifyImages(tt.options)
 
 			if tt.wantErrContains != "" {
-				g.Expect(err).To(HaveOccurred())
-				g.Expect(err.Error()).To(ContainSubstring(tt.wantErrContains))
-				g.Expect(result).To(Equal(0))
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErrContains)))
 				return
 			}
 
-			t.Log("result", result)
-
-			g.Expect(err).NotTo(HaveOccurred())
-			switch tt.wantCmpSign {
-			case "<":
-				g.Expect(result).To(BeNumerically("<", 0))
-			case "=":
-				g.Expect(result).To(Equal(0))
-			case ">":
-				g.Expect(result).To(BeNumerically(">", 0))
-			default:
-				t.Fatalf("invalid wantCmpSign %q", tt.wantCmpSign)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestGetEtcdSnapshotPolicy tests the GetEtcdSnapshotPolicy function
+func TestGetEtcdSnapshotPolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         map[string]string
+		expected        domain.EtcdSnapshotPolicy
+		wantErrContains string
+	}{
+		{
+			name:     "defaults",
+			options:  map[string]string{},
+			expected: domain.EtcdSnapshotPolicy{Dir: "opt/etcd-snapshots", Retention: 5},
+		},
+		{
+			name: "custom",
+			options: map[string]string{
+				"etcd_snapshot_dir":       "/var/lib/etcd-backups/",
+				"etcd_snapshot_retention": "10",
+			},
+			expected: domain.EtcdSnapshotPolicy{Dir: "var/lib/etcd-backups", Retention: 10},
+		},
+		{
+			name:            "dir_outside_root_path",
+			options:         map[string]string{"etcd_snapshot_dir": "../backups"},
+			wantErrContains: "invalid etcd_snapshot_dir",
+		},
+		{
+			name:            "root_path_dir",
+			options:         map[string]string{"etcd_snapshot_dir": "/"},
+			wantErrContains: "invalid etcd_snapshot_dir",
+		},
+		{
+			name:            "invalid_retention",
+			options:         map[string]string{"etcd_snapshot_retention": "0"},
+			wantErrContains: "invalid etcd_snapshot_retention",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetEtcdSnapshotPolicy(tt.options)
+
+			if tt.wantErrContains != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErrContains)))
+				return
 			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
 		})
 	}
 }
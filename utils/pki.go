@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+var caCertHashRegexp = regexp.MustCompile(`^sha256:[A-Fa-f0-9]{64}$`)
+
+// GetClusterPKI returns the CAs and service account key of the provider options, or nil when
+// kubeadm generates them. Init nodes need every CA with its key, joining nodes only read the
+// cluster CA certificate.
+func GetClusterPKI(options map[string]string, rootPath, nodeRole string) (*domain.ClusterPKI, error) {
+	var pki domain.ClusterPKI
+	var err error
+
+	if pki.CACert, err = readPEMOption(options, domain.CACertOption, rootPath); err != nil {
+		return nil, err
+	}
+
+	if nodeRole != clusterplugin.RoleInit {
+		if pki.CACert == "" {
+			return nil, nil
+		}
+		if _, err = parseCA(domain.CACertOption, pki.CACert); err != nil {
+			return nil, err
+		}
+		return &pki, nil
+	}
+
+	for _, option := range []struct {
+		name  string
+		value *string
+	}{
+		{domain.CAKeyOption, &pki.CAKey},
+		{domain.FrontProxyCACertOption, &pki.FrontProxyCACert},
+		{domain.FrontProxyCAKeyOption, &pki.FrontProxyCAKey},
+		{domain.EtcdCACertOption, &pki.EtcdCACert},
+		{domain.EtcdCAKeyOption, &pki.EtcdCAKey},
+		{domain.ServiceAccountKeyOption, &pki.ServiceAccountKey},
+	} {
+		if *option.value, err = readPEMOption(options, option.name, rootPath); err != nil {
+			return nil, err
+		}
+	}
+	if pki == (domain.ClusterPKI{}) {
+		return nil, nil
+	}
+
+	for _, pair := range [][4]string{
+		{domain.CACertOption, pki.CACert, domain.CAKeyOption, pki.CAKey},
+		{domain.FrontProxyCACertOption, pki.FrontProxyCACert, domain.FrontProxyCAKeyOption, pki.FrontProxyCAKey},
+		{domain.EtcdCACertOption, pki.EtcdCACert, domain.EtcdCAKeyOption, pki.EtcdCAKey},
+	} {
+		if err = validateCAKeyPair(pair[0], pair[1], pair[2], pair[3]); err != nil {
+			return nil, err
+		}
+	}
+
+	if pki.ServiceAccountKey != "" {
+		if _, err = GetServiceAccountPublicKey(pki.ServiceAccountKey); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", domain.ServiceAccountKeyOption, err)
+		}
+	}
+	return &pki, nil
+}
+
+// GetCACertHash returns the kubeadm discovery hash of a PEM encoded CA certificate.
+func GetCACertHash(certPEM string) (string, error) {
+	cert, err := parseCA(domain.CACertOption, certPEM)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(cert.RawSubjectPublicKeyInfo)), nil
+}
+
+// GetCACertHashes returns the cluster CA hashes of the provider options, in the sha256:<hex> format
+// of `kubeadm token create --print-join-command`. It is nil when joining nodes do not pin the CA.
+func GetCACertHashes(options map[string]string) ([]string, error) {
+	value := options[domain.CACertHashesOption]
+
+	var hashes []string
+	for _, hash := range strings.Split(value, ",") {
+		hash = strings.TrimSpace(hash)
+		if hash == "" {
+			continue
+		}
+		if !caCertHashRegexp.MatchString(hash) {
+			return nil, fmt.Errorf("invalid %s %q: %q is not a sha256:<hex> public key hash", domain.CACertHashesOption, value, hash)
+		}
+		hashes = append(hashes, strings.ToLower(hash))
+	}
+	return hashes, nil
+}
+
+// GetServiceAccountPublicKey returns the PEM encoded public key of an RSA or ECDSA service account key.
+func GetServiceAccountPublicKey(keyPEM string) (string, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return "", errors.New("must contain a PEM encoded private key")
+	}
+
+	var key crypto.Signer
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return "", errors.New("must be an RSA or ECDSA private key")
+		}
+		key = signer
+	} else if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else if parsed, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else {
+		return "", errors.New("must contain a PEM encoded private key")
+	}
+
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return "", errors.New("must be an RSA or ECDSA private key")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// GetLocalImagesPublicKey returns the PEM of the public key the local image archives are signed
+// with, or an empty string when their signature is not verified.
+func GetLocalImagesPublicKey(options map[string]string, rootPath string) (string, error) {
+	key, err := readPEMOption(options, domain.LocalImagesPublicKeyOption, rootPath)
+	if err != nil || key == "" {
+		return key, err
+	}
+	if _, err = ParsePublicKey(key); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", domain.LocalImagesPublicKeyOption, err)
+	}
+	return key, nil
+}
+
+// ParsePublicKey parses a PEM encoded ECDSA, RSA or Ed25519 public key, like the keys of
+// `cosign generate-key-pair`.
+func ParsePublicKey(keyPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("must contain a PEM encoded public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.New("must be an ECDSA, RSA or Ed25519 public key")
+	}
+}
+
+// readPEMOption returns the PEM of the option, reading it from the cluster root path unless the
+// option holds the PEM itself.
+func readPEMOption(options map[string]string, option, rootPath string) (string, error) {
+	value := strings.TrimSpace(options[option])
+	if value == "" || strings.HasPrefix(value, "-----BEGIN") {
+		return value, nil
+	}
+
+	path := filepath.Clean(strings.TrimPrefix(value, "/"))
+	if path == "." || path == ".." || strings.HasPrefix(path, "../") {
+		return "", fmt.Errorf("invalid %s %q: must be a PEM or a file under the cluster root path", option, value)
+	}
+
+	content, err := os.ReadFile(filepath.Join(rootPath, path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", option, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func parseCA(option, certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("invalid %s: must contain a PEM encoded certificate", option)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", option, err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("invalid %s: must be a CA certificate", option)
+	}
+	return cert, nil
+}
+
+// validateCAKeyPair checks that a CA is given with its key, and that the key matches.
+func validateCAKeyPair(certOption, certPEM, keyOption, keyPEM string) error {
+	switch {
+	case certPEM == "" && keyPEM == "":
+		return nil
+	case certPEM == "":
+		return fmt.Errorf("%s is required with %s", certOption, keyOption)
+	case keyPEM == "":
+		return fmt.Errorf("%s is required with %s", keyOption, certOption)
+	}
+
+	if _, err := parseCA(certOption, certPEM); err != nil {
+		return err
+	}
+	if _, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM)); err != nil {
+		return fmt.Errorf("invalid %s: must match %s", keyOption, certOption)
+	}
+	return nil
+}
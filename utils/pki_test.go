@@ -0,0 +1,327 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// testCA returns a PEM encoded self-signed certificate and its key.
+func testCA(t *testing.T, name string, isCA bool) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// TestGetClusterPKI tests the GetClusterPKI function
+func TestGetClusterPKI(t *testing.T) {
+	caCert, caKey := testCA(t, "kubernetes", true)
+	frontProxyCACert, frontProxyCAKey := testCA(t, "front-proxy-ca", true)
+	_, otherKey := testCA(t, "other", true)
+	leafCert, leafKey := testCA(t, "leaf", false)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+
+	rootPath := t.TempDir()
+	if err = os.MkdirAll(filepath.Join(rootPath, "opt/pki"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"ca.crt": caCert, "ca.key": caKey} {
+		if err = os.WriteFile(filepath.Join(rootPath, "opt/pki", name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		nodeRole      string
+		options       map[string]string
+		expected      *domain.ClusterPKI
+		expectedError string
+	}{
+		{
+			name:     "kubeadm_ca",
+			nodeRole: "init",
+			options:  map[string]string{},
+		},
+		{
+			name:     "pems",
+			nodeRole: "init",
+			options: map[string]string{
+				domain.CACertOption:            caCert,
+				domain.CAKeyOption:             caKey,
+				domain.FrontProxyCACertOption:  frontProxyCACert,
+				domain.FrontProxyCAKeyOption:   frontProxyCAKey,
+				domain.ServiceAccountKeyOption: saKey,
+			},
+			expected: &domain.ClusterPKI{
+				CACert:            trim(caCert),
+				CAKey:             trim(caKey),
+				FrontProxyCACert:  trim(frontProxyCACert),
+				FrontProxyCAKey:   trim(frontProxyCAKey),
+				ServiceAccountKey: trim(saKey),
+			},
+		},
+		{
+			name:     "paths_under_the_cluster_root",
+			nodeRole: "init",
+			options: map[string]string{
+				domain.CACertOption: "/opt/pki/ca.crt",
+				domain.CAKeyOption:  "opt/pki/ca.key",
+			},
+			expected: &domain.ClusterPKI{CACert: trim(caCert), CAKey: trim(caKey)},
+		},
+		{
+			name:     "joining_nodes_only_read_the_ca_certificate",
+			nodeRole: "worker",
+			options: map[string]string{
+				domain.CACertOption:            caCert,
+				domain.CAKeyOption:             "opt/pki/missing.key",
+				domain.ServiceAccountKeyOption: saKey,
+			},
+			expected: &domain.ClusterPKI{CACert: trim(caCert)},
+		},
+		{
+			name:          "path_outside_the_cluster_root",
+			nodeRole:      "init",
+			options:       map[string]string{domain.CACertOption: "../etc/pki/ca.crt"},
+			expectedError: `invalid ca_cert "../etc/pki/ca.crt": must be a PEM or a file under the cluster root path`,
+		},
+		{
+			name:          "missing_file",
+			nodeRole:      "init",
+			options:       map[string]string{domain.CACertOption: "opt/pki/missing.crt"},
+			expectedError: "failed to read ca_cert",
+		},
+		{
+			name:          "certificate_without_key",
+			nodeRole:      "init",
+			options:       map[string]string{domain.FrontProxyCACertOption: frontProxyCACert},
+			expectedError: "front_proxy_ca_key is required with front_proxy_ca_cert",
+		},
+		{
+			name:          "key_without_certificate",
+			nodeRole:      "init",
+			options:       map[string]string{domain.EtcdCAKeyOption: caKey},
+			expectedError: "etcd_ca_cert is required with etcd_ca_key",
+		},
+		{
+			name:          "key_does_not_match",
+			nodeRole:      "init",
+			options:       map[string]string{domain.CACertOption: caCert, domain.CAKeyOption: otherKey},
+			expectedError: "invalid ca_key: must match ca_cert",
+		},
+		{
+			name:          "not_a_ca",
+			nodeRole:      "controlplane",
+			options:       map[string]string{domain.CACertOption: leafCert, domain.CAKeyOption: leafKey},
+			expectedError: "invalid ca_cert: must be a CA certificate",
+		},
+		{
+			name:          "invalid_service_account_key",
+			nodeRole:      "init",
+			options:       map[string]string{domain.ServiceAccountKeyOption: caCert},
+			expectedError: "invalid service_account_key: must contain a PEM encoded private key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetClusterPKI(tt.options, rootPath, tt.nodeRole)
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.expectedError)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestGetCACertHash tests the GetCACertHash function
+func TestGetCACertHash(t *testing.T) {
+	g := NewWithT(t)
+
+	caCert, _ := testCA(t, "kubernetes", true)
+	block, _ := pem.Decode([]byte(caCert))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// the hash joining nodes pin is the kubeadm public key pin of the certificate
+	g.Expect(GetCACertHash(caCert)).To(Equal(fmt.Sprintf("sha256:%x", sha256.Sum256(cert.RawSubjectPublicKeyInfo))))
+
+	_, err = GetCACertHash("not a certificate")
+	g.Expect(err).To(HaveOccurred())
+}
+
+// TestGetCACertHashes tests the GetCACertHashes function
+func TestGetCACertHashes(t *testing.T) {
+	hash := "sha256:" + strings.Repeat("ab", 32)
+	otherHash := "sha256:" + strings.Repeat("01", 32)
+
+	tests := []struct {
+		name          string
+		options       map[string]string
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:    "not_pinned",
+			options: map[string]string{},
+		},
+		{
+			name:     "single",
+			options:  map[string]string{domain.CACertHashesOption: hash},
+			expected: []string{hash},
+		},
+		{
+			name:          "missing_prefix",
+			options:       map[string]string{domain.CACertHashesOption: " " + strings.ToUpper(hash[7:]) + ", " + otherHash + ","},
+			expectedError: "is not a sha256:<hex> public key hash",
+		},
+		{
+			name:     "list_with_uppercase",
+			options:  map[string]string{domain.CACertHashesOption: "sha256:" + strings.ToUpper(hash[7:]) + ", " + otherHash + ","},
+			expected: []string{hash, otherHash},
+		},
+		{
+			name:          "short_hash",
+			options:       map[string]string{domain.CACertHashesOption: "sha256:abcdef"},
+			expectedError: `invalid ca_cert_hashes "sha256:abcdef": "sha256:abcdef" is not a sha256:<hex> public key hash`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetCACertHashes(tt.options)
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.expectedError)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestGetServiceAccountPublicKey tests the GetServiceAccountPublicKey function
+func TestGetServiceAccountPublicKey(t *testing.T) {
+	g := NewWithT(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).ToNot(HaveOccurred())
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	pub, err := GetServiceAccountPublicKey(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	block, _ := pem.Decode([]byte(pub))
+	g.Expect(block.Type).To(Equal("PUBLIC KEY"))
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(parsed).To(Equal(&key.PublicKey))
+}
+
+// TestGetLocalImagesPublicKey tests the GetLocalImagesPublicKey function
+func TestGetLocalImagesPublicKey(t *testing.T) {
+	g := NewWithT(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).ToNot(HaveOccurred())
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	g.Expect(err).ToNot(HaveOccurred())
+	publicKey := trim(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+
+	rootPath := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(rootPath, "cosign.pub"), []byte(publicKey+"\n"), 0644)).To(Succeed())
+	_, caKey := testCA(t, "ca", true)
+
+	tests := []struct {
+		name            string
+		value           string
+		expected        string
+		wantErrContains string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:     "pem",
+			value:    publicKey,
+			expected: publicKey,
+		},
+		{
+			name:     "file",
+			value:    "/cosign.pub",
+			expected: publicKey,
+		},
+		{
+			name:            "private_key",
+			value:           caKey,
+			wantErrContains: "invalid local_images_public_key: must contain a PEM encoded public key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetLocalImagesPublicKey(map[string]string{domain.LocalImagesPublicKeyOption: tt.value}, rootPath)
+			if tt.wantErrContains != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErrContains)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+func trim(pem string) string {
+	return strings.TrimSpace(pem)
+}
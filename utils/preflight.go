@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kairos-io/kairos-sdk/clusterplugin"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+const (
+	// PreflightAll waives every kubeadm preflight check.
+	PreflightAll = "all"
+	// PreflightManifestsDir is the check that fails if the static pod manifests directory is not
+	// empty, as it is with the kube-vip manifest.
+	PreflightManifestsDir = "DirAvailable--etc-kubernetes-manifests"
+)
+
+var preflightCheckRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// GetIgnorePreflightErrors returns the preflight errors the provider ignores by default. Init nodes
+// ignore the CPU and memory checks, and every node ignores the manifests directory which holds the
+// kube-vip manifest. The provider option replaces the default, an empty value ignores nothing.
+// The manifests directory check is ignored anyway on nodes that write the kube-vip manifest.
+func GetIgnorePreflightErrors(options map[string]string, nodeRole string) ([]string, error) {
+	value, ok := options[domain.IgnorePreflightErrorsOption]
+	if !ok {
+		if nodeRole == clusterplugin.RoleInit {
+			return []string{"NumCPU", "Mem", PreflightManifestsDir}, nil
+		}
+		return []string{PreflightManifestsDir}, nil
+	}
+
+	checks := []string{}
+	for _, check := range strings.Split(value, ",") {
+		check = strings.TrimSpace(check)
+		if check == "" {
+			continue
+		}
+		if !preflightCheckRegexp.MatchString(check) {
+			return nil, fmt.Errorf("invalid %s %q: %q is not a preflight check name", domain.IgnorePreflightErrorsOption, value, check)
+		}
+		checks = append(checks, check)
+	}
+
+	if len(checks) > 1 && ContainsPreflightCheck(checks, PreflightAll) {
+		return nil, fmt.Errorf("invalid %s %q: %s cannot be combined with other checks", domain.IgnorePreflightErrorsOption, value, PreflightAll)
+	}
+	return checks, nil
+}
+
+// MergeIgnorePreflightErrors returns the union of the lists, in order and without duplicates.
+// Check names are case insensitive like in kubeadm, a list holding `all` collapses to it.
+func MergeIgnorePreflightErrors(lists ...[]string) []string {
+	var merged []string
+	for _, list := range lists {
+		for _, check := range list {
+			if strings.EqualFold(check, PreflightAll) {
+				return []string{PreflightAll}
+			}
+			if !ContainsPreflightCheck(merged, check) {
+				merged = append(merged, check)
+			}
+		}
+	}
+	return merged
+}
+
+// ContainsPreflightCheck reports whether the check is in the list, ignoring case.
+func ContainsPreflightCheck(checks []string, check string) bool {
+	for _, c := range checks {
+		if strings.EqualFold(c, check) {
+			return true
+		}
+	}
+	return false
+}
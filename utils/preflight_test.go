@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestGetIgnorePreflightErrors tests the GetIgnorePreflightErrors function
+func TestGetIgnorePreflightErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		nodeRole      string
+		options       map[string]string
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:     "init_default",
+			nodeRole: "init",
+			options:  map[string]string{},
+			expected: []string{"NumCPU", "Mem", "DirAvailable--etc-kubernetes-manifests"},
+		},
+		{
+			name:     "join_default",
+			nodeRole: "controlplane",
+			options:  map[string]string{},
+			expected: []string{"DirAvailable--etc-kubernetes-manifests"},
+		},
+		{
+			name:     "option_replaces_the_default",
+			nodeRole: "init",
+			options:  map[string]string{domain.IgnorePreflightErrorsOption: " Swap, Port-10250 ,"},
+			expected: []string{"Swap", "Port-10250"},
+		},
+		{
+			name:     "empty_option_ignores_nothing",
+			nodeRole: "worker",
+			options:  map[string]string{domain.IgnorePreflightErrorsOption: ""},
+			expected: []string{},
+		},
+		{
+			name:     "all",
+			nodeRole: "worker",
+			options:  map[string]string{domain.IgnorePreflightErrorsOption: "all"},
+			expected: []string{"all"},
+		},
+		{
+			name:          "all_combined_with_other_checks",
+			nodeRole:      "init",
+			options:       map[string]string{domain.IgnorePreflightErrorsOption: "Mem,all"},
+			expectedError: `invalid ignore_preflight_errors "Mem,all": all cannot be combined with other checks`,
+		},
+		{
+			name:          "invalid_check_name",
+			nodeRole:      "init",
+			options:       map[string]string{domain.IgnorePreflightErrorsOption: "Mem;reboot"},
+			expectedError: `invalid ignore_preflight_errors "Mem;reboot": "Mem;reboot" is not a preflight check name`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := GetIgnorePreflightErrors(tt.options, tt.nodeRole)
+			if tt.expectedError != "" {
+				g.Expect(err).To(MatchError(tt.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expected))
+		})
+	}
+}
+
+// TestMergeIgnorePreflightErrors tests the MergeIgnorePreflightErrors function
+func TestMergeIgnorePreflightErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		lists    [][]string
+		expected []string
+	}{
+		{
+			name:     "empty",
+			lists:    [][]string{nil, {}},
+			expected: nil,
+		},
+		{
+			name:     "union_without_duplicates",
+			lists:    [][]string{{"NumCPU", "Mem"}, {"mem", "Swap"}},
+			expected: []string{"NumCPU", "Mem", "Swap"},
+		},
+		{
+			name:     "all_collapses_the_list",
+			lists:    [][]string{{"NumCPU"}, {"ALL"}},
+			expected: []string{"all"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(MergeIgnorePreflightErrors(tt.lists...)).To(Equal(tt.expected))
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package utils
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/kairos-io/kairos/provider-kubeadm/domain"
 )
 
@@ -36,3 +41,18 @@ func GetDefaultNoProxy(clusterCtx *domain.ClusterContext) string {
 	}
 	return noProxy + "," + k8sNoProxy
 }
+
+// GetCommandEnv returns the environment for kubeadm and kubectl commands: the binaries under the
+// cluster root path are added to the PATH and the HTTP_PROXY, HTTPS_PROXY and NO_PROXY entries
+// of proxy are exported in upper and lower case.
+func GetCommandEnv(rootPath string, proxy map[string]string) []string {
+	env := os.Environ()
+	env = append(env, fmt.Sprintf("PATH=%s:%s:%s", os.Getenv("PATH"), filepath.Join(rootPath, "usr/bin"), filepath.Join(rootPath, "usr/local/bin")))
+
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		if value, ok := proxy[key]; ok {
+			env = append(env, key+"="+value, strings.ToLower(key)+"="+value)
+		}
+	}
+	return env
+}
@@ -157,3 +157,26 @@ func TestGetDefaultNoProxy(t *testing.T) {
 		})
 	}
 }
+
+// TestGetCommandEnv tests the GetCommandEnv function
+func TestGetCommandEnv(t *testing.T) {
+	g := NewWithT(t)
+
+	t.Setenv("PATH", "/usr/sbin")
+
+	env := GetCommandEnv("/persistent/spectro", nil)
+	g.Expect(env).To(ContainElement("PATH=/usr/sbin:/persistent/spectro/usr/bin:/persistent/spectro/usr/local/bin"))
+	g.Expect(env).ToNot(ContainElement(HavePrefix("https_proxy=")))
+
+	env = GetCommandEnv("/", map[string]string{
+		"HTTPS_PROXY": "http://proxy.example.com:8080",
+		"NO_PROXY":    ".svc",
+	})
+	g.Expect(env).To(ContainElements(
+		"HTTPS_PROXY=http://proxy.example.com:8080",
+		"https_proxy=http://proxy.example.com:8080",
+		"NO_PROXY=.svc",
+		"no_proxy=.svc",
+	))
+	g.Expect(env).ToNot(ContainElement(HavePrefix("http_proxy=")))
+}
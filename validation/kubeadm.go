@@ -0,0 +1,357 @@
+package validation
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+func ValidateKubeadmConfigBeta3(cfg *domain.KubeadmConfigBeta3) field.ErrorList {
+	var allErrs field.ErrorList
+
+	networking := cfg.ClusterConfiguration.Networking
+	allErrs = append(allErrs, ValidateNetworking(networking.PodSubnet, networking.ServiceSubnet, field.NewPath("clusterConfiguration", "networking"))...)
+	allErrs = append(allErrs, ValidateBindPort(cfg.InitConfiguration.LocalAPIEndpoint.BindPort, field.NewPath("initConfiguration", "localAPIEndpoint", "bindPort"))...)
+
+	if cfg.JoinConfiguration.ControlPlane != nil {
+		allErrs = append(allErrs, ValidateBindPort(cfg.JoinConfiguration.ControlPlane.LocalAPIEndpoint.BindPort, field.NewPath("joinConfiguration", "controlPlane", "localAPIEndpoint", "bindPort"))...)
+	}
+	allErrs = append(allErrs, ValidateIgnorePreflightErrors(cfg.InitConfiguration.NodeRegistration.IgnorePreflightErrors, field.NewPath("initConfiguration", "nodeRegistration", "ignorePreflightErrors"))...)
+	allErrs = append(allErrs, ValidateIgnorePreflightErrors(cfg.JoinConfiguration.NodeRegistration.IgnorePreflightErrors, field.NewPath("joinConfiguration", "nodeRegistration", "ignorePreflightErrors"))...)
+
+	etcd := cfg.ClusterConfiguration.Etcd
+	allErrs = append(allErrs, validateProviderConfiguration(&cfg.ProviderConfiguration, cfg.KubeletConfiguration.CgroupDriver, etcd.Local != nil, etcd.External != nil, domain.DefaultCertificateValidity)...)
+	return allErrs
+}
+
+func ValidateKubeadmConfigBeta4(cfg *domain.KubeadmConfigBeta4) field.ErrorList {
+	var allErrs field.ErrorList
+
+	networking := cfg.ClusterConfiguration.Networking
+	allErrs = append(allErrs, ValidateNetworking(networking.PodSubnet, networking.ServiceSubnet, field.NewPath("clusterConfiguration", "networking"))...)
+	allErrs = append(allErrs, ValidateBindPort(cfg.InitConfiguration.LocalAPIEndpoint.BindPort, field.NewPath("initConfiguration", "localAPIEndpoint", "bindPort"))...)
+
+	if cfg.JoinConfiguration.ControlPlane != nil {
+		allErrs = append(allErrs, ValidateBindPort(cfg.JoinConfiguration.ControlPlane.LocalAPIEndpoint.BindPort, field.NewPath("joinConfiguration", "controlPlane", "localAPIEndpoint", "bindPort"))...)
+	}
+	allErrs = append(allErrs, ValidateIgnorePreflightErrors(cfg.InitConfiguration.NodeRegistration.IgnorePreflightErrors, field.NewPath("initConfiguration", "nodeRegistration", "ignorePreflightErrors"))...)
+	allErrs = append(allErrs, ValidateIgnorePreflightErrors(cfg.JoinConfiguration.NodeRegistration.IgnorePreflightErrors, field.NewPath("joinConfiguration", "nodeRegistration", "ignorePreflightErrors"))...)
+
+	validity := domain.DefaultCertificateValidity
+	if cfg.ClusterConfiguration.CertificateValidityPeriod != nil {
+		validity = cfg.ClusterConfiguration.CertificateValidityPeriod.Duration
+	}
+	etcd := cfg.ClusterConfiguration.Etcd
+	allErrs = append(allErrs, validateProviderConfiguration(&cfg.ProviderConfiguration, cfg.KubeletConfiguration.CgroupDriver, etcd.Local != nil, etcd.External != nil, validity)...)
+	return allErrs
+}
+
+// validateProviderConfiguration validates the provider owned blocks of the cluster config against
+// the kubeadm configuration they are used with.
+func validateProviderConfiguration(cfg *domain.ProviderConfiguration, kubeletCgroupDriver string, localEtcd, externalEtcd bool, certificateValidity time.Duration) field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, ValidateDrain(&cfg.Drain, field.NewPath("drain"))...)
+	allErrs = append(allErrs, ValidateEtcdBackup(cfg.EtcdBackup, field.NewPath("etcdBackup"))...)
+	allErrs = append(allErrs, ValidateExternalEtcd(cfg.ExternalEtcd, field.NewPath("externalEtcd"))...)
+	allErrs = append(allErrs, validateEtcdTopology(cfg.ExternalEtcd, cfg.EtcdBackup, localEtcd, externalEtcd)...)
+	allErrs = append(allErrs, ValidateCertificateRenewal(&cfg.CertificateRenewal, certificateValidity, field.NewPath("certificateRenewal"))...)
+	allErrs = append(allErrs, ValidateRegistries(cfg.Registries, field.NewPath("registries"))...)
+	allErrs = append(allErrs, ValidateContainerd(cfg.Containerd, kubeletCgroupDriver, field.NewPath("containerd"))...)
+	return allErrs
+}
+
+// ValidateNetworking checks that the pod and service subnets are valid,
+// optionally dual-stack, CIDRs and that they do not overlap.
+func ValidateNetworking(podSubnet, serviceSubnet string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	podCidrs, errs := parseCidrs(podSubnet, fldPath.Child("podSubnet"))
+	allErrs = append(allErrs, errs...)
+
+	serviceCidrs, errs := parseCidrs(serviceSubnet, fldPath.Child("serviceSubnet"))
+	allErrs = append(allErrs, errs...)
+
+	for _, serviceCidr := range serviceCidrs {
+		for _, podCidr := range podCidrs {
+			if serviceCidr.Contains(podCidr.IP) || podCidr.Contains(serviceCidr.IP) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("serviceSubnet"), serviceSubnet, fmt.Sprintf("overlaps with podSubnet %s", podCidr.String())))
+			}
+		}
+	}
+	return allErrs
+}
+
+// ValidateDrain checks that the drain timeout is not negative.
+func ValidateDrain(drain *domain.DrainConfiguration, fldPath *field.Path) field.ErrorList {
+	if drain.Timeout != nil && drain.Timeout.Duration < 0 {
+		return field.ErrorList{field.Invalid(fldPath.Child("timeout"), drain.Timeout.Duration.String(), "must not be negative")}
+	}
+	return nil
+}
+
+// ValidateCertificateRenewal checks that the renewal window is at least an hour and shorter than
+// the certificate validity, otherwise the certificates would be renewed on every boot.
+func ValidateCertificateRenewal(renewal *domain.CertificateRenewalConfiguration, validity time.Duration, fldPath *field.Path) field.ErrorList {
+	if renewal.RenewBefore == nil {
+		return nil
+	}
+	if renewBefore := renewal.RenewBefore.Duration; renewBefore < time.Hour || renewBefore >= validity {
+		return field.ErrorList{field.Invalid(fldPath.Child("renewBefore"), renewBefore.String(), fmt.Sprintf("must be at least 1h and shorter than the certificate validity of %s", validity))}
+	}
+	return nil
+}
+
+// ValidateEtcdBackup checks the backup schedule, directory and retention, and that an S3 upload
+// has an http(s) endpoint, a bucket and credentials.
+func ValidateEtcdBackup(backup *domain.EtcdBackupConfiguration, fldPath *field.Path) field.ErrorList {
+	if backup == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	if backup.Interval != nil && backup.Interval.Duration < time.Minute {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("interval"), backup.Interval.Duration.String(), "must be at least 1m"))
+	}
+	if backup.Dir != "" {
+		dir := filepath.Clean(strings.TrimPrefix(backup.Dir, "/"))
+		if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("dir"), backup.Dir, "must be a directory under the cluster root path"))
+		}
+	}
+	if backup.Retention != nil && *backup.Retention < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retention"), *backup.Retention, "must be at least 1"))
+	}
+
+	if s3 := backup.S3; s3 != nil {
+		s3Path := fldPath.Child("s3")
+		if endpoint, err := url.Parse(s3.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			allErrs = append(allErrs, field.Invalid(s3Path.Child("endpoint"), s3.Endpoint, "must be an http or https URL"))
+		}
+		if s3.Bucket == "" {
+			allErrs = append(allErrs, field.Required(s3Path.Child("bucket"), ""))
+		}
+		if s3.AccessKeyID == "" {
+			allErrs = append(allErrs, field.Required(s3Path.Child("accessKeyID"), ""))
+		}
+		if s3.SecretAccessKey == "" {
+			allErrs = append(allErrs, field.Required(s3Path.Child("secretAccessKey"), ""))
+		}
+	}
+	return allErrs
+}
+
+// ValidateExternalEtcd checks that the endpoints are https URLs, and that the client certificate
+// matches its key and is a client certificate signed by the CA.
+func ValidateExternalEtcd(external *domain.ExternalEtcdConfiguration, fldPath *field.Path) field.ErrorList {
+	if external == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	if len(external.Endpoints) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("endpoints"), ""))
+	}
+	for i, endpoint := range external.Endpoints {
+		if u, err := url.Parse(endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("endpoints").Index(i), endpoint, "must be an https URL"))
+		}
+	}
+
+	for _, pem := range []struct{ name, value string }{
+		{"caCert", external.CACert},
+		{"clientCert", external.ClientCert},
+		{"clientKey", external.ClientKey},
+	} {
+		if pem.value == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child(pem.name), "PEM encoded"))
+		}
+	}
+	if external.CACert == "" || external.ClientCert == "" || external.ClientKey == "" {
+		return allErrs
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(external.CACert)) {
+		return append(allErrs, field.Invalid(fldPath.Child("caCert"), "<PEM>", "must contain a PEM encoded certificate"))
+	}
+	pair, err := tls.X509KeyPair([]byte(external.ClientCert), []byte(external.ClientKey))
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath.Child("clientKey"), "<PEM>", fmt.Sprintf("must match clientCert: %v", err)))
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err == nil {
+		_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	}
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("clientCert"), "<PEM>", fmt.Sprintf("must be a valid client certificate signed by caCert: %v", err)))
+	}
+	return allErrs
+}
+
+// validateEtcdTopology rejects an externalEtcd block next to an etcd in clusterConfiguration, and
+// scheduled backups of an external etcd, which can only snapshot the local member.
+func validateEtcdTopology(externalEtcd *domain.ExternalEtcdConfiguration, backup *domain.EtcdBackupConfiguration, local, external bool) field.ErrorList {
+	var allErrs field.ErrorList
+	if externalEtcd != nil && (local || external) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("clusterConfiguration", "etcd"), "must not be set together with externalEtcd"))
+	}
+	if backup != nil && (externalEtcd != nil || external) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("etcdBackup"), "needs a local etcd, back up the external etcd cluster instead"))
+	}
+	return allErrs
+}
+
+// ValidateContainerd checks the cgroup driver, which must not differ from the one of the kubelet
+// configuration, the root and registry config paths, the sandbox image and the runtime handlers.
+func ValidateContainerd(containerd *domain.ContainerdConfiguration, kubeletCgroupDriver string, fldPath *field.Path) field.ErrorList {
+	if containerd == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+
+	drivers := []string{"systemd", "cgroupfs"}
+	if containerd.CgroupDriver != "" && !slices.Contains(drivers, containerd.CgroupDriver) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("cgroupDriver"), containerd.CgroupDriver, drivers))
+	} else if containerd.CgroupDriver != "" && kubeletCgroupDriver != "" && containerd.CgroupDriver != kubeletCgroupDriver {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("cgroupDriver"), containerd.CgroupDriver, fmt.Sprintf("must match the kubeletConfiguration.cgroupDriver %s", kubeletCgroupDriver)))
+	}
+
+	if containerd.SandboxImage != "" {
+		if _, err := reference.ParseNormalizedNamed(containerd.SandboxImage); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("sandboxImage"), containerd.SandboxImage, err.Error()))
+		}
+	}
+	if containerd.Root != "" && !filepath.IsAbs(containerd.Root) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("root"), containerd.Root, "must be an absolute path"))
+	}
+	if containerd.RegistryConfigPath != "" && !filepath.IsAbs(containerd.RegistryConfigPath) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("registryConfigPath"), containerd.RegistryConfigPath, "must be an absolute path"))
+	}
+
+	seen := map[string]bool{}
+	for i, runtime := range containerd.Runtimes {
+		runtimePath := fldPath.Child("runtimes").Index(i)
+		if runtime.Name == "" {
+			allErrs = append(allErrs, field.Required(runtimePath.Child("name"), ""))
+		} else if errs := validation.IsDNS1123Label(runtime.Name); len(errs) > 0 {
+			allErrs = append(allErrs, field.Invalid(runtimePath.Child("name"), runtime.Name, strings.Join(errs, ", ")))
+		} else if seen[runtime.Name] {
+			allErrs = append(allErrs, field.Duplicate(runtimePath.Child("name"), runtime.Name))
+		}
+		seen[runtime.Name] = true
+
+		if runtime.BinaryName != "" && !filepath.IsAbs(runtime.BinaryName) {
+			allErrs = append(allErrs, field.Invalid(runtimePath.Child("binaryName"), runtime.BinaryName, "must be an absolute path"))
+		}
+	}
+	if containerd.DefaultRuntime != "" && containerd.DefaultRuntime != domain.DefaultContainerdRuntime && !seen[containerd.DefaultRuntime] {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("defaultRuntime"), containerd.DefaultRuntime, "must be runc or the name of a runtime"))
+	}
+	return allErrs
+}
+
+// ValidateRegistries checks that every upstream is a registry host configured once, that the
+// mirrors are http(s) URLs with known capabilities, and the CA bundles and credentials.
+func ValidateRegistries(registries []domain.RegistryConfiguration, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := map[string]bool{}
+	for i, registry := range registries {
+		registryPath := fldPath.Index(i)
+		if registry.Upstream == "" {
+			allErrs = append(allErrs, field.Required(registryPath.Child("upstream"), ""))
+		} else if u, err := url.Parse("//" + registry.Upstream); registry.Upstream != "_default" && (err != nil || u.Host != registry.Upstream || u.Hostname() == "") {
+			allErrs = append(allErrs, field.Invalid(registryPath.Child("upstream"), registry.Upstream, "must be a registry host with an optional port, or _default"))
+		} else if seen[registry.Upstream] {
+			allErrs = append(allErrs, field.Duplicate(registryPath.Child("upstream"), registry.Upstream))
+		}
+		seen[registry.Upstream] = true
+		if registry.Upstream == "_default" && registry.PlainHTTP {
+			allErrs = append(allErrs, field.Forbidden(registryPath.Child("plainHTTP"), "cannot be used for _default"))
+		}
+
+		allErrs = append(allErrs, validateRegistryHost(registry.CABundle, registry.Auth, registryPath)...)
+
+		for j, mirror := range registry.Mirrors {
+			mirrorPath := registryPath.Child("mirrors").Index(j)
+			if u, err := url.Parse(mirror.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				allErrs = append(allErrs, field.Invalid(mirrorPath.Child("endpoint"), mirror.Endpoint, "must be an http or https URL"))
+			}
+			for k, capability := range mirror.Capabilities {
+				if capability != "pull" && capability != "resolve" && capability != "push" {
+					allErrs = append(allErrs, field.NotSupported(mirrorPath.Child("capabilities").Index(k), capability, []string{"pull", "resolve", "push"}))
+				}
+			}
+			allErrs = append(allErrs, validateRegistryHost(mirror.CABundle, mirror.Auth, mirrorPath)...)
+		}
+	}
+	return allErrs
+}
+
+func validateRegistryHost(caBundle string, auth *domain.RegistryAuth, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if caBundle != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(caBundle)) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("caBundle"), "<PEM>", "must contain a PEM encoded certificate"))
+	}
+	if auth != nil {
+		if auth.Username == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("auth", "username"), ""))
+		}
+		if auth.Password == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("auth", "password"), ""))
+		}
+	}
+	return allErrs
+}
+
+// ValidateIgnorePreflightErrors checks that `all` is not combined with other checks, which
+// kubeadm rejects.
+func ValidateIgnorePreflightErrors(checks []string, fldPath *field.Path) field.ErrorList {
+	for _, check := range checks {
+		if len(checks) > 1 && strings.EqualFold(check, "all") {
+			return field.ErrorList{field.Invalid(fldPath, strings.Join(checks, ","), "all cannot be combined with other checks")}
+		}
+	}
+	return nil
+}
+
+// ValidateBindPort checks that a bind port is either unset, which selects the default port, or a valid TCP port.
+func ValidateBindPort(port int32, fldPath *field.Path) field.ErrorList {
+	if port < 0 || port > 65535 {
+		return field.ErrorList{field.Invalid(fldPath, port, "must be between 1 and 65535, or 0 for the default port")}
+	}
+	return nil
+}
+
+func parseCidrs(subnets string, fldPath *field.Path) ([]*net.IPNet, field.ErrorList) {
+	var cidrs []*net.IPNet
+	var allErrs field.ErrorList
+
+	if subnets == "" {
+		return nil, nil
+	}
+
+	for _, subnet := range strings.Split(subnets, ",") {
+		_, cidr, err := net.ParseCIDR(strings.TrimSpace(subnet))
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath, subnets, fmt.Sprintf("%q is not a valid CIDR", subnet)))
+			continue
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, allErrs
+}
@@ -0,0 +1,540 @@
+package validation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kubeadmapiv4 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+	"k8s.io/utils/ptr"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestValidateNetworking tests the ValidateNetworking function
+func TestValidateNetworking(t *testing.T) {
+	tests := []struct {
+		name           string
+		podSubnet      string
+		serviceSubnet  string
+		expectedErrors []string
+	}{
+		{
+			name:          "valid_subnets",
+			podSubnet:     "10.244.0.0/16",
+			serviceSubnet: "10.96.0.0/12",
+		},
+		{
+			name: "empty_subnets",
+		},
+		{
+			name:          "valid_dual_stack",
+			podSubnet:     "10.244.0.0/16,fd00:10:244::/56",
+			serviceSubnet: "10.96.0.0/12,fd00:10:96::/112",
+		},
+		{
+			name:           "invalid_pod_subnet",
+			podSubnet:      "10.244.0.0/33",
+			serviceSubnet:  "10.96.0.0/12",
+			expectedErrors: []string{"networking.podSubnet: Invalid value: \"10.244.0.0/33\""},
+		},
+		{
+			name:           "invalid_service_subnet",
+			podSubnet:      "10.244.0.0/16",
+			serviceSubnet:  "10.96.0.0",
+			expectedErrors: []string{"networking.serviceSubnet: Invalid value: \"10.96.0.0\""},
+		},
+		{
+			name:           "overlapping_subnets",
+			podSubnet:      "10.0.0.0/8",
+			serviceSubnet:  "10.96.0.0/12",
+			expectedErrors: []string{"networking.serviceSubnet: Invalid value: \"10.96.0.0/12\": overlaps with podSubnet 10.0.0.0/8"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := ValidateNetworking(tt.podSubnet, tt.serviceSubnet, field.NewPath("networking"))
+
+			g.Expect(errs).To(HaveLen(len(tt.expectedErrors)))
+			for i, expected := range tt.expectedErrors {
+				g.Expect(errs[i].Error()).To(ContainSubstring(expected))
+			}
+		})
+	}
+}
+
+// TestValidateBindPort tests the ValidateBindPort function
+func TestValidateBindPort(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ValidateBindPort(0, field.NewPath("bindPort"))).To(BeEmpty())
+	g.Expect(ValidateBindPort(6443, field.NewPath("bindPort"))).To(BeEmpty())
+	g.Expect(ValidateBindPort(-1, field.NewPath("bindPort"))).To(HaveLen(1))
+	g.Expect(ValidateBindPort(70000, field.NewPath("bindPort"))).To(ConsistOf(
+		field.Invalid(field.NewPath("bindPort"), int32(70000), "must be between 1 and 65535, or 0 for the default port"),
+	))
+}
+
+// TestValidateIgnorePreflightErrors tests the ValidateIgnorePreflightErrors function
+func TestValidateIgnorePreflightErrors(t *testing.T) {
+	g := NewWithT(t)
+	fldPath := field.NewPath("initConfiguration", "nodeRegistration", "ignorePreflightErrors")
+
+	g.Expect(ValidateIgnorePreflightErrors(nil, fldPath)).To(BeEmpty())
+	g.Expect(ValidateIgnorePreflightErrors([]string{"all"}, fldPath)).To(BeEmpty())
+	g.Expect(ValidateIgnorePreflightErrors([]string{"NumCPU", "Mem"}, fldPath)).To(BeEmpty())
+
+	errs := ValidateIgnorePreflightErrors([]string{"Mem", "All"}, fldPath)
+	g.Expect(errs).To(HaveLen(1))
+	g.Expect(errs[0].Error()).To(Equal(`initConfiguration.nodeRegistration.ignorePreflightErrors: Invalid value: "Mem,All": all cannot be combined with other checks`))
+}
+
+// TestValidateCertificateRenewal tests the ValidateCertificateRenewal function
+func TestValidateCertificateRenewal(t *testing.T) {
+	g := NewWithT(t)
+	validity := 365 * 24 * time.Hour
+	renewal := func(d time.Duration) *domain.CertificateRenewalConfiguration {
+		return &domain.CertificateRenewalConfiguration{RenewBefore: &metav1.Duration{Duration: d}}
+	}
+
+	g.Expect(ValidateCertificateRenewal(&domain.CertificateRenewalConfiguration{}, validity, field.NewPath("certificateRenewal"))).To(BeEmpty())
+	g.Expect(ValidateCertificateRenewal(renewal(720*time.Hour), validity, field.NewPath("certificateRenewal"))).To(BeEmpty())
+	g.Expect(ValidateCertificateRenewal(renewal(time.Minute), validity, field.NewPath("certificateRenewal"))).To(HaveLen(1))
+
+	errs := ValidateCertificateRenewal(renewal(validity), validity, field.NewPath("certificateRenewal"))
+	g.Expect(errs).To(HaveLen(1))
+	g.Expect(errs[0].Error()).To(Equal(`certificateRenewal.renewBefore: Invalid value: "8760h0m0s": must be at least 1h and shorter than the certificate validity of 8760h0m0s`))
+}
+
+// TestValidateEtcdBackup tests the ValidateEtcdBackup function
+func TestValidateEtcdBackup(t *testing.T) {
+	tests := []struct {
+		name           string
+		backup         *domain.EtcdBackupConfiguration
+		expectedFields []string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:   "defaults",
+			backup: &domain.EtcdBackupConfiguration{},
+		},
+		{
+			name: "valid_s3",
+			backup: &domain.EtcdBackupConfiguration{
+				Interval:  &metav1.Duration{Duration: time.Hour},
+				Dir:       "/var/lib/etcd-backups",
+				Retention: ptr.To(3),
+				S3: &domain.S3Configuration{
+					Endpoint:        "http://minio.local:9000",
+					Bucket:          "etcd",
+					AccessKeyID:     "minio",
+					SecretAccessKey: "minio123",
+				},
+			},
+		},
+		{
+			name: "invalid_schedule",
+			backup: &domain.EtcdBackupConfiguration{
+				Interval:  &metav1.Duration{Duration: time.Second},
+				Dir:       "../etc",
+				Retention: ptr.To(0),
+			},
+			expectedFields: []string{"etcdBackup.interval", "etcdBackup.dir", "etcdBackup.retention"},
+		},
+		{
+			name: "incomplete_s3",
+			backup: &domain.EtcdBackupConfiguration{
+				S3: &domain.S3Configuration{Endpoint: "minio.local:9000"},
+			},
+			expectedFields: []string{"etcdBackup.s3.endpoint", "etcdBackup.s3.bucket", "etcdBackup.s3.accessKeyID", "etcdBackup.s3.secretAccessKey"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := ValidateEtcdBackup(tt.backup, field.NewPath("etcdBackup"))
+
+			g.Expect(errs).To(HaveLen(len(tt.expectedFields)))
+			for i, expected := range tt.expectedFields {
+				g.Expect(errs[i].Field).To(Equal(expected))
+			}
+		})
+	}
+}
+
+// testCertificate returns a PEM encoded certificate and key, signed by the parent or self-signed.
+func testCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// TestValidateExternalEtcd tests the ValidateExternalEtcd function
+func TestValidateExternalEtcd(t *testing.T) {
+	ca := func(name string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+	}
+	client := func(usage x509.ExtKeyUsage) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "kube-apiserver-etcd-client"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+	}
+
+	caCert, caKey, caPEM, _ := testCertificate(t, ca("etcd-ca"), nil, nil)
+	_, _, clientPEM, clientKeyPEM := testCertificate(t, client(x509.ExtKeyUsageClientAuth), caCert, caKey)
+	_, _, serverPEM, serverKeyPEM := testCertificate(t, client(x509.ExtKeyUsageServerAuth), caCert, caKey)
+	_, _, otherCAPEM, _ := testCertificate(t, ca("other-ca"), nil, nil)
+	_, _, _, otherKeyPEM := testCertificate(t, client(x509.ExtKeyUsageClientAuth), caCert, caKey)
+
+	tests := []struct {
+		name           string
+		external       *domain.ExternalEtcdConfiguration
+		expectedErrors []string
+	}{
+		{
+			name: "local_etcd",
+		},
+		{
+			name: "valid",
+			external: &domain.ExternalEtcdConfiguration{
+				Endpoints:  []string{"https://10.0.0.5:2379", "https://etcd-2.example.com:2379"},
+				CACert:     caPEM,
+				ClientCert: clientPEM,
+				ClientKey:  clientKeyPEM,
+			},
+		},
+		{
+			name:     "missing_endpoints_and_certificates",
+			external: &domain.ExternalEtcdConfiguration{},
+			expectedErrors: []string{
+				"externalEtcd.endpoints: Required value",
+				"externalEtcd.caCert: Required value",
+				"externalEtcd.clientCert: Required value",
+				"externalEtcd.clientKey: Required value",
+			},
+		},
+		{
+			name: "plain_http_endpoint",
+			external: &domain.ExternalEtcdConfiguration{
+				Endpoints:  []string{"http://10.0.0.5:2379"},
+				CACert:     caPEM,
+				ClientCert: clientPEM,
+				ClientKey:  clientKeyPEM,
+			},
+			expectedErrors: []string{`externalEtcd.endpoints[0]: Invalid value: "http://10.0.0.5:2379": must be an https URL`},
+		},
+		{
+			name: "key_of_another_certificate",
+			external: &domain.ExternalEtcdConfiguration{
+				Endpoints:  []string{"https://10.0.0.5:2379"},
+				CACert:     caPEM,
+				ClientCert: clientPEM,
+				ClientKey:  otherKeyPEM,
+			},
+			expectedErrors: []string{"externalEtcd.clientKey: Invalid value: \"<PEM>\": must match clientCert"},
+		},
+		{
+			name: "signed_by_another_ca",
+			external: &domain.ExternalEtcdConfiguration{
+				Endpoints:  []string{"https://10.0.0.5:2379"},
+				CACert:     otherCAPEM,
+				ClientCert: clientPEM,
+				ClientKey:  clientKeyPEM,
+			},
+			expectedErrors: []string{"externalEtcd.clientCert: Invalid value: \"<PEM>\": must be a valid client certificate signed by caCert"},
+		},
+		{
+			name: "server_certificate",
+			external: &domain.ExternalEtcdConfiguration{
+				Endpoints:  []string{"https://10.0.0.5:2379"},
+				CACert:     caPEM,
+				ClientCert: serverPEM,
+				ClientKey:  serverKeyPEM,
+			},
+			expectedErrors: []string{"externalEtcd.clientCert: Invalid value: \"<PEM>\": must be a valid client certificate signed by caCert"},
+		},
+		{
+			name: "invalid_ca",
+			external: &domain.ExternalEtcdConfiguration{
+				Endpoints:  []string{"https://10.0.0.5:2379"},
+				CACert:     "not a certificate",
+				ClientCert: clientPEM,
+				ClientKey:  clientKeyPEM,
+			},
+			expectedErrors: []string{"externalEtcd.caCert: Invalid value: \"<PEM>\": must contain a PEM encoded certificate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := ValidateExternalEtcd(tt.external, field.NewPath("externalEtcd"))
+
+			g.Expect(errs).To(HaveLen(len(tt.expectedErrors)))
+			for i, expected := range tt.expectedErrors {
+				g.Expect(errs[i].Error()).To(ContainSubstring(expected))
+			}
+		})
+	}
+}
+
+// TestValidateContainerd tests the ValidateContainerd function
+func TestValidateContainerd(t *testing.T) {
+	tests := []struct {
+		name                string
+		containerd          *domain.ContainerdConfiguration
+		kubeletCgroupDriver string
+		expectedErrors      []string
+	}{
+		{
+			name: "no_block",
+		},
+		{
+			name:       "defaults",
+			containerd: &domain.ContainerdConfiguration{},
+		},
+		{
+			name: "valid",
+			containerd: &domain.ContainerdConfiguration{
+				Root:               "/var/lib/containerd",
+				CgroupDriver:       "cgroupfs",
+				SandboxImage:       "registry.local:5000/k8s/pause:3.10",
+				RegistryConfigPath: "/etc/registries",
+				DefaultRuntime:     "nvidia",
+				Runtimes: []domain.ContainerdRuntime{
+					{Name: "runc", BinaryName: "/usr/sbin/runc"},
+					{Name: "nvidia", BinaryName: "/usr/bin/nvidia-container-runtime"},
+				},
+			},
+			kubeletCgroupDriver: "cgroupfs",
+		},
+		{
+			name:                "cgroup_driver_of_the_kubelet",
+			containerd:          &domain.ContainerdConfiguration{CgroupDriver: "systemd"},
+			kubeletCgroupDriver: "cgroupfs",
+			expectedErrors:      []string{`containerd.cgroupDriver: Invalid value: "systemd": must match the kubeletConfiguration.cgroupDriver cgroupfs`},
+		},
+		{
+			name: "invalid",
+			containerd: &domain.ContainerdConfiguration{
+				Root:               "opt/containerd",
+				CgroupDriver:       "cgroupv2",
+				SandboxImage:       "Registry/Pause",
+				RegistryConfigPath: "certs.d",
+				DefaultRuntime:     "kata",
+				Runtimes: []domain.ContainerdRuntime{
+					{BinaryName: "/usr/bin/runsc"},
+					{Name: "Nvidia"},
+					{Name: "gvisor", BinaryName: "runsc"},
+					{Name: "gvisor"},
+				},
+			},
+			expectedErrors: []string{
+				`containerd.cgroupDriver: Unsupported value: "cgroupv2"`,
+				`containerd.sandboxImage: Invalid value: "Registry/Pause"`,
+				`containerd.root: Invalid value: "opt/containerd": must be an absolute path`,
+				`containerd.registryConfigPath: Invalid value: "certs.d": must be an absolute path`,
+				`containerd.runtimes[0].name: Required value`,
+				`containerd.runtimes[1].name: Invalid value: "Nvidia"`,
+				`containerd.runtimes[2].binaryName: Invalid value: "runsc": must be an absolute path`,
+				`containerd.runtimes[3].name: Duplicate value: "gvisor"`,
+				`containerd.defaultRuntime: Invalid value: "kata": must be runc or the name of a runtime`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := ValidateContainerd(tt.containerd, tt.kubeletCgroupDriver, field.NewPath("containerd"))
+
+			g.Expect(errs).To(HaveLen(len(tt.expectedErrors)))
+			for i, expected := range tt.expectedErrors {
+				g.Expect(errs[i].Error()).To(ContainSubstring(expected))
+			}
+		})
+	}
+}
+
+// TestValidateRegistries tests the ValidateRegistries function
+func TestValidateRegistries(t *testing.T) {
+	_, _, caPEM, _ := testCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "registry-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+
+	tests := []struct {
+		name           string
+		registries     []domain.RegistryConfiguration
+		expectedFields []string
+	}{
+		{
+			name: "valid",
+			registries: []domain.RegistryConfiguration{
+				{
+					Upstream: "docker.io",
+					Mirrors:  []domain.RegistryMirror{{Endpoint: "https://mirror.local", Capabilities: []string{"pull", "resolve"}, CABundle: caPEM}},
+				},
+				{Upstream: "registry.local:5000", CABundle: caPEM, Auth: &domain.RegistryAuth{Username: "admin", Password: "secret"}},
+				{Upstream: "[fd00::5]:5000", PlainHTTP: true},
+				{Upstream: "_default", Mirrors: []domain.RegistryMirror{{Endpoint: "http://10.0.0.5:5000"}}},
+			},
+		},
+		{
+			name: "invalid_upstreams",
+			registries: []domain.RegistryConfiguration{
+				{},
+				{Upstream: "https://registry.local"},
+				{Upstream: "registry.local/library"},
+				{Upstream: "docker.io"},
+				{Upstream: "docker.io"},
+				{Upstream: "_default", PlainHTTP: true},
+			},
+			expectedFields: []string{"registries[0].upstream", "registries[1].upstream", "registries[2].upstream", "registries[4].upstream", "registries[5].plainHTTP"},
+		},
+		{
+			name: "invalid_mirrors_and_credentials",
+			registries: []domain.RegistryConfiguration{
+				{
+					Upstream: "docker.io",
+					CABundle: "not a certificate",
+					Auth:     &domain.RegistryAuth{Username: "admin"},
+					Mirrors: []domain.RegistryMirror{
+						{Endpoint: "mirror.local"},
+						{Endpoint: "https://mirror.local", Capabilities: []string{"pull", "delete"}, Auth: &domain.RegistryAuth{Password: "secret"}},
+					},
+				},
+			},
+			expectedFields: []string{
+				"registries[0].caBundle",
+				"registries[0].auth.password",
+				"registries[0].mirrors[0].endpoint",
+				"registries[0].mirrors[1].capabilities[1]",
+				"registries[0].mirrors[1].auth.username",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := ValidateRegistries(tt.registries, field.NewPath("registries"))
+
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			g.Expect(fields).To(Equal(tt.expectedFields))
+		})
+	}
+}
+
+// TestValidateEtcdTopology tests that external etcd conflicts with a local etcd and scheduled backups
+func TestValidateEtcdTopology(t *testing.T) {
+	g := NewWithT(t)
+
+	cfg := domain.KubeadmConfigBeta4{}
+	cfg.ClusterConfiguration.Etcd.Local = &kubeadmapiv4.LocalEtcd{DataDir: "/var/lib/etcd"}
+	cfg.ExternalEtcd = &domain.ExternalEtcdConfiguration{}
+	cfg.EtcdBackup = &domain.EtcdBackupConfiguration{}
+
+	errs := ValidateKubeadmConfigBeta4(&cfg)
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	g.Expect(fields).To(ContainElements("clusterConfiguration.etcd", "etcdBackup"))
+
+	// external etcd configured in the kubeadm cluster configuration
+	cfg = domain.KubeadmConfigBeta4{}
+	cfg.ClusterConfiguration.Etcd.External = &kubeadmapiv4.ExternalEtcd{Endpoints: []string{"https://10.0.0.5:2379"}}
+	g.Expect(ValidateKubeadmConfigBeta4(&cfg)).To(BeEmpty())
+	cfg.EtcdBackup = &domain.EtcdBackupConfiguration{}
+	errs = ValidateKubeadmConfigBeta4(&cfg)
+	g.Expect(errs).To(HaveLen(1))
+	g.Expect(errs[0].Field).To(Equal("etcdBackup"))
+}
+
+// TestValidateKubeadmConfigBeta4 tests the ValidateKubeadmConfigBeta4 function
+func TestValidateKubeadmConfigBeta4(t *testing.T) {
+	g := NewWithT(t)
+
+	cfg := domain.KubeadmConfigBeta4{}
+	cfg.ClusterConfiguration.Networking.PodSubnet = "10.244.0.0/16"
+	cfg.ClusterConfiguration.Networking.ServiceSubnet = "10.244.0.0/24"
+	cfg.InitConfiguration.LocalAPIEndpoint.BindPort = 70000
+	cfg.JoinConfiguration.ControlPlane = &kubeadmapiv4.JoinControlPlane{
+		LocalAPIEndpoint: kubeadmapiv4.APIEndpoint{BindPort: -1},
+	}
+	cfg.Drain.Timeout = &metav1.Duration{Duration: -time.Minute}
+	cfg.EtcdBackup = &domain.EtcdBackupConfiguration{Retention: ptr.To(0)}
+	cfg.ClusterConfiguration.CertificateValidityPeriod = &metav1.Duration{Duration: 90 * 24 * time.Hour}
+	cfg.CertificateRenewal.RenewBefore = &metav1.Duration{Duration: 120 * 24 * time.Hour}
+	cfg.JoinConfiguration.NodeRegistration.IgnorePreflightErrors = []string{"all", "Mem"}
+
+	errs := ValidateKubeadmConfigBeta4(&cfg)
+
+	g.Expect(errs).To(HaveLen(7))
+	g.Expect(errs[0].Field).To(Equal("clusterConfiguration.networking.serviceSubnet"))
+	g.Expect(errs[1].Field).To(Equal("initConfiguration.localAPIEndpoint.bindPort"))
+	g.Expect(errs[2].Field).To(Equal("joinConfiguration.controlPlane.localAPIEndpoint.bindPort"))
+	g.Expect(errs[3].Field).To(Equal("joinConfiguration.nodeRegistration.ignorePreflightErrors"))
+	g.Expect(errs[4].Field).To(Equal("drain.timeout"))
+	g.Expect(errs[5].Field).To(Equal("etcdBackup.retention"))
+	g.Expect(errs[6].Field).To(Equal("certificateRenewal.renewBefore"))
+}
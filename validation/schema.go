@@ -0,0 +1,179 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// DecodeStrict decodes the user provided cluster options into out and reports
+// every unknown field and type mismatch together with its YAML path.
+func DecodeStrict(options string, out interface{}) field.ErrorList {
+	data, err := kyaml.YAMLToJSON([]byte(options))
+	if err != nil {
+		return field.ErrorList{field.Invalid(field.NewPath("config"), "", fmt.Sprintf("invalid YAML: %v", err))}
+	}
+
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&raw); err != nil {
+		return field.ErrorList{field.Invalid(field.NewPath("config"), "", fmt.Sprintf("invalid YAML: %v", err))}
+	}
+
+	if raw == nil {
+		return nil
+	}
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return field.ErrorList{field.TypeInvalid(field.NewPath("config"), field.OmitValueType{}, "expected an object")}
+	}
+
+	allErrs := validateObject(obj, reflect.TypeOf(out).Elem(), nil)
+
+	// Type mismatches are already reported above with their full path, the
+	// decode below only has to populate the fields that are valid.
+	_ = json.Unmarshal(data, out)
+
+	return allErrs
+}
+
+func validateValue(value interface{}, t reflect.Type, fldPath *field.Path) field.ErrorList {
+	if value == nil {
+		return nil
+	}
+
+	if t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return validateLeaf(value, t, fldPath)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return validateValue(value, t.Elem(), fldPath)
+	case reflect.Interface:
+		return nil
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, "expected an object")}
+		}
+		return validateObject(obj, t, fldPath)
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, "expected an object")}
+		}
+
+		var allErrs field.ErrorList
+		for _, key := range sortedKeys(obj) {
+			allErrs = append(allErrs, validateValue(obj[key], t.Elem(), fldPath.Key(key))...)
+		}
+		return allErrs
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return validateLeaf(value, t, fldPath)
+		}
+
+		list, ok := value.([]interface{})
+		if !ok {
+			return field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, "expected a list")}
+		}
+
+		var allErrs field.ErrorList
+		for i, item := range list {
+			allErrs = append(allErrs, validateValue(item, t.Elem(), fldPath.Index(i))...)
+		}
+		return allErrs
+	default:
+		return validateLeaf(value, t, fldPath)
+	}
+}
+
+func validateObject(obj map[string]interface{}, t reflect.Type, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	fields := jsonFields(t)
+	for _, key := range sortedKeys(obj) {
+		fieldType, ok := fields[key]
+		if !ok {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child(key), "unknown field"))
+			continue
+		}
+		allErrs = append(allErrs, validateValue(obj[key], fieldType, fldPath.Child(key))...)
+	}
+	return allErrs
+}
+
+func validateLeaf(value interface{}, t reflect.Type, fldPath *field.Path) field.ErrorList {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return field.ErrorList{field.InternalError(fldPath, err)}
+	}
+
+	if err = json.Unmarshal(data, reflect.New(t).Interface()); err != nil {
+		return field.ErrorList{field.TypeInvalid(fldPath, value, strings.TrimPrefix(err.Error(), "json: "))}
+	}
+	return nil
+}
+
+// jsonFields returns the json field names of a struct type, flattening
+// embedded and inlined structs the same way encoding/json does.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" && f.Anonymous {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for k, v := range jsonFields(embedded) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
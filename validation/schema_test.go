@@ -0,0 +1,119 @@
+package validation
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/kairos-io/kairos/provider-kubeadm/domain"
+)
+
+// TestDecodeStrict tests the DecodeStrict function
+func TestDecodeStrict(t *testing.T) {
+	tests := []struct {
+		name           string
+		options        string
+		expectedErrors []string
+	}{
+		{
+			name: "valid_options",
+			options: `
+clusterConfiguration:
+  kubernetesVersion: v1.30.11
+  networking:
+    podSubnet: 10.244.0.0/16
+initConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+      node-ip: 10.0.0.1
+kubeletConfiguration:
+  apiVersion: kubelet.config.k8s.io/v1beta1
+  kind: KubeletConfiguration
+  shutdownGracePeriod: 30s`,
+		},
+		{
+			name:    "empty_options",
+			options: "",
+		},
+		{
+			name: "unknown_fields",
+			options: `
+clusterConfiguration:
+  networkng:
+    podSubnet: 10.244.0.0/16
+initConfiguration:
+  nodeRegistration:
+    nodeIp: 10.0.0.1`,
+			expectedErrors: []string{
+				"clusterConfiguration.networkng: Forbidden: unknown field",
+				"initConfiguration.nodeRegistration.nodeIp: Forbidden: unknown field",
+			},
+		},
+		{
+			name: "wrong_types",
+			options: `
+clusterConfiguration:
+  networking: 10.244.0.0/16
+initConfiguration:
+  localAPIEndpoint:
+    bindPort: "port"
+  bootstrapTokens:
+    token: abcdef.0123456789abcdef`,
+			expectedErrors: []string{
+				"clusterConfiguration.networking: Invalid value: expected an object",
+				"initConfiguration.bootstrapTokens: Invalid value: expected a list",
+				"initConfiguration.localAPIEndpoint.bindPort: Invalid value: \"port\"",
+			},
+		},
+		{
+			name: "invalid_custom_type",
+			options: `
+kubeletConfiguration:
+  shutdownGracePeriod: forever`,
+			expectedErrors: []string{
+				"kubeletConfiguration.shutdownGracePeriod: Invalid value: \"forever\"",
+			},
+		},
+		{
+			name:           "not_an_object",
+			options:        `- clusterConfiguration`,
+			expectedErrors: []string{"config: Invalid value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var kubeadmConfig domain.KubeadmConfigBeta3
+			errs := DecodeStrict(tt.options, &kubeadmConfig)
+
+			g.Expect(errs).To(HaveLen(len(tt.expectedErrors)))
+			for i, expected := range tt.expectedErrors {
+				g.Expect(errs[i].Error()).To(ContainSubstring(expected))
+			}
+		})
+	}
+}
+
+// TestDecodeStrictPopulatesConfig tests that valid fields are decoded
+func TestDecodeStrictPopulatesConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	var kubeadmConfig domain.KubeadmConfigBeta4
+	errs := DecodeStrict(`
+clusterConfiguration:
+  networking:
+    podSubnet: 10.244.0.0/16
+    serviceSubnet: 10.96.0.0/12
+joinConfiguration:
+  nodeRegistration:
+    kubeletExtraArgs:
+    - name: node-ip
+      value: 10.0.0.2`, &kubeadmConfig)
+
+	g.Expect(errs).To(BeEmpty())
+	g.Expect(kubeadmConfig.ClusterConfiguration.Networking.PodSubnet).To(Equal("10.244.0.0/16"))
+	g.Expect(kubeadmConfig.ClusterConfiguration.Networking.ServiceSubnet).To(Equal("10.96.0.0/12"))
+	g.Expect(kubeadmConfig.JoinConfiguration.NodeRegistration.KubeletExtraArgs).To(HaveLen(1))
+}